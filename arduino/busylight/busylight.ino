@@ -18,7 +18,16 @@
 **  % alternately flash blue and red #2
 **
 ** The alphabetic commands may be sent in either case.
-** Any other bytes are simply ignored.
+** Any other bytes are simply ignored. Each command
+** is acknowledged by sending a '+' back to the host
+** once it has taken effect.
+**
+** A '?' asks us to identify ourselves: we send back
+** "busylight <model> <firmware version>" and a newline.
+**
+** If an attention-request button is wired between
+** pin 2 and ground, we send a 'P' back to the host
+** each time it is pressed.
 **
 ** The physical LED tree is stacked like so:
 **
@@ -40,6 +49,11 @@
 **                                    ||
 */
 
+//
+// What we say when asked to identify ourselves
+//
+#define IDENTITY "busylight tree 2"
+
 //
 // Digital output pin numbers for the lights
 // (a high output turns on the LEDs)
@@ -50,6 +64,14 @@ const int tree_red_1  = 6;
 const int tree_red_2  = 7;
 const int tree_blue   = 10;
 //
+// Digital input pin for the attention-request button
+// (pulled up internally; pressing the button grounds it)
+//
+const int button_pin  = 2;
+const unsigned long button_debounce_ms = 250;
+static volatile bool button_pressed = false;
+static volatile unsigned long button_last_ms = 0;
+//
 // tree_flash controls our two flashing modes.
 // if 0, no flashing is done and whatever light
 // is currently on (if any) stays steadily on.
@@ -75,6 +97,7 @@ void setup() {
 	pinMode(tree_red_1, OUTPUT);
 	pinMode(tree_red_2, OUTPUT);
 	pinMode(tree_blue, OUTPUT);
+	pinMode(button_pin, INPUT_PULLUP);
 	//
 	// Cycle through all the lights at power-on
 	// to test that they all work
@@ -99,6 +122,23 @@ void setup() {
 	// Our serial port will be 9600 baud
 	//
 	Serial.begin(9600);
+	//
+	// Catch button presses by interrupt, since the flashing
+	// modes may keep the main loop busy for a while.
+	//
+	attachInterrupt(digitalPinToInterrupt(button_pin), button_isr, FALLING);
+}
+
+//
+// button_isr(): note that the button was pressed, ignoring
+// the contact bounce which follows
+//
+void button_isr() {
+	unsigned long now = millis();
+	if (now - button_last_ms > button_debounce_ms) {
+		button_pressed = true;
+	}
+	button_last_ms = now;
 }
 
 //
@@ -123,7 +163,12 @@ void loop() {
 	// it's perfectly fine to throw newlines in the
 	// stream).
 	//
+	if (button_pressed) {
+		button_pressed = false;
+		Serial.write('P');
+	}
 	while (Serial.available() > 0) {
+		bool understood = true;
 		switch (Serial.read()) {
 		case 'B':
 		case 'b':
@@ -171,6 +216,16 @@ void loop() {
 		case '@':
 			tree_flash |= 0x40;
 			break;
+		case '?':
+			Serial.println(IDENTITY);
+			understood = false; // (the answer is acknowledgement enough)
+			break;
+		default:
+			understood = false;
+			break;
+		}
+		if (understood) {
+			Serial.write('+');
 		}
 	}
 	//
@@ -220,6 +275,9 @@ void loop() {
 		digitalWrite(tree_green, HIGH);
 		delay(50);
 		digitalWrite(tree_green, LOW);
-		delay(2000);
+		// (but don't leave the next command waiting that long)
+		for (int i = 0; i < 40 && Serial.available() == 0; i++) {
+			delay(50);
+		}
 	}
 }
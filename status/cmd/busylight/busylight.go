@@ -2,15 +2,16 @@
 // vi:set ai sm nu ts=4 sw=4:
 //
 // CLI tool to control long-running daemon busylightd
-// by sending it these signals:
+// by sending it these signals (by default; see internal/signals):
 //
 //    USR1   - in zoom, muted
 //    USR2   - in zoom, unmuted
 //    HUP    - out of zoom
-//    INFO   - force refresh from calendar now
+//    INFO   - force refresh from calendar now (RTMIN on Linux)
 //    VTALRM - toggle urgent indicator
 //    WINCH  - toggle idle/working state
-//    CHLD   - toggle low-priority indicator
+//    ALRM   - toggle low-priority indicator
+//    RTMIN+1 - re-read the configuration (Linux only)
 //
 // Steve Willoughby <steve@madscience.zone>
 // License: BSD 3-Clause open-source license
@@ -19,15 +20,17 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
+
+	"github.com/fizban-of-ragnarok/busylight/internal/configdir"
+	"github.com/fizban-of-ragnarok/busylight/internal/signals"
 )
 
 func fatal(format string, a ...interface{}) {
@@ -42,16 +45,53 @@ func main() {
 	var Fzzz = flag.Bool("zzz", false, "toggle active/inactive status")
 	var Fkill = flag.Bool("kill", false, "terminate busylight service")
 	var Freload = flag.Bool("reload", false, "reload calendar data")
+	var Freconfigure = flag.Bool("reconfigure", false, "re-read the daemon's configuration file")
 	var Furgent = flag.Bool("urgent", false, "toggle urgent condition indicator")
 	var Flowpri = flag.Bool("lowpri", false, "toggle low-priority condition indicator")
+	var Freport = flag.Bool("report", false, "summarize time spent in each state")
+	var Fweek = flag.Bool("week", false, "with -report, summarize by week instead of by day")
+	var Fdays = flag.Int("days", 7, "with -report, how many days (or weeks) to summarize")
+	var Fconfig = flag.String("config", "", "the daemon's configuration file")
+	var Fhub = flag.String("hub", "", "with team, the hub's URL (default: the hub among Federation.PushURLs)")
 	flag.Parse()
 
-	thisUser, err := user.Current()
+	configFile, err := configdir.ConfigFile(*Fconfig)
+	if err != nil {
+		fatal("%v\n", err)
+	}
+
+	if *Freport {
+		report(configFile, *Fdays, *Fweek)
+		return
+	}
+	switch flag.Arg(0) {
+	case "":
+	case "team":
+		team(configFile, *Fhub)
+		return
+	default:
+		fatal("Unknown command \"%s\" (the only command is \"team\"; states are given as options, e.g. -mute)\n", flag.Arg(0))
+	}
+
+	// (the daemon may have been told to use different signals, or to put its PID file elsewhere)
+	var config struct {
+		PidFile string
+		Signals map[string]string
+	}
+	if data, err := ioutil.ReadFile(configFile); err == nil {
+		if err = json.Unmarshal(data, &config); err != nil {
+			fatal("Can't understand %s: %v\n", configFile, err)
+		}
+	}
+	if config.PidFile == "" {
+		config.PidFile = filepath.Join(filepath.Dir(configFile), "busylightd.pid")
+	}
+	signalFor, err := signals.Table(config.Signals)
 	if err != nil {
-		fatal("Who are you? (%v)\n", err)
+		fatal("Can't understand Signals in %s: %v\n", configFile, err)
 	}
 
-	pidbytes, err := ioutil.ReadFile(filepath.Join(thisUser.HomeDir, ".busylight/busylightd.pid"))
+	pidbytes, err := ioutil.ReadFile(config.PidFile)
 	if err != nil {
 		fatal("Can't read PID file: %v\n", err)
 	}
@@ -66,28 +106,38 @@ func main() {
 		fatal("Can't find daemon process: %v\n", err)
 	}
 
+	send := func(action string) {
+		sig, possible := signalFor[action]
+		if !possible {
+			fatal("Can't signal the daemon to %s on this system; use busylightctl instead.\n", action)
+		}
+		process.Signal(sig)
+	}
 	if *Furgent {
-		process.Signal(syscall.SIGVTALRM)
+		send(signals.Urgent)
 	}
 	if *Fmute {
-		process.Signal(syscall.SIGUSR1)
+		send(signals.Mute)
 	}
 	if *Fopen {
-		process.Signal(syscall.SIGUSR2)
+		send(signals.Open)
 	}
 	if *Fcal {
-		process.Signal(syscall.SIGHUP)
+		send(signals.Cal)
 	}
 	if *Fzzz {
-		process.Signal(syscall.SIGWINCH)
+		send(signals.Zzz)
 	}
 	if *Fkill {
-		process.Signal(syscall.SIGINT)
+		send(signals.Kill)
 	}
 	if *Freload {
-		process.Signal(syscall.SIGINFO)
+		send(signals.Reload)
+	}
+	if *Freconfigure {
+		send(signals.Reconfigure)
 	}
 	if *Flowpri {
-		process.Signal(syscall.SIGCHLD)
+		send(signals.LowPri)
 	}
 }
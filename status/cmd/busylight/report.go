@@ -0,0 +1,260 @@
+//
+// Summary reports from busylightd's state transition record.
+//
+// Reads the CSV file busylightd writes (see the Analytics configuration
+// setting) and totals up the time spent in each state per day or per week,
+// along with the number of interruptions (button presses and urgent alerts).
+// Our own states share columns where they mean much the same thing (the two
+// kinds of call are both "meeting"); each of the user's own states (from
+// the States setting) has a column of its own.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// transition is one line from the analytics file.
+type transition struct {
+	When  time.Time
+	State string
+	Cause string
+}
+
+// reportPeriod accumulates the totals for one day or week.
+type reportPeriod struct {
+	Start         time.Time
+	Time          map[string]time.Duration // time spent in each report column
+	Interruptions int
+}
+
+// ownReportColumns are the columns of the report for our own states, in
+// order, with the states counted under each. The user's own states follow
+// these, then "other" (for states we no longer know, such as one of the
+// user's which has since been removed from the configuration) and "off".
+var ownReportColumns = []struct {
+	Column string
+	States []string
+}{
+	{"free", []string{"free"}},
+	{"busy", []string{"busy"}},
+	{"meeting", []string{"zoom-muted", "zoom-open"}},
+	{"focus", []string{"dnd"}},
+	{"away", []string{"away"}},
+	{"warning", []string{"warning"}},
+	{"urgent", []string{"urgent"}},
+}
+
+// reportColumns are the columns of the report, in order, given the user's own states.
+func reportColumns(customStates []string) []string {
+	var columns []string
+	for _, c := range ownReportColumns {
+		columns = append(columns, c.Column)
+	}
+	columns = append(columns, customStates...)
+	return append(columns, "other", "off")
+}
+
+// reportColumn says which report column time spent in a given state is counted under.
+func reportColumn(state string, customStates []string) string {
+	if state == "off" {
+		return "off"
+	}
+	for _, c := range ownReportColumns {
+		for _, s := range c.States {
+			if s == state {
+				return c.Column
+			}
+		}
+	}
+	for _, s := range customStates {
+		if s == state {
+			return state
+		}
+	}
+	return "other"
+}
+
+// reportSettings finds out from the daemon's configuration where it records
+// transitions, and the names of the user's own states.
+func reportSettings(configFile string) (string, []string, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return "", nil, err
+	}
+	var config struct {
+		Analytics struct {
+			File string
+		}
+		States map[string]json.RawMessage
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return "", nil, fmt.Errorf("Can't understand config.json: %v", err)
+	}
+	if config.Analytics.File == "" {
+		return "", nil, fmt.Errorf("Analytics.File isn't set in config.json, so busylightd isn't recording anything to report on")
+	}
+	var customStates []string
+	for name := range config.States {
+		customStates = append(customStates, name)
+	}
+	sort.Strings(customStates)
+	return config.Analytics.File, customStates, nil
+}
+
+// readTransitions reads the analytics file.
+func readTransitions(path string) ([]transition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var transitions []transition
+	for _, record := range records {
+		if len(record) < 4 {
+			continue
+		}
+		when, err := time.Parse(time.RFC3339, record[0])
+		if err != nil {
+			continue
+		}
+		transitions = append(transitions, transition{When: when.Local(), State: record[1], Cause: record[3]})
+	}
+	return transitions, nil
+}
+
+// periodStart returns the start of the day (or the week, starting Monday) containing t.
+func periodStart(t time.Time, weekly bool) time.Time {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	if weekly {
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	}
+	return start
+}
+
+// nextPeriod returns the start of the period after the one starting at start.
+func nextPeriod(start time.Time, weekly bool) time.Time {
+	if weekly {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// summarize totals up time and interruptions per period, from the start of
+// the period containing since up to now.
+func summarize(transitions []transition, customStates []string, since time.Time, weekly bool) []*reportPeriod {
+	now := time.Now()
+	var periods []*reportPeriod
+	for start := periodStart(since, weekly); start.Before(now); start = nextPeriod(start, weekly) {
+		periods = append(periods, &reportPeriod{Start: start, Time: make(map[string]time.Duration)})
+	}
+	if len(periods) == 0 {
+		return nil
+	}
+	find := func(t time.Time) *reportPeriod {
+		for i := len(periods) - 1; i >= 0; i-- {
+			if !t.Before(periods[i].Start) {
+				return periods[i]
+			}
+		}
+		return nil
+	}
+
+	// Count each stretch of time in a state toward the period(s) it falls in,
+	// splitting it where it crosses from one period to the next.
+	add := func(state string, from, to time.Time) {
+		if from.Before(periods[0].Start) {
+			from = periods[0].Start
+		}
+		for from.Before(to) {
+			p := find(from)
+			end := nextPeriod(p.Start, weekly)
+			if end.After(to) {
+				end = to
+			}
+			p.Time[reportColumn(state, customStates)] += end.Sub(from)
+			from = end
+		}
+	}
+
+	for i, t := range transitions {
+		end := now
+		if i+1 < len(transitions) {
+			end = transitions[i+1].When
+		}
+		add(t.State, t.When, end)
+		if p := find(t.When); p != nil && (t.Cause == "button" || (t.State == "urgent" && (i == 0 || transitions[i-1].State != "urgent"))) {
+			p.Interruptions++
+		}
+	}
+	return periods
+}
+
+// formatHours shows a duration as hours and minutes.
+func formatHours(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// report prints a summary of the last few days (or weeks) of activity.
+func report(configFile string, count int, weekly bool) {
+	path, customStates, err := reportSettings(configFile)
+	if err != nil {
+		fatal("%v\n", err)
+	}
+	transitions, err := readTransitions(path)
+	if err != nil {
+		fatal("Can't read %s: %v\n", path, err)
+	}
+	if count < 1 {
+		count = 1
+	}
+	since := periodStart(time.Now(), weekly)
+	for i := 1; i < count; i++ {
+		if weekly {
+			since = since.AddDate(0, 0, -7)
+		} else {
+			since = since.AddDate(0, 0, -1)
+		}
+	}
+
+	label := "Day"
+	if weekly {
+		label = "Week of"
+	}
+	columns := reportColumns(customStates)
+	width := func(column string) int {
+		if len(column) > 8 {
+			return len(column)
+		}
+		return 8
+	}
+	fmt.Printf("%-16s", label)
+	for _, column := range columns {
+		fmt.Printf(" %*s", width(column), column)
+	}
+	fmt.Printf(" %13s\n", "interruptions")
+	for _, p := range summarize(transitions, customStates, since, weekly) {
+		fmt.Printf("%-16s", p.Start.Format("Mon 2006-01-02"))
+		for _, column := range columns {
+			fmt.Printf(" %*s", width(column), formatHours(p.Time[column]))
+		}
+		fmt.Printf(" %13d\n", p.Interruptions)
+	}
+}
@@ -0,0 +1,180 @@
+//
+// Team roster from a presence hub.
+//
+// "busylight team" asks the hub our daemon reports to (see the Hub setting
+// and hub.go in busylightd) for everyone's states, and prints them as a
+// table: who, what they're doing, since when, and (if they're busy) when
+// their calendar says they'll next be free. The hub is the one among
+// Federation.PushURLs whose path is /hub/state (or given with -hub), and we
+// present the same token the daemon reports with (Federation.Token), or the
+// API token (HTTP.APIToken) when asking a hub on this machine.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hubPath is where a hub answers (see hub.go in busylightd).
+const hubPath = "/hub/state"
+
+// teamMember is what the hub tells us about one member.
+type teamMember struct {
+	Name           string
+	State          string
+	Since          time.Time
+	LowPriority    bool
+	NextTransition time.Time
+}
+
+// teamOverview is the hub's answer.
+type teamOverview struct {
+	State   string // what the hub's light shows for everyone combined
+	Members []teamMember
+}
+
+// hubSettings finds out from the daemon's configuration which hub it reports
+// to, and how to prove we're allowed to ask it.
+func hubSettings(configFile, hubURL string) (string, string, string, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return "", "", "", err
+	}
+	var config struct {
+		Federation struct {
+			PushURLs []string
+			Token    string
+			CAFile   string
+		}
+		HTTP struct {
+			APIToken string
+		}
+	}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return "", "", "", fmt.Errorf("Can't understand config.json: %v", err)
+	}
+	if hubURL == "" {
+		for _, target := range config.Federation.PushURLs {
+			if u, err := url.Parse(target); err == nil && strings.TrimSuffix(u.Path, "/") == hubPath {
+				hubURL = target
+				break
+			}
+		}
+		if hubURL == "" {
+			return "", "", "", fmt.Errorf("None of Federation.PushURLs in config.json is a hub (ending in %s); give its URL with -hub", hubPath)
+		}
+	}
+	token := config.Federation.Token
+	if token == "" {
+		token = config.HTTP.APIToken
+	}
+	if token == "" {
+		return "", "", "", fmt.Errorf("Neither Federation.Token nor HTTP.APIToken is set in config.json, so the hub wouldn't know us")
+	}
+	return hubURL, token, config.Federation.CAFile, nil
+}
+
+// fetchTeam asks the hub for everyone's states.
+func fetchTeam(hubURL, token, caFile string) (teamOverview, error) {
+	var overview teamOverview
+	tlsConfig := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return overview, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return overview, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	req, err := http.NewRequest(http.MethodGet, hubURL, nil)
+	if err != nil {
+		return overview, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return overview, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return overview, fmt.Errorf("the hub said %s", resp.Status)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&overview); err != nil {
+		return overview, fmt.Errorf("Can't understand the hub's answer: %v", err)
+	}
+	sort.Slice(overview.Members, func(i, j int) bool {
+		return strings.ToLower(overview.Members[i].Name) < strings.ToLower(overview.Members[j].Name)
+	})
+	return overview, nil
+}
+
+// formatTeamTime shows a time as briefly as we can, relative to now: just
+// the time of day if it's today, or with the day of the week otherwise.
+func formatTeamTime(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	t = t.Local()
+	if y, m, d := t.Date(); y == now.Year() && m == now.Month() && d == now.Day() {
+		return t.Format("15:04")
+	}
+	return t.Format("Mon 15:04")
+}
+
+// team prints the roster of everyone reporting to our hub.
+func team(configFile, hubURL string) {
+	hubURL, token, caFile, err := hubSettings(configFile, hubURL)
+	if err != nil {
+		fatal("%v\n", err)
+	}
+	overview, err := fetchTeam(hubURL, token, caFile)
+	if err != nil {
+		fatal("Can't ask the hub %s: %v\n", hubURL, err)
+	}
+	if len(overview.Members) == 0 {
+		fmt.Printf("Nobody is reporting to the hub right now.\n")
+		return
+	}
+
+	now := time.Now()
+	rows := [][]string{{"Member", "State", "Since", "Free at"}}
+	for _, m := range overview.Members {
+		state, freeAt := m.State, formatTeamTime(m.NextTransition, now)
+		if m.LowPriority {
+			state += " (lowpri)"
+		}
+		if m.State == "free" {
+			freeAt = "now"
+		}
+		rows = append(rows, []string{m.Name, state, formatTeamTime(m.Since, now), freeAt})
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	for _, row := range rows {
+		fmt.Printf("%-*s  %-*s  %-*s  %s\n", widths[0], row[0], widths[1], row[1], widths[2], row[2], row[3])
+	}
+	fmt.Printf("\nThe hub's light shows: %s\n", overview.State)
+}
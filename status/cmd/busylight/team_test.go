@@ -0,0 +1,152 @@
+//
+// Tests for the team roster.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHubSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		hubURL    string // given with -hub
+		wantURL   string
+		wantToken string
+		wantErr   string
+	}{
+		{
+			name:      "hub among the push URLs",
+			config:    `{"Federation": {"PushURLs": ["https://home.example/federation/state", "https://hub.example:8642/hub/state"], "Token": "t1"}}`,
+			wantURL:   "https://hub.example:8642/hub/state",
+			wantToken: "t1",
+		},
+		{
+			name:      "trailing slash",
+			config:    `{"Federation": {"PushURLs": ["https://hub.example/hub/state/"], "Token": "t1"}}`,
+			wantURL:   "https://hub.example/hub/state/",
+			wantToken: "t1",
+		},
+		{
+			name:      "given with -hub",
+			config:    `{"Federation": {"Token": "t1"}}`,
+			hubURL:    "https://other.example/hub/state",
+			wantURL:   "https://other.example/hub/state",
+			wantToken: "t1",
+		},
+		{
+			name:      "the hub's own API token",
+			config:    `{"HTTP": {"APIToken": "api"}}`,
+			hubURL:    "http://localhost:8642/hub/state",
+			wantURL:   "http://localhost:8642/hub/state",
+			wantToken: "api",
+		},
+		{
+			name:      "our own token first",
+			config:    `{"Federation": {"PushURLs": ["https://hub.example/hub/state"], "Token": "t1"}, "HTTP": {"APIToken": "api"}}`,
+			wantURL:   "https://hub.example/hub/state",
+			wantToken: "t1",
+		},
+		{
+			name:    "no hub",
+			config:  `{"Federation": {"PushURLs": ["https://home.example/federation/state"], "Token": "t1"}}`,
+			wantErr: "give its URL with -hub",
+		},
+		{
+			name:    "no token",
+			config:  `{"Federation": {"PushURLs": ["https://hub.example/hub/state"]}}`,
+			wantErr: "the hub wouldn't know us",
+		},
+		{
+			name:    "not JSON",
+			config:  `Federation: yes`,
+			wantErr: "Can't understand config.json",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "busylight-team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.json")
+	for _, test := range tests {
+		if err := ioutil.WriteFile(configFile, []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		hubURL, token, _, err := hubSettings(configFile, test.hubURL)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if hubURL != test.wantURL || token != test.wantToken {
+			t.Errorf("%s: got %s with %q, want %s with %q", test.name, hubURL, token, test.wantURL, test.wantToken)
+		}
+	}
+}
+
+func TestFetchTeam(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.Header.Get("Authorization") != "Bearer t1" {
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"State": "busy", "Members": [
+			{"Name": "carol", "State": "free", "Since": "2024-03-04T09:00:00Z"},
+			{"Name": "Alice", "State": "busy", "Since": "2024-03-04T10:00:00Z", "NextTransition": "2024-03-04T11:00:00Z", "Source": "hub"}
+		]}`)
+	}))
+	defer server.Close()
+
+	overview, err := fetchTeam(server.URL+hubPath, "t1", "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if overview.State != "busy" || len(overview.Members) != 2 {
+		t.Fatalf("got %+v", overview)
+	}
+	if alice := overview.Members[0]; alice.Name != "Alice" || !alice.NextTransition.Equal(time.Date(2024, 3, 4, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %+v first, want Alice (members in name order)", alice)
+	}
+
+	if _, err = fetchTeam(server.URL+hubPath, "wrong", ""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("wrong token: got error %v, want the hub's 401", err)
+	}
+}
+
+func TestFormatTeamTime(t *testing.T) {
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Time{}, "-"},
+		{time.Date(2024, 3, 6, 9, 5, 0, 0, time.Local), "09:05"},
+		{time.Date(2024, 3, 6, 23, 59, 0, 0, time.Local), "23:59"},
+		{time.Date(2024, 3, 5, 17, 30, 0, 0, time.Local), "Tue 17:30"},
+		{time.Date(2024, 3, 7, 8, 0, 0, 0, time.Local), "Thu 08:00"},
+	}
+
+	for _, test := range tests {
+		if got := formatTeamTime(test.t, now); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.t, got, test.want)
+		}
+	}
+}
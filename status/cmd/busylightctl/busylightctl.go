@@ -0,0 +1,186 @@
+//
+// CLI tool to control the long-running daemon busylightd.
+//
+// Usage: busylightctl [-json] [-config file] command [args...]
+//
+//    status                       - show the daemon's current status
+//    zoom muted|open|off          - in a call (muted or not), or out of it
+//    urgent [on|off]              - set (or toggle) the urgent indicator
+//    lowpri [on|off]              - set (or toggle) the low-priority indicator
+//    dnd <time>|until HH:MM|off   - do not disturb for a while, or stop
+//    busy <time>|until HH:MM|off  - show as busy for a while, or stop
+//    off, on                      - make the daemon inactive or active
+//    refresh                      - refresh calendar data now
+//    reconfigure                  - re-read the configuration file
+//    state <name> [<time>|off]    - turn one of the user's own states on or off
+//    flash [<signal>] [<times>]   - flash the light for attention, then carry on
+//    snooze [<time>|off]          - turn the light off for a while (or say how long is left)
+//    force <state> <time>|off     - show any state for a while, whatever else is going on
+//    kill                         - terminate the daemon
+//
+// If the daemon has a control socket (SocketFile in config.json), we send
+// it the command there and print its reply. Otherwise we fall back to
+// sending it signals (as the busylight CLI does), which only works for the
+// commands that have a signal equivalent.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fizban-of-ragnarok/busylight/internal/configdir"
+	"github.com/fizban-of-ragnarok/busylight/internal/signals"
+)
+
+func fatal(format string, a ...interface{}) {
+	fmt.Printf(format, a...)
+	os.Exit(1)
+}
+
+// daemonConfig holds the parts of the daemon's configuration we need.
+type daemonConfig struct {
+	PidFile    string
+	SocketFile string
+	Signals    map[string]string
+}
+
+// socketCommand translates our command line into a daemon control command.
+func socketCommand(args []string) (string, error) {
+	switch args[0] {
+	case "zoom":
+		if len(args) != 2 {
+			return "", fmt.Errorf("usage: zoom muted|open|off")
+		}
+		switch args[1] {
+		case "muted", "mute":
+			return "mute", nil
+		case "open", "unmuted":
+			return "open", nil
+		case "off", "end":
+			return "cal", nil
+		}
+		return "", fmt.Errorf("usage: zoom muted|open|off")
+	case "refresh":
+		return "reload", nil
+	}
+	return strings.Join(args, " "), nil
+}
+
+// signalDaemon sends a signal to the daemon whose PID is in pidFile.
+func signalDaemon(pidFile string, sig syscall.Signal) {
+	pidbytes, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		fatal("Can't read PID file: %v\n", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSuffix(string(pidbytes), "\n"))
+	if err != nil {
+		fatal("Can't understand PID value: %v\n", err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		fatal("Can't find daemon process: %v\n", err)
+	}
+	if runtime.GOOS == "windows" {
+		// Windows can't deliver a signal to another process, so the only
+		// one we get here (kill) has to be done the hard way.
+		err = process.Kill()
+	} else {
+		err = process.Signal(sig)
+	}
+	if err != nil {
+		fatal("Can't signal daemon process: %v\n", err)
+	}
+}
+
+func main() {
+	var Fjson = flag.Bool("json", false, "print the daemon's full reply as JSON")
+	var Fconfig = flag.String("config", "", "the daemon's configuration file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: busylightctl [-json] [-config file] status|zoom muted|zoom open|zoom off|urgent [on|off]|lowpri [on|off]|dnd <time>|busy <time>|off|on|refresh|reconfigure|state <name> [<time>|off]|flash [<signal>] [<times>]|snooze [<time>|off]|force <state> <time>|off|kill\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	configFile, err := configdir.ConfigFile(*Fconfig)
+	if err != nil {
+		fatal("%v\n", err)
+	}
+	config := daemonConfig{PidFile: filepath.Join(filepath.Dir(configFile), "busylightd.pid")}
+	if data, err := ioutil.ReadFile(configFile); err == nil {
+		if err = json.Unmarshal(data, &config); err != nil {
+			fatal("Can't understand %s: %v\n", configFile, err)
+		}
+	}
+
+	// The signal to send the daemon for each command, when we can't use the control socket.
+	commandSignals, err := signals.Table(config.Signals)
+	if err != nil {
+		fatal("Can't understand Signals in %s: %v\n", configFile, err)
+	}
+	delete(commandSignals, signals.Zzz) // ("off" and "on" aren't toggles)
+
+	if args[0] == "kill" {
+		signalDaemon(config.PidFile, commandSignals[signals.Kill])
+		return
+	}
+	command, err := socketCommand(args)
+	if err != nil {
+		fatal("%v\n", err)
+	}
+
+	if config.SocketFile == "" {
+		words := strings.Fields(command)
+		sig, known := commandSignals[words[0]]
+		if !known || len(words) > 1 {
+			fatal("\"%s\" needs the daemon's control socket (set SocketFile in config.json).\n", command)
+		}
+		signalDaemon(config.PidFile, sig)
+		return
+	}
+
+	conn, err := net.DialTimeout("unix", config.SocketFile, 5*time.Second)
+	if err != nil {
+		fatal("Can't connect to daemon: %v\n", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(15 * time.Second))
+	if _, err = fmt.Fprintln(conn, command); err != nil {
+		fatal("Can't send command to daemon: %v\n", err)
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		fatal("No reply from daemon: %v\n", err)
+	}
+	if *Fjson {
+		os.Stdout.Write(line)
+		return
+	}
+	var reply struct {
+		Reply string
+	}
+	if err = json.Unmarshal(line, &reply); err != nil {
+		fatal("Can't understand daemon's reply: %v\n", err)
+	}
+	fmt.Println(reply.Reply)
+}
@@ -0,0 +1,212 @@
+//
+// Alert webhook receiver.
+//
+// Monitoring systems can send their alert notifications to our HTTP server,
+// turning the light into a desk alert beacon. We understand the webhook
+// formats of Prometheus Alertmanager (/alerts/alertmanager), Grafana
+// (/alerts/grafana; both its unified alerting, which looks just like
+// Alertmanager's, and its legacy alerts), and Opsgenie (/alerts/opsgenie).
+//
+// Each alert's severity (or Opsgenie priority) decides whether it makes the
+// light urgent or adds the low-priority indicator. We keep track of which
+// alerts are still open, and the indicator goes off again once all the
+// alerts which turned it on have been resolved.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// AlertsConfigData controls the alert webhook receiver.
+type AlertsConfigData struct {
+	// Accept alert webhooks?
+	Enabled bool
+
+	// If given, senders must supply this token, either as a bearer token in the
+	// Authorization header or as a "token" query parameter.
+	Token string
+
+	// Maps alert severities (or Opsgenie priorities) to "urgent" or "lowpri".
+	// Alerts of any other severity are ignored. Alerts without a severity are
+	// taken to be "critical". If omitted, defaultAlertSeverities is used.
+	Severities map[string]string
+}
+
+var defaultAlertSeverities = map[string]string{
+	"critical": "urgent",
+	"error":    "urgent",
+	"page":     "urgent",
+	"p1":       "urgent",
+	"p2":       "urgent",
+	"warning":  "lowpri",
+	"p3":       "lowpri",
+}
+
+// alertNotice is one alert's news, whatever format it arrived in.
+type alertNotice struct {
+	Key      string // identifies the alert across notifications
+	Severity string
+	Resolved bool
+}
+
+// openAlerts remembers which alerts are currently open, and which indicator each one wants.
+type openAlerts struct {
+	lock   sync.Mutex
+	alerts map[string]string
+}
+
+// update records the news about some alerts and reports the indicators the open ones now call for.
+func (o *openAlerts) update(notices []alertNotice, severities map[string]string) (status sourceStatus) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.alerts == nil {
+		o.alerts = make(map[string]string)
+	}
+	for _, notice := range notices {
+		severity := strings.ToLower(notice.Severity)
+		if severity == "" {
+			severity = "critical"
+		}
+		if notice.Resolved || severities[severity] == "" {
+			delete(o.alerts, notice.Key)
+		} else {
+			o.alerts[notice.Key] = severities[severity]
+		}
+	}
+	for _, indicator := range o.alerts {
+		switch indicator {
+		case "urgent":
+			status.Urgent = true
+		case "lowpri":
+			status.LowPriority = true
+		}
+	}
+	return status
+}
+
+// parseAlertmanager understands Alertmanager's (and Grafana unified alerting's) webhooks.
+func parseAlertmanager(body []byte) ([]alertNotice, error) {
+	var msg struct {
+		Alerts []struct {
+			Status      string            `json:"status"`
+			Labels      map[string]string `json:"labels"`
+			Fingerprint string            `json:"fingerprint"`
+		} `json:"alerts"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	var notices []alertNotice
+	for _, a := range msg.Alerts {
+		key := a.Fingerprint
+		if key == "" {
+			key = a.Labels["alertname"]
+		}
+		notices = append(notices, alertNotice{
+			Key:      "alertmanager:" + key,
+			Severity: a.Labels["severity"],
+			Resolved: a.Status == "resolved",
+		})
+	}
+	return notices, nil
+}
+
+// parseGrafana understands Grafana's webhooks, in either the unified or legacy alerting format.
+func parseGrafana(body []byte) ([]alertNotice, error) {
+	var msg struct {
+		Alerts []json.RawMessage `json:"alerts"`
+		RuleID int               `json:"ruleId"`
+		State  string            `json:"state"`
+		Tags   map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Alerts != nil {
+		return parseAlertmanager(body)
+	}
+	return []alertNotice{{
+		Key:      fmt.Sprintf("grafana:%d", msg.RuleID),
+		Severity: msg.Tags["severity"],
+		Resolved: msg.State != "alerting",
+	}}, nil
+}
+
+// parseOpsgenie understands Opsgenie's outgoing webhooks.
+func parseOpsgenie(body []byte) ([]alertNotice, error) {
+	var msg struct {
+		Action string `json:"action"`
+		Alert  struct {
+			AlertID  string `json:"alertId"`
+			Priority string `json:"priority"`
+		} `json:"alert"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	switch msg.Action {
+	case "Create", "Close", "Delete", "EscalateNext", "Escalate", "UpdatePriority":
+	default:
+		return nil, nil
+	}
+	return []alertNotice{{
+		Key:      "opsgenie:" + msg.Alert.AlertID,
+		Severity: msg.Alert.Priority,
+		Resolved: msg.Action == "Close" || msg.Action == "Delete",
+	}}, nil
+}
+
+// alertsHandler answers alert webhooks in the format understood by the given parser.
+func alertsHandler(config *ConfigData, alerts *openAlerts, parse func([]byte) ([]alertNotice, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := currentSettings(config)
+		if !settings.Alerts.Enabled {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token := settings.Alerts.Token; token != "" {
+			given := r.URL.Query().Get("token")
+			if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+				given = strings.TrimPrefix(bearer, "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				config.logger.Printf("WARNING: Rejected alert webhook with bad token from %s", r.RemoteAddr)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		var body json.RawMessage
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024*1024)).Decode(&body); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		notices, err := parse(body)
+		if err != nil {
+			config.logger.Printf("WARNING: Unable to understand alert webhook from %s: %v", r.RemoteAddr, err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		severities := settings.Alerts.Severities
+		if severities == nil {
+			severities = defaultAlertSeverities
+		}
+		reportSource(config, "alerts", alerts.update(notices, severities))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
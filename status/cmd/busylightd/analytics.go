@@ -0,0 +1,151 @@
+//
+// State transition analytics.
+//
+// If configured, we record every state change in a CSV file, one line per
+// change:
+//
+//    time,state,previous,cause,waiting
+//
+// where time is in RFC 3339 format and waiting is 1 if someone had just
+// pressed the attention-request button. "busylight --report" reads this
+// file and summarizes the time spent in each state per day or week.
+// Lines older than the retention period are pruned once a day.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnalyticsConfigData controls recording state transitions for later analysis.
+type AnalyticsConfigData struct {
+	File          string // CSV file to record transitions in; if empty, nothing is recorded
+	RetentionDays int    // how long to keep records (default 90)
+}
+
+// analyticsLock keeps the daemon from writing to the analytics file from two places at once.
+var analyticsLock sync.Mutex
+
+// recordTransition appends a line to the analytics file.
+func recordTransition(config *ConfigData, when time.Time, state, previous, cause string, waiting bool) {
+	analyticsLock.Lock()
+	defer analyticsLock.Unlock()
+	f, err := os.OpenFile(currentSettings(config).Analytics.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		config.logger.Printf("ERROR: Unable to record state transition: %v", err)
+		return
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{when.Format(time.RFC3339), state, previous, cause, boolFlag(waiting)})
+	w.Flush()
+	if err = w.Error(); err != nil {
+		config.logger.Printf("ERROR: Unable to record state transition: %v", err)
+	}
+}
+
+// pruneTransitions removes records older than the retention period from the analytics file.
+func pruneTransitions(config *ConfigData) error {
+	analyticsLock.Lock()
+	defer analyticsLock.Unlock()
+	settings := currentSettings(config).Analytics
+	file := settings.File
+	days := settings.RetentionDays
+	if days <= 0 {
+		days = 90
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	in, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+	var kept []string
+	pruned := 0
+	lines := bufio.NewScanner(in)
+	for lines.Scan() {
+		line := lines.Text()
+		if i := strings.IndexByte(line, ','); i > 0 {
+			if when, err := time.Parse(time.RFC3339, line[:i]); err == nil && when.Before(cutoff) {
+				pruned++
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+	if err = lines.Err(); err != nil {
+		return err
+	}
+	if pruned == 0 {
+		return nil
+	}
+
+	temp := file + ".new"
+	out, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	for _, line := range kept {
+		fmt.Fprintln(out, line)
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	config.logger.Printf("Pruned %d old records from %s", pruned, file)
+	return os.Rename(temp, file)
+}
+
+// startAnalytics starts recording state transitions, if configured to do so.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startAnalytics(config *ConfigData) {
+	if config.Analytics.File == "" {
+		return
+	}
+	events := config.events.Subscribe()
+	go func() {
+		prune := time.NewTicker(24 * time.Hour)
+		defer prune.Stop()
+		if err := pruneTransitions(config); err != nil {
+			config.logger.Printf("ERROR: Unable to prune %s: %v", config.Analytics.File, err)
+		}
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				// (someone pressing the button doesn't change our state, but it's still worth counting as an interruption)
+				if event.Status.State != event.Previous || (event.Cause == "button" && event.Status.Waiting) {
+					recordTransition(config, time.Now(), event.Status.State, event.Previous, event.Cause, event.Status.Waiting)
+				}
+			case <-prune.C:
+				if err := pruneTransitions(config); err != nil {
+					config.logger.Printf("ERROR: Unable to prune %s: %v", config.Analytics.File, err)
+				}
+			}
+		}
+	}()
+}
+
+// recordShutdown notes that the daemon is going away, so time until the next
+// startup isn't counted as being in whatever state we were last in.
+func recordShutdown(config *ConfigData) {
+	if config.Analytics.File != "" {
+		recordTransition(config, time.Now(), "off", config.events.Current().State, "shutdown", false)
+	}
+}
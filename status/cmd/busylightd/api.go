@@ -0,0 +1,199 @@
+//
+// HTTP control API.
+//
+// Lets scripts, browser extensions, and tools on other machines control
+// the daemon with simple HTTP requests instead of signals:
+//
+//    GET  /api/status          - our current status, as JSON
+//    GET  /api/dashboard       - what the dashboard shows (see dashboard.go)
+//    GET  /api/events          - a WebSocket on which we send each state
+//                                change (a StateEvent) as JSON, starting
+//                                with the current status
+//    POST /api/<command>[/arg] - run a control command (see control.go), e.g.
+//                                POST /api/mute, POST /api/urgent/on,
+//                                or POST /api/dnd/30m
+//    POST /api/command         - run the control command given in the JSON
+//                                body as {"Command": "dnd until 15:30"}
+//
+// Every request must carry the configured API token (or a client's own,
+// from APITokens), as "Authorization: Bearer <token>", or come from a
+// client with a certificate whose name is in APIClients. The API is
+// disabled if none of them is set. (Browsers can't add headers to
+// WebSocket connections, so for those the token may be given as
+// ?token=<token> instead.) What a named client may do may be limited (see
+// scopes.go); one which may only read gets the status, the dashboard, and
+// the events, but can't run any commands but "status".
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// apiReply is the response to a control command sent through the API.
+type apiReply struct {
+	Command string
+	Reply   string
+}
+
+// apiClient is who's using the API, and what they may do.
+type apiClient struct {
+	Name  string // the client's name (empty if they used APIToken)
+	Scope clientScope
+}
+
+// describe says who the client is, for the log.
+func (c apiClient) describe(via, address string) string {
+	if c.Name == "" {
+		return fmt.Sprintf("%s (%s)", via, address)
+	}
+	return fmt.Sprintf("%s client %s (%s, %s)", via, c.Name, c.Scope, address)
+}
+
+// apiAuthorized reports who a request comes from, if it carries an API
+// token, or a client certificate we accept instead.
+func apiAuthorized(config *ConfigData, r *http.Request) (apiClient, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" && strings.Trim(r.URL.Path, "/") == "api/events" {
+		token = r.URL.Query().Get("token")
+	}
+	return apiCredentials(config, token, r.TLS)
+}
+
+// apiCredentials reports who a client is, if they gave an API token, or
+// connected with a client certificate we accept instead.
+func apiCredentials(config *ConfigData, token string, conn *tls.ConnectionState) (apiClient, bool) {
+	settings := currentSettings(config)
+	if conn != nil && len(conn.VerifiedChains) > 0 {
+		name := conn.VerifiedChains[0][0].Subject.CommonName
+		for _, client := range settings.HTTP.APIClients {
+			if name == client {
+				return apiClient{Name: name, Scope: scopeOf(settings, name)}, true
+			}
+		}
+	}
+	if token == "" {
+		return apiClient{}, false
+	}
+	if settings.HTTP.APIToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(settings.HTTP.APIToken)) == 1 {
+		return apiClient{Scope: scopeAdmin}, true
+	}
+	if name, found := clientWithToken(settings.HTTP.APITokens, token); found {
+		return apiClient{Name: name, Scope: scopeOf(settings, name)}, true
+	}
+	return apiClient{}, false
+}
+
+// writeJSON sends a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiHandler answers requests to the control API.
+func apiHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, authorized := apiAuthorized(config, r)
+		if !authorized {
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+		if path == "status" || path == "dashboard" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if path == "dashboard" {
+				writeJSON(w, config.dashboard.data(config.events.Current()))
+			} else {
+				writeJSON(w, config.events.Current())
+			}
+			return
+		}
+		if path == "events" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			// (we've checked the token, so we don't care where the page came from)
+			websocket.Server{
+				Handshake: func(*websocket.Config, *http.Request) error { return nil },
+				Handler:   apiEventStream(config),
+			}.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		command := strings.Join(strings.Split(path, "/"), " ")
+		if path == "command" {
+			var body struct {
+				Command string
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+			command = body.Command
+		}
+		source := client.describe("HTTP API", r.RemoteAddr)
+		if client.Scope < commandScope(commandWords(command)) {
+			config.logger.Printf("WARNING: Refused to let %s run \"%s\"", source, command)
+			http.Error(w, "not allowed", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, apiReply{
+			Command: command,
+			Reply:   sendCommand(config, source, command, 5*time.Second),
+		})
+	}
+}
+
+// apiEventStream sends each state change to a WebSocket client as it
+// happens, starting with the current status, until the client hangs up.
+func apiEventStream(config *ConfigData) websocket.Handler {
+	return func(ws *websocket.Conn) {
+		events := config.events.Subscribe()
+		defer config.events.Unsubscribe(events)
+
+		// We don't expect the client to say anything, but reading is how we
+		// find out it's gone.
+		gone := make(chan struct{})
+		go func() {
+			io.Copy(ioutil.Discard, ws)
+			close(gone)
+		}()
+
+		if err := websocket.JSON.Send(ws, StateEvent{Cause: "connected", Status: config.events.Current()}); err != nil {
+			return
+		}
+		for {
+			select {
+			case <-gone:
+				return
+			case event := <-events:
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
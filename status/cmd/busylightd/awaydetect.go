@@ -0,0 +1,156 @@
+//
+// Noticing we've stepped away from the computer.
+//
+// The calendar may say we're free, but if the screen is locked or nobody
+// has touched the keyboard or mouse for a while, we're probably not at our
+// desk, and the light shouldn't invite people to come and talk to us. So
+// on macOS we keep an eye on both, and tell the main loop we're away until
+// the screen is unlocked (or someone types something) again.
+//
+// We ask ioreg for both: the HID system's idle time, and whether the
+// console session's screen is locked.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// AwayDetectionConfigData controls noticing we've left the computer.
+type AwayDetectionConfigData struct {
+	Enabled     bool
+	IdleMinutes int // how long without keyboard or mouse input means we're away (default 10)
+	LockMinutes int // how long the screen must be locked before we're away (default 0, at once)
+	PollSeconds int // how often to check (default 15)
+}
+
+// idleMinutes is how long without input means we're away.
+func (a AwayDetectionConfigData) idleMinutes() int {
+	if a.IdleMinutes == 0 {
+		return 10
+	}
+	return a.IdleMinutes
+}
+
+// pollInterval is how often to check.
+func (a AwayDetectionConfigData) pollInterval() time.Duration {
+	if a.PollSeconds == 0 {
+		return 15 * time.Second
+	}
+	return time.Duration(a.PollSeconds) * time.Second
+}
+
+// macIdleTime picks the time since the last input (in nanoseconds) out of
+// "ioreg -c IOHIDSystem".
+var macIdleTime = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+// macScreenLocked picks out the console session's screen lock from
+// "ioreg -n Root -d1".
+var macScreenLocked = regexp.MustCompile(`"CGSSessionScreenIsLocked"\s*=\s*Yes`)
+
+// macPresence asks how long it's been since anyone touched the keyboard or
+// mouse, and whether the screen is locked.
+func macPresence(config *ConfigData) (idle time.Duration, locked bool, err error) {
+	output, err := config.children.output("ioreg", "-c", "IOHIDSystem", "-d", "4")
+	if err != nil {
+		return 0, false, err
+	}
+	match := macIdleTime.FindSubmatch(output)
+	if match == nil {
+		return 0, false, fmt.Errorf("ioreg didn't tell us the HID idle time")
+	}
+	ns, err := strconv.ParseInt(string(match[1]), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("ioreg gave a strange HID idle time: %v", err)
+	}
+
+	output, err = config.children.output("ioreg", "-n", "Root", "-d1")
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(ns), macScreenLocked.Match(output), nil
+}
+
+// watchMacPresence polls for screen locking and idleness, reporting whether
+// we're away each time that changes.
+func watchMacPresence(config *ConfigData) {
+	settings := currentSettings(config).AwayDetection
+	idleLimit := time.Duration(settings.idleMinutes()) * time.Minute
+	lockLimit := time.Duration(settings.LockMinutes) * time.Minute
+	var lockedSince time.Time
+	away, working := false, true
+	for {
+		idle, locked, err := macPresence(config)
+		if err != nil {
+			if working {
+				config.logger.Printf("ERROR: Unable to check for idleness or screen locking: %v", err)
+			}
+			working = false
+			time.Sleep(settings.pollInterval())
+			continue
+		}
+		if !working {
+			config.logger.Printf("Checking for idleness and screen locking again")
+			working = true
+		}
+
+		if !locked {
+			lockedSince = time.Time{}
+		} else if lockedSince.IsZero() {
+			lockedSince = time.Now()
+		}
+		why := ""
+		switch {
+		case locked && time.Since(lockedSince) >= lockLimit:
+			why = "screen locked"
+		case idle >= idleLimit:
+			why = fmt.Sprintf("idle for %v", idle.Truncate(time.Minute))
+		}
+		if nowAway := why != ""; nowAway != away {
+			if nowAway {
+				config.logger.Printf("Away from the computer (%s)", why)
+			} else {
+				config.logger.Printf("Back at the computer")
+			}
+			reportSource(config, "away", sourceStatus{Away: nowAway})
+			away = nowAway
+		}
+		time.Sleep(settings.pollInterval())
+	}
+}
+
+// checkAwayDetection makes sure the AwayDetection setting makes sense.
+func checkAwayDetection(config *ConfigData) error {
+	a := config.AwayDetection
+	if a.IdleMinutes < 0 {
+		return fmt.Errorf("AwayDetection.IdleMinutes can't be negative")
+	}
+	if a.LockMinutes < 0 {
+		return fmt.Errorf("AwayDetection.LockMinutes can't be negative")
+	}
+	if a.PollSeconds < 0 {
+		return fmt.Errorf("AwayDetection.PollSeconds can't be negative")
+	}
+	return nil
+}
+
+// startAwayDetection begins watching for us leaving the computer, if enabled.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startAwayDetection(config *ConfigData) {
+	if !config.AwayDetection.Enabled {
+		return
+	}
+	if runtime.GOOS != "darwin" {
+		config.logger.Printf("ERROR: Away detection isn't supported on %s", runtime.GOOS)
+		return
+	}
+	go watchMacPresence(config)
+}
@@ -0,0 +1,28 @@
+//
+// ThingM blink(1) driver.
+//
+// A blink(1) is a USB HID device with one (or, on the mk2 and later, two)
+// RGB LEDs. See rgblight.go for how we show our signals on it.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+const (
+	blink1VendorID  = 0x27b8
+	blink1ProductID = 0x01ed
+)
+
+// newBlink1Light makes a driver for the first blink(1) attached to the system.
+func newBlink1Light(config *ConfigData) lightDriver {
+	return newRGBLight(config, &hidDevice{
+		name: "blink(1)",
+		ids:  [][2]uint16{{blink1VendorID, blink1ProductID}},
+		command: func(c rgbColor) []byte {
+			// report 1, "fade to RGB" command, color, fade time (10ms units), all LEDs
+			return []byte{1, 'c', c[0], c[1], c[2], 0, 0, 0, 0}
+		},
+	}, rgbLightTiming{})
+}
@@ -7,10 +7,13 @@
 //    USR1   - in zoom, muted
 //    USR2   - in zoom, unmuted
 //    HUP    - out of zoom
-//    INFO   - force refresh from calendar now
+//    INFO   - force refresh from calendar now (RTMIN on Linux)
 //    VTALRM - toggle urgent indicator
 //    WINCH  - toggle idle/working state
-//    CHLD   - toggle low-priority
+//    ALRM   - toggle low-priority
+//    RTMIN+1 - re-read the configuration (Linux only)
+//
+// (These are the defaults; see internal/signals.)
 //
 // Steve Willoughby <steve@madscience.zone>
 // License: BSD 3-Clause open-source license
@@ -19,54 +22,129 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"os/user"
-	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"go.bug.st/serial"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fizban-of-ragnarok/busylight/internal/configdir"
+	"github.com/fizban-of-ragnarok/busylight/internal/dbus"
+	"github.com/fizban-of-ragnarok/busylight/internal/signals"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/grpc"
 )
 
 // CalendarConfigData provides configuration data which can be specified for each calendar
 // being monitored. These are read from the config.json file.
 type CalendarConfigData struct {
-	Title              string // Arbitrary user-friendly name for the calendar
-	IgnoreAllDayEvents bool   // If true, ignore this calendar if booked the whole time
+	Title              string                // Arbitrary user-friendly name for the calendar
+	IgnoreAllDayEvents bool                  // If true, ignore this calendar if booked the whole time
+	Provider           string                // Where the calendar lives: "google" (the default), "microsoft", or "ics"
+	CheckResponses     bool                  // If true (Google only), ignore invitations we've declined or not answered (see googleevents.go)
+	IgnoreTentative    bool                  // If true (with CheckResponses), ignore invitations we've only tentatively accepted
+	Rules              []EventRuleConfigData // What to do with events, by title (see eventrules.go)
+	EventTypes         map[string]string     // The states Google's special kinds of events call for (see googleevents.go)
+	State              string                // The state this calendar's busy time calls for (default "busy")
 }
 
 // ConfigData holds the configuration specified by the user in the config.json file
 // as well as some run-time values we need to refer to throughout the run of the daemon.
 type ConfigData struct {
-	// A map of all Google calendars being monitored by the daemon.Calendars
-	// The key is the Google-provided calendar ID; the value is a CalendarConfigData
+	// The name by which other people know you (e.g., "Alice"). This is used when
+	// reporting your status to other people and services.
+	Name string
+
+	// A map of all calendars being monitored by the daemon.
+	// The key is the Google-provided calendar ID (or, for Microsoft 365 calendars,
+	// the mailbox's email address, or for ICS feeds, the URL); the value is a CalendarConfigData
 	// structure describing what we want to do with that calendar.
 	Calendars map[string]CalendarConfigData
 
+	// How often, and how far ahead, to poll the calendars (see polling.go).
+	Polling PollingConfigData
+
+	// How many minutes to stay busy after each busy period ends, in case the
+	// meeting runs over. Busy periods closer together than this run together.
+	GraceMinutes int
+
+	// Busy periods shorter than this many minutes (e.g., reminders someone put
+	// on a shared calendar) are ignored.
+	MinimumEventMinutes int
+
+	// How we read Microsoft 365 calendars, if we have any.
+	Microsoft365 Microsoft365ConfigData
+
 	// The path to the file where our access credentials to the calendars is cached.
 	TokenFile string
 
+	// The path to the file where we keep the busy times from the last poll, to
+	// go by if we can't reach the calendars when we start up (see calcache.go).
+	CalendarCacheFile string
+
 	// The path to the file where our API keys are stored.
 	CredentialFile string
 
 	// The path to our logfile where daemon activity is recorded.
 	LogFile string
 
+	// When to start a new log file (see logfile.go). This is captured at startup;
+	// changing it requires a restart of the daemon.
+	LogRotation LogRotationConfigData
+
+	// When we're working, by day of the week (see workinghours.go). Outside
+	// these hours, we go to sleep by ourselves.
+	WorkingHours map[string]string
+
+	// When to keep the light quiet, whatever the state (see quiethours.go).
+	QuietHours QuietHoursConfigData
+
+	// The light signal shown while snoozing (see snooze.go); the default is "off".
+	SnoozeSignal string
+
 	// The path to the file where we store our PID while we're running.
 	PidFile string
 
+	// Which signal asks for each action (see internal/signals), where it isn't
+	// the default for this system, e.g. {"reload": "RTMIN+1"}. This is captured
+	// at startup; changing it requires a restart of the daemon.
+	Signals map[string]string
+
+	// The path to a Unix socket on which we accept control commands (see socket.go).
+	// If empty, no socket is created.
+	SocketFile string
+
+	// The kind of light hardware we have: "serial" (our own device; the default),
+	// "blink1" (a ThingM blink(1)), "luxafor" (a Luxafor flag), "kuando"
+	// (a Kuando Busylight), "hue" (Philips Hue lights; see `Hue`), "mqtt"
+	// (no hardware; the signals are published to the MQTT broker in `MQTT`),
+	// or "remote" (another daemon's light; see `RemoteLight`).
+	Driver string
+
+	// The Philips Hue light(s) to use if `Driver` is "hue".
+	Hue HueConfigData
+
+	// The light server to use if `Driver` is "remote" (see remotelight.go).
+	RemoteLight RemoteLightConfigData
+
+	// Offering our light to other daemons whose Driver is "remote".
+	LightServer LightServerConfigData
+
 	// The path to the serial device we use to communicate with the light hardware.
 	Device string
 
@@ -79,63 +157,322 @@ type ConfigData struct {
 	// The baud rate at which we communicate with the hardware.
 	BaudRate int
 
+	// If true, wait for the hardware to acknowledge each command (as newer
+	// firmware does), sending it again or reopening the port if it doesn't.
+	SerialAcks bool
+
+	// If true, ask the hardware to identify itself when we open it (as newer
+	// firmware can), and don't use any port where it doesn't.
+	SerialIdentify bool
+
+	// Where to upload our status every time it changes, if anywhere.
+	Publish PublishConfigData
+
+	// Chat rooms where we announce state changes and answer status queries.
+	Chat ChatConfigData
+
+	// Sharing our status with other daemons on the local network.
+	MDNS MDNSConfigData
+
+	// Showing the combined state of several people on our light.
+	Household HouseholdConfigData
+
+	// The embedded HTTP server (status widget, etc.).
+	HTTP HTTPConfigData
+
+	// The gRPC control service (see grpc.go).
+	GRPC GRPCConfigData
+
+	// Offering our status and controls on the D-Bus session bus (see dbus.go).
+	DBus DBusConfigData
+
+	// Other daemons we push our state to over HTTPS.
+	Federation FederationConfigData
+
+	// Other people's daemons (or scripts) which report their states to us, as a hub.
+	Hub HubConfigData
+
+	// What each named client of the HTTP API, light server, or hub may do:
+	// "read", "control", or "admin" (see scopes.go).
+	Scopes map[string]string
+
+	// Where to fetch centrally-managed settings from, if anywhere.
+	RemoteConfig RemoteConfigData
+
+	// The attention-request button outside the door, if there is one.
+	Button ButtonConfigData
+
+	// External programs to run when the state changes.
+	Hooks []HookConfigData
+
+	// URLs to notify when the state changes.
+	Webhooks []WebhookConfigData
+
+	// A Telegram bot for remote control.
+	Telegram TelegramConfigData
+
+	// Warning that a busy period is about to start.
+	MeetingWarning MeetingWarningConfigData
+
+	// Putting manual overrides on the calendar.
+	CalendarWriteBack CalendarWriteBackConfigData
+
+	// Keeping time-tracking entries in line with our state.
+	TimeTracking TimeTrackingConfigData
+
+	// Recording state transitions for "busylight --report".
+	Analytics AnalyticsConfigData
+
+	// Push notifications to a phone.
+	Push PushConfigData
+
+	// OBS Studio scenes to switch to when the state changes.
+	OBS OBSConfigData
+
+	// Keeping our Slack status in line with our state.
+	Slack SlackConfigData
+
+	// Keeping our Microsoft Teams presence in line with our state.
+	Teams TeamsConfigData
+
+	// Noticing we're in a call when the camera or microphone is in use.
+	CallDetection CallDetectionConfigData
+
+	// Noticing we're in a Google Meet call from the browsers' titles.
+	MeetDetection MeetDetectionConfigData
+
+	// Hearing about Zoom calls from a Zoom app's webhooks.
+	ZoomWebhook ZoomWebhookConfigData
+
+	// Noticing we've stepped away when the screen is locked or we're idle.
+	AwayDetection AwayDetectionConfigData
+
+	// Home Assistant services to call when the state changes.
+	HomeAssistant HomeAssistantConfigData
+
+	// An MQTT broker to publish our state to.
+	MQTT MQTTConfigData
+
+	// Watching PagerDuty for on-call shifts and incidents.
+	PagerDuty PagerDutyConfigData
+
+	// Accepting alert notifications from monitoring systems.
+	Alerts AlertsConfigData
+
+	// CI builds whose status we show.
+	CI CIConfigData
+
+	// Issue-tracker searches which make us urgent when something new turns up.
+	Issues IssuesConfigData
+
+	// A mailbox to watch for urgent mail.
+	Mail MailConfigData
+
+	// Services whose health we show.
+	Monitor MonitorConfigData
+
+	// Which reasons for showing a state win over which (see priority.go).
+	StatePriority []string
+
+	// The user's own states, by name (see states.go).
+	States map[string]CustomStateConfigData
+
+	// How to show light signals, where that differs from the usual, or for
+	// new signals for the user's own states (see lightsignals.go).
+	LightSignals map[string]LightSignalConfigData
+
 	// These values are used internally by the daemon while it's running.
 	googleConfig []byte      // unmarshalled data needed for Google API calls
 	logger       *log.Logger // logger open on the requested file
-	port         serial.Port // open serial port device
-	portOpen     bool        // is `port` valid and open now?
+	light        lightDriver // the light hardware, while it's open
+	finding      lightDriver // the light we're looking for in the background, if any (see openLight)
+	events       eventBus    // distributes state changes to interested subsystems
+	peers        peerTable   // what we know about other people's busylights
+	mdnsGoodbye  func()      // tells mDNS peers we're leaving (if sharing via mDNS)
+
+	hardwareFault bool                // have we failed to write to the light (and not succeeded since)?
+	lightLost     bool                // has the light gone away (so we're trying to reopen it)?
+	lastSignal    string              // what the light is showing (e.g., "green+lowpri"; empty if we don't know)
+	dashboard     dashboardSnapshot   // what the dashboard shows besides our status (see dashboard.go)
+	hotplug       chan struct{}       // devices have come or gone (nil if we can't tell)
+	clockChanges  chan clockChange    // the computer woke up, the clock was set, or the time zone changed
+	buttonPresses chan string         // attention-request button presses (by source)
+	children      childProcesses      // external commands we're running
+	commands      chan controlCommand // requests from control interfaces for the event loop
+	sourceUpdates chan sourceUpdate   // indicator changes from automatic sources
+	remoteLights  chan lightClaim     // what light server clients want our light to show
+	remoteConfigs chan []byte         // managed configuration documents, fetched in the background
+	lightsFound   chan lightFound     // lights looked for in the background (see openLight)
+	writeBacks    chan calendarWrite  // overrides to put on the calendar, or take off it (see writeBackOverride)
+	current       atomic.Value        // the settings for other goroutines to use (see currentSettings)
+	zone          atomic.Value        // the system's time zone, if it's changed since we started (see localZone)
+	pushes        chan pushMessage    // push notifications waiting to be sent (nil if we don't send them)
+	controlSocket net.Listener        // listening for commands on SocketFile (nil if not)
+	grpcServer    *grpc.Server        // offering the gRPC service (nil if not)
+	dbusConn      *dbus.Conn          // connection to the D-Bus session bus (nil if not offering our object there)
+	mqtt          mqtt.Client         // connection to the MQTT broker (nil if not configured)
+
+	configFile   string          // where to read the configuration from (-config; see configdir.ConfigFile)
+	overrides    configOverrides // settings from the command line and environment, laid over the configuration
+	remoteConfig []byte          // the managed configuration laid over the local one (nil if none)
 }
 
 // lightSignal tells the hardware to signal a particular condition on the lights.
 // If `delay` is positive, we wait that long before returning, to make some trivial
 // multi-step (but very quick and short-lived) sequences easy to implement.
+// We don't bother the hardware with the signal it's showing already.
 func lightSignal(config *ConfigData, color string, delay time.Duration) {
-	// colorCode maps the color strings as passed in to this function to the
-	// actual commands sent to the hardware.
-	var colorCode = map[string]string{
-		"blue":     "B",
-		"green":    "G",
-		"off":      "X",
-		"red":      "R",
-		"red2":     "2",
-		"redflash": "#",
-		"urgent":   "%",
-		"yellow":   "Y",
-		"lowpri":   "@",
-	}
-
-	if config.portOpen {
-		command, valid := colorCode[color]
-		if !valid {
-			config.logger.Printf("ERROR: Unable to send light signal \"%v\"; not defined.", color)
+	if config.light != nil {
+		if color == config.lastSignal && !config.hardwareFault {
+			return
+		}
+		showing := config.lastSignal
+		config.lastSignal = ""
+		if err := config.light.Set(color); err != nil {
+			if !config.hardwareFault {
+				config.hardwareFault = true
+				config.logger.Printf("ERROR: Unable to send light signal \"%v\": %v", color, err)
+				pushNotify(config, "hardware", "Unable to control the light: %v", err)
+			}
+			loseLight(config)
 			return
+		} else if config.hardwareFault {
+			config.hardwareFault = false
+			config.logger.Printf("Light is working again")
+		}
+		if color == "lowpri" {
+			config.lastSignal = showing + "+lowpri" // (it's added to what was there)
+		} else {
+			config.lastSignal = color
 		}
-		config.port.Write([]byte(command))
 		if delay > 0 {
 			time.Sleep(delay)
 		}
 	}
 }
 
+// stateColors maps each overall state to the light signal used to display it.
+var stateColors = map[string]string{
+	"off":        "off",
+	"free":       "green",
+	"busy":       "yellow",
+	"zoom-muted": "red",
+	"zoom-open":  "redflash",
+	"urgent":     "urgent",
+	"dnd":        "red",
+	"warning":    "warning",
+	"away":       "blue",
+}
+
+// displayState sets the light to show the given overall state (unless it is already).
+func displayState(config *ConfigData, state string, lowPriority bool) {
+	signal := stateSignal(config, state)
+	lowPriority = lowPriority && state != "off"
+	showing := signal
+	if lowPriority {
+		showing += "+lowpri"
+	}
+	if config.light == nil || (!config.hardwareFault && config.lastSignal == showing) {
+		return // (the main loop shows the state when checkLightHealth finds the light again)
+	}
+	lightSignal(config, signal, 0)
+	config.logger.Printf("Signal %s", state)
+	if lowPriority {
+		lightSignal(config, "lowpri", 0)
+	}
+}
+
+// getConfigFromFile reads our configuration. Settings we don't know are an
+// error, since they're most likely misspellings (and otherwise we'd quietly
+// carry on with the default for whatever was meant).
 func getConfigFromFile(filename string, data *ConfigData) error {
 	cdata, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("Unable to read from %s: %v", filename, err)
 	}
 
-	err = json.Unmarshal(cdata, &data)
+	decoder := json.NewDecoder(bytes.NewReader(cdata))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(data)
 	if err != nil {
+		if line := configErrorLine(cdata, err); line > 0 {
+			return fmt.Errorf("Unable to understand %s configuration at line %d: %v", filename, line, err)
+		}
 		return fmt.Errorf("Unable to understand %s configuration: %v", filename, err)
 	}
 	return nil
 }
 
-func getClient(config *oauth2.Config, tokFile string) (*http.Client, error) {
+// useSettings replaces all of the settings read from the configuration
+// with those from another copy (which has already been checked), leaving
+// the daemon's internal values alone, and hands the other goroutines a copy
+// of their own (see currentSettings).
+func useSettings(config, from *ConfigData) {
+	to, settings := reflect.ValueOf(config).Elem(), reflect.ValueOf(from).Elem()
+	for i := 0; i < to.NumField(); i++ {
+		if to.Type().Field(i).PkgPath == "" { // (exported)
+			to.Field(i).Set(settings.Field(i))
+		}
+	}
+	config.current.Store(pollingSettings(config))
+}
+
+// currentSettings returns the settings as of the last time the configuration
+// was (re-)loaded. Anything running outside the main event loop (such as
+// the HTTP handlers) must use these rather than config's own, which the
+// event loop replaces as it re-loads them; these are never changed, only
+// replaced as a whole.
+func currentSettings(config *ConfigData) *ConfigData {
+	if settings, loaded := config.current.Load().(*ConfigData); loaded {
+		return settings
+	}
+	return config
+}
+
+// pollingSettings returns a copy of the settings (and what else we need to
+// poll the calendars), which stays the same if the configuration is
+// re-loaded while a poll is under way.
+func pollingSettings(config *ConfigData) *ConfigData {
+	copied := &ConfigData{googleConfig: config.googleConfig, logger: config.logger}
+	from, to := reflect.ValueOf(config).Elem(), reflect.ValueOf(copied).Elem()
+	for i := 0; i < from.NumField(); i++ {
+		if from.Type().Field(i).PkgPath == "" { // (exported)
+			to.Field(i).Set(from.Field(i))
+		}
+	}
+	return copied
+}
+
+// configErrorLine works out which line of the configuration file a decoding
+// error refers to, or returns 0 if it can't tell.
+func configErrorLine(cdata []byte, err error) int {
+	offset := int64(-1)
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		// (unknown settings aren't reported with their position, so we look
+		// for the first place the name is used as a key)
+		if name := strings.TrimPrefix(err.Error(), "json: unknown field "); name != err.Error() {
+			if found := regexp.MustCompile(regexp.QuoteMeta(name) + `\s*:`).FindIndex(cdata); found != nil {
+				offset = int64(found[0])
+			}
+		}
+	}
+	if offset < 0 || offset > int64(len(cdata)) {
+		return 0
+	}
+	return bytes.Count(cdata[:offset], []byte("\n")) + 1
+}
+
+func getClient(ctx context.Context, config *oauth2.Config, tokFile string) (*http.Client, error) {
 	tok, err := tokenFromFile(tokFile)
 	if err != nil {
 		return nil, err
 	}
-	return config.Client(context.Background(), tok), nil
+	return config.Client(ctx, tok), nil
 }
 
 func tokenFromFile(file string) (*oauth2.Token, error) {
@@ -152,6 +489,8 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 // BusyPeriod specifies a range of times during which a calendar indicates one or more events occur.
 type BusyPeriod struct {
 	Start, End time.Time
+	Title      string // the event's title, where the calendar tells us (see eventrules.go)
+	State      string // the state it calls for, if not just "busy"
 }
 
 // ByStartTime provides a custom sort order for `BusyPeriod` elements.
@@ -175,24 +514,24 @@ type CalendarAvailability struct {
 	LastPollTime time.Time
 
 	// The list of "busy" time spans found on the calendars from the last poll.
-	UpcomingPeriods []BusyPeriod // will be in chronological order
+	// Spans calling for different states may overlap.
+	UpcomingPeriods []BusyPeriod // will be in chronological order (by start time)
+
+	// Are these from the CalendarCacheFile, because we haven't been able to poll since we started?
+	Stale bool
 }
 
 // RemoveExpiredPeriods trims busy spans from a `CalendarAvailability` value which occur in the past.
 func (cal *CalendarAvailability) RemoveExpiredPeriods(config *ConfigData) {
-	for len(cal.UpcomingPeriods) > 0 {
-		if time.Now().Add(5 * time.Second).After(cal.UpcomingPeriods[0].End) {
-			cal.UpcomingPeriods = cal.UpcomingPeriods[1:]
-		} else {
-			break
-		}
-	}
-	if len(cal.UpcomingPeriods) == 0 && time.Now().After(cal.LastPollTime.Add(30*time.Minute)) {
-		err := cal.Refresh(config)
-		if err != nil {
-			config.logger.Printf("Unable to refresh calendar data while removing expired periods: %v", err)
+	var current []BusyPeriod
+	for _, period := range cal.UpcomingPeriods {
+		if !time.Now().Add(5 * time.Second).After(period.End) {
+			current = append(current, period)
 		}
 	}
+	cal.UpcomingPeriods = current
+	// (when we run out, the next poll will find more; polls always look
+	// further ahead than the time between them)
 	// yes, we're trusting the Google service not to give us past events.
 }
 
@@ -202,15 +541,22 @@ func (cal *CalendarAvailability) NextTransitionTime(config *ConfigData) time.Tim
 
 	if len(cal.UpcomingPeriods) == 0 {
 		// nothing scheduled for the time we queried about.
-		// Tell the caller to check back in 8 hours.
-		return time.Now().Add(8 * time.Hour)
+		// Tell the caller to check back when that time is up.
+		return time.Now().Add(config.Polling.lookahead())
 	}
-	if time.Now().Add(5 * time.Second).After(cal.UpcomingPeriods[0].Start) {
-		// we're already into the period, so the next transition will be at its end
-		return cal.UpcomingPeriods[0].End
+	var next time.Time
+	for _, period := range cal.UpcomingPeriods {
+		// if we're already into the period, the next transition will be at its end;
+		// if it hasn't started yet, the transition will be at its beginning.
+		transition := period.Start
+		if time.Now().Add(5 * time.Second).After(period.Start) {
+			transition = period.End
+		}
+		if next.IsZero() || transition.Before(next) {
+			next = transition
+		}
 	}
-	// the period hasn't started yet so the transition will be at its beginning.
-	return cal.UpcomingPeriods[0].Start
+	return next
 }
 
 // ScheduledBusyNow checks to see if, according to the monitored calendars, we are scheduled to be busy right now.
@@ -226,39 +572,132 @@ func (cal *CalendarAvailability) ScheduledBusyNow(config *ConfigData) bool {
 	return false
 }
 
-// Refresh polls the Google API and updates the `CalendarAvailability` structure accordingly.
-func (cal *CalendarAvailability) Refresh(config *ConfigData) error {
-	config.logger.Printf("Polling Google Calendars")
-	googleConfig, err := google.ConfigFromJSON(config.googleConfig, calendar.CalendarReadonlyScope)
+// ScheduledState returns the state the calendars call for right now: "busy",
+// unless one of the periods we're in calls for another state (in which case
+// the most recently started of those wins).
+func (cal *CalendarAvailability) ScheduledState(config *ConfigData) string {
+	state := "busy"
+	for _, period := range cal.UpcomingPeriods {
+		if period.State != "" && time.Now().Add(5*time.Second).After(period.Start) {
+			state = period.State
+		}
+	}
+	return state
+}
+
+// googleBusyPeriods asks the Google Calendar API when each of the given calendars is busy
+// between start and end, adding what it finds to busy (keyed by calendar ID).
+func googleBusyPeriods(ctx context.Context, config *ConfigData, ids []string, start, end time.Time, busy map[string][]BusyPeriod) error {
+	ctx, cancel := context.WithTimeout(ctx, config.Polling.timeout())
+	defer cancel()
+	srv, err := newCalendarService(ctx, config)
 	if err != nil {
 		return err
 	}
 
-	client, err := getClient(googleConfig, config.TokenFile)
+	var query calendar.FreeBusyRequest
+	query.TimeMin = start.Format(time.RFC3339)
+	query.TimeMax = end.Format(time.RFC3339)
+	for _, cID := range ids {
+		if calInfo := config.Calendars[cID]; calInfo.CheckResponses || len(calInfo.Rules) > 0 || len(calInfo.EventTypes) > 0 {
+			periods, err := googleEventBusyPeriods(ctx, config, srv, cID, start, end)
+			if err != nil {
+				config.logger.Printf("ERROR: Calendar \"%s\": %v", config.Calendars[cID].Title, err)
+				continue
+			}
+			busy[cID] = periods
+			continue
+		}
+		query.Items = append(query.Items, &calendar.FreeBusyRequestItem{Id: cID})
+	}
+	if len(query.Items) == 0 {
+		return nil
+	}
+	freelist, err := srv.Freebusy.Query(&query).Context(ctx).Do()
 	if err != nil {
-		return fmt.Errorf("Unable to query calendar: %v", err)
+		return err
+	}
+
+	for calID, calData := range freelist.Calendars {
+		title := config.Calendars[calID].Title
+		for _, e := range calData.Errors {
+			config.logger.Printf("ERROR: Calendar \"%s\": %v", title, e)
+		}
+		busy[calID] = nil
+		for _, b := range calData.Busy {
+			startTime, err := time.Parse(time.RFC3339, b.Start)
+			if err != nil {
+				config.logger.Printf("ERROR: %s: Unable to parse start time \"%v\": %v", title, b.Start, err)
+				continue
+			}
+			endTime, err := time.Parse(time.RFC3339, b.End)
+			if err != nil {
+				config.logger.Printf("ERROR: %s: Unable to parse end time \"%v\": %v", title, b.End, err)
+				continue
+			}
+			busy[calID] = append(busy[calID], BusyPeriod{Start: startTime, End: endTime})
+		}
 	}
+	return nil
+}
 
-	srv, err := calendar.New(client)
+// Refresh polls the calendar services and updates the `CalendarAvailability` structure accordingly.
+func (cal *CalendarAvailability) Refresh(config *ConfigData) error {
+	periods, err := pollBusyPeriods(context.Background(), config)
 	if err != nil {
 		return err
 	}
+	cal.update(config, periods)
+	return nil
+}
+
+// update takes the busy periods found by a successful poll of the calendars.
+func (cal *CalendarAvailability) update(config *ConfigData, periods []BusyPeriod) {
+	cal.UpcomingPeriods = periods
+	cal.LastPollTime = time.Now()
+	cal.Stale = false
+	cal.saveCache(config)
+}
+
+// pollBusyPeriods polls the calendar services, returning the busy periods
+// coming up (in chronological order). It may be cancelled through ctx.
+func pollBusyPeriods(ctx context.Context, config *ConfigData) ([]BusyPeriod, error) {
+	var googleIDs, microsoftIDs, icsURLs []string
+	for cID, calInfo := range config.Calendars {
+		switch calInfo.Provider {
+		case "", "google":
+			googleIDs = append(googleIDs, cID)
+		case "microsoft":
+			microsoftIDs = append(microsoftIDs, cID)
+		case "ics":
+			icsURLs = append(icsURLs, cID)
+		default:
+			config.logger.Printf("ERROR: Calendar \"%s\" has unknown provider \"%s\" (ignored)", calInfo.Title, calInfo.Provider)
+		}
+	}
 
-	var query calendar.FreeBusyRequest
 	queryStartTime := time.Now()
-	queryEndTime := queryStartTime.Add(time.Hour * 8)
-	query.TimeMin = queryStartTime.Format(time.RFC3339)
-	query.TimeMax = queryEndTime.Format(time.RFC3339)
-	for cID := range config.Calendars {
-		query.Items = append(query.Items, &calendar.FreeBusyRequestItem{Id: cID})
+	queryEndTime := queryStartTime.Add(config.Polling.lookahead())
+	busy := make(map[string][]BusyPeriod)
+	if len(googleIDs) > 0 {
+		config.logger.Printf("Polling Google Calendars")
+		if err := googleBusyPeriods(ctx, config, googleIDs, queryStartTime, queryEndTime, busy); err != nil {
+			return nil, err
+		}
 	}
-	freelist, err := srv.Freebusy.Query(&query).Do()
-	if err != nil {
-		return err
+	if len(microsoftIDs) > 0 {
+		config.logger.Printf("Polling Microsoft 365 calendars")
+		if err := microsoftBusyPeriods(ctx, config, microsoftIDs, queryStartTime, queryEndTime, busy); err != nil {
+			return nil, err
+		}
+	}
+	if len(icsURLs) > 0 {
+		config.logger.Printf("Polling calendar feeds")
+		icsBusyPeriods(ctx, config, icsURLs, queryStartTime, queryEndTime, busy)
 	}
 
 	var rawbusylist []BusyPeriod
-	for calID, calData := range freelist.Calendars {
+	for calID, periods := range busy {
 		calInfo, isKnown := config.Calendars[calID]
 		if !isKnown {
 			config.logger.Printf("WARNING: Calendar <%s> in API results does not match any in our configuration!", calID)
@@ -267,21 +706,9 @@ func (cal *CalendarAvailability) Refresh(config *ConfigData) error {
 			}
 		}
 
-		for _, e := range calData.Errors {
-			config.logger.Printf("ERROR: Calendar \"%s\": %v", calInfo.Title, e)
-		}
-		for _, busy := range calData.Busy {
-			startTime, err := time.Parse(time.RFC3339, busy.Start)
-			if err != nil {
-				config.logger.Printf("ERROR: %s: Unable to parse start time \"%v\": %v", calInfo.Title, busy.Start, err)
-				continue
-			}
-			endTime, err := time.Parse(time.RFC3339, busy.End)
-			if err != nil {
-				config.logger.Printf("ERROR: %s: Unable to parse end time \"%v\": %v", calInfo.Title, busy.End, err)
-				continue
-			}
-			config.logger.Printf("Calendar \"%s\": busy %v - %v", calInfo.Title, startTime.Local(), endTime.Local())
+		for _, period := range periods {
+			startTime, endTime := period.Start, period.End
+			config.logger.Printf("Calendar \"%s\": busy %v - %v", calInfo.Title, startTime.In(localZone(config)), endTime.In(localZone(config)))
 			if calInfo.IgnoreAllDayEvents {
 				// This calendar is on our ignore list for all-day bookings.
 				// There isn't any really great way to identify all-day events
@@ -296,17 +723,51 @@ func (cal *CalendarAvailability) Refresh(config *ConfigData) error {
 					continue
 				}
 			}
-			rawbusylist = append(rawbusylist, BusyPeriod{Start: startTime, End: endTime})
+			if period.State == "" && calInfo.State != "busy" {
+				period.State = calInfo.State
+			}
+			if state, counted := applyEventRules(calInfo, period.Title); !counted {
+				config.logger.Printf("Ignoring event \"%s\" from %s", period.Title, calInfo.Title)
+				continue
+			} else if state != "" {
+				period.State = state
+			}
+			// (a period already under way when we asked may be cut short
+			// in the results, so we can't tell how long it really is)
+			if endTime.Sub(startTime) < time.Duration(config.MinimumEventMinutes)*time.Minute &&
+				startTime.After(queryStartTime.Add(5*time.Second)) {
+				config.logger.Printf("Ignoring short event from %s", calInfo.Title)
+				continue
+			}
+			period.End = period.End.Add(time.Duration(config.GraceMinutes) * time.Minute)
+			rawbusylist = append(rawbusylist, period)
 		}
 	}
-	// smush list and sort it
+	// smush list and sort it (keeping periods which call for different
+	// states apart)
 	config.logger.Printf("DEBUG: Initial list: %v", rawbusylist)
 	sort.Sort(ByStartTime(rawbusylist))
 	config.logger.Printf("DEBUG: Sorted list: %v", rawbusylist)
+	byState := make(map[string][]BusyPeriod)
+	for _, period := range rawbusylist {
+		byState[period.State] = append(byState[period.State], period)
+	}
+	var merged []BusyPeriod
+	for state, periods := range byState {
+		merged = append(merged, mergeBusyPeriods(state, periods)...)
+	}
+	sort.Sort(ByStartTime(merged))
+	config.logger.Printf("DEBUG: final list: %v", merged)
+	return merged, nil
+}
+
+// mergeBusyPeriods combines overlapping periods (sorted by start time) which
+// call for the same state.
+func mergeBusyPeriods(state string, rawbusylist []BusyPeriod) []BusyPeriod {
+	var merged []BusyPeriod
 	var currentStart time.Time
 	var currentEnd time.Time
 
-	cal.UpcomingPeriods = nil
 	for _, eachPeriod := range rawbusylist {
 		if currentEnd.IsZero() {
 			currentEnd = eachPeriod.End
@@ -316,7 +777,7 @@ func (cal *CalendarAvailability) Refresh(config *ConfigData) error {
 			currentStart = eachPeriod.Start
 		} else if eachPeriod.Start.After(currentEnd) {
 			// disjoint; we've reached the end of our busy time, so commit what we have
-			cal.UpcomingPeriods = append(cal.UpcomingPeriods, BusyPeriod{Start: currentStart, End: currentEnd})
+			merged = append(merged, BusyPeriod{Start: currentStart, End: currentEnd, State: state})
 			currentStart = eachPeriod.Start
 			currentEnd = eachPeriod.End
 		} else if eachPeriod.End.After(currentEnd) {
@@ -328,11 +789,9 @@ func (cal *CalendarAvailability) Refresh(config *ConfigData) error {
 	}
 	if !currentStart.IsZero() {
 		// we need to commit the last one, too
-		cal.UpcomingPeriods = append(cal.UpcomingPeriods, BusyPeriod{Start: currentStart, End: currentEnd})
+		merged = append(merged, BusyPeriod{Start: currentStart, End: currentEnd, State: state})
 	}
-	config.logger.Printf("DEBUG: final list: %v", cal.UpcomingPeriods)
-	cal.LastPollTime = time.Now()
-	return nil
+	return merged
 }
 
 //
@@ -355,16 +814,14 @@ func (cal *CalendarAvailability) Refresh(config *ConfigData) error {
 //  re-schedule next transition
 
 func setup(config *ConfigData) error {
-	var thisUser *user.User
-	previousLogFile := config.LogFile
-	previousPidFile := config.PidFile
-
-	thisUser, err := user.Current()
-	if err != nil {
-		return fmt.Errorf("Unable to determine current user: %v", err)
+	// (we build the settings afresh, so settings removed from the file don't
+	// linger, and only put them in place once we know they make sense)
+	settings, err := loadSettings(config, config.remoteConfig)
+	if err != nil && config.remoteConfig != nil {
+		config.logger.Printf("ERROR: Not using the remote configuration (it doesn't make sense with the local one): %v", err)
+		config.remoteConfig = nil
+		settings, err = loadSettings(config, nil)
 	}
-
-	err = getConfigFromFile(filepath.Join(thisUser.HomeDir, ".busylight/config.json"), config)
 	if err != nil {
 		return fmt.Errorf("Unable to initialize: %v", err)
 	}
@@ -374,16 +831,20 @@ func setup(config *ConfigData) error {
 	// existing logfile and pid file alone.
 	//
 	if config.logger == nil {
-		f, err := os.OpenFile(config.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-		if err != nil {
-			return fmt.Errorf("Unable to open logfile: %v", err)
+		if settings.LogFile == "-" {
+			config.logger = log.New(os.Stderr, "busylightd: ", log.LstdFlags)
+		} else {
+			f, err := openRotatingLog(settings.LogFile, settings.LogRotation)
+			if err != nil {
+				return fmt.Errorf("Unable to open logfile: %v", err)
+			}
+			config.logger = log.New(f, "busylightd: ", log.LstdFlags)
 		}
-		config.logger = log.New(f, "busylightd: ", log.LstdFlags)
 
 		myPID := os.Getpid()
 		config.logger.Printf("busylightd started, PID=%v", myPID)
 
-		pidf, err := os.OpenFile(config.PidFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		pidf, err := os.OpenFile(settings.PidFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 		if err != nil {
 			config.logger.Printf("ERROR creating PID file (is another busylightd running?): %v", err)
 			return err
@@ -391,100 +852,152 @@ func setup(config *ConfigData) error {
 		pidf.WriteString(fmt.Sprintf("%d\n", myPID))
 		pidf.Close()
 
-		config.googleConfig, err = ioutil.ReadFile(config.CredentialFile)
-		if err != nil {
-			config.logger.Printf("Unable to read client secret file %v: %v", config.CredentialFile, err)
-			return fmt.Errorf("Unable to read client secret file %v: %v", config.CredentialFile, err)
+		// (someone only using Microsoft 365 calendars doesn't need Google credentials)
+		if settings.CredentialFile != "" {
+			config.googleConfig, err = ioutil.ReadFile(settings.CredentialFile)
+			if err != nil {
+				config.logger.Printf("Unable to read client secret file %v: %v", settings.CredentialFile, err)
+				return fmt.Errorf("Unable to read client secret file %v: %v", settings.CredentialFile, err)
+			}
 		}
 	} else {
-		if previousPidFile != config.PidFile {
-			config.logger.Printf("WARNING: PID file changed from %v to %v on reload. This requires a full restart of the daemon. Ignoring the change for now.", previousPidFile, config.PidFile)
+		if settings.PidFile != config.PidFile {
+			config.logger.Printf("WARNING: PID file changed from %v to %v on reload. This requires a full restart of the daemon. Ignoring the change for now.", config.PidFile, settings.PidFile)
+			settings.PidFile = config.PidFile
 		}
-		if previousLogFile != config.LogFile {
-			config.logger.Printf("WARNING: Log file changed from %v to %v on reload. This requires a full restart of the daemon. Ignoring the change for now.", previousLogFile, config.LogFile)
+		if settings.LogFile != config.LogFile {
+			config.logger.Printf("WARNING: Log file changed from %v to %v on reload. This requires a full restart of the daemon. Ignoring the change for now.", config.LogFile, settings.LogFile)
+			settings.LogFile = config.LogFile
 		}
 	}
+	useSettings(config, settings)
 
 	//
-	// Open the hardware port
+	// Pick up any centrally-managed settings (once they arrive, the main
+	// event loop lays them over these)
 	//
-	if config.portOpen {
-		config.port.Close()
-		config.portOpen = false
-	}
+	fetchRemoteConfigLater(config)
 
-	// If the user had a specific port in mind, just use that.
-	if config.Device != "" {
-		config.port, err = serial.Open(config.Device, &serial.Mode{
-			BaudRate: config.BaudRate,
-		})
-		if err != nil {
-			shutdown(config)
-			config.logger.Fatalf("Can't open serial device %v: %v", config.Device, err)
-		}
-		config.portOpen = true
-	} else {
-		// On the other hand, maybe we should hunt around to find it.
-		// This is necessary on systems where the USB port is given a
-		// random device name every time.
-		config.logger.Printf("Searching for available device port in %s...", config.DeviceDir)
-		fileList, err := os.ReadDir(config.DeviceDir)
-		if err != nil {
-			shutdown(config)
-			config.logger.Fatalf("Can't scan directory %s: %v", config.DeviceDir, err)
-		}
-		for _, f := range fileList {
-			if !f.IsDir() {
-				ok, err := regexp.MatchString(config.DeviceRegexp, f.Name())
-				if err != nil {
-					shutdown(config)
-					config.logger.Fatalf("Matching %s vs %s: %v", f.Name(), config.DeviceRegexp, err)
-				}
-				if ok {
-					config.port, err = serial.Open(fmt.Sprintf("%s%c%s", config.DeviceDir, os.PathSeparator, f.Name()),
-						&serial.Mode{BaudRate: config.BaudRate})
-					if err == nil {
-						config.logger.Printf("Opened %s%c%s", config.DeviceDir, os.PathSeparator, f.Name())
-						config.portOpen = true
-						break
-					}
-				}
-			}
-		}
-		if !config.portOpen {
-			shutdown(config)
-			config.logger.Fatalf("Unable to open any device matching /%s/ in %s.", config.DeviceRegexp, config.DeviceDir)
-		}
+	openDevice(config)
+	return nil
+}
+
+// openDevice opens the light, and signals that we're online and ready. If
+// we can't, we carry on without it (checkLightHealth keeps trying). If it's
+// to be looked for in the background, the main loop does the signalling
+// when it's found.
+func openDevice(config *ConfigData) {
+	if config.light != nil {
+		config.light.Close()
+		config.light = nil
+	}
+	config.finding = nil
+	config.lightLost = false
+	if config.buttonPresses == nil {
+		config.buttonPresses = make(chan string, 1) // (in case the light has a button)
+	}
+	light, err := newLight(config)
+	if err != nil {
+		config.logger.Printf("ERROR: %v (carrying on without the light)", err)
+		config.lightLost = true
+		return
 	}
+	if openLight(config, light) {
+		greetLight(config)
+	}
+}
 
-	//
-	// Signal that we're online and ready
-	//
+// greetLight signals on the light that we're online and ready.
+func greetLight(config *ConfigData) {
 	lightSignal(config, "blue", 100*time.Millisecond)
 	lightSignal(config, "off", 50*time.Millisecond)
 	lightSignal(config, "blue", 100*time.Millisecond)
 	lightSignal(config, "off", 0)
+}
 
-	return nil
+// checkConfigFile makes sure the configuration file (with the overrides
+// laid over it) can be loaded, without changing the settings we have now.
+func checkConfigFile(config *ConfigData) error {
+	_, err := loadSettings(config, nil)
+	return err
+}
+
+// loadSettings reads the configuration file afresh, with the overrides and
+// the given managed configuration (if any) laid over it, and makes sure the
+// result makes sense, without changing the settings we have now.
+func loadSettings(config *ConfigData, remote []byte) (*ConfigData, error) {
+	settings := &ConfigData{configFile: config.configFile, overrides: config.overrides, logger: config.logger}
+	configFile, err := configdir.ConfigFile(config.configFile)
+	if err == nil {
+		err = getConfigFromFile(configFile, settings)
+	}
+	if err == nil {
+		err = applyOverrides(settings, settings.overrides)
+	}
+	if err == nil && remote != nil {
+		if err = layRemoteConfig(settings, remote); err == nil {
+			err = applyOverrides(settings, settings.overrides)
+		}
+	}
+	if err == nil {
+		err = checkSettings(settings)
+	}
+	return settings, err
+}
+
+// lightHealth describes how the light is doing, for the status.
+func lightHealth(config *ConfigData) string {
+	switch {
+	case config.lightLost:
+		return "lost"
+	case config.finding != nil:
+		return "searching"
+	case config.light == nil:
+		return "closed"
+	case config.hardwareFault:
+		return "failing"
+	}
+	return "ok"
 }
 
 //
 // reverse whatever setup() did
 //
 func closeDevice(config *ConfigData) {
-	if config.portOpen {
+	if config.light != nil {
 		lightSignal(config, "red2", 100*time.Millisecond)
 		lightSignal(config, "off", 50*time.Millisecond)
 		lightSignal(config, "red2", 100*time.Millisecond)
 		lightSignal(config, "off", 0)
-		config.logger.Printf("Closing serial port")
-		config.port.Close()
-		config.portOpen = false
 	}
+	if config.light != nil { // (unless it failed just now)
+		config.logger.Printf("Closing light device")
+		config.light.Close()
+		config.light = nil
+	}
+	config.finding = nil
+	config.lightLost = false
 }
 
 func shutdown(config *ConfigData) {
+	recordShutdown(config)
+	if config.Publish.File != "" {
+		writeStateFile(config, config.Publish.File, DaemonStatus{State: "off", Description: describeState(config, "off"), Since: time.Now()})
+	}
 	closeDevice(config)
+	stopMQTT(config)
+	if config.mdnsGoodbye != nil {
+		config.mdnsGoodbye()
+	}
+	if config.controlSocket != nil {
+		config.controlSocket.Close()
+	}
+	if config.grpcServer != nil {
+		config.grpcServer.Stop()
+	}
+	if config.dbusConn != nil {
+		config.dbusConn.Close()
+	}
 	err := os.Remove(config.PidFile)
 	if err != nil {
 		config.logger.Printf("Error removing PID file: %v", err)
@@ -494,6 +1007,30 @@ func shutdown(config *ConfigData) {
 
 func main() {
 	var config ConfigData
+	var overrides configOverrides
+
+	var Fconfig = flag.String("config", "", "read the configuration from this file")
+	flag.Var(&overrides, "set", "override a configuration setting (Key=value; may be repeated)")
+	flag.Var(overrides.setting("Device"), "device", "serial device the light is on (overrides Device)")
+	flag.Var(overrides.setting("BaudRate"), "baud", "baud rate for the serial device (overrides BaudRate)")
+	flag.Var(overrides.setting("LogFile"), "log", "log to this file, or \"-\" for standard error (overrides LogFile)")
+	var FcheckConfig = flag.Bool("check-config", false, "check the configuration for problems, without starting the daemon")
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	config.configFile = *Fconfig
+	config.overrides = append(environmentOverrides(), overrides...)
+	config.remoteConfigs = make(chan []byte, 1)
+	config.lightsFound = make(chan lightFound, 1)
+
+	if *FcheckConfig {
+		if !checkConfig(&config) {
+			os.Exit(1)
+		}
+		return
+	}
 
 	if err := setup(&config); err != nil {
 		log.Fatalf("Unable to start daemon: %v", err)
@@ -503,137 +1040,767 @@ func main() {
 	//
 	// Listen for incoming signals from outside
 	//
+	signalTable, err := signals.Table(config.Signals)
+	if err != nil {
+		shutdown(&config)
+		config.logger.Fatalf("Unable to understand Signals setting: %v", err)
+	}
+	signalActions := make(map[os.Signal]string)
 	req := make(chan os.Signal, 5)
-	signal.Notify(req, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH, syscall.SIGINFO, syscall.SIGINT, syscall.SIGVTALRM, syscall.SIGCHLD)
+	for action, sig := range signalTable {
+		signalActions[sig] = action
+		signal.Notify(req, sig)
+	}
+	// SIGTERM (what init systems and kill(1) send by default) shuts us down
+	// gracefully too, unless it's been given some other job.
+	if _, taken := signalActions[syscall.SIGTERM]; !taken {
+		signalActions[syscall.SIGTERM] = signals.Kill
+		signal.Notify(req, syscall.SIGTERM)
+	}
 
 	//
 	// Get initial calendar download
 	//
 	var busyTimes CalendarAvailability
-	err := busyTimes.Refresh(&config)
-	if err != nil {
-		config.logger.Printf("Error updating busy/free times from calendar: %v", err)
+	initialPollErr := busyTimes.Refresh(&config)
+	if initialPollErr != nil {
+		config.logger.Printf("Error updating busy/free times from calendar: %v", initialPollErr)
+		if config.CalendarCacheFile != "" {
+			if err = busyTimes.loadCache(&config); err != nil {
+				config.logger.Printf("Unable to read saved calendar data: %v", err)
+			} else {
+				config.logger.Printf("Going by the calendar data saved at %v until we can poll again", busyTimes.LastPollTime.In(localZone(&config)))
+			}
+		}
 	}
 
-	isZoomNow := false
-	isZoomMuted := false
-	isActiveNow := true
-	isUrgent := false
-	isLowPriority := false
+	ind := indicators{Active: true}
+	isWaiting := false
+	sources := make(sourceStatuses)
+	var remoteLights lightClaims // (what light server clients want our light to show)
+	var override manualOverride
+	var forced manualOverride // (a state the user forced with the "force" command)
 
 	//
 	// Set the current state and schedule for next transition
 	//
-	isBusyTimeNow := busyTimes.ScheduledBusyNow(&config)
+	ind.BusyTime = busyTimes.ScheduledBusyNow(&config)
 	nextTransitionTime := busyTimes.NextTransitionTime(&config)
 	transitionTimer := time.NewTimer(time.Until(nextTransitionTime))
 
-	if isBusyTimeNow {
-		lightSignal(&config, "yellow", 0)
-	} else {
-		lightSignal(&config, "green", 0)
+	config.commands = make(chan controlCommand, 10)
+	config.sourceUpdates = make(chan sourceUpdate, 10)
+	config.remoteLights = make(chan lightClaim, 10)
+	startStatusPublisher(&config)
+	startChatBots(&config)
+	startTelegramBot(&config)
+	if err := startMDNS(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startHTTPServer(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startControlSocket(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startGRPCServer(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startDBus(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startLightServer(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startFederation(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	startButtons(&config)
+	watchHotplug(&config)
+	watchClock(&config)
+	startHooks(&config)
+	if err := startWebhooks(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startSlackStatus(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startTeamsPresence(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	startSlackPresence(&config)
+	startCallDetection(&config)
+	startMeetDetection(&config)
+	startAwayDetection(&config)
+	startHomeAssistant(&config)
+	if err := startMQTT(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	startOBS(&config)
+	if err := startTimeTracking(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	if err := startPagerDuty(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	startCIWatcher(&config)
+	startIssueWatcher(&config)
+	startMailWatcher(&config)
+	startMonitor(&config)
+	startAnalytics(&config)
+	startCalendarWriteBack(&config)
+	if err := startPushNotifications(&config); err != nil {
+		config.logger.Printf("ERROR: %v", err)
+	}
+	waitingTimer := time.NewTimer(0)
+	<-waitingTimer.C
+	overrideTimer := time.NewTimer(0)
+	<-overrideTimer.C
+	customStates := make(activeStates)
+	customStateTimer := time.NewTimer(0)
+	<-customStateTimer.C
+	warningTimer := time.NewTimer(0) // (for when to start warning of the next meeting)
+	<-warningTimer.C
+	var snoozeUntil time.Time // (when the snooze ends; zero if we're not snoozing)
+	snoozeTimer := time.NewTimer(0)
+	<-snoozeTimer.C
+	forceTimer := time.NewTimer(0)
+	<-forceTimer.C
+	isFlashing := false // (playing a flash notification instead of showing the state)
+	flashTimer := time.NewTimer(0)
+	<-flashTimer.C
+	isQuietNow := false
+
+	// Set the timer for the next of the user's states to end by itself.
+	resetCustomStateTimer := func() {
+		if !customStateTimer.Stop() {
+			select {
+			case <-customStateTimer.C:
+			default:
+			}
+		}
+		if next, pending := customStates.nextExpiry(); pending {
+			customStateTimer.Reset(time.Until(next))
+		}
+	}
+
+	// Poll the calendars in the background, so a slow calendar service doesn't
+	// hold everything else up; the results come back to the main loop on
+	// calendarPolls. Only one poll is under way at a time (if we're asked for
+	// another meanwhile, we start it when the first one is done).
+	type calendarPoll struct {
+		periods []BusyPeriod
+		err     error
 	}
+	calendarPolls := make(chan calendarPoll, 1)
+	pollContext, stopPolling := context.WithCancel(context.Background())
+	defer stopPolling()
+	isPolling := false
+	pollAgain := false
+	pollCalendar := func() {
+		if isPolling {
+			pollAgain = true
+			return
+		}
+		isPolling = true
+		pollConfig := pollingSettings(&config)
+		go func() {
+			periods, err := pollBusyPeriods(pollContext, pollConfig)
+			calendarPolls <- calendarPoll{periods: periods, err: err}
+		}()
+	}
+
+	// If a poll fails, try again sooner than usual (backing off if it keeps
+	// failing), and flash the "degraded" signal to let the user know.
+	pollFailures := 0 // (how many polls in a row have failed)
+	retryTimer := time.NewTimer(0)
+	<-retryTimer.C
+	if initialPollErr != nil {
+		pollFailures++
+		retryTimer.Reset(config.Polling.retryDelay(pollFailures))
+	}
+	calendarPolled := func(poll calendarPoll) {
+		retryTimer.Stop()
+		if poll.err != nil {
+			pollFailures++
+			delay := config.Polling.retryDelay(pollFailures)
+			config.logger.Printf("Reload failed: %v (trying again in %v)", poll.err, delay.Round(time.Second))
+			retryTimer.Reset(delay)
+			if ind.Active && !isQuietNow && snoozeUntil.IsZero() {
+				isFlashing = true
+				lightSignal(&config, "degraded", 0)
+				flashTimer.Stop()
+				flashTimer.Reset(flashLength(&config, "degraded", 2))
+			}
+			return
+		}
+		if pollFailures > 0 {
+			config.logger.Printf("Calendar polling is working again after %d failed attempt(s)", pollFailures)
+			pollFailures = 0
+		}
+		busyTimes.update(&config, poll.periods)
+	}
+
+	refreshCalendar := func() {
+		config.logger.Printf("Reloading calendar status by request")
+		pollCalendar()
+	}
+
+	// End a manual override early, removing it from the calendar if we'd put it there.
+	cancelOverride := func() {
+		if override.State == "" {
+			return
+		}
+		if !overrideTimer.Stop() {
+			select {
+			case <-overrideTimer.C:
+			default:
+			}
+		}
+		if override.OnCalendar {
+			writeBackOverride(&config, calendarWrite{})
+		}
+		override = manualOverride{}
+	}
+
+	//
+	// Let everyone interested know whenever our overall state changes.
+	//
+	currentState := ""
+	cause := "startup"
+	reportState := func(state string) {
+		previous := config.events.Current()
+		auto := sources.combined()
+		status := DaemonStatus{
+			State:          state,
+			Description:    describeState(&config, state),
+			Since:          time.Now(),
+			Active:         ind.Active,
+			BusyNow:        ind.BusyTime,
+			Zoom:           ind.Zoom || auto.InCall,
+			Muted:          (ind.Zoom && ind.ZoomMuted) || (!ind.Zoom && auto.InCall && !auto.MicOpen),
+			Urgent:         ind.Urgent || auto.Urgent,
+			LowPriority:    ind.LowPriority || auto.LowPriority,
+			Waiting:        isWaiting,
+			OnCall:         auto.OnCall,
+			Stale:          busyTimes.Stale,
+			Quiet:          isQuietNow,
+			Snoozing:       !snoozeUntil.IsZero(),
+			NextTransition: nextTransitionTime,
+			LastPoll:       busyTimes.LastPollTime,
+			Light:          lightHealth(&config),
+		}
+		if state == forced.State {
+			status.Until = forced.Until
+		} else if state == override.State {
+			status.Until = override.Until
+		} else if until, isCustom := customStates[state]; isCustom {
+			status.Until = until
+		}
+		if state == currentState && status.LowPriority == previous.LowPriority && status.Waiting == previous.Waiting &&
+			status.OnCall == previous.OnCall && status.Stale == previous.Stale && status.Until.Equal(previous.Until) {
+			status.Since = previous.Since
+			config.events.Refresh(status)
+			return
+		}
+		if state == currentState {
+			status.Since = previous.Since
+		}
+		config.events.Publish(&config, StateEvent{Previous: currentState, Cause: cause, Status: status})
+		currentState = state
+	}
+
+	//
+	// Show our state on the light, or the whole household's if we're
+	// combining our state with other people's.
+	//
+	var householdTicker <-chan time.Time
+	if config.Household.Enabled {
+		householdTicker = time.NewTicker(time.Minute).C
+	}
+	showState := func(state string) {
+		lowPriority := ind.lowPriority(sources.combined())
+		if config.Household.Enabled && ind.Active {
+			state, lowPriority = config.Household.combine(config.events.Current(), config.peers.List())
+		}
+		displayState(&config, state, lowPriority)
+	}
+
+	initialState := "free"
+	if ind.BusyTime {
+		initialState = "busy"
+	}
+	reportState(initialState)
+	showState(initialState)
 
 	// We will keep a timer for refreshing the calendar and one for transitioning
 	// to the next free/busy state
-	refreshTimer := time.NewTicker(time.Hour * 1)
+	refreshTimer := time.NewTicker(config.Polling.interval())
+
+	// Go to sleep (turning off the light and calendar polling) or wake up again.
+	setActive := func(active bool) {
+		ind.Active = active
+		if ind.Active {
+			config.logger.Printf("Activating service; re-loading configuration and opening serial port")
+			if err = checkConfigFile(&config); err != nil {
+				config.logger.Printf("ERROR: Not re-loading configuration (carrying on with what we had): %v", err)
+				openDevice(&config)
+			} else if err = setup(&config); err != nil {
+				config.logger.Printf("ERROR: Unable to re-load configuration: %v", err)
+			}
+			config.logger.Printf("Activating service; getting fresh calendar data")
+			pollCalendar()
+			config.logger.Printf("Resetting timers")
+			refreshTimer.Reset(config.Polling.interval())
+			ind.BusyTime = busyTimes.ScheduledBusyNow(&config)
+			nextTransitionTime = busyTimes.NextTransitionTime(&config)
+			transitionTimer.Reset(time.Until(nextTransitionTime))
+		} else {
+			config.logger.Printf("Stopping timers")
+			refreshTimer.Stop()
+			retryTimer.Stop()
+			transitionTimer.Stop()
+			closeDevice(&config)
+			config.logger.Printf("Daemon in inactive state... zzz")
+		}
+	}
+
+	// Keep to the working hours, if there are any: wake up when they start,
+	// and go to sleep when they're over.
+	workTimer := time.NewTimer(0)
+	<-workTimer.C
+	var workChange time.Time // (when working hours next start or end)
+	resetWorkTimer := func() {
+		workTimer.Stop()
+		if _, workChange = workingHours(&config, time.Now()); !workChange.IsZero() {
+			workTimer.Reset(time.Until(workChange))
+		}
+	}
+	// Likewise, keep the light quiet during quiet hours.
+	quietTimer := time.NewTimer(0)
+	<-quietTimer.C
+	var quietChange time.Time // (when quiet hours next start or end)
+	resetQuietTimer := func() {
+		quietTimer.Stop()
+		if isQuietNow, quietChange = quietHours(&config, time.Now()); !quietChange.IsZero() {
+			quietTimer.Reset(time.Until(quietChange))
+		}
+	}
+	resetQuietTimer()
+	if isQuietNow {
+		lightSignal(&config, config.QuietHours.quietSignal(), 0)
+	}
+
+	if working, _ := workingHours(&config, time.Now()); !working {
+		config.logger.Printf("Outside working hours")
+		setActive(false)
+		reportState("off")
+	}
+	resetWorkTimer()
+
+	// Re-read the configuration file without otherwise changing what we're
+	// doing. We make sure it can be read first, so a mistake in it doesn't
+	// bring down a daemon that's been running happily.
+	reconfigure := func() string {
+		if err := checkConfigFile(&config); err != nil {
+			config.logger.Printf("ERROR: Not re-loading configuration: %v", err)
+			return fmt.Sprintf("Not re-loading configuration: %v", err)
+		}
+		if !ind.Active {
+			return "The configuration looks fine; it will be re-loaded when the daemon becomes active again."
+		}
+		config.logger.Printf("Re-loading configuration by request")
+		if err := setup(&config); err != nil {
+			config.logger.Printf("ERROR: Unable to re-load configuration: %v", err)
+			return fmt.Sprintf("Unable to re-load configuration: %v", err)
+		}
+		refreshCalendar()
+		refreshTimer.Reset(config.Polling.interval())
+		resetWorkTimer()
+		resetQuietTimer()
+		return "Configuration re-loaded"
+	}
+
+	// Set the timers again from the times they're meant to go off, after
+	// they've lost track (while the computer was asleep, they stood still;
+	// if the clock was set, they're off by as much). Any whose time has
+	// passed go off at once.
+	rearmTimers := func() {
+		if ind.Active {
+			ind.BusyTime = busyTimes.ScheduledBusyNow(&config)
+			nextTransitionTime = busyTimes.NextTransitionTime(&config)
+			rearmTimer(transitionTimer, nextTransitionTime)
+		}
+		rearmTimer(workTimer, workChange)
+		rearmTimer(quietTimer, quietChange)
+		rearmTimer(overrideTimer, override.Until)
+		rearmTimer(forceTimer, forced.Until)
+		rearmTimer(snoozeTimer, snoozeUntil)
+		resetCustomStateTimer()
+	}
 
 	//
 	// Main event loop:
 	// 	On incoming signals, indicate light status as requested by signaller
-	//  Otherwise, update Google calendar status hourly while active
+	//  Otherwise, update calendar status periodically while active
 	//	Update lights based on busy/free status when transition times arrive unless in Zoom
 	//
+	lightHealthTicker := time.NewTicker(15 * time.Second)
+	hotplugTimer := time.NewTimer(0) // (to check the light once devices have settled down)
+	<-hotplugTimer.C
+	var replyTo chan string // a control command waiting for our reply until we've updated the state
+	var replyText string
 eventLoop:
 	for {
 		select {
 		case _ = <-refreshTimer.C:
-			if isActiveNow {
+			cause = "calendar refresh"
+			if ind.Active {
 				config.logger.Printf("Periodic calendar refresh starts")
-				err = busyTimes.Refresh(&config)
-				if err != nil {
-					config.logger.Printf("Reload failed: %v", err)
-				}
-				isBusyTimeNow = busyTimes.ScheduledBusyNow(&config)
-				transitionTimer.Stop()
-				transitionTimer.Reset(time.Until(busyTimes.NextTransitionTime(&config)))
+				pollCalendar()
 			} else {
 				config.logger.Printf("Ignoring scheduled request to refresh calendar since service isn't active now.")
 				refreshTimer.Stop()
 			}
 
+		case <-retryTimer.C:
+			cause = "calendar retry"
+			if ind.Active {
+				config.logger.Printf("Trying the calendars again")
+				pollCalendar()
+			}
+
+		case poll := <-calendarPolls:
+			cause = "calendar refresh"
+			isPolling = false
+			calendarPolled(poll)
+			ind.BusyTime = busyTimes.ScheduledBusyNow(&config)
+			transitionTimer.Stop()
+			nextTransitionTime = busyTimes.NextTransitionTime(&config)
+			transitionTimer.Reset(time.Until(nextTransitionTime))
+			if pollAgain {
+				pollAgain = false
+				pollCalendar()
+			}
+
+		case <-config.peers.Changed():
+			cause = "peer"
+			if !config.Household.Enabled {
+				continue
+			}
+
+		case <-householdTicker:
+			cause = "peer"
+			// (check for household members who have silently gone away)
+
+		case <-lightHealthTicker.C:
+			if !checkLightHealth(&config) {
+				continue
+			}
+			cause = "light"
+
+		case <-config.hotplug:
+			hotplugTimer.Stop()
+			hotplugTimer.Reset(hotplugSettle)
+			continue
+
+		case found := <-config.lightsFound:
+			greet := !config.lightLost // (we were opening it afresh, not waiting for it to come back)
+			if !foundLight(&config, found) {
+				continue
+			}
+			if greet {
+				greetLight(&config)
+			}
+			cause = "light"
+
+		case <-hotplugTimer.C:
+			if !checkLightHealth(&config) {
+				continue
+			}
+			cause = "light"
+
+		case change := <-config.clockChanges:
+			switch {
+			case change.Jump > 0:
+				cause = "wake"
+				config.logger.Printf("Woke up after sleeping for about %v (or the clock was set forward)", change.Jump.Round(time.Minute))
+			case change.Jump < 0:
+				cause = "clock change"
+				config.logger.Printf("The clock was set back by about %v", (-change.Jump).Round(time.Minute))
+			}
+			if change.Location != nil {
+				config.zone.Store(change.Location)
+			}
+			if change.Zone != "" {
+				cause = "time zone change"
+				config.logger.Printf("The time zone is now %s", change.Zone)
+				busyTimes.inZone(localZone(&config))
+				if !workChange.IsZero() {
+					workChange = time.Now() // (to see whether we're in working hours now)
+				}
+			}
+			rearmTimers()
+			if change.Zone != "" {
+				resetQuietTimer()
+			}
+			if ind.Active {
+				config.logger.Printf("Getting fresh calendar data")
+				pollCalendar()
+				refreshTimer.Reset(config.Polling.interval())
+			}
+
+		case source := <-config.buttonPresses:
+			cause = "button"
+			if ind.Active {
+				acknowledgeButton(&config, source)
+			} else {
+				config.logger.Printf("Attention requested (button pressed on %s) while inactive", source)
+			}
+			isWaiting = true
+			waitingTimer.Stop()
+			waitingTimer.Reset(config.Button.waitingDuration())
+
+		case <-waitingTimer.C:
+			cause = "button timeout"
+			config.logger.Printf("No longer signalling that someone is waiting")
+			isWaiting = false
+
+		case update := <-config.sourceUpdates:
+			cause = update.Source
+			if update.Status != sources[update.Source] {
+				config.logger.Printf("Indicators from %s now %+v", update.Source, update.Status)
+			}
+			sources[update.Source] = update.Status
+
+		case claim := <-config.remoteLights:
+			cause = "remote light"
+			remoteLights.update(claim)
+
+		case doc := <-config.remoteConfigs:
+			cause = "reconfigure"
+			if settings, err := loadSettings(&config, doc); err != nil {
+				config.logger.Printf("ERROR: Not applying remote configuration (carrying on with what we had): %v", err)
+			} else {
+				config.remoteConfig = doc
+				useSettings(&config, settings)
+				config.logger.Printf("Applied remote configuration %s", config.RemoteConfig.URL)
+				resetWorkTimer()
+				resetQuietTimer()
+				resetCustomStateTimer()
+			}
+
+		case <-customStateTimer.C:
+			cause = "state timeout"
+			for _, name := range customStates.expire(time.Now()) {
+				config.logger.Printf("State %s is over", name)
+			}
+			resetCustomStateTimer()
+
+		case <-workTimer.C:
+			cause = "working hours"
+			if working, _ := workingHours(&config, time.Now()); working != ind.Active {
+				if working {
+					config.logger.Printf("Working hours are starting")
+				} else {
+					config.logger.Printf("Working hours are over")
+				}
+				setActive(working)
+			}
+			resetWorkTimer()
+
+		case <-quietTimer.C:
+			cause = "quiet hours"
+			resetQuietTimer()
+			if isQuietNow {
+				config.logger.Printf("Quiet hours are starting")
+			} else {
+				config.logger.Printf("Quiet hours are over")
+			}
+
+		case <-warningTimer.C:
+			cause = "meeting warning"
+
+		case <-snoozeTimer.C:
+			cause = "snooze over"
+			config.logger.Printf("Snooze is over")
+			snoozeUntil = time.Time{}
+
+		case <-flashTimer.C:
+			cause = "flash over"
+			isFlashing = false
+
+		case <-forceTimer.C:
+			cause = "force timeout"
+			config.logger.Printf("Forced %s period is over", forced.State)
+			forced = manualOverride{}
+
+		case <-overrideTimer.C:
+			cause = override.State + " timeout"
+			config.logger.Printf("Manual %s period is over", override.State)
+			override = manualOverride{}
+
+		case cmd := <-config.commands:
+			cause = "command from " + cmd.Source
+			config.logger.Printf("Command from %s: %v", cmd.Source, cmd.Words)
+			reply := "OK"
+			switch cmd.Words[0] {
+			case "status":
+				reply = statusSummary(&config, config.Name, config.events.Current())
+
+			case "mute":
+				ind.Zoom = true
+				ind.ZoomMuted = true
+
+			case "open":
+				ind.Zoom = true
+				ind.ZoomMuted = false
+
+			case "cal":
+				ind.Zoom = false
+
+			case "urgent":
+				if ind.Urgent, err = parseToggle(cmd.Words[1:], ind.Urgent); err != nil {
+					reply = err.Error()
+				} else {
+					reply = fmt.Sprintf("Urgent indicator is now %v", ind.Urgent)
+				}
+
+			case "lowpri":
+				if ind.LowPriority, err = parseToggle(cmd.Words[1:], ind.LowPriority); err != nil {
+					reply = err.Error()
+				} else {
+					reply = fmt.Sprintf("Low-priority indicator is now %v", ind.LowPriority)
+				}
+
+			case "dnd", "busy":
+				state := cmd.Words[0]
+				if len(cmd.Words) == 2 && cmd.Words[1] == "off" {
+					if override.State == state {
+						cancelOverride()
+					}
+					reply = fmt.Sprintf("%s is off", describeState(&config, state))
+				} else if until, err := parseOverrideEnd(&config, cmd.Words[1:]); err != nil {
+					reply = fmt.Sprintf("%v (usage: %s <time>|until <HH:MM>|off)", err, state)
+				} else {
+					cancelOverride()
+					override = manualOverride{State: state, Until: until}
+					overrideTimer.Reset(time.Until(until))
+					if config.CalendarWriteBack.Enabled {
+						override.OnCalendar = writeBackOverride(&config, calendarWrite{State: state, Until: until})
+					}
+					reply = fmt.Sprintf("%s until %s", describeState(&config, state), until.In(localZone(&config)).Format("15:04"))
+				}
+
+			case "off", "on":
+				if active := cmd.Words[0] == "on"; active != ind.Active {
+					setActive(active)
+				}
+				reply = "Light is now " + cmd.Words[0]
+
+			case "reload":
+				if ind.Active {
+					refreshCalendar()
+				} else {
+					reply = "Ignoring reload request since service isn't active now."
+				}
+
+			case "reconfigure":
+				reply = reconfigure()
+
+			case "state":
+				reply = customStates.command(&config, cmd.Words[1:])
+				resetCustomStateTimer()
+
+			case "force":
+				reply = forceCommand(&config, &forced, cmd.Words[1:])
+				forceTimer.Stop()
+				if forced.State != "" {
+					forceTimer.Reset(time.Until(forced.Until))
+				}
+
+			case "snooze":
+				reply = snoozeCommand(&config, &snoozeUntil, cmd.Words[1:])
+				snoozeTimer.Stop()
+				if !snoozeUntil.IsZero() {
+					snoozeTimer.Reset(time.Until(snoozeUntil))
+				}
+
+			case "flash":
+				if !ind.Active {
+					reply = "Not flashing the light since the service isn't active now."
+				} else if isQuietNow {
+					reply = "Not flashing the light during quiet hours."
+				} else if !snoozeUntil.IsZero() {
+					reply = "Not flashing the light while snoozing."
+				} else if signal, length, err := parseFlash(&config, cmd.Words[1:]); err != nil {
+					reply = err.Error()
+				} else {
+					isFlashing = true
+					lightSignal(&config, signal, 0)
+					flashTimer.Stop()
+					flashTimer.Reset(length)
+					reply = fmt.Sprintf("Flashing %s", signal)
+				}
+
+			default:
+				if _, isCustom := config.States[cmd.Words[0]]; isCustom {
+					reply = customStates.command(&config, cmd.Words)
+					resetCustomStateTimer()
+				} else {
+					reply = "Unknown command. " + commandHelp
+				}
+			}
+			replyTo, replyText = cmd.Reply, reply
+
 		case _ = <-transitionTimer.C:
+			cause = "calendar"
 			config.logger.Printf("Scheduled status change")
-			isBusyTimeNow = busyTimes.ScheduledBusyNow(&config)
-			transitionTimer.Reset(time.Until(busyTimes.NextTransitionTime(&config)))
+			ind.BusyTime = busyTimes.ScheduledBusyNow(&config)
+			nextTransitionTime = busyTimes.NextTransitionTime(&config)
+			transitionTimer.Reset(time.Until(nextTransitionTime))
 
 		case externalSignal := <-req:
-			switch externalSignal {
-			case syscall.SIGVTALRM:
-				isUrgent = !isUrgent
-				config.logger.Printf("Toggle URGENT indicator to %v", isUrgent)
+			cause = "signal " + signals.Name(externalSignal.(syscall.Signal))
+			switch signalActions[externalSignal] {
+			case signals.Urgent:
+				ind.Urgent = !ind.Urgent
+				config.logger.Printf("Toggle URGENT indicator to %v", ind.Urgent)
 
-			case syscall.SIGCHLD:
-				isLowPriority = !isLowPriority
-				config.logger.Printf("Toggle low-priority indicator to %v", isLowPriority)
+			case signals.LowPri:
+				ind.LowPriority = !ind.LowPriority
+				config.logger.Printf("Toggle low-priority indicator to %v", ind.LowPriority)
 
-			case syscall.SIGHUP:
+			case signals.Cal:
 				config.logger.Printf("ZOOM: Call ended")
-				isZoomNow = false
+				ind.Zoom = false
 
-			case syscall.SIGUSR1:
+			case signals.Mute:
 				config.logger.Printf("ZOOM: Muted")
-				isZoomNow = true
-				isZoomMuted = true
+				ind.Zoom = true
+				ind.ZoomMuted = true
 
-			case syscall.SIGUSR2:
+			case signals.Open:
 				config.logger.Printf("ZOOM: Unmuted")
-				isZoomNow = true
-				isZoomMuted = false
+				ind.Zoom = true
+				ind.ZoomMuted = false
 
-			case syscall.SIGWINCH:
+			case signals.Zzz:
 				config.logger.Printf("Toggle active state")
-				isActiveNow = !isActiveNow
-				if isActiveNow {
-					config.logger.Printf("Activating service; re-loading configuration and opening serial port")
-					err = setup(&config)
-					if err != nil {
-						config.logger.Fatalf("Error loading configuration data. Unable to restart: %v", err)
-						return
-					}
-					config.logger.Printf("Activating service; getting fresh calendar data")
-					err = busyTimes.Refresh(&config)
-					if err != nil {
-						config.logger.Printf("Error updating busy/free times from calendar: %v", err)
-					}
-					config.logger.Printf("Resetting timers")
-					refreshTimer.Reset(1 * time.Hour)
-					isBusyTimeNow = busyTimes.ScheduledBusyNow(&config)
-					transitionTimer.Reset(time.Until(busyTimes.NextTransitionTime(&config)))
-				} else {
-					config.logger.Printf("Stopping timers")
-					refreshTimer.Stop()
-					transitionTimer.Stop()
-					closeDevice(&config)
-					config.logger.Printf("Daemon in inactive state... zzz")
-				}
+				setActive(!ind.Active)
 
-			case syscall.SIGINFO:
-				if isActiveNow {
-					config.logger.Printf("Reloading calendar status by request")
-					err = busyTimes.Refresh(&config)
-					if err != nil {
-						config.logger.Printf("Reload failed: %v", err)
-					}
-					isBusyTimeNow = busyTimes.ScheduledBusyNow(&config)
-					transitionTimer.Stop()
-					transitionTimer.Reset(time.Until(busyTimes.NextTransitionTime(&config)))
+			case signals.Reload:
+				if ind.Active {
+					refreshCalendar()
 				} else {
 					config.logger.Printf("Ignoring reload request since service isn't active now.")
 				}
 
-			case syscall.SIGINT:
-				config.logger.Printf("Received interrupt signal")
+			case signals.Reconfigure:
+				reconfigure()
+
+			case signals.Kill:
+				config.logger.Printf("Received SIG%s; shutting down", signals.Name(externalSignal.(syscall.Signal)))
 				break eventLoop
 
 			default:
@@ -642,30 +1809,42 @@ eventLoop:
 		}
 
 		// Set signal to current state
-		if isActiveNow {
-			if isUrgent {
-				lightSignal(&config, "urgent", 0)
-			} else if isZoomNow {
-				if isZoomMuted {
-					lightSignal(&config, "red", 0)
-					config.logger.Printf("Signal ZOOM MUTED")
-				} else {
-					lightSignal(&config, "redflash", 0)
-					config.logger.Printf("Signal ZOOM OPEN")
-				}
-			} else if isBusyTimeNow {
-				lightSignal(&config, "yellow", 0)
-				config.logger.Printf("Signal BUSY")
-			} else {
-				lightSignal(&config, "green", 0)
-				config.logger.Printf("Signal FREE")
+		in := stateInputs{
+			indicators: ind,
+			Auto:       sources.combined(),
+			Force:      forced.State,
+			Override:   override.State,
+			Quiet:      isQuietNow,
+			Snoozing:   !snoozeUntil.IsZero(),
+			Flashing:   isFlashing,
+		}
+		if ind.Active {
+			if ind.BusyTime {
+				in.Calendar = busyTimes.ScheduledState(&config)
 			}
-			if isLowPriority {
-				lightSignal(&config, "lowpri", 0)
+			warningTimer.Stop()
+			var warnAt time.Time
+			if in.Warning, warnAt = meetingWarning(&config, &busyTimes); !warnAt.IsZero() {
+				warningTimer.Reset(time.Until(warnAt))
 			}
-		} else {
-			lightSignal(&config, "off", 0)
-			config.logger.Printf("Signal off")
+			for name := range customStates {
+				if _, stillDefined := config.States[name]; stillDefined {
+					in.Custom = append(in.Custom, name)
+				}
+			}
+		}
+		newState := resolveState(&config, in)
+		in.Remote = remoteLights.showing(&config, newState)
+		reportState(newState)
+		if display := resolveDisplay(&config, in); display.Signal != "" {
+			showLightSignal(&config, display.Signal)
+		} else if !display.Hold {
+			showState(newState)
+		}
+		config.dashboard.update(&config, busyTimes.UpcomingPeriods)
+		if replyTo != nil {
+			replyTo <- replyText
+			replyTo = nil
 		}
 	}
 }
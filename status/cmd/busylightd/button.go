@@ -0,0 +1,115 @@
+//
+// Attention-request button.
+//
+// A visitor outside the door can press a button to let us know they're
+// waiting. The button may be wired to the busylight hardware itself (which
+// then sends us a byte over the serial port; see serialLight.listen), or to a GPIO pin on machines
+// such as a Raspberry Pi. Either way, the press is passed along to the main
+// event loop, which acknowledges it on the light, raises a desktop
+// notification, and sets the "someone is waiting" flag for a while.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ButtonConfigData describes the attention-request button, if there is one.
+type ButtonConfigData struct {
+	// The character the light hardware sends over the serial port when its button is pressed.
+	// The standard firmware sends "P". If empty, we don't listen to the serial port.
+	SerialCode string
+
+	// For a button wired to a GPIO pin, the sysfs file holding the pin's value
+	// (e.g., "/sys/class/gpio/gpio17/value").
+	GPIOValueFile string
+
+	// If true, the GPIO pin reads 0 when the button is pressed.
+	ActiveLow bool
+
+	// The command to run to raise a desktop notification. If not given, a suitable
+	// default for the operating system is used.
+	NotifyCommand []string
+
+	// How long the "someone is waiting" flag stays set after the button is pressed.
+	// Defaults to 10 minutes.
+	WaitingMinutes int
+}
+
+// waitingDuration returns how long the "someone is waiting" flag should stay set.
+func (b ButtonConfigData) waitingDuration() time.Duration {
+	if b.WaitingMinutes <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(b.WaitingMinutes) * time.Minute
+}
+
+// notifyCommand returns the command used to raise a desktop notification.
+func (b ButtonConfigData) notifyCommand(message string) []string {
+	if len(b.NotifyCommand) > 0 {
+		return append(append([]string{}, b.NotifyCommand...), message)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"osascript", "-e", "display notification \"" + message + "\" with title \"busylight\" sound name \"Glass\""}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return []string{"notify-send", "--urgency=critical", "busylight", message}
+	}
+	return nil
+}
+
+// pressButton tells the main event loop that the button was pressed.
+func pressButton(config *ConfigData, source string) {
+	select {
+	case config.buttonPresses <- source:
+	default:
+		// there's already a press waiting to be handled
+	}
+}
+
+// watchGPIOButton polls a GPIO pin for button presses for the life of the daemon.
+func watchGPIOButton(config *ConfigData, valueFile string, activeLow bool) {
+	wasPressed := false
+	for {
+		time.Sleep(50 * time.Millisecond)
+		value, err := ioutil.ReadFile(valueFile)
+		if err != nil {
+			config.logger.Printf("ERROR: Unable to read button GPIO %s (giving up): %v", valueFile, err)
+			return
+		}
+		pressed := strings.TrimSpace(string(value)) == "1"
+		if activeLow {
+			pressed = !pressed
+		}
+		if pressed && !wasPressed {
+			pressButton(config, "GPIO")
+		}
+		wasPressed = pressed
+	}
+}
+
+// startButtons begins watching the GPIO button, if there is one. (Watching for
+// serial button presses starts whenever we open the serial port.)
+func startButtons(config *ConfigData) {
+	if config.Button.GPIOValueFile != "" {
+		go watchGPIOButton(config, config.Button.GPIOValueFile, config.Button.ActiveLow)
+	}
+}
+
+// acknowledgeButton flashes the light to show the visitor we got their request,
+// and lets the user know someone is waiting.
+func acknowledgeButton(config *ConfigData, source string) {
+	config.logger.Printf("Attention requested (button pressed on %s)", source)
+	for i := 0; i < 3; i++ {
+		lightSignal(config, "blue", 150*time.Millisecond)
+		lightSignal(config, "off", 100*time.Millisecond)
+	}
+	config.children.start(config, "button notification", config.Button.notifyCommand("Someone is waiting at the door"), nil)
+}
@@ -0,0 +1,70 @@
+//
+// Keeping the busy schedule across restarts.
+//
+// If CalendarCacheFile is set, we save what we find each time we poll the
+// calendars there. Then if we can't reach the calendars when the daemon
+// starts (say, the network isn't up yet when the machine boots), we can
+// go by the schedule we saved last time rather than assuming there's
+// nothing on it. The status says the schedule is stale until we manage to
+// poll the calendars again.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// calendarCache is what we save in the CalendarCacheFile.
+type calendarCache struct {
+	LastPollTime    time.Time
+	UpcomingPeriods []BusyPeriod
+}
+
+// saveCache saves the busy schedule to the CalendarCacheFile, if there is one.
+func (cal *CalendarAvailability) saveCache(config *ConfigData) {
+	if config.CalendarCacheFile == "" {
+		return
+	}
+	data, err := json.Marshal(calendarCache{LastPollTime: cal.LastPollTime, UpcomingPeriods: cal.UpcomingPeriods})
+	if err != nil {
+		config.logger.Printf("ERROR: Unable to save calendar data: %v", err)
+		return
+	}
+	temp := config.CalendarCacheFile + ".new"
+	if err = ioutil.WriteFile(temp, data, 0600); err == nil {
+		err = os.Rename(temp, config.CalendarCacheFile)
+	}
+	if err != nil {
+		config.logger.Printf("ERROR: Unable to save calendar data to %s: %v", config.CalendarCacheFile, err)
+		os.Remove(temp)
+	}
+}
+
+// loadCache reads the busy schedule saved in the CalendarCacheFile, marking
+// it stale. Periods which are over by now are left out.
+func (cal *CalendarAvailability) loadCache(config *ConfigData) error {
+	data, err := ioutil.ReadFile(config.CalendarCacheFile)
+	if err != nil {
+		return err
+	}
+	var cache calendarCache
+	if err = json.Unmarshal(data, &cache); err != nil {
+		return err
+	}
+	cal.LastPollTime = cache.LastPollTime
+	cal.UpcomingPeriods = nil
+	for _, period := range cache.UpcomingPeriods {
+		if period.End.After(time.Now()) {
+			cal.UpcomingPeriods = append(cal.UpcomingPeriods, period)
+		}
+	}
+	cal.Stale = true
+	return nil
+}
@@ -0,0 +1,192 @@
+//
+// Noticing calls by watching the camera and microphone.
+//
+// Rather than relying on a script that knows how to ask one particular
+// video-call app whether it's in a meeting, we can simply notice when any
+// app is using the camera or microphone, and take that to mean we're in a
+// call: with the microphone open if it's in use, or muted if only the camera
+// is. (Anything set explicitly with the mute/open/cal signals or commands
+// takes precedence.)
+//
+// On macOS, we follow the system log messages which drive the camera and
+// microphone indicators in the menu bar. On Linux, we look for processes
+// with a /dev/video* device open, and ask PulseAudio (or PipeWire's
+// PulseAudio server) whether anything is recording.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// CallDetectionConfigData controls noticing calls from camera and microphone use.
+type CallDetectionConfigData struct {
+	Enabled     bool
+	IgnoreApps  []string // apps (macOS bundle IDs or Linux program names) whose use of the camera or microphone doesn't count
+	PollSeconds int      // how often to check, on Linux (default 5)
+}
+
+// mediaUse is which apps are using the camera and microphone.
+type mediaUse struct {
+	Camera     []string
+	Microphone []string
+}
+
+// status turns media use into what we report to the event loop, leaving out
+// any apps we've been told to ignore.
+func (u mediaUse) status(ignore []string) sourceStatus {
+	counts := func(apps []string) bool {
+	nextApp:
+		for _, app := range apps {
+			for _, ignored := range ignore {
+				if app == ignored {
+					continue nextApp
+				}
+			}
+			return true
+		}
+		return false
+	}
+	camera, mic := counts(u.Camera), counts(u.Microphone)
+	return sourceStatus{InCall: camera || mic, MicOpen: mic}
+}
+
+// macSensorAttribution picks out the apps in the log messages which update
+// the menu bar's camera and microphone indicators, e.g.
+//
+//	Active activity attributions changed to ["cam:us.zoom.xos", "mic:us.zoom.xos"]
+var macSensorAttribution = regexp.MustCompile(`\b(cam|mic):([^\s",\]]+)`)
+
+// watchMacMediaUse follows the system log for changes in camera and microphone use.
+func watchMacMediaUse(config *ConfigData, report func(mediaUse)) {
+	argv := []string{"log", "stream", "--style", "ndjson", "--predicate",
+		`subsystem == "com.apple.controlcenter" AND category == "sensor-indicators"`}
+	for {
+		err := config.children.watch(argv, func(stdout io.Reader) {
+			scanner := bufio.NewScanner(stdout)
+			for scanner.Scan() {
+				var entry struct {
+					EventMessage string `json:"eventMessage"`
+				}
+				if json.Unmarshal(scanner.Bytes(), &entry) != nil || !strings.Contains(entry.EventMessage, "attributions") {
+					continue
+				}
+				var use mediaUse
+				for _, match := range macSensorAttribution.FindAllStringSubmatch(entry.EventMessage, -1) {
+					if match[1] == "cam" {
+						use.Camera = append(use.Camera, match[2])
+					} else {
+						use.Microphone = append(use.Microphone, match[2])
+					}
+				}
+				report(use)
+			}
+		})
+		config.logger.Printf("ERROR: Stopped following the system log for camera and microphone use (will try again): %v", err)
+		time.Sleep(time.Minute)
+	}
+}
+
+// linuxCameraUse finds the processes (which we can see) that have a video device open.
+func linuxCameraUse() []string {
+	var apps []string
+	fdDirs, _ := filepath.Glob("/proc/[0-9]*/fd")
+	for _, fdDir := range fdDirs {
+		fds, err := ioutil.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err == nil && strings.HasPrefix(target, "/dev/video") {
+				name, _ := ioutil.ReadFile(filepath.Join(filepath.Dir(fdDir), "comm"))
+				apps = append(apps, strings.TrimSpace(string(name)))
+				break
+			}
+		}
+	}
+	return apps
+}
+
+// pulseRecordingApp picks the program names out of "pactl list source-outputs".
+var pulseRecordingApp = regexp.MustCompile(`(?m)^\s*application\.process\.binary = "([^"]*)"`)
+
+// linuxMicrophoneUse asks PulseAudio which programs are recording.
+func linuxMicrophoneUse(config *ConfigData) ([]string, error) {
+	output, err := config.children.output("pactl", "list", "source-outputs")
+	if err != nil {
+		return nil, err
+	}
+	var apps []string
+	for _, match := range pulseRecordingApp.FindAllStringSubmatch(string(output), -1) {
+		apps = append(apps, match[1])
+	}
+	if len(apps) == 0 && strings.Contains(string(output), "Source Output #") {
+		apps = append(apps, "unknown") // (recording, but not telling us who)
+	}
+	return apps, nil
+}
+
+// watchLinuxMediaUse polls for camera and microphone use.
+func watchLinuxMediaUse(config *ConfigData, report func(mediaUse)) {
+	interval := time.Duration(currentSettings(config).CallDetection.PollSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	pulseWorking := true
+	for {
+		use := mediaUse{Camera: linuxCameraUse()}
+		mic, err := linuxMicrophoneUse(config)
+		if err != nil {
+			if pulseWorking {
+				config.logger.Printf("ERROR: Unable to ask PulseAudio about microphone use: %v", err)
+			}
+		} else if !pulseWorking {
+			config.logger.Printf("PulseAudio is answering again")
+		}
+		pulseWorking = err == nil
+		use.Microphone = mic
+		report(use)
+		time.Sleep(interval)
+	}
+}
+
+// startCallDetection begins watching for camera and microphone use, if enabled.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startCallDetection(config *ConfigData) {
+	settings := config.CallDetection
+	if !settings.Enabled {
+		return
+	}
+
+	var previous sourceStatus
+	report := func(use mediaUse) {
+		status := use.status(settings.IgnoreApps)
+		if status != previous {
+			config.logger.Printf("Camera in use by %v; microphone in use by %v", use.Camera, use.Microphone)
+			reportSource(config, "camera/microphone", status)
+			previous = status
+		}
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		go watchMacMediaUse(config, report)
+	case "linux":
+		go watchLinuxMediaUse(config, report)
+	default:
+		config.logger.Printf("ERROR: Call detection isn't supported on %s", runtime.GOOS)
+	}
+}
@@ -0,0 +1,340 @@
+//
+// Chat room status bots for busylightd.
+//
+// These connect to a Matrix room, an IRC channel, and/or a Discord server
+// (see discord.go), announce significant changes in our state as they come
+// across the event bus, and answer "!status" queries from other people in
+// the room.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MatrixConfigData describes the Matrix room we report our status to.
+type MatrixConfigData struct {
+	Homeserver  string // base URL of the homeserver, e.g. "https://matrix.org"
+	AccessToken string // access token for the bot's account
+	Room        string // room ID, e.g. "!abcdefg:matrix.org"
+}
+
+// IRCConfigData describes the IRC channel we report our status to.
+type IRCConfigData struct {
+	Server   string // host:port of the IRC server
+	TLS      bool   // connect using TLS?
+	Nick     string // nickname for the bot
+	Password string // server password, if required
+	Channel  string // channel to join, e.g. "#office"
+}
+
+// ChatConfigData holds the configuration for all of the chat bots.
+type ChatConfigData struct {
+	Matrix  MatrixConfigData
+	IRC     IRCConfigData
+	Discord DiscordConfigData
+
+	// The list of states which are announced to the room when we enter them.
+	// If empty, all state changes are announced.
+	AnnounceStates []string
+}
+
+// announces reports whether the chat configuration says to announce entering this state.
+func (c ChatConfigData) announces(state string) bool {
+	return stateSelected(c.AnnounceStates, state)
+}
+
+// statusSummary describes a status snapshot in a short sentence suitable for a chat message.
+func statusSummary(config *ConfigData, name string, status DaemonStatus) string {
+	summary := fmt.Sprintf("%s is now: %s (since %s)", name, status.Description, status.Since.In(localZone(config)).Format("15:04"))
+	if status.BusyNow && !status.NextTransition.IsZero() {
+		summary += fmt.Sprintf("; free at %s", status.NextTransition.In(localZone(config)).Format("15:04"))
+	}
+	if status.Stale {
+		summary += " (calendar data may be out of date)"
+	}
+	return summary
+}
+
+// chatQueryReply returns the reply to a chat message, or an empty string if the message isn't
+// a status query we can answer. We answer "!status" by itself or "!status <name>" for ourselves
+// or any peer we know about.
+func chatQueryReply(config *ConfigData, message string) string {
+	fields := strings.Fields(message)
+	if len(fields) == 0 || fields[0] != "!status" {
+		return ""
+	}
+	name := currentSettings(config).Name
+	if len(fields) > 1 && !strings.EqualFold(fields[1], name) {
+		// Maybe they're asking about someone else we know about.
+		if peer, known := config.peers.Get(fields[1]); known {
+			return statusSummary(config, peer.Name, peer.Summary())
+		}
+		return ""
+	}
+	return statusSummary(config, name, config.events.Current())
+}
+
+// startChatBots starts up whichever chat bots are configured.
+// Their settings are captured at startup; changing them requires a restart of the daemon.
+func startChatBots(config *ConfigData) {
+	chat := config.Chat
+	var announcers []func(string)
+
+	if chat.Matrix.Homeserver != "" && chat.Matrix.Room != "" {
+		bot := &matrixBot{settings: chat.Matrix, client: &http.Client{Timeout: 60 * time.Second}}
+		go bot.listen(config)
+		announcers = append(announcers, func(msg string) {
+			if err := bot.send(msg); err != nil {
+				config.logger.Printf("ERROR: Unable to send message to Matrix room %s: %v", bot.settings.Room, err)
+			}
+		})
+	}
+	if chat.IRC.Server != "" && chat.IRC.Channel != "" {
+		bot := &ircBot{settings: chat.IRC}
+		go bot.run(config)
+		announcers = append(announcers, bot.privmsg)
+	}
+	if chat.Discord.Token != "" {
+		bot := &discordBot{settings: chat.Discord, client: &http.Client{Timeout: 30 * time.Second}}
+		go bot.run(config)
+		if chat.Discord.Channel != "" {
+			announcers = append(announcers, func(msg string) {
+				if err := bot.send(msg); err != nil {
+					config.logger.Printf("ERROR: Unable to send message to Discord channel %s: %v", bot.settings.Channel, err)
+				}
+			})
+		}
+	}
+	if len(announcers) == 0 {
+		return
+	}
+
+	events := config.events.Subscribe()
+	go func() {
+		for event := range events {
+			if event.Status.State == event.Previous || !chat.announces(event.Status.State) {
+				continue
+			}
+			msg := statusSummary(config, currentSettings(config).Name, event.Status)
+			for _, announce := range announcers {
+				announce(msg)
+			}
+		}
+	}()
+}
+
+//
+// Matrix client-server API
+//
+
+type matrixBot struct {
+	settings MatrixConfigData
+	client   *http.Client
+	txnID    int64
+}
+
+// matrixSyncResponse holds the parts of a /sync response we care about.
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []struct {
+					Type    string `json:"type"`
+					Sender  string `json:"sender"`
+					Content struct {
+						MsgType string `json:"msgtype"`
+						Body    string `json:"body"`
+					} `json:"content"`
+				} `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+func (bot *matrixBot) request(method, path string, query url.Values, body interface{}, result interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	target := strings.TrimSuffix(bot.settings.Homeserver, "/") + path
+	if query != nil {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+bot.settings.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := bot.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("homeserver returned %s", resp.Status)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// send posts a text message to our room.
+func (bot *matrixBot) send(message string) error {
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/busylight-%d-%d",
+		url.PathEscape(bot.settings.Room), time.Now().Unix(), atomic.AddInt64(&bot.txnID, 1))
+	return bot.request(http.MethodPut, path, nil, map[string]string{"msgtype": "m.notice", "body": message}, nil)
+}
+
+// listen long-polls the homeserver for new messages in our room and answers status queries.
+func (bot *matrixBot) listen(config *ConfigData) {
+	filter := fmt.Sprintf(`{"room":{"rooms":[%q],"timeline":{"limit":20}}}`, bot.settings.Room)
+	since := ""
+	for {
+		query := url.Values{"filter": {filter}, "timeout": {"30000"}}
+		if since != "" {
+			query.Set("since", since)
+		}
+		var sync matrixSyncResponse
+		if err := bot.request(http.MethodGet, "/_matrix/client/v3/sync", query, nil, &sync); err != nil {
+			config.logger.Printf("ERROR: Matrix sync failed: %v (retrying in 1 minute)", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+		if since != "" {
+			// (the first sync just brings us up to date; we don't answer old messages)
+			for _, ev := range sync.Rooms.Join[bot.settings.Room].Timeline.Events {
+				if ev.Type != "m.room.message" || ev.Content.MsgType != "m.text" {
+					continue
+				}
+				if reply := chatQueryReply(config, ev.Content.Body); reply != "" {
+					if err := bot.send(reply); err != nil {
+						config.logger.Printf("ERROR: Unable to answer Matrix query from %s: %v", ev.Sender, err)
+					}
+				}
+			}
+		}
+		since = sync.NextBatch
+	}
+}
+
+//
+// IRC
+//
+
+type ircBot struct {
+	settings IRCConfigData
+	lock     sync.Mutex
+	conn     net.Conn // nil while disconnected
+}
+
+func (bot *ircBot) write(format string, a ...interface{}) error {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+	if bot.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	bot.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	_, err := fmt.Fprintf(bot.conn, format+"\r\n", a...)
+	return err
+}
+
+// privmsg sends a message to our channel. If we're not connected at the moment, it's just dropped.
+func (bot *ircBot) privmsg(message string) {
+	bot.write("PRIVMSG %s :%s", bot.settings.Channel, message)
+}
+
+// run connects to the server and stays connected for the life of the daemon.
+func (bot *ircBot) run(config *ConfigData) {
+	for {
+		err := bot.session(config)
+		config.logger.Printf("ERROR: IRC connection to %s lost: %v (reconnecting in 1 minute)", bot.settings.Server, err)
+		time.Sleep(time.Minute)
+	}
+}
+
+// session handles a single connection to the IRC server until it fails.
+func (bot *ircBot) session(config *ConfigData) error {
+	var conn net.Conn
+	var err error
+	if bot.settings.TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", bot.settings.Server, nil)
+	} else {
+		conn, err = net.DialTimeout("tcp", bot.settings.Server, 30*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+	bot.lock.Lock()
+	bot.conn = conn
+	bot.lock.Unlock()
+	defer func() {
+		bot.lock.Lock()
+		bot.conn.Close()
+		bot.conn = nil
+		bot.lock.Unlock()
+	}()
+
+	if bot.settings.Password != "" {
+		bot.write("PASS %s", bot.settings.Password)
+	}
+	bot.write("NICK %s", bot.settings.Nick)
+	bot.write("USER %s 0 * :busylight status bot", bot.settings.Nick)
+
+	input := bufio.NewScanner(conn)
+	for input.Scan() {
+		line := input.Text()
+		prefix := ""
+		if strings.HasPrefix(line, ":") {
+			if i := strings.Index(line, " "); i > 0 {
+				prefix, line = line[1:i], line[i+1:]
+			}
+		}
+		command, params := line, ""
+		if i := strings.Index(line, " "); i > 0 {
+			command, params = line[:i], line[i+1:]
+		}
+
+		switch command {
+		case "PING":
+			bot.write("PONG %s", params)
+
+		case "001":
+			config.logger.Printf("Connected to IRC server %s; joining %s", bot.settings.Server, bot.settings.Channel)
+			bot.write("JOIN %s", bot.settings.Channel)
+
+		case "PRIVMSG":
+			// params: <target> :<message>
+			if i := strings.Index(params, " :"); i > 0 && strings.EqualFold(params[:i], bot.settings.Channel) {
+				if reply := chatQueryReply(config, params[i+2:]); reply != "" {
+					config.logger.Printf("Answering IRC status query from %s", prefix)
+					bot.privmsg(reply)
+				}
+			}
+		}
+	}
+	if err = input.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("server closed connection")
+}
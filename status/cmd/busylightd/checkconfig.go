@@ -0,0 +1,167 @@
+//
+// Checking the configuration without starting the daemon.
+//
+// busylightd -check-config reads the configuration just as the daemon
+// would, and then makes sure the things it refers to are really there: the
+// credential and token files, the light, and so on. Everything found wrong
+// is reported, rather than stopping at the first problem, and nothing is
+// started (in particular, no PID file is written).
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/fizban-of-ragnarok/busylight/internal/configdir"
+	"github.com/fizban-of-ragnarok/busylight/internal/signals"
+)
+
+// checkConfig reports any problems with the configuration, returning true if there are none.
+func checkConfig(config *ConfigData) bool {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	configFile, err := configdir.ConfigFile(config.configFile)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return false
+	}
+	fmt.Printf("Checking %s...\n", configFile)
+	if err = getConfigFromFile(configFile, config); err != nil {
+		fmt.Printf("%v\n", err)
+		return false
+	}
+	if err = applyOverrides(config, config.overrides); err != nil {
+		problem("%v", err)
+	}
+	config.logger = log.New(os.Stdout, "", 0)
+	if config.RemoteConfig.URL != "" {
+		if doc, err := remoteConfigDocument(config, config.RemoteConfig); err != nil {
+			problem("%v", err)
+		} else if err = layRemoteConfig(config, doc); err != nil {
+			problem("%v", err)
+		} else if err = applyOverrides(config, config.overrides); err != nil {
+			problem("%v", err)
+		}
+	}
+	if err = checkSettings(config); err != nil {
+		problem("%v", err)
+	}
+
+	// (the Google credentials are only needed for Google calendars)
+	for _, calendar := range config.Calendars {
+		if calendar.Provider == "" || calendar.Provider == "google" {
+			if config.CredentialFile == "" {
+				problem("CredentialFile is needed for Google calendars, but isn't set")
+			} else if _, err := os.Stat(config.CredentialFile); err != nil {
+				problem("Can't read CredentialFile: %v", err)
+			}
+			if config.TokenFile == "" {
+				problem("TokenFile is needed for Google calendars, but isn't set")
+			} else if _, err := os.Stat(config.TokenFile); err != nil {
+				problem("Can't read TokenFile (run upcoming to get a token): %v", err)
+			}
+			break
+		}
+	}
+
+	if config.LogFile == "" {
+		problem("LogFile isn't set")
+	} else if config.LogFile != "-" {
+		if info, err := os.Stat(filepath.Dir(config.LogFile)); err != nil || !info.IsDir() {
+			problem("The directory for LogFile %s doesn't exist", config.LogFile)
+		}
+	}
+
+	daemonRunning := false
+	if config.PidFile == "" {
+		problem("PidFile isn't set")
+	} else if _, err := os.Stat(config.PidFile); err == nil {
+		problem("PID file %s already exists (is another busylightd running?)", config.PidFile)
+		daemonRunning = true
+	}
+
+	if _, err = signals.Table(config.Signals); err != nil {
+		problem("Unable to understand Signals setting: %v", err)
+	}
+
+	if (config.Driver == "" || config.Driver == "serial") && config.Device == "" {
+		if _, err = regexp.Compile(config.DeviceRegexp); err != nil {
+			problem("Unable to understand DeviceRegexp: %v", err)
+		}
+	}
+	if light, err := newLight(config); err != nil {
+		problem("%v", err)
+	} else if daemonRunning {
+		fmt.Printf("Not trying to open the light, since the daemon may be using it\n")
+	} else if err = light.Open(); err != nil {
+		problem("Unable to open the light: %v", err)
+	} else {
+		light.Close()
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("No problems found\n")
+		return true
+	}
+	for _, p := range problems {
+		fmt.Printf("PROBLEM: %s\n", p)
+	}
+	return false
+}
+
+// checkSettings makes sure the settings make sense in themselves, before we
+// act on them (at startup, on re-reading the configuration, and for
+// -check-config).
+func checkSettings(config *ConfigData) error {
+	if err := checkCustomStates(config); err != nil {
+		return err
+	}
+	if err := checkLightSignals(config); err != nil {
+		return err
+	}
+	if err := checkSchedule("WorkingHours", config.WorkingHours); err != nil {
+		return err
+	}
+	if err := checkQuietHours(config); err != nil {
+		return err
+	}
+	if err := checkEventRules(config); err != nil {
+		return err
+	}
+	if err := checkPolling(config); err != nil {
+		return err
+	}
+	if err := checkMeetDetection(config); err != nil {
+		return err
+	}
+	if err := checkAwayDetection(config); err != nil {
+		return err
+	}
+	if err := checkHTTP(config); err != nil {
+		return err
+	}
+	if err := checkHub(config); err != nil {
+		return err
+	}
+	if err := checkScopes(config); err != nil {
+		return err
+	}
+	if err := checkZoomWebhook(config); err != nil {
+		return err
+	}
+	if err := checkRemoteLight(config); err != nil {
+		return err
+	}
+	return checkStatePriority(config)
+}
@@ -0,0 +1,61 @@
+//
+// Running external commands from the daemon.
+//
+// Each command is waited for (in the background, where it runs there), so
+// it's reaped when it exits and its failure, if any, is logged.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// childProcesses runs the external commands we need.
+type childProcesses struct{}
+
+// start runs a command in the background. The description is used in log messages.
+// Any additional environment variables given are added to our own environment.
+func (c *childProcesses) start(config *ConfigData, description string, argv []string, env []string) {
+	if len(argv) == 0 {
+		return
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if err := cmd.Start(); err != nil {
+		config.logger.Printf("ERROR: Unable to run %s (%s): %v", description, argv[0], err)
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			config.logger.Printf("ERROR: %s (%s) failed: %v", description, argv[0], err)
+		}
+	}()
+}
+
+// output runs a command and returns its standard output.
+func (c *childProcesses) output(argv ...string) ([]byte, error) {
+	return exec.Command(argv[0], argv[1:]...).Output()
+}
+
+// watch runs a long-lived command, passing its standard output to handle, and
+// returns when it exits.
+func (c *childProcesses) watch(argv []string, handle func(io.Reader)) error {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	handle(stdout)
+	return cmd.Wait()
+}
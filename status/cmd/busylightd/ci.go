@@ -0,0 +1,192 @@
+//
+// CI build status.
+//
+// We can watch the latest CI build on some branches (GitHub Actions or GitLab
+// CI) and reflect its status on the light, so a broken main branch literally
+// glows on the desk. By default a failed build adds the low-priority
+// indicator until the branch is fixed, but any of the build states
+// (running, failed, or passed) may be shown as either the low-priority
+// indicator or the urgent state.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CIBranch identifies a branch whose builds we watch.
+type CIBranch struct {
+	Provider string // "github" or "gitlab"
+	Repo     string // "owner/name" (GitHub) or project path or ID (GitLab)
+	Branch   string // branch to watch (default "main")
+	Workflow string // GitHub only: just watch this workflow (file name or ID)
+	Token    string // API token, if needed to see the builds
+	BaseURL  string // GitLab only: URL of a self-hosted server (default "https://gitlab.com")
+}
+
+// CIConfigData controls watching CI builds.
+type CIConfigData struct {
+	Branches    []CIBranch
+	PollSeconds int // how often to check (default 300)
+
+	// Maps build states ("running", "failed", "passed") to "urgent" or "lowpri".
+	// Builds in any other state don't affect the light. If omitted,
+	// defaultCIIndicators is used.
+	Indicators map[string]string
+}
+
+var defaultCIIndicators = map[string]string{
+	"failed": "lowpri",
+}
+
+// ciGet fetches a JSON document from a CI provider's API.
+func ciGet(client *http.Client, endpoint string, headers map[string]string, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// buildState finds out whether the latest build on a branch is running, failed, or passed.
+// An empty string means there's no build or it's in some other state (such as cancelled).
+func (b CIBranch) buildState(client *http.Client) (string, error) {
+	branch := b.Branch
+	if branch == "" {
+		branch = "main"
+	}
+
+	switch strings.ToLower(b.Provider) {
+	case "github":
+		endpoint := "https://api.github.com/repos/" + b.Repo + "/actions/runs"
+		if b.Workflow != "" {
+			endpoint = "https://api.github.com/repos/" + b.Repo + "/actions/workflows/" + url.PathEscape(b.Workflow) + "/runs"
+		}
+		headers := map[string]string{"Accept": "application/vnd.github.v3+json"}
+		if b.Token != "" {
+			headers["Authorization"] = "token " + b.Token
+		}
+		var reply struct {
+			WorkflowRuns []struct {
+				Status     string `json:"status"`
+				Conclusion string `json:"conclusion"`
+			} `json:"workflow_runs"`
+		}
+		if err := ciGet(client, endpoint+"?"+url.Values{"branch": {branch}, "per_page": {"1"}}.Encode(), headers, &reply); err != nil {
+			return "", err
+		}
+		if len(reply.WorkflowRuns) == 0 {
+			return "", nil
+		}
+		run := reply.WorkflowRuns[0]
+		switch {
+		case run.Status != "completed":
+			return "running", nil
+		case run.Conclusion == "success":
+			return "passed", nil
+		case run.Conclusion == "failure" || run.Conclusion == "timed_out":
+			return "failed", nil
+		}
+		return "", nil
+
+	case "gitlab":
+		base := b.BaseURL
+		if base == "" {
+			base = "https://gitlab.com"
+		}
+		headers := map[string]string{}
+		if b.Token != "" {
+			headers["PRIVATE-TOKEN"] = b.Token
+		}
+		var pipelines []struct {
+			Status string `json:"status"`
+		}
+		endpoint := strings.TrimSuffix(base, "/") + "/api/v4/projects/" + url.PathEscape(b.Repo) + "/pipelines"
+		if err := ciGet(client, endpoint+"?"+url.Values{"ref": {branch}, "per_page": {"1"}}.Encode(), headers, &pipelines); err != nil {
+			return "", err
+		}
+		if len(pipelines) == 0 {
+			return "", nil
+		}
+		switch pipelines[0].Status {
+		case "created", "waiting_for_resource", "preparing", "pending", "running":
+			return "running", nil
+		case "success":
+			return "passed", nil
+		case "failed":
+			return "failed", nil
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown CI provider %q", b.Provider)
+}
+
+// startCIWatcher starts polling the configured branches' builds, reporting to the main
+// event loop whenever the indicators they call for change.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startCIWatcher(config *ConfigData) {
+	ci := config.CI
+	if len(ci.Branches) == 0 {
+		return
+	}
+	interval := 300 * time.Second
+	if ci.PollSeconds > 0 {
+		interval = time.Duration(ci.PollSeconds) * time.Second
+	}
+	indicators := ci.Indicators
+	if indicators == nil {
+		indicators = defaultCIIndicators
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	go func() {
+		var last sourceStatus
+		states := make([]string, len(ci.Branches))
+		for {
+			var status sourceStatus
+			for i, b := range ci.Branches {
+				state, err := b.buildState(client)
+				if err != nil {
+					// keep showing what we knew before
+					config.logger.Printf("ERROR: Unable to check CI builds for %s %s: %v", b.Repo, b.Branch, err)
+				} else {
+					if state != states[i] {
+						config.logger.Printf("CI build for %s %s is now %q", b.Repo, b.Branch, state)
+					}
+					states[i] = state
+				}
+				switch indicators[states[i]] {
+				case "urgent":
+					status.Urgent = true
+				case "lowpri":
+					status.LowPriority = true
+				}
+			}
+			if status != last {
+				reportSource(config, "ci", status)
+				last = status
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,159 @@
+//
+// Command-line and environment overrides for the configuration.
+//
+// Any setting in config.json may be overridden from the command line, with
+// -set Key=value (or one of the shorthand flags for the settings most often
+// changed, like -device), or from the environment, with BUSYLIGHT_KEY=value.
+// Settings inside objects are named with dots on the command line
+// (-set Hue.Bridge=10.0.0.2) and underscores in the environment
+// (BUSYLIGHT_HUE_BRIDGE=10.0.0.2). As in config.json, names are matched
+// without regard to case.
+//
+// Values are given as JSON (e.g., -set BaudRate=9600 or -set
+// 'CallDetection.IgnoreApps=["zoom"]'), except that strings may be given
+// without quotes. As in config.json, naming a setting we don't have is an
+// error, rather than being quietly ignored.
+//
+// Overrides are laid over config.json and any remote configuration, both
+// at startup and on every reload. The command line wins over the
+// environment.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// environmentPrefix starts the names of the environment variables we look at.
+const environmentPrefix = "BUSYLIGHT_"
+
+// reservedEnvironment are BUSYLIGHT_ variables which aren't configuration
+// overrides (including those we give our hooks; see hooks.go).
+var reservedEnvironment = []string{
+	"BUSYLIGHT_CONFIG", "BUSYLIGHT_HOOK", "BUSYLIGHT_OLD_STATE", "BUSYLIGHT_STATE", "BUSYLIGHT_CAUSE", "BUSYLIGHT_TIME",
+	"BUSYLIGHT_LOW_PRIORITY", "BUSYLIGHT_WAITING", "BUSYLIGHT_ON_CALL", "BUSYLIGHT_NEXT_TRANSITION",
+}
+
+// configOverride is one setting to override.
+type configOverride struct {
+	Key    []string // the setting's name, with the names of any objects it's in before it
+	Value  string
+	Source string // where it came from, for error messages
+}
+
+// configOverrides collects -set flags from the command line.
+type configOverrides []configOverride
+
+func (o *configOverrides) String() string {
+	var settings []string
+	for _, override := range *o {
+		settings = append(settings, strings.Join(override.Key, ".")+"="+override.Value)
+	}
+	return strings.Join(settings, " ")
+}
+
+func (o *configOverrides) Set(setting string) error {
+	equals := strings.Index(setting, "=")
+	if equals < 1 {
+		return fmt.Errorf("expected Key=value")
+	}
+	*o = append(*o, configOverride{
+		Key:    strings.Split(setting[:equals], "."),
+		Value:  setting[equals+1:],
+		Source: "-set " + setting[:equals],
+	})
+	return nil
+}
+
+// setting returns a flag.Value which overrides one particular setting, for the shorthand flags.
+func (o *configOverrides) setting(key string) *overrideFlag {
+	return &overrideFlag{overrides: o, key: key}
+}
+
+type overrideFlag struct {
+	overrides *configOverrides
+	key       string
+}
+
+func (f *overrideFlag) String() string {
+	return ""
+}
+
+func (f *overrideFlag) Set(value string) error {
+	return f.overrides.Set(f.key + "=" + value)
+}
+
+// environmentOverrides finds the overrides in our environment.
+func environmentOverrides() configOverrides {
+	var overrides configOverrides
+	environment := os.Environ()
+	sort.Strings(environment) // (so they're applied in a predictable order)
+	for _, variable := range environment {
+		equals := strings.Index(variable, "=")
+		name := variable[:equals]
+		if !strings.HasPrefix(strings.ToUpper(name), environmentPrefix) || containsFold(reservedEnvironment, name) || len(name) == len(environmentPrefix) {
+			continue
+		}
+		overrides = append(overrides, configOverride{
+			Key:    strings.Split(name[len(environmentPrefix):], "_"),
+			Value:  variable[equals+1:],
+			Source: name,
+		})
+	}
+	return overrides
+}
+
+// applyOverrides lays the overrides over the configuration.
+func applyOverrides(config *ConfigData, overrides configOverrides) error {
+	for _, override := range overrides {
+		// (a value which isn't valid JSON, or is but isn't the right type,
+		// may be a string given without quotes)
+		err := applyOverride(config, override.Key, override.Value)
+		if err != nil {
+			quotedErr := applyOverride(config, override.Key, strconv.Quote(override.Value))
+			if quotedErr == nil {
+				continue
+			}
+			if !json.Valid([]byte(override.Value)) {
+				err = quotedErr // (it can only have been meant as a string)
+			}
+			return fmt.Errorf("Unable to apply %s: %v", override.Source, err)
+		}
+	}
+	return nil
+}
+
+// applyOverride sets one configuration value from its JSON representation.
+// As in config.json, a setting we don't know is an error.
+func applyOverride(config *ConfigData, key []string, value string) error {
+	if !json.Valid([]byte(value)) {
+		return fmt.Errorf("%s is not a valid value", value)
+	}
+	doc := json.RawMessage(value)
+	for i := len(key) - 1; i >= 0; i-- {
+		wrapped, err := json.Marshal(map[string]json.RawMessage{key[i]: doc})
+		if err != nil {
+			return err
+		}
+		doc = wrapped
+	}
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		if name := strings.TrimPrefix(err.Error(), "json: unknown field "); name != err.Error() {
+			return fmt.Errorf("%s is not a setting (unknown field %s)", strings.Join(key, "."), name)
+		}
+		return err
+	}
+	return nil
+}
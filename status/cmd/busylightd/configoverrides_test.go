@@ -0,0 +1,92 @@
+//
+// Tests for overriding settings from the command line and environment.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     []string // as given to -set
+		setting func(*ConfigData) interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{"number", []string{"BaudRate=9600"}, func(c *ConfigData) interface{} { return c.BaudRate }, 9600, ""},
+		{"bare string", []string{"Device=/dev/ttyUSB0"}, func(c *ConfigData) interface{} { return c.Device }, "/dev/ttyUSB0", ""},
+		{"quoted string", []string{`Device="/dev/ttyUSB0"`}, func(c *ConfigData) interface{} { return c.Device }, "/dev/ttyUSB0", ""},
+		{"string which looks like a number", []string{"Name=1234"}, func(c *ConfigData) interface{} { return c.Name }, "1234", ""},
+		{"string which looks like JSON", []string{"Name=true"}, func(c *ConfigData) interface{} { return c.Name }, "true", ""},
+		{"empty string", []string{"Device="}, func(c *ConfigData) interface{} { return c.Device }, "", ""},
+		{"list", []string{`CallDetection.IgnoreApps=["zoom","obs"]`}, func(c *ConfigData) interface{} { return c.CallDetection.IgnoreApps }, []string{"zoom", "obs"}, ""},
+		{"inside an object", []string{"Hue.Bridge=10.0.0.2"}, func(c *ConfigData) interface{} { return c.Hue.Bridge }, "10.0.0.2", ""},
+		{"names without regard to case", []string{"hue.BRIDGE=10.0.0.2"}, func(c *ConfigData) interface{} { return c.Hue.Bridge }, "10.0.0.2", ""},
+		{"leaves the rest of the object alone", []string{"Hue.Bridge=10.0.0.2"}, func(c *ConfigData) interface{} { return c.Hue.Group }, "3", ""},
+		{"last one wins", []string{"BaudRate=9600", "BaudRate=19200"}, func(c *ConfigData) interface{} { return c.BaudRate }, 19200, ""},
+
+		{"not a number", []string{"BaudRate=fast"}, nil, nil, "Unable to apply -set BaudRate"},
+		{"wrong type of JSON", []string{"BaudRate=[1]"}, nil, nil, "Unable to apply -set BaudRate"},
+		{"unknown setting", []string{"NoSuchThing=1"}, nil, nil, "NoSuchThing is not a setting"},
+		{"unknown bare string setting", []string{"NoSuchThing=x"}, nil, nil, "NoSuchThing is not a setting"},
+		{"unknown setting inside an object", []string{"Hue.Colour=red"}, nil, nil, "Hue.Colour is not a setting"},
+	}
+
+	for _, test := range tests {
+		var overrides configOverrides
+		for _, setting := range test.set {
+			if err := overrides.Set(setting); err != nil {
+				t.Fatalf("%s: -set %s: %v", test.name, setting, err)
+			}
+		}
+		config := &ConfigData{}
+		config.Hue.Group = "3"
+		err := applyOverrides(config, overrides)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if got := test.setting(config); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOverrideSet(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    []string
+		valid   bool
+	}{
+		{"BaudRate=9600", []string{"BaudRate"}, true},
+		{"Hue.Bridge=a=b", []string{"Hue", "Bridge"}, true},
+		{"=9600", nil, false},
+		{"BaudRate", nil, false},
+	}
+
+	for _, test := range tests {
+		var overrides configOverrides
+		err := overrides.Set(test.setting)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid=%v", test.setting, err, test.valid)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(overrides[0].Key, test.want) {
+			t.Errorf("%s: got key %v, want %v", test.setting, overrides[0].Key, test.want)
+		}
+	}
+}
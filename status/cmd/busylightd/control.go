@@ -0,0 +1,149 @@
+//
+// Control commands for busylightd.
+//
+// Besides the signals we've always accepted, other control interfaces (a
+// Slack slash command, for example) can ask the main event loop to change
+// our state by sending it a command. Commands are simple words, much like
+// the options to the busylight CLI:
+//
+//    status            - just report our current status
+//    mute              - in a video call, muted
+//    open              - in a video call, unmuted
+//    cal               - out of the video call
+//    urgent [on|off]   - set (or toggle) the urgent indicator
+//    lowpri [on|off]   - set (or toggle) the low-priority indicator
+//    dnd <time>|off    - do not disturb for a while (e.g., "dnd 1h" or
+//                        "dnd until 15:30"), or stop
+//    busy <time>|off   - show as busy for a while, or stop
+//    off               - go inactive (like the busylight CLI's --zzz)
+//    on                - become active again
+//    reload            - refresh calendar data now
+//    reconfigure       - re-read the configuration file
+//    state <name> [<time>|off]
+//                      - turn one of the user's own states (see states.go)
+//                        on (for a while) or off; "<name> [<time>|off]"
+//                        works too, where it isn't another command
+//    flash [<signal>] [<times>]
+//                      - flash the light a few times to get our attention,
+//                        then go back to what it was showing
+//    snooze [<time>|off]
+//                      - show the SnoozeSignal (normally off) for a while
+//                        (e.g., "snooze 30m"), say how long is left, or
+//                        stop early
+//    force <state> <time>|off
+//                      - show any state (e.g., "force free 2h") for a
+//                        while, whatever else is going on, or stop
+//
+// For convenience, "zoom-muted" and "zoom-open" (the names of the states
+// they lead to) are accepted for mute and open, and "refresh" for reload.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// controlCommand is a request for the main event loop to do something.
+type controlCommand struct {
+	Words  []string    // the command and its arguments, e.g. ["dnd", "1h"]
+	Source string      // who sent it, for the log
+	Reply  chan string // the event loop's response
+}
+
+// commandUsages describes each of the available commands.
+var commandUsages = []string{
+	"status", "mute", "open", "cal", "urgent [on|off]", "lowpri [on|off]",
+	"dnd <time>|off", "busy <time>|off", "off", "on", "reload", "reconfigure",
+	"state <name> [<time>|off]", "flash [<signal>] [<times>]",
+	"snooze [<time>|off]", "force <state> <time>|off",
+}
+
+// commandHelp describes the available commands, for anyone who asks.
+var commandHelp = "commands: " + strings.Join(commandUsages, ", ")
+
+// commandNames lists the names of the available commands.
+func commandNames() []string {
+	var names []string
+	for _, usage := range commandUsages {
+		names = append(names, strings.Fields(usage)[0])
+	}
+	return names
+}
+
+// commandAliases are alternative names for some commands.
+var commandAliases = map[string]string{
+	"zoom-muted": "mute",
+	"zoom-open":  "open",
+	"refresh":    "reload",
+}
+
+// sendCommand passes a command to the main event loop and returns its reply.
+// If the event loop is too busy to answer within the given time, the command
+// is left for it to get to when it can.
+func sendCommand(config *ConfigData, source, text string, wait time.Duration) string {
+	words := commandWords(text)
+	if len(words) == 0 || words[0] == "help" {
+		return commandHelp
+	}
+	cmd := controlCommand{Words: words, Source: source, Reply: make(chan string, 1)}
+	select {
+	case config.commands <- cmd:
+	default:
+		return "Sorry, too many requests are waiting already. Try again in a moment."
+	}
+	select {
+	case reply := <-cmd.Reply:
+		return reply
+	case <-time.After(wait):
+		return "OK, I'll get to that as soon as I can."
+	}
+}
+
+// commandWords splits a command into its words, with the command's proper
+// name (rather than an alias) first.
+func commandWords(text string) []string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) > 0 {
+		if alias, isAlias := commandAliases[words[0]]; isAlias {
+			words[0] = alias
+		}
+	}
+	return words
+}
+
+// parseToggle interprets an optional on/off argument to a command.
+// With no argument, the setting is toggled from its current value.
+func parseToggle(args []string, current bool) (bool, error) {
+	if len(args) == 0 {
+		return !current, nil
+	}
+	switch args[0] {
+	case "on", "yes", "true", "1":
+		return true, nil
+	case "off", "no", "false", "0":
+		return false, nil
+	}
+	return current, fmt.Errorf("expected on or off, not %q", args[0])
+}
+
+// parseCommandDuration interprets a duration given to a command, such as "1h", "90m", or just "30" (minutes).
+func parseCommandDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if minutes, atoiErr := strconv.Atoi(s); atoiErr == nil {
+		d, err = time.Duration(minutes)*time.Minute, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("can't understand %q as a length of time", s)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("length of time must be positive")
+	}
+	return d, nil
+}
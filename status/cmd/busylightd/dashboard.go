@@ -0,0 +1,196 @@
+//
+// Web dashboard.
+//
+// A small page, served at /dashboard, for checking on the light from a
+// phone or another room and changing what it says: it shows the colors
+// the light is showing, whether we're in a call, and a timeline of the
+// day's busy periods, with buttons to override the state, snooze the
+// light, or refresh the calendars.
+//
+// The page itself has nothing to hide, but everything it shows or does
+// goes through the control API (see api.go), so it needs the API token.
+// Visit /dashboard#token=<token> once and the browser remembers it.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// dashboardData is what the dashboard shows.
+type dashboardData struct {
+	Status   DaemonStatus
+	Signal   string       // the light signal the light is showing (empty if we don't know)
+	Colors   []string     // the colors it's made of, e.g. ["#ff0000"]
+	Upcoming []BusyPeriod // the busy periods from the calendars
+}
+
+// dashboardSnapshot is the main loop's latest word on what the dashboard
+// shows besides our status, which the HTTP server can't look up for itself.
+type dashboardSnapshot struct {
+	lock     sync.Mutex
+	signal   string
+	colors   []string
+	upcoming []BusyPeriod
+}
+
+// update records what the light is showing and the busy periods ahead.
+func (d *dashboardSnapshot) update(config *ConfigData, periods []BusyPeriod) {
+	signal := strings.TrimSuffix(config.lastSignal, "+lowpri")
+	var colors []string
+	for _, step := range rgbSignalPatterns(config)[signal] {
+		color := fmt.Sprintf("#%02x%02x%02x", step.Color[0], step.Color[1], step.Color[2])
+		if len(colors) == 0 || colors[len(colors)-1] != color {
+			colors = append(colors, color)
+		}
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.signal = signal
+	d.colors = colors
+	d.upcoming = append([]BusyPeriod(nil), periods...)
+}
+
+// data returns what the dashboard shows.
+func (d *dashboardSnapshot) data(status DaemonStatus) dashboardData {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return dashboardData{Status: status, Signal: d.signal, Colors: d.colors, Upcoming: d.upcoming}
+}
+
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>busylight</title>
+<style>
+body { margin: 0; padding: 12px; font-family: sans-serif; font-size: 16px; max-width: 40em; }
+#top { display: flex; align-items: center; margin-bottom: 12px; }
+#lamp { width: 56px; height: 56px; border-radius: 50%; margin-right: 14px; background: #000; border: 2px solid #9e9e9e; }
+#desc { font-size: 22px; }
+#detail, #reply { color: #757575; }
+#error { color: #c62828; }
+#timeline { position: relative; height: 32px; background: #e8f5e9; margin: 12px 0 2px; border-radius: 4px; overflow: hidden; }
+#timeline div { position: absolute; top: 0; bottom: 0; background: #f9a825; }
+#timeline #now { background: #000; width: 2px; }
+#hours { display: flex; justify-content: space-between; color: #757575; font-size: 12px; }
+#periods { padding-left: 1.2em; }
+#buttons button { font-size: 16px; margin: 4px 4px 4px 0; padding: 8px 12px; }
+</style>
+</head>
+<body>
+<div id="top"><span id="lamp"></span><div><div id="desc">&nbsp;</div><div id="detail"></div></div></div>
+<div id="error"></div>
+<div id="reply"></div>
+<div id="timeline"></div>
+<div id="hours"></div>
+<ul id="periods"></ul>
+<div id="buttons">
+<button data-command="busy/30m">Busy 30m</button>
+<button data-command="dnd/30m">Do not disturb 30m</button>
+<button data-command="busy/off">Not busy</button>
+<button data-command="dnd/off">Disturb</button>
+<button data-command="urgent">Urgent</button>
+<button data-command="snooze/30m">Snooze 30m</button>
+<button data-command="snooze/off">Wake</button>
+<button data-command="reload">Refresh calendars</button>
+</div>
+<script>
+(function () {
+	var hours = 12;
+	var m = location.hash.match(/token=([^&]*)/);
+	if (m) {
+		localStorage.setItem("busylightToken", decodeURIComponent(m[1]));
+		history.replaceState(null, "", location.pathname);
+	}
+	var token = localStorage.getItem("busylightToken") || "";
+	function el(id) { return document.getElementById(id); }
+	function clock(t) { return new Date(t).toLocaleTimeString([], {hour: "2-digit", minute: "2-digit"}); }
+	function api(method, path) {
+		return fetch("api/" + path, {method: method, headers: {"Authorization": "Bearer " + token}}).then(function (r) {
+			if (!r.ok) { throw new Error(r.status == 401 ? "Not authorized: visit this page as dashboard#token=<your API token>" : r.statusText); }
+			return r.json();
+		});
+	}
+	var blink = null;
+	function show(d) {
+		var s = d.Status;
+		el("error").textContent = "";
+		el("desc").textContent = s.Description;
+		var detail = [];
+		if (s.Zoom) { detail.push(s.Muted ? "in a call (muted)" : "in a call (microphone open)"); }
+		if (s.Until && s.Until.indexOf("0001") != 0) { detail.push("until " + clock(s.Until)); }
+		if (s.Snoozing) { detail.push("light snoozing"); }
+		if (s.Quiet) { detail.push("quiet hours"); }
+		if (s.Light != "ok") { detail.push("light " + s.Light); }
+		el("detail").textContent = detail.join(", ");
+		clearInterval(blink);
+		var colors = d.Colors && d.Colors.length ? d.Colors : ["#000000"], i = 0;
+		el("lamp").style.background = colors[0];
+		if (colors.length > 1) {
+			blink = setInterval(function () { i = (i + 1) % colors.length; el("lamp").style.background = colors[i]; }, 500);
+		}
+
+		var now = Date.now(), end = now + hours * 3600000;
+		var timeline = el("timeline"), periods = el("periods");
+		timeline.innerHTML = "";
+		periods.innerHTML = "";
+		(d.Upcoming || []).forEach(function (p) {
+			var start = Date.parse(p.Start), stop = Date.parse(p.End);
+			if (stop <= now || start >= end) { return; }
+			var bar = document.createElement("div");
+			bar.style.left = (Math.max(start, now) - now) / (end - now) * 100 + "%";
+			bar.style.width = (Math.min(stop, end) - Math.max(start, now)) / (end - now) * 100 + "%";
+			bar.title = p.Title || p.State || "busy";
+			timeline.appendChild(bar);
+			var li = document.createElement("li");
+			li.textContent = clock(p.Start) + "–" + clock(p.End) + " " + (p.Title || p.State || "busy");
+			periods.appendChild(li);
+		});
+		var mark = document.createElement("div");
+		mark.id = "now";
+		timeline.appendChild(mark);
+		el("hours").innerHTML = "<span>now</span><span>+" + hours / 2 + "h</span><span>+" + hours + "h</span>";
+	}
+	function refresh() {
+		api("GET", "dashboard").then(show).catch(function (e) { el("error").textContent = e.message; });
+	}
+	Array.prototype.forEach.call(document.querySelectorAll("#buttons button"), function (b) {
+		b.onclick = function () {
+			api("POST", b.getAttribute("data-command")).then(function (r) {
+				el("reply").textContent = r.Reply;
+				refresh();
+			}).catch(function (e) { el("error").textContent = e.message; });
+		};
+	});
+	function listen() {
+		var ws = new WebSocket(location.href.replace(/^http/, "ws").replace(/dashboard.*$/, "api/events?token=" + encodeURIComponent(token)));
+		ws.onmessage = refresh;
+		ws.onclose = function () { setTimeout(listen, 10000); };
+	}
+	refresh();
+	listen();
+	setInterval(refresh, 60000);
+})();
+</script>
+</body>
+</html>
+`
+
+// dashboardPageHandler serves the dashboard page.
+func dashboardPageHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(w, dashboardPage)
+	}
+}
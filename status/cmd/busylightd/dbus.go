@@ -0,0 +1,250 @@
+//
+// Our status and controls on the D-Bus session bus.
+//
+// With DBus.Enabled set (on Linux, or anywhere else with a session bus),
+// we take the name org.madscience.Busylight on the user's session bus and
+// offer the object /org/madscience/Busylight there, so desktop extensions
+// and scripts can see our status as properties (with the usual
+// PropertiesChanged signal whenever it changes, plus our own StateChanged
+// signal) and control us with the same commands as the control socket:
+//
+//    busctl --user call org.madscience.Busylight /org/madscience/Busylight \
+//        org.madscience.Busylight Command s "dnd 30m"
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"time"
+
+	"github.com/fizban-of-ragnarok/busylight/internal/dbus"
+)
+
+// DBusConfigData controls offering our status and controls on the session bus.
+type DBusConfigData struct {
+	Enabled bool
+}
+
+const (
+	dbusName      = "org.madscience.Busylight"
+	dbusPath      = dbus.ObjectPath("/org/madscience/Busylight")
+	dbusInterface = "org.madscience.Busylight"
+)
+
+const dbusIntrospection = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+<node>
+  <interface name="org.madscience.Busylight">
+    <method name="Command">
+      <arg name="command" type="s" direction="in"/>
+      <arg name="reply" type="s" direction="out"/>
+    </method>
+    <method name="Mute"><arg name="reply" type="s" direction="out"/></method>
+    <method name="Unmute"><arg name="reply" type="s" direction="out"/></method>
+    <method name="EndCall"><arg name="reply" type="s" direction="out"/></method>
+    <method name="Refresh"><arg name="reply" type="s" direction="out"/></method>
+    <signal name="StateChanged">
+      <arg name="state" type="s"/>
+      <arg name="previous" type="s"/>
+      <arg name="cause" type="s"/>
+    </signal>
+    <property name="State" type="s" access="read"/>
+    <property name="Description" type="s" access="read"/>
+    <property name="Since" type="x" access="read"/>
+    <property name="Active" type="b" access="read"/>
+    <property name="BusyNow" type="b" access="read"/>
+    <property name="Zoom" type="b" access="read"/>
+    <property name="Muted" type="b" access="read"/>
+    <property name="Urgent" type="b" access="read"/>
+    <property name="LowPriority" type="b" access="read"/>
+    <property name="Waiting" type="b" access="read"/>
+    <property name="OnCall" type="b" access="read"/>
+    <property name="Stale" type="b" access="read"/>
+    <property name="Quiet" type="b" access="read"/>
+    <property name="Snoozing" type="b" access="read"/>
+    <property name="NextTransition" type="x" access="read"/>
+    <property name="Until" type="x" access="read"/>
+    <property name="LastPoll" type="x" access="read">
+      <annotation name="org.freedesktop.DBus.Property.EmitsChangedSignal" value="false"/>
+    </property>
+    <property name="Light" type="s" access="read">
+      <annotation name="org.freedesktop.DBus.Property.EmitsChangedSignal" value="false"/>
+    </property>
+  </interface>
+  <interface name="org.freedesktop.DBus.Properties">
+    <method name="Get">
+      <arg name="interface" type="s" direction="in"/>
+      <arg name="property" type="s" direction="in"/>
+      <arg name="value" type="v" direction="out"/>
+    </method>
+    <method name="GetAll">
+      <arg name="interface" type="s" direction="in"/>
+      <arg name="properties" type="a{sv}" direction="out"/>
+    </method>
+    <method name="Set">
+      <arg name="interface" type="s" direction="in"/>
+      <arg name="property" type="s" direction="in"/>
+      <arg name="value" type="v" direction="in"/>
+    </method>
+    <signal name="PropertiesChanged">
+      <arg name="interface" type="s"/>
+      <arg name="changed" type="a{sv}"/>
+      <arg name="invalidated" type="as"/>
+    </signal>
+  </interface>
+  <interface name="org.freedesktop.DBus.Introspectable">
+    <method name="Introspect"><arg name="xml" type="s" direction="out"/></method>
+  </interface>
+  <interface name="org.freedesktop.DBus.Peer">
+    <method name="Ping"/>
+  </interface>
+</node>
+`
+
+// dbusTime gives a time as seconds since the epoch (0 for none).
+func dbusTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// dbusProperties gives our status as properties.
+func dbusProperties(s DaemonStatus) map[string]dbus.Variant {
+	str := func(v string) dbus.Variant { return dbus.Variant{Signature: "s", Value: v} }
+	flag := func(v bool) dbus.Variant { return dbus.Variant{Signature: "b", Value: v} }
+	when := func(t time.Time) dbus.Variant { return dbus.Variant{Signature: "x", Value: dbusTime(t)} }
+	return map[string]dbus.Variant{
+		"State":          str(s.State),
+		"Description":    str(s.Description),
+		"Since":          when(s.Since),
+		"Active":         flag(s.Active),
+		"BusyNow":        flag(s.BusyNow),
+		"Zoom":           flag(s.Zoom),
+		"Muted":          flag(s.Muted),
+		"Urgent":         flag(s.Urgent),
+		"LowPriority":    flag(s.LowPriority),
+		"Waiting":        flag(s.Waiting),
+		"OnCall":         flag(s.OnCall),
+		"Stale":          flag(s.Stale),
+		"Quiet":          flag(s.Quiet),
+		"Snoozing":       flag(s.Snoozing),
+		"NextTransition": when(s.NextTransition),
+		"Until":          when(s.Until),
+		"LastPoll":       when(s.LastPoll),
+		"Light":          str(s.Light),
+	}
+}
+
+// dbusCommands are the methods which just run one of our control commands.
+var dbusCommands = map[string]string{
+	"Mute":    "mute",
+	"Unmute":  "open",
+	"EndCall": "cal",
+	"Refresh": "reload",
+}
+
+// dbusError is the reply to a call we can't answer.
+func dbusError(name, message string) dbus.Reply {
+	return dbus.Reply{ErrorName: name, Error: message}
+}
+
+// dbusCall answers a method call to our object.
+func dbusCall(config *ConfigData, call *dbus.Message) dbus.Reply {
+	if call.Path != dbusPath {
+		return dbusError("org.freedesktop.DBus.Error.UnknownObject", "No such object "+string(call.Path))
+	}
+	switch call.Interface + "." + call.Member {
+	case "org.freedesktop.DBus.Introspectable.Introspect":
+		return dbus.Reply{Signature: "s", Body: []interface{}{dbusIntrospection}}
+
+	case "org.freedesktop.DBus.Peer.Ping":
+		return dbus.Reply{}
+
+	case "org.freedesktop.DBus.Properties.Get":
+		if call.Signature != "ss" || call.Body[0] != dbusInterface {
+			return dbusError("org.freedesktop.DBus.Error.InvalidArgs", "Expected our interface and the name of one of its properties")
+		}
+		value, known := dbusProperties(config.events.Current())[call.Body[1].(string)]
+		if !known {
+			return dbusError("org.freedesktop.DBus.Error.UnknownProperty", "No such property")
+		}
+		return dbus.Reply{Signature: "v", Body: []interface{}{value}}
+
+	case "org.freedesktop.DBus.Properties.GetAll":
+		if call.Signature != "s" {
+			return dbusError("org.freedesktop.DBus.Error.InvalidArgs", "Expected an interface name")
+		}
+		properties := map[string]dbus.Variant{}
+		if call.Body[0] == dbusInterface {
+			properties = dbusProperties(config.events.Current())
+		}
+		return dbus.Reply{Signature: "a{sv}", Body: []interface{}{properties}}
+
+	case "org.freedesktop.DBus.Properties.Set":
+		return dbusError("org.freedesktop.DBus.Error.PropertyReadOnly", "Our properties can't be set (use Command instead)")
+
+	case dbusInterface + ".Command":
+		if call.Signature != "s" {
+			return dbusError("org.freedesktop.DBus.Error.InvalidArgs", "Expected a command")
+		}
+		return dbus.Reply{Signature: "s", Body: []interface{}{sendCommand(config, "D-Bus", call.Body[0].(string), 5*time.Second)}}
+	}
+	if call.Interface == dbusInterface || call.Interface == "" {
+		if command, known := dbusCommands[call.Member]; known {
+			return dbus.Reply{Signature: "s", Body: []interface{}{sendCommand(config, "D-Bus", command, 5*time.Second)}}
+		}
+	}
+	return dbusError("org.freedesktop.DBus.Error.UnknownMethod", "No such method "+call.Member)
+}
+
+// startDBus connects to the session bus and offers our object there, if
+// configured to do so. This is captured at startup; changing it requires a
+// restart of the daemon.
+func startDBus(config *ConfigData) error {
+	if !config.DBus.Enabled {
+		return nil
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	if err = conn.RequestName(dbusName); err != nil {
+		conn.Close()
+		return err
+	}
+	config.dbusConn = conn
+	config.logger.Printf("Offering status and controls on the session bus as %s", dbusName)
+
+	events := config.events.Subscribe()
+	go func() {
+		err := conn.Serve(func(call *dbus.Message) dbus.Reply {
+			return dbusCall(config, call)
+		})
+		config.events.Unsubscribe(events)
+		config.logger.Printf("Disconnected from the session bus: %v", err)
+	}()
+	go func() {
+		previous := dbusProperties(config.events.Current())
+		for event := range events {
+			properties := dbusProperties(event.Status)
+			changed := make(map[string]dbus.Variant)
+			for name, value := range properties {
+				if value != previous[name] && name != "LastPoll" && name != "Light" {
+					changed[name] = value
+				}
+			}
+			previous = properties
+			if err := conn.Emit(dbusPath, "org.freedesktop.DBus.Properties", "PropertiesChanged", "sa{sv}as", dbusInterface, changed, []string{}); err != nil {
+				return
+			}
+			if err := conn.Emit(dbusPath, dbusInterface, "StateChanged", "sss", event.Status.State, event.Previous, event.Cause); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
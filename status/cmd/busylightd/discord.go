@@ -0,0 +1,330 @@
+//
+// Discord bot for busylightd.
+//
+// Like the other chat bots, this announces our state changes (to a channel
+// on a Discord server) and answers questions about our status. It also
+// registers a /busylight slash command on that server, so the allowed users
+// can control the light with the same commands the Slack slash command
+// accepts (e.g., "/busylight dnd 30m").
+//
+// Optionally, it watches a Discord user's voice state: while they're in a
+// voice channel we show that we're in a call (muted or not, according to
+// Discord), and when they leave we go back to the calendar, just as if a
+// Zoom call had started and ended.
+//
+// All of this happens over Discord's gateway connection, so it works from
+// behind a home router without anything having to reach our HTTP server.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// DiscordConfigData describes the Discord server our bot works with.
+type DiscordConfigData struct {
+	Token        string   // the bot's token
+	GuildID      string   // ID of the server (guild) to register the /busylight command on
+	Channel      string   // ID of the channel to announce state changes to (if any)
+	AllowedUsers []string // Discord user IDs who may change the state (default: anyone on the server)
+	VoiceUserID  string   // if given, follow this user's voice-channel state as calls
+}
+
+const (
+	discordAPI     = "https://discord.com/api/v10"
+	discordGateway = "wss://gateway.discord.gg/?v=10&encoding=json"
+
+	discordIntents = 1<<0 | 1<<7 // GUILDS, GUILD_VOICE_STATES
+)
+
+type discordBot struct {
+	settings DiscordConfigData
+	client   *http.Client
+	lock     sync.Mutex      // protects conn and seq
+	conn     *websocket.Conn // nil while disconnected
+	seq      *int64          // last sequence number received from the gateway
+}
+
+// discordPayload is a message received over the gateway.
+type discordPayload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+	S  *int64          `json:"s"`
+	T  string          `json:"t"`
+}
+
+// request calls the Discord REST API.
+func (bot *discordBot) request(method, path string, body interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, discordAPI+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+bot.settings.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := bot.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Discord returned %s", resp.Status)
+	}
+	return nil
+}
+
+// send posts a message to our announcement channel.
+func (bot *discordBot) send(message string) error {
+	return bot.request(http.MethodPost, "/channels/"+bot.settings.Channel+"/messages", map[string]string{"content": message})
+}
+
+// gatewaySend sends a message to the gateway, if we're connected.
+func (bot *discordBot) gatewaySend(op int, d interface{}) error {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+	if bot.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	return websocket.JSON.Send(bot.conn, map[string]interface{}{"op": op, "d": d})
+}
+
+// isAllowed reports whether the given Discord user may change our state.
+func (bot *discordBot) isAllowed(userID string) bool {
+	if len(bot.settings.AllowedUsers) == 0 {
+		return true
+	}
+	for _, u := range bot.settings.AllowedUsers {
+		if u == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// run connects to the gateway and stays connected for the life of the daemon.
+func (bot *discordBot) run(config *ConfigData) {
+	for {
+		err := bot.session(config)
+		config.logger.Printf("ERROR: Discord gateway connection lost: %v (reconnecting in 1 minute)", err)
+		time.Sleep(time.Minute)
+	}
+}
+
+// session handles a single connection to the gateway until it fails.
+func (bot *discordBot) session(config *ConfigData) error {
+	conn, err := websocket.Dial(discordGateway, "", "https://localhost/")
+	if err != nil {
+		return err
+	}
+	bot.lock.Lock()
+	bot.conn = conn
+	bot.seq = nil
+	bot.lock.Unlock()
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		bot.lock.Lock()
+		bot.conn.Close()
+		bot.conn = nil
+		bot.lock.Unlock()
+	}()
+
+	var hello discordPayload
+	if err = websocket.JSON.Receive(conn, &hello); err != nil {
+		return err
+	}
+	var helloData struct {
+		HeartbeatInterval int `json:"heartbeat_interval"`
+	}
+	if err = json.Unmarshal(hello.D, &helloData); err != nil || hello.Op != 10 || helloData.HeartbeatInterval <= 0 {
+		return fmt.Errorf("unexpected greeting from gateway (op %d)", hello.Op)
+	}
+	go func() {
+		heartbeat := time.NewTicker(time.Duration(helloData.HeartbeatInterval) * time.Millisecond)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-heartbeat.C:
+				bot.lock.Lock()
+				seq := bot.seq
+				bot.lock.Unlock()
+				bot.gatewaySend(1, seq)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err = bot.gatewaySend(2, map[string]interface{}{
+		"token":   bot.settings.Token,
+		"intents": discordIntents,
+		"properties": map[string]string{
+			"os":      runtime.GOOS,
+			"browser": "busylightd",
+			"device":  "busylightd",
+		},
+	}); err != nil {
+		return err
+	}
+
+	var inCall, muted bool
+	for {
+		var msg discordPayload
+		if err = websocket.JSON.Receive(conn, &msg); err != nil {
+			return err
+		}
+		if msg.S != nil {
+			bot.lock.Lock()
+			bot.seq = msg.S
+			bot.lock.Unlock()
+		}
+
+		switch msg.Op {
+		case 1: // the gateway wants a heartbeat right now
+			bot.lock.Lock()
+			seq := bot.seq
+			bot.lock.Unlock()
+			bot.gatewaySend(1, seq)
+
+		case 7:
+			return fmt.Errorf("gateway asked us to reconnect")
+
+		case 9:
+			return fmt.Errorf("gateway says our session is invalid")
+
+		case 0:
+			switch msg.T {
+			case "READY":
+				var ready struct {
+					Application struct {
+						ID string `json:"id"`
+					} `json:"application"`
+				}
+				if err = json.Unmarshal(msg.D, &ready); err != nil {
+					return err
+				}
+				config.logger.Printf("Connected to Discord gateway")
+				if bot.settings.GuildID != "" {
+					go bot.registerCommand(config, ready.Application.ID)
+				}
+
+			case "VOICE_STATE_UPDATE":
+				var voice struct {
+					GuildID   string  `json:"guild_id"`
+					ChannelID *string `json:"channel_id"`
+					UserID    string  `json:"user_id"`
+					Mute      bool    `json:"mute"`
+					SelfMute  bool    `json:"self_mute"`
+				}
+				if err = json.Unmarshal(msg.D, &voice); err != nil || bot.settings.VoiceUserID == "" || voice.UserID != bot.settings.VoiceUserID {
+					continue
+				}
+				nowInCall := voice.ChannelID != nil
+				nowMuted := voice.Mute || voice.SelfMute
+				if nowInCall == inCall && (nowMuted == muted || !nowInCall) {
+					continue
+				}
+				inCall, muted = nowInCall, nowMuted
+				command := "cal"
+				if inCall && muted {
+					command = "mute"
+				} else if inCall {
+					command = "open"
+				}
+				go sendCommand(config, "discord voice", command, time.Second)
+
+			case "INTERACTION_CREATE":
+				go bot.answerInteraction(config, msg.D)
+			}
+		}
+	}
+}
+
+// registerCommand sets up our /busylight slash command on the Discord server.
+func (bot *discordBot) registerCommand(config *ConfigData, applicationID string) {
+	commands := []map[string]interface{}{{
+		"name":        "busylight",
+		"description": "Check or change " + currentSettings(config).Name + "'s busylight",
+		"options": []map[string]interface{}{{
+			"type":        3, // STRING
+			"name":        "command",
+			"description": strings.Join(commandNames(), "/"), // (Discord allows up to 100 characters)
+			"required":    false,
+		}},
+	}}
+	if err := bot.request(http.MethodPut, "/applications/"+applicationID+"/guilds/"+bot.settings.GuildID+"/commands", commands); err != nil {
+		config.logger.Printf("ERROR: Unable to register Discord slash command: %v", err)
+	}
+}
+
+// answerInteraction carries out a /busylight slash command.
+func (bot *discordBot) answerInteraction(config *ConfigData, data json.RawMessage) {
+	var interaction struct {
+		ID     string `json:"id"`
+		Token  string `json:"token"`
+		Type   int    `json:"type"`
+		Member struct {
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"member"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		Data struct {
+			Name    string `json:"name"`
+			Options []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &interaction); err != nil || interaction.Type != 2 || interaction.Data.Name != "busylight" {
+		return
+	}
+	userID := interaction.Member.User.ID
+	if userID == "" {
+		userID = interaction.User.ID
+	}
+	text := "status"
+	for _, option := range interaction.Data.Options {
+		if option.Name == "command" && option.Value != "" {
+			text = option.Value
+		}
+	}
+
+	var reply string
+	if text != "status" && !bot.isAllowed(userID) {
+		config.logger.Printf("WARNING: Ignoring Discord command %q from user %s who isn't allowed to control the light", text, userID)
+		reply = "Sorry, you aren't allowed to control this light."
+	} else {
+		reply = sendCommand(config, "discord user "+userID, text, 2*time.Second)
+	}
+	if err := bot.request(http.MethodPost, "/interactions/"+interaction.ID+"/"+interaction.Token+"/callback", map[string]interface{}{
+		"type": 4, // CHANNEL_MESSAGE_WITH_SOURCE
+		"data": map[string]interface{}{
+			"content": reply,
+			"flags":   64, // EPHEMERAL
+		},
+	}); err != nil {
+		config.logger.Printf("ERROR: Unable to answer Discord command: %v", err)
+	}
+}
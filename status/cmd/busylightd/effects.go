@@ -0,0 +1,176 @@
+//
+// Light effects.
+//
+// Our own hardware flashes its lights by itself, given the right command
+// ("#" for redflash, "%" for urgent), but that's only good for the patterns
+// built into its firmware, and the other lights can't do it at all. So the
+// daemon can do the flashing itself: an effect says how to show a color
+// over time, and the animator plays the resulting pattern on any light,
+// changing it on a timer. The effects are:
+//
+//    steady       - just show the color
+//    alternate    - show each of several colors in turn
+//    blink        - flash the color on and off
+//    double-pulse - two quick flashes, then a pause
+//    breathe      - fade the color up and down (RGB lights only)
+//
+// Each repeats at a given rate (in Hz, i.e., times per second), so the same
+// effect looks the same on every kind of light.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// effectRates are the effects we know, and how many times per second each
+// repeats unless told otherwise.
+var effectRates = map[string]float64{
+	"steady":       0,
+	"alternate":    1,
+	"blink":        1,
+	"double-pulse": 0.75,
+	"breathe":      0.25,
+}
+
+// breatheSteps is how many steps each fade up and down is made of.
+const breatheSteps = 24
+
+// effectPattern makes the pattern which shows the colors with an effect,
+// repeating hz times per second (or at the effect's usual rate, if zero).
+// Effects which show one color at a time show each of the colors in turn.
+func effectPattern(effect string, hz float64, colors ...rgbColor) []rgbStep {
+	if hz <= 0 {
+		hz = effectRates[effect]
+	}
+	period := time.Duration(0)
+	if hz > 0 {
+		period = time.Duration(float64(time.Second) / hz)
+	}
+
+	var pattern []rgbStep
+	for _, c := range colors {
+		switch effect {
+		case "alternate":
+			pattern = append(pattern, rgbStep{Color: c, Hold: period / time.Duration(len(colors))})
+		case "blink":
+			pattern = append(pattern, rgbStep{Color: c, Hold: period / 2}, rgbStep{Color: rgbOff, Hold: period / 2})
+		case "double-pulse":
+			pattern = append(pattern,
+				rgbStep{Color: c, Hold: period / 8}, rgbStep{Color: rgbOff, Hold: period / 8},
+				rgbStep{Color: c, Hold: period / 8}, rgbStep{Color: rgbOff, Hold: period * 5 / 8})
+		case "breathe":
+			for i := 0; i < breatheSteps; i++ {
+				level := (1 - math.Cos(2*math.Pi*float64(i)/breatheSteps)) / 2
+				pattern = append(pattern, rgbStep{Color: c.scaled(level), Hold: period / breatheSteps})
+			}
+		default:
+			return []rgbStep{{Color: c}}
+		}
+	}
+	return pattern
+}
+
+// scaled returns the color at a fraction of its brightness.
+func (c rgbColor) scaled(level float64) rgbColor {
+	var s rgbColor
+	for i := range c {
+		s[i] = byte(math.Round(float64(c[i]) * level))
+	}
+	return s
+}
+
+// checkEffect makes sure we know an effect, and that its rate makes sense.
+func checkEffect(effect string, hz float64) error {
+	if _, known := effectRates[effect]; !known {
+		return fmt.Errorf("unknown effect \"%s\" (expected steady, alternate, blink, double-pulse, or breathe)", effect)
+	}
+	if hz < 0 || hz > 10 {
+		return fmt.Errorf("effect rate %g Hz is out of range (0-10)", hz)
+	}
+	return nil
+}
+
+// animator keeps a pattern going on a light, in the background (and keeps
+// the light awake, if it needs that).
+type animator struct {
+	timing rgbLightTiming
+
+	lock    sync.Mutex           // protects pattern and show
+	pattern []rgbStep            // what we're showing now
+	show    func(rgbColor) error // how to show each step of it
+	changed chan struct{}
+	done    chan struct{}
+}
+
+// start starts the animator, with nothing to show yet.
+func (a *animator) start(timing rgbLightTiming) {
+	a.timing = timing
+	a.changed = make(chan struct{}, 1)
+	a.done = make(chan struct{})
+	go a.animate()
+}
+
+// play starts showing a pattern, using show to show each step.
+func (a *animator) play(pattern []rgbStep, show func(rgbColor) error) error {
+	a.lock.Lock()
+	a.pattern, a.show = pattern, show
+	a.lock.Unlock()
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+	return show(pattern[0].Color)
+}
+
+// current returns the pattern we're showing now.
+func (a *animator) current() []rgbStep {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.pattern
+}
+
+// stop stops the animator.
+func (a *animator) stop() {
+	close(a.done)
+}
+
+func (a *animator) animate() {
+	var hold <-chan time.Time
+	var pattern []rgbStep
+	var show func(rgbColor) error
+	step := 0
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-a.changed:
+			a.lock.Lock()
+			pattern, show = a.pattern, a.show
+			a.lock.Unlock()
+			step = 0 // (play has shown this one already)
+		case <-hold:
+			if len(pattern) > 1 {
+				step = (step + 1) % len(pattern)
+			}
+			show(pattern[step].Color)
+		}
+		hold = nil
+		if len(pattern) > 1 {
+			d := pattern[step].Hold
+			if d < a.timing.MinHold {
+				d = a.timing.MinHold
+			}
+			hold = time.After(d)
+		} else if a.timing.KeepAlive > 0 && show != nil {
+			hold = time.After(a.timing.KeepAlive)
+		}
+	}
+}
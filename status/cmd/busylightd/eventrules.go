@@ -0,0 +1,70 @@
+//
+// Rules for calendar events, by title.
+//
+// Each calendar may have Rules saying what to do with events whose titles
+// match a regular expression: ignore them (e.g., "Focus time" blocks), or
+// show some state other than "busy" while they're on (e.g., "urgent" for
+// "Interview.*"). The first rule which matches an event decides; one which
+// neither ignores the event nor gives a state just counts it as busy, which
+// is useful to make an exception to a later rule. Events no rule matches
+// are busy, as usual.
+//
+// This only works where the calendar tells us the titles: iCalendar feeds,
+// Microsoft 365 calendars (where the application may see them), and Google
+// calendars, which we read event by event if they have any rules (see
+// googleevents.go). The rules are re-read along with the rest of the
+// configuration.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// EventRuleConfigData says what to do with a calendar's events whose titles match.
+type EventRuleConfigData struct {
+	Match  string // regular expression matched against the event's title (e.g., "^Interview")
+	Ignore bool   // if true, ignore matching events
+	State  string // otherwise, the state to show during them (default "busy")
+}
+
+// applyEventRules returns the state an event calls for (empty for plain
+// "busy"), and whether it counts at all.
+func applyEventRules(calInfo CalendarConfigData, title string) (string, bool) {
+	for _, rule := range calInfo.Rules {
+		// (rules which can't be understood were rejected by checkEventRules)
+		if re, err := regexp.Compile(rule.Match); err == nil && re.MatchString(title) {
+			return rule.State, !rule.Ignore
+		}
+	}
+	return "", true
+}
+
+// checkEventRules makes sure the calendars' Rules make sense, along with
+// the other settings which give states for their busy time.
+func checkEventRules(config *ConfigData) error {
+	for _, calInfo := range config.Calendars {
+		if calInfo.State != "" && !knownState(config, calInfo.State) {
+			return fmt.Errorf("Calendar \"%s\" calls for unknown state \"%s\"", calInfo.Title, calInfo.State)
+		}
+		for _, rule := range calInfo.Rules {
+			if _, err := regexp.Compile(rule.Match); err != nil {
+				return fmt.Errorf("Calendar \"%s\" has a rule which can't be understood: %v", calInfo.Title, err)
+			}
+			if rule.State != "" && !knownState(config, rule.State) {
+				return fmt.Errorf("Calendar \"%s\" has a rule calling for unknown state \"%s\"", calInfo.Title, rule.State)
+			}
+		}
+		for eventType, state := range calInfo.EventTypes {
+			if state != "ignore" && !knownState(config, state) {
+				return fmt.Errorf("Calendar \"%s\" calls for unknown state \"%s\" for %s events", calInfo.Title, state, eventType)
+			}
+		}
+	}
+	return nil
+}
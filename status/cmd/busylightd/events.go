@@ -0,0 +1,136 @@
+//
+// Internal event bus for busylightd.
+//
+// Every time the overall state of the light changes, the main event loop
+// publishes a StateEvent here. Any subsystem which wants to react to those
+// changes (publishing our status somewhere, notifying other services, etc.)
+// subscribes to the bus and receives its own copy of each event on a channel,
+// so that slow network operations never hold up the event loop itself.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// stateDescriptions gives a human-friendly description of each overall state
+// the daemon may report.
+var stateDescriptions = map[string]string{
+	"off":        "Offline",
+	"free":       "Available",
+	"busy":       "Busy",
+	"zoom-muted": "In a meeting",
+	"zoom-open":  "In a meeting (microphone open)",
+	"urgent":     "Urgent",
+	"dnd":        "Do not disturb",
+	"warning":    "Meeting soon",
+	"away":       "Away",
+}
+
+// DaemonStatus is a snapshot of what the daemon believes is going on at a given moment.
+type DaemonStatus struct {
+	State          string    // overall state name (see stateDescriptions)
+	Description    string    // human-friendly description of State
+	Since          time.Time // when we entered this state
+	Active         bool      // is the daemon active (as opposed to sleeping)?
+	BusyNow        bool      // do the calendars say we're busy now?
+	Zoom           bool      // are we in a video call?
+	Muted          bool      // if in a video call, is the microphone muted?
+	Urgent         bool      // is the urgent indicator on?
+	LowPriority    bool      // is the low-priority indicator on?
+	Waiting        bool      // has someone pressed the button to say they're waiting to see us?
+	OnCall         bool      // are we on call (according to PagerDuty)?
+	Stale          bool      // are we going by saved calendar data, not having been able to poll since we started?
+	Quiet          bool      // is it quiet hours?
+	Snoozing       bool      // is the light snoozing?
+	NextTransition time.Time // when the calendars say our busy/free status will next change
+	Until          time.Time // when the current temporary state (e.g., dnd) ends, if it's temporary
+	LastPoll       time.Time // when we last managed to poll the calendars
+	Light          string    // how the light is doing: "ok", "failing", "lost" (trying to reopen it), "searching" (for it, when first opening it), or "closed"
+}
+
+// StateEvent describes a change from one overall state to another.
+type StateEvent struct {
+	Previous string       // state we were in before (empty at startup)
+	Cause    string       // what made us change (e.g., "calendar" or "signal USR1")
+	Status   DaemonStatus // full status after the change
+}
+
+// stateSelected reports whether a state is in a list of states of interest.
+// An empty list selects every state.
+func stateSelected(states []string, state string) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// eventBus distributes StateEvents to all interested subscribers.
+type eventBus struct {
+	lock        sync.Mutex
+	current     DaemonStatus
+	subscribers []chan StateEvent
+}
+
+// Subscribe returns a channel on which the caller will receive every subsequent StateEvent.
+func (bus *eventBus) Subscribe() <-chan StateEvent {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	ch := make(chan StateEvent, 16)
+	bus.subscribers = append(bus.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe stops sending events to a channel previously returned by Subscribe.
+func (bus *eventBus) Unsubscribe(ch <-chan StateEvent) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	for i, sub := range bus.subscribers {
+		if sub == ch {
+			bus.subscribers = append(bus.subscribers[:i], bus.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Publish records the new status and sends the event to every subscriber.
+// This never blocks; if a subscriber has fallen so far behind that its channel
+// is full, it simply misses this event.
+func (bus *eventBus) Publish(config *ConfigData, event StateEvent) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	bus.current = event.Status
+	for _, ch := range bus.subscribers {
+		select {
+		case ch <- event:
+		default:
+			config.logger.Printf("WARNING: event subscriber fell behind; dropped %s event", event.Status.State)
+		}
+	}
+}
+
+// Refresh records the latest status without announcing it, for when
+// nothing has changed which subscribers need to hear about (like the time
+// of the last calendar poll).
+func (bus *eventBus) Refresh(status DaemonStatus) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	bus.current = status
+}
+
+// Current returns the most recently published status.
+func (bus *eventBus) Current() DaemonStatus {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	return bus.current
+}
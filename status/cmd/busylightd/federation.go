@@ -0,0 +1,182 @@
+//
+// Daemon-to-daemon federation over HTTPS.
+//
+// A daemon can push its own state to other daemons (say, from the office to
+// home) across networks where mDNS doesn't reach. The pushes are made over
+// HTTPS using client certificates, so the receiving daemon knows who it's
+// hearing from. On the receiving end, the pushed states simply join the
+// table of peers we know about, exactly as if we'd heard them via mDNS.
+// (We can also push to a hub, which knows us by a token instead; see hub.go.)
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// FederationConfigData controls pushing our state to other daemons.
+type FederationConfigData struct {
+	// URLs of the other daemons' federation endpoints, e.g. "https://home.example.com:8642/federation/state".
+	PushURLs []string
+
+	// Our client certificate and its private key (PEM files).
+	CertFile string
+	KeyFile  string
+
+	// If given, we send this token with each push, for a hub which knows us
+	// by a token of our own instead of a certificate (see hub.go).
+	Token string
+
+	// CA certificate(s) used to verify the other daemons' server certificates.
+	// If empty, the system's trusted CAs are used.
+	CAFile string
+}
+
+// federationMessage is what we push to other daemons.
+type federationMessage struct {
+	State          string
+	Since          time.Time
+	LowPriority    bool
+	NextTransition time.Time
+	TTL            int // seconds the receiver should believe this
+}
+
+const federationInterval = 60 * time.Second
+
+// loadCertPool reads a file of PEM-encoded CA certificates.
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", filename)
+	}
+	return pool, nil
+}
+
+// startFederation begins pushing our state to the configured daemons.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startFederation(config *ConfigData) error {
+	f := config.Federation
+	if len(f.PushURLs) == 0 {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if f.CertFile != "" || f.Token == "" {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return fmt.Errorf("Unable to load federation client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if f.CAFile != "" {
+		var err error
+		if tlsConfig.RootCAs, err = loadCertPool(f.CAFile); err != nil {
+			return fmt.Errorf("Unable to load federation CA file: %v", err)
+		}
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	push := func(status DaemonStatus) {
+		body, err := json.Marshal(federationMessage{
+			State:          status.State,
+			Since:          status.Since,
+			LowPriority:    status.LowPriority,
+			NextTransition: status.NextTransition,
+			TTL:            int(3 * federationInterval / time.Second),
+		})
+		if err != nil {
+			config.logger.Printf("ERROR: Unable to encode federation message: %v", err)
+			return
+		}
+		for _, target := range f.PushURLs {
+			req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+			if err != nil {
+				config.logger.Printf("ERROR: Unable to push state to %s: %v", target, err)
+				continue
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if f.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+f.Token)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				config.logger.Printf("ERROR: Unable to push state to %s: %v", target, err)
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+				config.logger.Printf("ERROR: Unable to push state to %s: server returned %s", target, resp.Status)
+			}
+		}
+	}
+
+	events := config.events.Subscribe()
+	go func() {
+		ticker := time.NewTicker(federationInterval)
+		for {
+			select {
+			case event := <-events:
+				push(event.Status)
+			case <-ticker.C:
+				push(config.events.Current())
+			}
+		}
+	}()
+	return nil
+}
+
+// federationHandler accepts state pushed to us by another daemon. The sender must
+// have presented a client certificate which we verified against HTTP.ClientCAFile;
+// the peer is known by the common name on that certificate.
+func federationHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusForbidden)
+			return
+		}
+		name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+
+		var msg federationMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if msg.TTL <= 0 {
+			msg.TTL = int(3 * federationInterval / time.Second)
+		}
+		if config.peers.Update(PeerStatus{
+			Name:           name,
+			State:          msg.State,
+			Since:          msg.Since,
+			LowPriority:    msg.LowPriority,
+			NextTransition: msg.NextTransition,
+			Source:         "federation",
+			Expires:        time.Now().Add(time.Duration(msg.TTL) * time.Second),
+		}) {
+			config.logger.Printf("Federated peer %s (%s) checked in, currently %s", name, r.RemoteAddr, msg.State)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,51 @@
+//
+// Flash notifications.
+//
+// Sometimes something just wants to catch the user's eye for a moment (a
+// build failed, someone's at the door, the pager went off) without changing
+// what the light says about them, as the urgent indicator would. The
+// "flash" control command plays a light signal a few times (by default,
+// the built-in "flash" signal, three quick red pulses), and then the light
+// goes back to showing whatever it should be showing by then:
+//
+//    flash [<signal>] [<times>]
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// defaultFlashTimes is how many times a flash repeats, unless asked otherwise.
+const defaultFlashTimes = 3
+
+// parseFlash works out which signal to flash, and for how long, from the
+// rest of the "flash" command.
+func parseFlash(config *ConfigData, args []string) (string, time.Duration, error) {
+	signal, times := "flash", defaultFlashTimes
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n < 1 || n > 100 {
+				return "", 0, fmt.Errorf("can't flash %d times (usage: flash [<signal>] [<times>])", n)
+			}
+			times = n
+		} else {
+			signal = arg
+		}
+	}
+	if signal == "lowpri" || !lightSignalDefined(config, signal) {
+		return "", 0, fmt.Errorf("the light can't show \"%s\" (usage: flash [<signal>] [<times>])", signal)
+	}
+	return signal, flashLength(config, signal, times), nil
+}
+
+// flashLength returns how long it takes to flash a signal some number of times.
+func flashLength(config *ConfigData, signal string, times int) time.Duration {
+	return time.Duration(float64(times) / signalRate(config, signal) * float64(time.Second))
+}
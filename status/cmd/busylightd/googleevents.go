@@ -0,0 +1,126 @@
+//
+// Reading Google calendars event by event.
+//
+// The free/busy query we usually make is cheap, but it lumps every event
+// together, including invitations the user has declined or never answered
+// (so one unanswered mass invitation keeps the light on all afternoon). For
+// calendars with CheckResponses set, we read the events themselves instead,
+// and only count those the user is actually going to: ones they've accepted
+// (or tentatively accepted, unless IgnoreTentative is set), or which they
+// put on the calendar themselves. We also read the events of calendars
+// with Rules, since those need the events' titles (see eventrules.go).
+//
+// Reading the events also tells us what kind each is, so the special kinds
+// can show states of their own rather than just "busy": out of the office
+// shows "away", and focus time "dnd" (unless the calendar's EventTypes
+// setting says otherwise; a state of "ignore" ignores them altogether).
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// defaultGoogleEventTypes are the states Google's special kinds of events
+// call for, unless configured otherwise.
+var defaultGoogleEventTypes = map[string]string{
+	"outOfOffice":     "away",
+	"focusTime":       "dnd",
+	"workingLocation": "ignore",
+}
+
+// googleEventState returns the state a kind of event calls for on a calendar
+// (empty for plain "busy"), and whether it counts at all.
+func googleEventState(calInfo CalendarConfigData, eventType string) (string, bool) {
+	state, known := calInfo.EventTypes[eventType]
+	if !known {
+		state = defaultGoogleEventTypes[eventType]
+	}
+	return state, state != "ignore"
+}
+
+// googleEventBusyPeriods reads the events on a Google calendar between start
+// and end, returning the busy periods for those the user is going to.
+func googleEventBusyPeriods(ctx context.Context, config *ConfigData, srv *calendar.Service, calID string, start, end time.Time) ([]BusyPeriod, error) {
+	calInfo := config.Calendars[calID]
+	var periods []BusyPeriod
+	pageToken := ""
+	for {
+		events, err := srv.Events.List(calID).
+			TimeMin(start.Format(time.RFC3339)).
+			TimeMax(end.Format(time.RFC3339)).
+			SingleEvents(true).
+			PageToken(pageToken).
+			Context(ctx).
+			Do()
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events.Items {
+			if event.Status == "cancelled" || event.Transparency == "transparent" {
+				continue
+			}
+			if calInfo.CheckResponses {
+				switch googleResponse(event) {
+				case "declined", "needsAction":
+					continue
+				case "tentative":
+					if calInfo.IgnoreTentative {
+						continue
+					}
+				}
+			}
+			state, counted := googleEventState(calInfo, event.EventType)
+			if !counted {
+				continue
+			}
+			period, err := googleEventPeriod(event, localZone(config))
+			if err != nil {
+				config.logger.Printf("ERROR: %s: Unable to understand the time of event \"%s\": %v", calInfo.Title, event.Summary, err)
+				continue
+			}
+			period.State = state
+			periods = append(periods, period)
+		}
+		if pageToken = events.NextPageToken; pageToken == "" {
+			return periods, nil
+		}
+	}
+}
+
+// googleResponse returns how the user responded to an event's invitation
+// ("accepted" for events with no guests, which they must have put there themselves).
+func googleResponse(event *calendar.Event) string {
+	for _, attendee := range event.Attendees {
+		if attendee.Self {
+			return attendee.ResponseStatus
+		}
+	}
+	return "accepted"
+}
+
+// googleEventPeriod returns the time an event takes up. All-day events take
+// up the whole of their days, in the given (local) time zone.
+func googleEventPeriod(event *calendar.Event, loc *time.Location) (BusyPeriod, error) {
+	if event.Start.DateTime == "" {
+		start, err := time.ParseInLocation("2006-01-02", event.Start.Date, loc)
+		if err != nil {
+			return BusyPeriod{}, err
+		}
+		end, err := time.ParseInLocation("2006-01-02", event.End.Date, loc)
+		return BusyPeriod{Start: start, End: end, Title: event.Summary}, err
+	}
+	start, err := time.Parse(time.RFC3339, event.Start.DateTime)
+	if err != nil {
+		return BusyPeriod{}, err
+	}
+	end, err := time.Parse(time.RFC3339, event.End.DateTime)
+	return BusyPeriod{Start: start, End: end, Title: event.Summary}, err
+}
@@ -0,0 +1,237 @@
+//
+// gRPC control service.
+//
+// The Busylight service (defined in busylightpb/busylight.proto) offers
+// much the same as the HTTP control API (see api.go), for programs which
+// would rather have typed, generated client code than make HTTP requests
+// and pick apart JSON. It's off unless GRPC.Listen is set, and uses the
+// HTTP server's TLS settings, API tokens, and APIClients, so a client needs
+// the same credentials for either, and may do the same with them (see
+// scopes.go): GetState and Subscribe need only read, SetOverride and
+// TriggerRefresh control.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fizban-of-ragnarok/busylight/busylightpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCConfigData controls the daemon's gRPC service.
+type GRPCConfigData struct {
+	// The address to listen on, as for HTTP.Listen (so ":8643" means
+	// localhost only). If empty, the service isn't offered.
+	Listen string
+}
+
+// grpcService answers calls to the Busylight service.
+type grpcService struct {
+	busylightpb.UnimplementedBusylightServer
+	config *ConfigData
+}
+
+// grpcTimestamp converts a time for a message, leaving it out if it's zero.
+func grpcTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// grpcStatus converts our status for a message.
+func grpcStatus(s DaemonStatus) *busylightpb.Status {
+	return &busylightpb.Status{
+		State:          s.State,
+		Description:    s.Description,
+		Since:          grpcTimestamp(s.Since),
+		Active:         s.Active,
+		BusyNow:        s.BusyNow,
+		Zoom:           s.Zoom,
+		Muted:          s.Muted,
+		Urgent:         s.Urgent,
+		LowPriority:    s.LowPriority,
+		Waiting:        s.Waiting,
+		OnCall:         s.OnCall,
+		Stale:          s.Stale,
+		Quiet:          s.Quiet,
+		Snoozing:       s.Snoozing,
+		NextTransition: grpcTimestamp(s.NextTransition),
+		Until:          grpcTimestamp(s.Until),
+		LastPoll:       grpcTimestamp(s.LastPoll),
+		Light:          s.Light,
+	}
+}
+
+func (g *grpcService) GetState(ctx context.Context, req *busylightpb.GetStateRequest) (*busylightpb.Status, error) {
+	return grpcStatus(g.config.events.Current()), nil
+}
+
+func (g *grpcService) SetOverride(ctx context.Context, req *busylightpb.SetOverrideRequest) (*busylightpb.CommandReply, error) {
+	if req.State != "busy" && req.State != "dnd" {
+		return nil, status.Errorf(codes.InvalidArgument, "state must be \"busy\" or \"dnd\"")
+	}
+	command := req.State + " off"
+	if d := req.Duration.AsDuration(); d > 0 {
+		command = fmt.Sprintf("%s %s", req.State, d)
+	}
+	return &busylightpb.CommandReply{Reply: sendCommand(g.config, grpcSource(ctx), command, 5*time.Second)}, nil
+}
+
+func (g *grpcService) Subscribe(req *busylightpb.SubscribeRequest, stream busylightpb.Busylight_SubscribeServer) error {
+	events := g.config.events.Subscribe()
+	defer g.config.events.Unsubscribe(events)
+
+	if err := stream.Send(&busylightpb.StateEvent{Cause: "connected", Status: grpcStatus(g.config.events.Current())}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-events:
+			if err := stream.Send(&busylightpb.StateEvent{Previous: event.Previous, Cause: event.Cause, Status: grpcStatus(event.Status)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (g *grpcService) TriggerRefresh(ctx context.Context, req *busylightpb.TriggerRefreshRequest) (*busylightpb.CommandReply, error) {
+	return &busylightpb.CommandReply{Reply: sendCommand(g.config, grpcSource(ctx), "reload", 5*time.Second)}, nil
+}
+
+// grpcMethodScopes are the scopes needed to call each method, by name.
+var grpcMethodScopes = map[string]clientScope{
+	"GetState":       scopeRead,
+	"Subscribe":      scopeRead,
+	"SetOverride":    scopeControl,
+	"TriggerRefresh": scopeControl,
+}
+
+// grpcAuthorized makes sure a call carries an API token (as
+// "authorization: Bearer <token>" metadata) or a client certificate we
+// accept instead, and that the client may call the method. It returns who
+// the client is, for the log.
+func grpcAuthorized(ctx context.Context, config *ConfigData, fullMethod string) (string, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = strings.TrimPrefix(values[0], "Bearer ")
+		}
+	}
+	var conn *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			conn = &info.State
+		}
+	}
+	client, authorized := apiCredentials(config, token, conn)
+	if !authorized {
+		return "", status.Errorf(codes.Unauthenticated, "not authorized")
+	}
+	address := "unknown address"
+	if p, ok := peer.FromContext(ctx); ok {
+		address = p.Addr.String()
+	}
+	source := client.describe("gRPC", address)
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	needed, known := grpcMethodScopes[method]
+	if !known {
+		needed = scopeAdmin
+	}
+	if client.Scope < needed {
+		config.logger.Printf("WARNING: Refused to let %s call %s", source, method)
+		return "", status.Errorf(codes.PermissionDenied, "not allowed")
+	}
+	return source, nil
+}
+
+// grpcSourceKey is the context key for who's making a call (see grpcSource).
+type grpcSourceKey struct{}
+
+// grpcSource returns who's making a call, for the log.
+func grpcSource(ctx context.Context) string {
+	if source, known := ctx.Value(grpcSourceKey{}).(string); known {
+		return source
+	}
+	return "gRPC"
+}
+
+// startGRPCServer starts offering the Busylight service, if configured to do so.
+// The settings are captured at startup; changing them requires a restart of the daemon.
+func startGRPCServer(config *ConfigData) error {
+	if config.GRPC.Listen == "" {
+		return nil
+	}
+	address, err := listenAddress("GRPC.Listen", config.GRPC.Listen)
+	if err != nil {
+		return err
+	}
+
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			source, err := grpcAuthorized(ctx, config, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(context.WithValue(ctx, grpcSourceKey{}, source), req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if _, err := grpcAuthorized(stream.Context(), config, info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	}
+	if config.HTTP.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.HTTP.CertFile, config.HTTP.KeyFile)
+		if err != nil {
+			return fmt.Errorf("Unable to load certificate for gRPC: %v", err)
+		}
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+		if config.HTTP.ClientCAFile != "" {
+			pool, err := loadCertPool(config.HTTP.ClientCAFile)
+			if err != nil {
+				return fmt.Errorf("Unable to load client CA file for gRPC: %v", err)
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("Unable to start gRPC server: %v", err)
+	}
+	if config.HTTP.CertFile == "" && config.HTTP.apiTokenSet() && !isLoopback(listener.Addr()) {
+		config.logger.Printf("WARNING: API tokens can be read by anyone on the network between here and gRPC clients (set HTTP.CertFile and HTTP.KeyFile to use TLS)")
+	}
+	server := grpc.NewServer(options...)
+	busylightpb.RegisterBusylightServer(server, &grpcService{config: config})
+	config.grpcServer = server
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			config.logger.Printf("ERROR: gRPC server stopped: %v", err)
+		}
+	}()
+	config.logger.Printf("Offering gRPC service on %s", listener.Addr())
+	return nil
+}
@@ -0,0 +1,103 @@
+//
+// Home Assistant service calls on state transitions.
+//
+// When the light changes state, we can call any Home Assistant services
+// we've been told to (turn on a "Meeting" scene, pause the media players,
+// set the thermostat, ...) through its REST API, using a long-lived
+// access token.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HomeAssistantServiceCall is a Home Assistant service to call when entering certain states.
+type HomeAssistantServiceCall struct {
+	// The service to call, as "domain.service" (e.g., "scene.turn_on").
+	Service string
+
+	// The service data, e.g. {"entity_id": "scene.meeting"}.
+	Data map[string]interface{}
+
+	// The service is only called when entering one of these states.
+	// If empty, it is called on every state change.
+	States []string
+}
+
+// HomeAssistantConfigData describes how we talk to Home Assistant.
+type HomeAssistantConfigData struct {
+	URL      string // base URL of Home Assistant, e.g. "http://homeassistant.local:8123"
+	Token    string // long-lived access token
+	Services []HomeAssistantServiceCall
+}
+
+// callHomeAssistant calls a Home Assistant service.
+func callHomeAssistant(client *http.Client, ha HomeAssistantConfigData, call HomeAssistantServiceCall) error {
+	domain, service := call.Service, ""
+	if i := strings.IndexByte(call.Service, '.'); i > 0 {
+		domain, service = call.Service[:i], call.Service[i+1:]
+	}
+	if service == "" {
+		return fmt.Errorf("service %q should be given as domain.service", call.Service)
+	}
+	data := call.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(ha.URL, "/")+"/api/services/"+domain+"/"+service, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+ha.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Home Assistant returned %s", resp.Status)
+	}
+	return nil
+}
+
+// startHomeAssistant arranges for the configured Home Assistant services to be called on each state change.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startHomeAssistant(config *ConfigData) {
+	ha := config.HomeAssistant
+	if ha.URL == "" || len(ha.Services) == 0 {
+		return
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	events := config.events.Subscribe()
+	go func() {
+		for event := range events {
+			if event.Status.State == event.Previous {
+				continue
+			}
+			for _, call := range ha.Services {
+				if stateSelected(call.States, event.Status.State) {
+					if err := callHomeAssistant(client, ha, call); err != nil {
+						config.logger.Printf("ERROR: Unable to call Home Assistant service %s: %v", call.Service, err)
+					}
+				}
+			}
+		}
+	}()
+}
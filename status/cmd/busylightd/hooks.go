@@ -0,0 +1,106 @@
+//
+// Hook scripts run on state transitions.
+//
+// The user may configure any number of external programs to be run when the
+// light changes state. This is the simplest way to make anything else
+// happen along with the light (pause the music, mute the doorbell, switch
+// video scenes, ...) without waiting for a native integration.
+//
+// Each hook is given the details of the transition in its environment:
+//
+//    BUSYLIGHT_OLD_STATE       - state we were in before (empty at startup)
+//    BUSYLIGHT_STATE           - state we are in now
+//    BUSYLIGHT_CAUSE           - what made the state change
+//    BUSYLIGHT_TIME            - when the change happened (RFC 3339)
+//    BUSYLIGHT_NEXT_TRANSITION - when the calendar says we'll next change (RFC 3339)
+//    BUSYLIGHT_LOW_PRIORITY    - "1" if the low-priority indicator is on, else "0"
+//    BUSYLIGHT_WAITING         - "1" if someone is waiting at the door, else "0"
+//    BUSYLIGHT_ON_CALL         - "1" if we're on call, else "0"
+//    BUSYLIGHT_HOOK            - "enter" if run on entering a state, "exit" on leaving one
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import "time"
+
+// HookConfigData describes an external program to run on state transitions.
+type HookConfigData struct {
+	// The program to run and its arguments.
+	Command []string
+
+	// The hook is run when entering one of these states, or when leaving one
+	// of the ExitStates. If both are empty, it is run on every state change.
+	States     []string
+	ExitStates []string
+}
+
+// runsOn reports why (if at all) the hook should be run for a state change:
+// "enter" or "exit".
+func (h HookConfigData) runsOn(event StateEvent) string {
+	if len(h.States) == 0 && len(h.ExitStates) == 0 {
+		return "enter"
+	}
+	for _, state := range h.States {
+		if state == event.Status.State {
+			return "enter"
+		}
+	}
+	for _, state := range h.ExitStates {
+		if state == event.Previous {
+			return "exit"
+		}
+	}
+	return ""
+}
+
+// boolFlag renders a boolean as "1" or "0" for hook environments.
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// hookEnvironment describes a state transition as a set of environment variables.
+func hookEnvironment(event StateEvent) []string {
+	env := []string{
+		"BUSYLIGHT_OLD_STATE=" + event.Previous,
+		"BUSYLIGHT_STATE=" + event.Status.State,
+		"BUSYLIGHT_CAUSE=" + event.Cause,
+		"BUSYLIGHT_TIME=" + event.Status.Since.Format(time.RFC3339),
+		"BUSYLIGHT_LOW_PRIORITY=" + boolFlag(event.Status.LowPriority),
+		"BUSYLIGHT_WAITING=" + boolFlag(event.Status.Waiting),
+		"BUSYLIGHT_ON_CALL=" + boolFlag(event.Status.OnCall),
+	}
+	if !event.Status.NextTransition.IsZero() {
+		env = append(env, "BUSYLIGHT_NEXT_TRANSITION="+event.Status.NextTransition.Format(time.RFC3339))
+	}
+	return env
+}
+
+// startHooks arranges for the configured hooks to be run on each state change.
+// The hooks are captured at startup; changing them requires a restart of the daemon.
+func startHooks(config *ConfigData) {
+	hooks := config.Hooks
+	if len(hooks) == 0 {
+		return
+	}
+
+	events := config.events.Subscribe()
+	go func() {
+		for event := range events {
+			if event.Status.State == event.Previous {
+				continue
+			}
+			env := hookEnvironment(event)
+			for _, hook := range hooks {
+				if why := hook.runsOn(event); why != "" {
+					config.children.start(config, "hook", hook.Command, append(env, "BUSYLIGHT_HOOK="+why))
+				}
+			}
+		}
+	}()
+}
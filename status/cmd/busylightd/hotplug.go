@@ -0,0 +1,31 @@
+//
+// Noticing the light being plugged in or unplugged.
+//
+// We check every 15 seconds that the light is still there (see
+// checkLightHealth), and keep trying to open it again while it's gone.
+// Where the system tells us about devices coming and going (on Linux, by
+// the kernel's uevents), we also check as soon as anything changes, so
+// plugging the light in (or power-cycling the hub it's on) shows up on it
+// right away.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import "time"
+
+// hotplugSettle is how long to wait after a device comes or goes before
+// we look, giving the system time to set it up (and letting the flurry of
+// events for one device die down).
+const hotplugSettle = time.Second
+
+// noticeHotplug tells the main event loop that a device came or went.
+func noticeHotplug(config *ConfigData) {
+	select {
+	case config.hotplug <- struct{}{}:
+	default:
+		// there's already one waiting to be handled
+	}
+}
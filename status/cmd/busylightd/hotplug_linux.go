@@ -0,0 +1,72 @@
+//
+// Hotplug events on Linux.
+//
+// The kernel announces each device it adds or removes on a netlink socket
+// (the same uevents udev acts on). We only care about the kinds of device
+// a light might be: serial ports, HID devices, and USB devices in general.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"strings"
+	"syscall"
+)
+
+// hotplugSubsystems are the kinds of device a light might show up as.
+var hotplugSubsystems = map[string]bool{
+	"tty":    true,
+	"hidraw": true,
+	"usb":    true,
+}
+
+// watchHotplug starts listening for devices being added or removed.
+// This is set up at startup, and lasts for the life of the daemon.
+func watchHotplug(config *ConfigData) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err == nil {
+		err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1})
+		if err != nil {
+			syscall.Close(fd)
+		}
+	}
+	if err != nil {
+		config.logger.Printf("Unable to watch for devices being plugged in (will check every 15 seconds instead): %v", err)
+		return
+	}
+	config.hotplug = make(chan struct{}, 1)
+
+	go func() {
+		buf := make([]byte, 8192)
+		for {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				config.logger.Printf("ERROR: Stopped watching for devices being plugged in: %v", err)
+				return
+			}
+			if action, subsystem := parseUevent(buf[:n]); (action == "add" || action == "remove") && hotplugSubsystems[subsystem] {
+				noticeHotplug(config)
+			}
+		}
+	}()
+}
+
+// parseUevent picks out what happened, and to what kind of device, from a
+// kernel uevent ("add@/devices/...", then "KEY=value" fields, each ending
+// with a null byte).
+func parseUevent(message []byte) (action, subsystem string) {
+	for _, field := range strings.Split(string(message), "\x00") {
+		if value := strings.TrimPrefix(field, "ACTION="); value != field {
+			action = value
+		} else if value := strings.TrimPrefix(field, "SUBSYSTEM="); value != field {
+			subsystem = value
+		}
+	}
+	return action, subsystem
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+//
+// Hotplug events elsewhere.
+//
+// We don't listen for devices coming and going on other systems, and rely
+// on the regular health checks instead.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+// watchHotplug does nothing here.
+func watchHotplug(config *ConfigData) {}
@@ -0,0 +1,100 @@
+//
+// Household combined-state mode.
+//
+// A single light (say, in a hallway outside a shared home office) can show
+// the combined state of several people at once. We take our own state along
+// with whatever our peers have told us, and run through a list of rules to
+// decide what to display, such as "red if anyone is on a call, yellow if
+// anyone is busy, green only if everyone is free."
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import "strings"
+
+// HouseholdRule is one step in deciding the combined state. If the condition
+// holds for the members' states, the light shows the state named by `Show`.
+type HouseholdRule struct {
+	If     string   // "any" (at least one member) or "all" (every member)
+	States []string // is in one of these states
+	Show   string   // then show this state on the light
+}
+
+// HouseholdConfigData controls combining several people's states onto our light.
+type HouseholdConfigData struct {
+	Enabled     bool            // show the combined state instead of just our own?
+	IncludeSelf bool            // include our own state in the combination?
+	Members     []string        // names of the peers to include (default: all known peers)
+	Rules       []HouseholdRule // combination rules, checked in order (default: defaultHouseholdRules)
+}
+
+// defaultHouseholdRules shows the "busiest" state of anyone in the household.
+var defaultHouseholdRules = []HouseholdRule{
+	{If: "any", States: []string{"urgent"}, Show: "urgent"},
+	{If: "any", States: []string{"zoom-open", "zoom-muted", "dnd"}, Show: "zoom-muted"},
+	{If: "any", States: []string{"busy"}, Show: "busy"},
+	{If: "all", States: []string{"off"}, Show: "off"},
+}
+
+// matches reports whether a rule's condition holds for the given set of states.
+func (r HouseholdRule) matches(states []string) bool {
+	if len(states) == 0 {
+		return false
+	}
+	count := 0
+	for _, state := range states {
+		for _, s := range r.States {
+			if s == state {
+				count++
+				break
+			}
+		}
+	}
+	if strings.EqualFold(r.If, "all") {
+		return count == len(states)
+	}
+	return count > 0
+}
+
+// isMember reports whether we should include the named peer in the combination.
+func (h HouseholdConfigData) isMember(name string) bool {
+	if len(h.Members) == 0 {
+		return true
+	}
+	for _, m := range h.Members {
+		if strings.EqualFold(m, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// combine works out the state to be shown on the light, given our own status and our peers'.
+// If no rule applies, the household is shown as free.
+func (h HouseholdConfigData) combine(own DaemonStatus, peers []PeerStatus) (state string, lowPriority bool) {
+	var states []string
+	if h.IncludeSelf {
+		states = append(states, own.State)
+		lowPriority = own.LowPriority || own.OnCall
+	}
+	for _, p := range peers {
+		if h.isMember(p.Name) {
+			states = append(states, p.State)
+			lowPriority = lowPriority || p.LowPriority
+		}
+	}
+
+	rules := h.Rules
+	if len(rules) == 0 {
+		rules = defaultHouseholdRules
+	}
+	for _, rule := range rules {
+		if rule.matches(states) {
+			return rule.Show, lowPriority
+		}
+	}
+	return "free", lowPriority
+}
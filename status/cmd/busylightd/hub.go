@@ -0,0 +1,138 @@
+//
+// Team presence hub.
+//
+// One daemon can act as a hub for a team (or a household): the daemon
+// driving the light outside a shared office or team room, which everyone
+// else's daemon (or anything else which knows their state, such as a
+// script) reports to. Each client is registered in the Hub setting with a
+// token of its own, which tells us who's reporting:
+//
+//    POST   /hub/state - report a client's state, as JSON of the same form
+//                        as a federation push, e.g. {"State": "busy"}
+//    DELETE /hub/state - the client is signing off
+//    GET    /hub/state - everyone's states, and what the light shows for
+//                        them all (for any client, or with an API token)
+//
+// A client whose scope is only "read" (see scopes.go) may look, but not report.
+//
+// The clients' states join the table of peers, just like those we hear
+// about via mDNS or federation, and with Household.Enabled set, the light
+// shows them combined according to the Household rules (by default, the
+// "busiest" of them).
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HubConfigData controls acting as a hub for other people's states.
+type HubConfigData struct {
+	// The clients which may report to us, by name, each with the token it
+	// must present (as "Authorization: Bearer <token>").
+	Clients map[string]string
+}
+
+// hubOverview is what we tell clients about the hub's members.
+type hubOverview struct {
+	State   string       // what the light shows for everyone combined
+	Members []PeerStatus // what each member last told us
+}
+
+// hubHandler takes reports from the hub's clients, and tells them about each other.
+func hubHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := currentSettings(config)
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		name, isClient := clientWithToken(settings.Hub.Clients, token)
+		if isClient && r.Method != http.MethodGet && scopeOf(settings, name) < scopeControl {
+			config.logger.Printf("WARNING: Refused to let hub client %s (%s, %s) report to us", name, scopeOf(settings, name), r.RemoteAddr)
+			http.Error(w, "not allowed", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if _, isAPIClient := apiAuthorized(config, r); !isClient && !isAPIClient {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+			household := settings.Household
+			var overview hubOverview
+			for _, peer := range config.peers.List() {
+				if household.isMember(peer.Name) {
+					overview.Members = append(overview.Members, peer)
+				}
+			}
+			overview.State, _ = household.combine(config.events.Current(), overview.Members)
+			writeJSON(w, overview)
+
+		case http.MethodPost:
+			if !isClient {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+			var msg federationMessage
+			if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+			if stateDescriptions[msg.State] == "" {
+				http.Error(w, fmt.Sprintf("unknown state \"%s\"", msg.State), http.StatusBadRequest)
+				return
+			}
+			if msg.TTL <= 0 {
+				msg.TTL = int(3 * federationInterval / time.Second)
+			}
+			if msg.Since.IsZero() {
+				msg.Since = time.Now()
+				if previous, known := config.peers.Get(name); known && previous.State == msg.State {
+					msg.Since = previous.Since
+				}
+			}
+			if config.peers.Update(PeerStatus{
+				Name:           name,
+				State:          msg.State,
+				Since:          msg.Since,
+				LowPriority:    msg.LowPriority,
+				NextTransition: msg.NextTransition,
+				Source:         "hub",
+				Expires:        time.Now().Add(time.Duration(msg.TTL) * time.Second),
+			}) {
+				config.logger.Printf("Hub client %s (%s) checked in, currently %s", name, r.RemoteAddr, msg.State)
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case http.MethodDelete:
+			if !isClient {
+				http.Error(w, "not authorized", http.StatusUnauthorized)
+				return
+			}
+			config.peers.Remove(name)
+			config.logger.Printf("Hub client %s (%s) signed off", name, r.RemoteAddr)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// checkHub makes sure the Hub setting makes sense.
+func checkHub(config *ConfigData) error {
+	if len(config.Hub.Clients) == 0 {
+		return nil
+	}
+	if config.HTTP.Listen == "" {
+		return fmt.Errorf("Hub.Clients needs HTTP.Listen, so the clients can report to us")
+	}
+	return checkClientTokens("Hub", config.Hub.Clients)
+}
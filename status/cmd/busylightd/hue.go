@@ -0,0 +1,175 @@
+//
+// Philips Hue driver.
+//
+// A Hue bulb (or a group of them) can serve as the light, through the Hue
+// bridge's REST API, so the signal can be somewhere no USB cable reaches,
+// like outside the office door. See rgblight.go for how we show our
+// signals on it.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// HueConfigData describes the Hue light(s) we use, if Driver is "hue".
+type HueConfigData struct {
+	Bridge     string // the bridge's address (e.g., "192.168.1.20")
+	Username   string // an authorized user (application key) on the bridge
+	Light      string // the ID of the light to use...
+	Group      string // ...or the ID of a group (room or zone) of lights
+	Brightness int    // 1 to 254 (default 254)
+}
+
+// hueXY converts a color to the CIE xy coordinates the Hue API wants.
+func hueXY(c rgbColor) [2]float64 {
+	var linear [3]float64
+	for i, v := range c {
+		f := float64(v) / 255
+		if f > 0.04045 {
+			f = math.Pow((f+0.055)/1.055, 2.4)
+		} else {
+			f /= 12.92
+		}
+		linear[i] = f
+	}
+	r, g, b := linear[0], linear[1], linear[2]
+	x := r*0.664511 + g*0.154324 + b*0.162028
+	y := r*0.283881 + g*0.668433 + b*0.047685
+	z := r*0.000088 + g*0.072310 + b*0.986039
+	if x+y+z == 0 {
+		return [2]float64{0.3127, 0.3290} // (white, for want of anything better)
+	}
+	return [2]float64{x / (x + y + z), y / (x + y + z)}
+}
+
+// hueDevice is the Hue light (or group of lights) we control.
+type hueDevice struct {
+	settings   HueConfigData
+	logger     *log.Logger
+	client     *http.Client
+	endpoint   string // the light's URL on the bridge
+	brightness int
+}
+
+// newHueLight makes a driver for the Hue light(s) in the configuration.
+func newHueLight(config *ConfigData) lightDriver {
+	// The bridge can only take about ten light changes (or one group change)
+	// per second, so we flash more slowly than the other lights.
+	timing := rgbLightTiming{MinHold: 500 * time.Millisecond}
+	if config.Hue.Group != "" {
+		timing.MinHold = time.Second
+	}
+	return newRGBLight(config, &hueDevice{settings: config.Hue, logger: config.logger}, timing)
+}
+
+func (d *hueDevice) Open() error {
+	if d.settings.Bridge == "" || d.settings.Username == "" || (d.settings.Light == "") == (d.settings.Group == "") {
+		return fmt.Errorf("Can't use Hue light: Bridge, Username, and one of Light or Group must be given")
+	}
+	d.endpoint = "http://" + d.settings.Bridge + "/api/" + d.settings.Username + "/lights/" + d.settings.Light
+	if d.settings.Group != "" {
+		d.endpoint = "http://" + d.settings.Bridge + "/api/" + d.settings.Username + "/groups/" + d.settings.Group
+	}
+	d.brightness = d.settings.Brightness
+	if d.brightness <= 0 || d.brightness > 254 {
+		d.brightness = 254
+	}
+	d.client = &http.Client{Timeout: 5 * time.Second}
+	if err := d.HealthCheck(); err != nil {
+		return fmt.Errorf("Can't use Hue light: %v", err)
+	}
+	d.logger.Printf("Using Hue light(s) on bridge %s", d.settings.Bridge)
+	return nil
+}
+
+// hueError returns the first error in a response from the bridge, if any.
+// (The bridge reports errors as a list of {"error": {...}} objects, with
+// a 200 status.)
+func hueError(body []byte) error {
+	var results []struct {
+		Error *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &results) != nil {
+		return nil // (not a list, so not an error list)
+	}
+	for _, r := range results {
+		if r.Error != nil {
+			return fmt.Errorf("Hue bridge: %s", r.Error.Description)
+		}
+	}
+	return nil
+}
+
+func (d *hueDevice) SetColor(c rgbColor) error {
+	state := map[string]interface{}{"on": false}
+	if c != rgbOff {
+		state = map[string]interface{}{"on": true, "bri": d.brightness, "xy": hueXY(c), "transitiontime": 0}
+	}
+	body, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	url := d.endpoint + "/state"
+	if d.settings.Group != "" {
+		url = d.endpoint + "/action"
+	}
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		return err
+	}
+	return hueError(body)
+}
+
+func (d *hueDevice) Close() error {
+	return nil
+}
+
+// HealthCheck makes sure the bridge is answering, and can reach the light.
+func (d *hueDevice) HealthCheck() error {
+	resp, err := d.client.Get(d.endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err = hueError(body); err != nil {
+		return err
+	}
+	var light struct {
+		State *struct {
+			Reachable *bool `json:"reachable"`
+		} `json:"state"`
+	}
+	if err = json.Unmarshal(body, &light); err != nil {
+		return fmt.Errorf("unexpected response from Hue bridge: %v", err)
+	}
+	if light.State != nil && light.State.Reachable != nil && !*light.State.Reachable {
+		return fmt.Errorf("the bridge can't reach light %s", d.settings.Light)
+	}
+	return nil
+}
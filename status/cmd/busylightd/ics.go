@@ -0,0 +1,313 @@
+//
+// ICS (iCalendar) feed subscriptions.
+//
+// Calendars whose Provider is "ics" are published iCalendar feeds, such as
+// shared team calendars or calendars from services with no API we can use.
+// The calendar ID is the feed's URL. Each time we poll the calendars, we
+// download the feed and work out which of its events (including repeats of
+// recurring events) fall in the period we're interested in.
+//
+// Events marked as cancelled or as free time ("transparent") are ignored.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// icsEvent is the part of a VEVENT we care about.
+type icsEvent struct {
+	UID          string
+	Start, End   time.Time
+	Duration     time.Duration // if given instead of End
+	RRule        string
+	ExDates      []time.Time
+	RecurrenceID time.Time // set if this event replaces one occurrence of a recurring event
+	Summary      string    // the event's title
+	Skip         bool      // cancelled, or doesn't block time
+}
+
+// icsProperty is one (unfolded) content line of an iCalendar file.
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// readICSProperties reads and unfolds the content lines of an iCalendar file.
+func readICSProperties(r io.Reader) ([]icsProperty, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var properties []icsProperty
+	for _, line := range lines {
+		// The value starts after the first colon which isn't inside a quoted parameter value.
+		colon, quoted := -1, false
+		for i, c := range line {
+			if c == '"' {
+				quoted = !quoted
+			} else if c == ':' && !quoted {
+				colon = i
+				break
+			}
+		}
+		if colon < 0 {
+			continue
+		}
+		p := icsProperty{Params: make(map[string]string), Value: line[colon+1:]}
+		parts := strings.Split(line[:colon], ";")
+		p.Name = strings.ToUpper(parts[0])
+		for _, param := range parts[1:] {
+			if eq := strings.IndexByte(param, '='); eq > 0 {
+				p.Params[strings.ToUpper(param[:eq])] = strings.Trim(param[eq+1:], `"`)
+			}
+		}
+		properties = append(properties, p)
+	}
+	return properties, nil
+}
+
+// parseICSTime interprets a DATE or DATE-TIME value, in the time zone given
+// by its TZID parameter (if any), or else the given (local) one.
+func parseICSTime(p icsProperty, value string, local *time.Location) (time.Time, error) {
+	loc := local
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+		// (feeds from Outlook use Windows zone names, which we can't look up; local time is our best guess)
+	}
+	switch {
+	case p.Params["VALUE"] == "DATE" || len(value) == 8:
+		return time.ParseInLocation("20060102", value, local)
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	default:
+		return time.ParseInLocation("20060102T150405", value, loc)
+	}
+}
+
+// icsTextUnescaper undoes the escaping of special characters in text values.
+var icsTextUnescaper = strings.NewReplacer(`\\`, `\`, `\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ")
+
+var icsDurationPattern = regexp.MustCompile(`^([-+])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICSDuration interprets a DURATION value such as "PT1H30M" or "P1D".
+func parseICSDuration(value string) (time.Duration, error) {
+	m := icsDurationPattern.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration \"%s\"", value)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseICSEvents picks the events out of an iCalendar file (taking times
+// without a time zone to be local time). If some of them can't be
+// understood, it returns the rest along with an error saying so.
+func parseICSEvents(r io.Reader, local *time.Location) ([]icsEvent, error) {
+	properties, err := readICSProperties(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []icsEvent
+	var event *icsEvent
+	var skipped []string
+	depth := 0 // how deeply we're nested in components inside the event (e.g., VALARM)
+	for _, p := range properties {
+		switch {
+		case p.Name == "BEGIN" && strings.EqualFold(p.Value, "VEVENT"):
+			event, depth = &icsEvent{}, 0
+			continue
+		case event == nil:
+			continue
+		case p.Name == "BEGIN":
+			depth++
+			continue
+		case p.Name == "END" && depth > 0:
+			depth--
+			continue
+		case p.Name == "END":
+			if !event.Start.IsZero() {
+				events = append(events, *event)
+			}
+			event = nil
+			continue
+		case depth > 0:
+			continue
+		}
+
+		var err error
+		switch p.Name {
+		case "UID":
+			event.UID = p.Value
+		case "SUMMARY":
+			event.Summary = icsTextUnescaper.Replace(p.Value)
+		case "DTSTART":
+			event.Start, err = parseICSTime(p, p.Value, local)
+		case "DTEND":
+			event.End, err = parseICSTime(p, p.Value, local)
+		case "DURATION":
+			event.Duration, err = parseICSDuration(p.Value)
+		case "RRULE":
+			event.RRule = p.Value
+		case "EXDATE":
+			for _, value := range strings.Split(p.Value, ",") {
+				var t time.Time
+				if t, err = parseICSTime(p, value, local); err == nil {
+					event.ExDates = append(event.ExDates, t)
+				}
+			}
+		case "RECURRENCE-ID":
+			event.RecurrenceID, err = parseICSTime(p, p.Value, local)
+		case "STATUS":
+			event.Skip = event.Skip || strings.EqualFold(p.Value, "CANCELLED")
+		case "TRANSP":
+			event.Skip = event.Skip || strings.EqualFold(p.Value, "TRANSPARENT")
+		}
+		if err != nil {
+			// Skip this event, but not the rest of the calendar.
+			skipped = append(skipped, fmt.Sprintf("%s (%s: %v)", event.UID, p.Name, err))
+			event = nil
+		}
+	}
+	if len(skipped) > 0 {
+		return events, fmt.Errorf("skipped invalid events: %s", strings.Join(skipped, ", "))
+	}
+	return events, nil
+}
+
+// length returns how long each occurrence of the event lasts.
+func (e icsEvent) length() time.Duration {
+	switch {
+	case !e.End.IsZero():
+		return e.End.Sub(e.Start)
+	case e.Duration != 0:
+		return e.Duration
+	case e.Start.Equal(time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, e.Start.Location())):
+		return 24 * time.Hour // an all-day event with no end given
+	}
+	return 0
+}
+
+// occurrences returns the start times of the event's occurrences which overlap start..end.
+func (e icsEvent) occurrences(start, end time.Time) ([]time.Time, error) {
+	length := e.length()
+	if e.RRule == "" {
+		if e.Start.Before(end) && e.Start.Add(length).After(start) {
+			return []time.Time{e.Start}, nil
+		}
+		return nil, nil
+	}
+	option, err := rrule.StrToROptionInLocation(strings.TrimPrefix(e.RRule, "RRULE:"), e.Start.Location())
+	if err != nil {
+		return nil, err
+	}
+	option.Dtstart = e.Start
+	rule, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, err
+	}
+	var set rrule.Set
+	set.RRule(rule)
+	for _, t := range e.ExDates {
+		set.ExDate(t)
+	}
+	return set.Between(start.Add(-length), end, false), nil
+}
+
+// icsBusyPeriods downloads each of the given iCalendar feeds and adds the busy periods
+// between start and end to busy (keyed by feed URL). Feeds we can't read are logged and skipped.
+func icsBusyPeriods(ctx context.Context, config *ConfigData, urls []string, start, end time.Time, busy map[string][]BusyPeriod) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, feed := range urls {
+		title := config.Calendars[feed].Title
+		events, err := func() ([]icsEvent, error) {
+			url := feed
+			if strings.HasPrefix(url, "webcal://") {
+				url = "https://" + strings.TrimPrefix(url, "webcal://")
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("server returned %s", resp.Status)
+			}
+			return parseICSEvents(resp.Body, localZone(config))
+		}()
+		if err != nil {
+			config.logger.Printf("ERROR: Calendar \"%s\": Unable to read feed: %v", title, err)
+			if events == nil {
+				continue
+			}
+		}
+
+		// Occurrences of recurring events which were changed individually
+		// appear as events of their own, which replace the originals.
+		replaced := make(map[string]bool)
+		for _, e := range events {
+			if !e.RecurrenceID.IsZero() {
+				replaced[e.UID+"@"+e.RecurrenceID.UTC().Format(time.RFC3339)] = true
+			}
+		}
+
+		busy[feed] = nil
+		for _, e := range events {
+			if e.Skip {
+				continue
+			}
+			occurrences, err := e.occurrences(start, end)
+			if err != nil {
+				config.logger.Printf("ERROR: Calendar \"%s\": event %s: %v", title, e.UID, err)
+				continue
+			}
+			for _, t := range occurrences {
+				if e.RecurrenceID.IsZero() && e.RRule != "" && replaced[e.UID+"@"+t.UTC().Format(time.RFC3339)] {
+					continue
+				}
+				busy[feed] = append(busy[feed], BusyPeriod{Start: t, End: t.Add(e.length()), Title: e.Summary})
+			}
+		}
+	}
+}
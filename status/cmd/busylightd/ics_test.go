@@ -0,0 +1,199 @@
+//
+// Tests for reading iCalendar feeds.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseICSDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		valid bool
+	}{
+		{"PT1H30M", 90 * time.Minute, true},
+		{"PT45S", 45 * time.Second, true},
+		{"P1D", 24 * time.Hour, true},
+		{"P1W", 7 * 24 * time.Hour, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"+PT15M", 15 * time.Minute, true},
+		{"-PT15M", -15 * time.Minute, true},
+		{"P", 0, true},
+		{"1H", 0, false},
+		{"PT1.5H", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseICSDuration(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: got error %v, want valid=%v", test.value, err, test.valid)
+		} else if got != test.want {
+			t.Errorf("%q: got %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+// icsFeed wraps events in a calendar, with the CRLF line endings feeds use.
+func icsFeed(events ...string) string {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0"}
+	for _, event := range events {
+		lines = append(lines, "BEGIN:VEVENT")
+		lines = append(lines, strings.Split(event, "\n")...)
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestParseICSEvents(t *testing.T) {
+	local := time.FixedZone("local", -7*60*60)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("no time zone data: %v", err)
+	}
+	tests := []struct {
+		name    string
+		event   string
+		want    []icsEvent
+		wantErr bool
+	}{
+		{
+			name:  "UTC",
+			event: "UID:a\nSUMMARY:Standup\nDTSTART:20240304T170000Z\nDTEND:20240304T171500Z",
+			want:  []icsEvent{{UID: "a", Summary: "Standup", Start: time.Date(2024, 3, 4, 17, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 4, 17, 15, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "floating time is local",
+			event: "UID:b\nDTSTART:20240304T090000\nDURATION:PT1H",
+			want:  []icsEvent{{UID: "b", Start: time.Date(2024, 3, 4, 9, 0, 0, 0, local), Duration: time.Hour}},
+		},
+		{
+			name:  "time zone",
+			event: "UID:c\nDTSTART;TZID=Asia/Tokyo:20240304T090000\nDTEND;TZID=Asia/Tokyo:20240304T100000",
+			want:  []icsEvent{{UID: "c", Start: time.Date(2024, 3, 4, 9, 0, 0, 0, tokyo), End: time.Date(2024, 3, 4, 10, 0, 0, 0, tokyo)}},
+		},
+		{
+			name:  "unknown time zone is local",
+			event: "UID:d\nDTSTART;TZID=\"Pacific Standard Time\":20240304T090000\nDURATION:PT1H",
+			want:  []icsEvent{{UID: "d", Start: time.Date(2024, 3, 4, 9, 0, 0, 0, local), Duration: time.Hour}},
+		},
+		{
+			name:  "all day",
+			event: "UID:e\nDTSTART;VALUE=DATE:20240304",
+			want:  []icsEvent{{UID: "e", Start: time.Date(2024, 3, 4, 0, 0, 0, 0, local)}},
+		},
+		{
+			name:  "folded and escaped",
+			event: "UID:f\nSUMMARY:Planning\\, budget\n  and hiring\nDTSTART:20240304T170000Z",
+			want:  []icsEvent{{UID: "f", Summary: "Planning, budget and hiring", Start: time.Date(2024, 3, 4, 17, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "recurring, with exceptions",
+			event: "UID:g\nDTSTART:20240304T170000Z\nDURATION:PT30M\nRRULE:FREQ=WEEKLY;BYDAY=MO\nEXDATE:20240311T170000Z,20240318T170000Z",
+			want: []icsEvent{{UID: "g", Start: time.Date(2024, 3, 4, 17, 0, 0, 0, time.UTC), Duration: 30 * time.Minute, RRule: "FREQ=WEEKLY;BYDAY=MO",
+				ExDates: []time.Time{time.Date(2024, 3, 11, 17, 0, 0, 0, time.UTC), time.Date(2024, 3, 18, 17, 0, 0, 0, time.UTC)}}},
+		},
+		{
+			name:  "moved occurrence",
+			event: "UID:g\nRECURRENCE-ID:20240311T170000Z\nDTSTART:20240312T170000Z\nDURATION:PT30M",
+			want:  []icsEvent{{UID: "g", RecurrenceID: time.Date(2024, 3, 11, 17, 0, 0, 0, time.UTC), Start: time.Date(2024, 3, 12, 17, 0, 0, 0, time.UTC), Duration: 30 * time.Minute}},
+		},
+		{
+			name:  "cancelled",
+			event: "UID:h\nSTATUS:CANCELLED\nDTSTART:20240304T170000Z",
+			want:  []icsEvent{{UID: "h", Skip: true, Start: time.Date(2024, 3, 4, 17, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "free time",
+			event: "UID:i\nTRANSP:TRANSPARENT\nDTSTART:20240304T170000Z",
+			want:  []icsEvent{{UID: "i", Skip: true, Start: time.Date(2024, 3, 4, 17, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "alarm's properties aren't the event's",
+			event: "UID:j\nDTSTART:20240304T170000Z\nBEGIN:VALARM\nDURATION:PT15M\nEND:VALARM",
+			want:  []icsEvent{{UID: "j", Start: time.Date(2024, 3, 4, 17, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "no start",
+			event: "UID:k\nSUMMARY:Someday",
+		},
+		{
+			name:    "bad time",
+			event:   "UID:l\nDTSTART:tomorrow",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseICSEvents(strings.NewReader(icsFeed(test.event)), local)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error=%v", test.name, err, test.wantErr)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	// an invalid event doesn't cost us the rest of them
+	got, err := parseICSEvents(strings.NewReader(icsFeed("UID:bad\nDTSTART:tomorrow", "UID:good\nDTSTART:20240304T170000Z")), local)
+	if err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Errorf("mixed: got error %v, want one naming the bad event", err)
+	}
+	if len(got) != 1 || got[0].UID != "good" {
+		t.Errorf("mixed: got %+v, want just the good event", got)
+	}
+}
+
+func TestICSOccurrences(t *testing.T) {
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 3, day, hour, minute, 0, 0, time.UTC) }
+	weekly := icsEvent{Start: at(4, 9, 0), End: at(4, 10, 0), RRule: "FREQ=WEEKLY;BYDAY=MO"}
+	tests := []struct {
+		name       string
+		event      icsEvent
+		start, end time.Time
+		want       []time.Time
+	}{
+		{"single, inside", icsEvent{Start: at(4, 9, 0), Duration: time.Hour}, at(4, 0, 0), at(5, 0, 0), []time.Time{at(4, 9, 0)}},
+		{"single, under way", icsEvent{Start: at(4, 9, 0), Duration: time.Hour}, at(4, 9, 30), at(5, 0, 0), []time.Time{at(4, 9, 0)}},
+		{"single, over", icsEvent{Start: at(4, 9, 0), Duration: time.Hour}, at(4, 10, 0), at(5, 0, 0), nil},
+		{"single, not yet", icsEvent{Start: at(4, 9, 0), Duration: time.Hour}, at(3, 0, 0), at(4, 9, 0), nil},
+		{"all day", icsEvent{Start: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)}, at(4, 23, 0), at(5, 0, 0), []time.Time{at(4, 0, 0)}},
+		{"weekly", weekly, at(1, 0, 0), at(26, 0, 0), []time.Time{at(4, 9, 0), at(11, 9, 0), at(18, 9, 0), at(25, 9, 0)}},
+		{"weekly, under way", weekly, at(11, 9, 30), at(12, 0, 0), []time.Time{at(11, 9, 0)}},
+		{"weekly, just over", weekly, at(11, 10, 0), at(12, 0, 0), nil},
+		{"weekly, with exceptions", icsEvent{Start: weekly.Start, End: weekly.End, RRule: "RRULE:FREQ=WEEKLY;BYDAY=MO", ExDates: []time.Time{at(11, 9, 0)}}, at(1, 0, 0), at(19, 0, 0), []time.Time{at(4, 9, 0), at(18, 9, 0)}},
+		{"counted", icsEvent{Start: at(4, 9, 0), Duration: time.Hour, RRule: "FREQ=DAILY;COUNT=3"}, at(1, 0, 0), at(31, 0, 0), []time.Time{at(4, 9, 0), at(5, 9, 0), at(6, 9, 0)}},
+	}
+
+	for _, test := range tests {
+		got, err := test.event.occurrences(test.start, test.end)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Equal(test.want[i]) {
+				t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+
+	if _, err := (icsEvent{Start: at(4, 9, 0), RRule: "FREQ=SOMETIMES"}).occurrences(at(1, 0, 0), at(31, 0, 0)); err == nil {
+		t.Errorf("invalid rule: no error")
+	}
+}
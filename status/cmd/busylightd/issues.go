@@ -0,0 +1,166 @@
+//
+// Issue-tracker urgent triggers.
+//
+// We can watch Jira or GitHub for items matching a search (say, blocker
+// issues assigned to us, or anything labelled prod-incident) and make the
+// light urgent for a while whenever a new one turns up, so critical
+// assignments can't be missed while notifications are muted. Items which
+// already match when we start don't count as new.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IssueWatch is a search for items which should get our attention.
+type IssueWatch struct {
+	Provider string // "jira" or "github"
+	Query    string // JQL (Jira) or issue search query (GitHub), e.g. "assignee:@me label:prod-incident is:open"
+	BaseURL  string // Jira only: URL of the Jira site, e.g. "https://example.atlassian.net"
+	Username string // Jira only: user (email address) to log in as
+	Token    string // API token
+}
+
+// IssuesConfigData controls watching issue trackers.
+type IssuesConfigData struct {
+	Watches       []IssueWatch
+	PollSeconds   int // how often to search (default 120)
+	UrgentMinutes int // how long to show urgent for a new item (default 10)
+}
+
+// matchingItems finds the items currently matching the search, as a set of identifiers.
+func (w IssueWatch) matchingItems(client *http.Client) (map[string]bool, error) {
+	var req *http.Request
+	var err error
+	switch strings.ToLower(w.Provider) {
+	case "jira":
+		query := url.Values{"jql": {w.Query}, "fields": {"key"}, "maxResults": {"100"}}
+		req, err = http.NewRequest(http.MethodGet, strings.TrimSuffix(w.BaseURL, "/")+"/rest/api/2/search?"+query.Encode(), nil)
+		if err == nil && w.Username != "" {
+			req.SetBasicAuth(w.Username, w.Token)
+		}
+	case "github":
+		query := url.Values{"q": {w.Query}, "per_page": {"100"}}
+		req, err = http.NewRequest(http.MethodGet, "https://api.github.com/search/issues?"+query.Encode(), nil)
+		if err == nil {
+			req.Header.Set("Accept", "application/vnd.github.v3+json")
+			if w.Token != "" {
+				req.Header.Set("Authorization", "token "+w.Token)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown issue tracker %q", w.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	var reply struct {
+		Issues []struct {
+			Key string `json:"key"`
+		} `json:"issues"`
+		Items []struct {
+			HTMLURL string `json:"html_url"`
+		} `json:"items"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, err
+	}
+	items := make(map[string]bool)
+	for _, issue := range reply.Issues {
+		items[issue.Key] = true
+	}
+	for _, item := range reply.Items {
+		items[item.HTMLURL] = true
+	}
+	return items, nil
+}
+
+// startIssueWatcher starts searching the issue trackers, making us urgent for a while
+// whenever a new matching item appears.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startIssueWatcher(config *ConfigData) {
+	issues := config.Issues
+	if len(issues.Watches) == 0 {
+		return
+	}
+	interval := 120 * time.Second
+	if issues.PollSeconds > 0 {
+		interval = time.Duration(issues.PollSeconds) * time.Second
+	}
+	urgentFor := 10 * time.Minute
+	if issues.UrgentMinutes > 0 {
+		urgentFor = time.Duration(issues.UrgentMinutes) * time.Minute
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	go func() {
+		seen := make([]map[string]bool, len(issues.Watches))
+		poll := time.NewTicker(interval)
+		expire := time.NewTimer(0)
+		<-expire.C
+		urgent := false
+
+		check := func() {
+			found := false
+			for i, w := range issues.Watches {
+				items, err := w.matchingItems(client)
+				if err != nil {
+					config.logger.Printf("ERROR: Unable to search %s for %q: %v", w.Provider, w.Query, err)
+					continue
+				}
+				if seen[i] != nil {
+					for item := range items {
+						if !seen[i][item] {
+							config.logger.Printf("New item %s matches %q", item, w.Query)
+							found = true
+						}
+					}
+				}
+				seen[i] = items
+			}
+			if found {
+				if !urgent {
+					reportSource(config, "issues", sourceStatus{Urgent: true})
+					urgent = true
+				}
+				if !expire.Stop() {
+					select {
+					case <-expire.C:
+					default:
+					}
+				}
+				expire.Reset(urgentFor)
+			}
+		}
+
+		check()
+		for {
+			select {
+			case <-poll.C:
+				check()
+			case <-expire.C:
+				reportSource(config, "issues", sourceStatus{})
+				urgent = false
+			}
+		}
+	}()
+}
@@ -0,0 +1,61 @@
+//
+// Plenom Kuando Busylight driver.
+//
+// The Kuando Busylight (Alpha and Omega models) is a USB HID device with an
+// RGB light. See rgblight.go for how we show our signals on it.
+//
+// Each command we send it is a little program of up to seven steps; we
+// only ever need the first one, which sets the color and stays there. The
+// device turns itself off if it hasn't heard from us for about 30 seconds,
+// so we repeat the current color every 10 seconds even if it hasn't changed.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import "time"
+
+// kuandoDevices are the USB vendor and product IDs of the Kuando Busylight models.
+var kuandoDevices = [][2]uint16{
+	{0x27bb, 0x3bca}, // Alpha
+	{0x27bb, 0x3bcb}, // UC Alpha
+	{0x27bb, 0x3bcc}, // UC Omega
+	{0x27bb, 0x3bcd}, // Omega
+	{0x27bb, 0x3bce},
+	{0x27bb, 0x3bcf},
+	{0x04d8, 0xf848}, // Alpha (older firmware)
+}
+
+const kuandoKeepAlive = 10 * time.Second
+
+// kuandoCommand builds the report which sets the light to a steady color.
+func kuandoCommand(c rgbColor) []byte {
+	report := make([]byte, 65) // report ID 0 followed by 64 bytes
+	cmd := report[1:]
+
+	// step 0: jump to step 0 (i.e., stay here), no repeat, color as 0-100 levels, no on/off timing, no sound
+	cmd[0] = 0x10
+	cmd[2] = byte(int(c[0]) * 100 / 255)
+	cmd[3] = byte(int(c[1]) * 100 / 255)
+	cmd[4] = byte(int(c[2]) * 100 / 255)
+
+	// after the 7 steps: sensitivity, timeout, trigger, padding, then the checksum
+	cmd[59], cmd[60], cmd[61] = 0xff, 0xff, 0xff
+	sum := 0
+	for _, b := range cmd[:62] {
+		sum += int(b)
+	}
+	cmd[62], cmd[63] = byte(sum>>8), byte(sum)
+	return report
+}
+
+// newKuandoLight makes a driver for the first Kuando Busylight attached to the system.
+func newKuandoLight(config *ConfigData) lightDriver {
+	return newRGBLight(config, &hidDevice{
+		name:    "Kuando Busylight",
+		ids:     kuandoDevices,
+		command: kuandoCommand,
+	}, rgbLightTiming{KeepAlive: kuandoKeepAlive})
+}
@@ -0,0 +1,584 @@
+//
+// Light hardware drivers.
+//
+// The daemon shows its state using a handful of named light signals
+// ("green", "redflash", "urgent", and so on). A driver knows how to show
+// those on a particular kind of hardware: our own serial-port device (see
+// arduino/protocol.txt), one of the RGB lights in rgblight.go, and so on.
+//
+// Each kind of driver is listed in lightDrivers under the name used for it
+// in the Driver setting. Adding a new kind of light means writing a type
+// which implements lightDriver and adding it there.
+//
+// Finding our own hardware may mean asking each serial port in turn what's
+// there, which can take several seconds, so the serial driver is a
+// lightFinder: it looks for its port in the background, and the main loop
+// carries on meanwhile, finishing opening the light when it's found.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// lightDriver is the hardware we show our light signals on.
+type lightDriver interface {
+	Open() error            // find and open the hardware
+	Set(color string) error // show one of the named light signals
+	Close() error
+	HealthCheck() error // is the hardware still there and working?
+}
+
+// lightFinder is a driver which may take a while to find its hardware, so
+// that's done on its own goroutine before Open is called (see openLight).
+// Find mustn't touch anything the main loop uses.
+type lightFinder interface {
+	Find() error
+}
+
+// lightFound is the outcome of looking for a lightFinder's hardware.
+type lightFound struct {
+	light lightDriver
+	err   error
+}
+
+// lightDrivers makes a (not yet opened) driver of each kind we support, by
+// the name used for it in the Driver setting.
+var lightDrivers = map[string]func(config *ConfigData) lightDriver{
+	"serial":  newSerialLight,
+	"blink1":  newBlink1Light,
+	"luxafor": newLuxaforLight,
+	"kuando":  newKuandoLight,
+	"hue":     newHueLight,
+	"mqtt":    newMQTTLight,
+	"remote":  newRemoteLight,
+}
+
+// newLight makes a driver for the light hardware named by the Driver setting.
+func newLight(config *ConfigData) (lightDriver, error) {
+	kind := config.Driver
+	if kind == "" {
+		kind = "serial"
+	}
+	newDriver, known := lightDrivers[kind]
+	if !known {
+		return nil, fmt.Errorf("Unknown light driver \"%s\"", config.Driver)
+	}
+	return newDriver(config), nil
+}
+
+// openLight opens the light hardware and starts using it, reporting whether
+// it's ready. If it can't be opened (say, it's unplugged), we carry on
+// without it, and checkLightHealth keeps trying to open it until it turns
+// up. A lightFinder is looked for in the background instead, and reported
+// to the main loop on config.lightsFound (see foundLight).
+func openLight(config *ConfigData, light lightDriver) bool {
+	if finder, slow := light.(lightFinder); slow {
+		config.finding = light
+		go func() {
+			config.lightsFound <- lightFound{light: light, err: finder.Find()}
+		}()
+		return false
+	}
+	return startLight(config, light, light.Open())
+}
+
+// foundLight finishes opening a light we looked for in the background,
+// reporting whether it's ready.
+func foundLight(config *ConfigData, found lightFound) bool {
+	if found.light != config.finding {
+		// (we've given up on it since, say because we were reconfigured)
+		if found.err == nil {
+			found.light.Close()
+		}
+		return false
+	}
+	config.finding = nil
+	if found.err == nil {
+		found.err = found.light.Open()
+	}
+	return startLight(config, found.light, found.err)
+}
+
+// startLight starts using the light, if it could be opened, and reports
+// whether it could.
+func startLight(config *ConfigData, light lightDriver, err error) bool {
+	if err != nil {
+		if !config.lightLost {
+			config.logger.Printf("ERROR: Unable to open the light (will keep trying): %v", err)
+			config.lightLost = true
+		}
+		return false
+	}
+	if config.lightLost {
+		config.hardwareFault = false
+		config.logger.Printf("Light is working again")
+	}
+	config.light = light
+	config.lightLost = false
+	config.lastSignal = ""
+	return true
+}
+
+// loseLight closes the light after it stops working, so we can try to open
+// it again (it may only have been unplugged for a moment).
+func loseLight(config *ConfigData) {
+	config.light.Close()
+	config.light = nil
+	config.lightLost = true
+	config.logger.Printf("Closed the light; will keep trying to open it again")
+}
+
+// serialLight is our own busylight hardware, on a serial port.
+type serialLight struct {
+	config   *ConfigData
+	port     serial.Port
+	incoming <-chan []byte // what the hardware sends us
+	writer   serialWriter  // writes our commands to the port
+	effects  animator      // plays any effects the hardware can't do itself
+	started  bool          // have we started using the port (see Open)?
+	settings *ConfigData   // the settings to find the port with (see Find)
+	quiet    bool          // don't log our search (we're waiting for a lost light to come back)
+}
+
+func newSerialLight(config *ConfigData) lightDriver {
+	return &serialLight{config: config, settings: pollingSettings(config), quiet: config.lightLost}
+}
+
+// serialColorCodes maps the light signals to the commands the hardware
+// understands (unless configured otherwise; see lightsignals.go).
+var serialColorCodes = map[string]string{
+	"blue":     "B",
+	"green":    "G",
+	"off":      "X",
+	"red":      "R",
+	"red2":     "2",
+	"redflash": "#",
+	"urgent":   "%",
+	"yellow":   "Y",
+	"lowpri":   "@",
+}
+
+// Find looks for the port our hardware is on (see openSerialPort), which
+// may take a while if we have to ask each one what's there.
+func (l *serialLight) Find() error {
+	port, incoming, err := openSerialPort(l.settings, l.quiet)
+	if err != nil {
+		return err
+	}
+	l.port, l.incoming = port, incoming
+	return nil
+}
+
+// Open starts using the port Find found (looking for it now, if it hasn't).
+func (l *serialLight) Open() error {
+	if l.port == nil {
+		if err := l.Find(); err != nil {
+			return err
+		}
+	}
+	l.writer.start(l.port, l.config.logger, l.config.SerialAcks)
+	go l.listen()
+	l.effects.start(rgbLightTiming{})
+	l.started = true
+	return nil
+}
+
+// serialAck is what the hardware sends back for each command, if its
+// firmware acknowledges them (see arduino/protocol.txt).
+const serialAck = '+'
+
+// listen watches what the hardware sends us for button presses and
+// acknowledgements. It returns when the port is closed.
+func (l *serialLight) listen() {
+	for data := range l.incoming {
+		for _, b := range data {
+			if b == serialAck {
+				l.writer.acknowledged()
+			}
+		}
+		if code := currentSettings(l.config).Button.SerialCode; code != "" && strings.Contains(string(data), code) {
+			pressButton(l.config, "light hardware")
+		}
+	}
+}
+
+// readSerialPort reads everything the hardware sends us, passing it along
+// on the channel it returns (which is closed when the port is).
+func readSerialPort(port serial.Port) <-chan []byte {
+	incoming := make(chan []byte, 16)
+	go func() {
+		defer close(incoming)
+		for {
+			buf := make([]byte, 64)
+			n, err := port.Read(buf)
+			if err != nil || n == 0 {
+				return
+			}
+			incoming <- buf[:n]
+		}
+	}()
+	return incoming
+}
+
+// serialIdentifyTimeout is how long we give the hardware to identify
+// itself. (Opening the port restarts many Arduino boards, which then take a
+// couple of seconds to start listening.)
+const serialIdentifyTimeout = 4 * time.Second
+
+// identifySerialDevice asks the hardware what it is, returning its answer
+// ("busylight <model> <firmware version>"; see arduino/protocol.txt), or an
+// error if it doesn't answer as a busylight.
+func identifySerialDevice(port serial.Port, incoming <-chan []byte) (string, error) {
+	ask := time.NewTicker(500 * time.Millisecond)
+	defer ask.Stop()
+	giveUp := time.After(serialIdentifyTimeout)
+	var reply string
+	port.Write([]byte("?"))
+	for {
+		select {
+		case data, open := <-incoming:
+			if !open {
+				return "", fmt.Errorf("the port was closed")
+			}
+			reply += string(data)
+			if start := strings.Index(reply, "busylight "); start >= 0 {
+				if end := strings.IndexByte(reply[start:], '\n'); end >= 0 {
+					return strings.TrimSpace(reply[start : start+end]), nil
+				}
+			}
+		case <-ask.C:
+			port.Write([]byte("?"))
+		case <-giveUp:
+			return "", fmt.Errorf("the device didn't identify itself as a busylight (is its firmware up to date?)")
+		}
+	}
+}
+
+// openSerialDevice opens a serial port, and if we're to make sure that
+// what's there is a busylight, asks it.
+func openSerialDevice(config *ConfigData, path string) (serial.Port, <-chan []byte, error) {
+	port, err := serial.Open(path, &serial.Mode{BaudRate: config.BaudRate})
+	if err != nil {
+		return nil, nil, err
+	}
+	incoming := readSerialPort(port)
+	if config.SerialIdentify {
+		identity, err := identifySerialDevice(port, incoming)
+		if err != nil {
+			port.Close()
+			return nil, nil, err
+		}
+		config.logger.Printf("Found %s on %s", identity, path)
+	}
+	return port, incoming, nil
+}
+
+// Set shows a light signal. The hardware adds the "lowpri" strobe to
+// whatever it's showing already, so that doesn't interrupt any effect.
+func (l *serialLight) Set(color string) error {
+	command, valid := serialCommand(l.config, color)
+	if !valid {
+		return fmt.Errorf("not defined")
+	}
+	if color == "lowpri" {
+		return l.writer.write(command)
+	}
+	off, _ := serialCommand(l.config, "off")
+	return l.effects.play(serialPattern(l.config, color), func(c rgbColor) error {
+		if c == rgbOff {
+			return l.writer.write(off)
+		}
+		return l.writer.write(command)
+	})
+}
+
+func (l *serialLight) Close() error {
+	if l.started {
+		l.effects.stop()
+		l.writer.stop()
+	}
+	return l.port.Close()
+}
+
+// HealthCheck makes sure our writes are getting through, and asks the port
+// for its modem status, which fails if the device has been unplugged.
+func (l *serialLight) HealthCheck() error {
+	if err := l.writer.failure(); err != nil {
+		return err
+	}
+	_, err := l.port.GetModemStatusBits()
+	return err
+}
+
+// serialWriteTimeout is how long a command may take to write before we
+// decide the device is wedged.
+const serialWriteTimeout = 2 * time.Second
+
+// serialQueueLength is how many commands may be waiting to be written.
+const serialQueueLength = 16
+
+// serialAckTimeout is how long we wait for the hardware to acknowledge a
+// command (if it does), and serialRetries how many more times we send it
+// if it doesn't.
+const (
+	serialAckTimeout = time.Second
+	serialRetries    = 2
+)
+
+// serialWriter writes commands to a serial port in the background, so a
+// wedged device can't hold up the main loop. Once a write fails (or takes
+// too long, or goes unacknowledged), the rest are skipped, and the error is
+// returned for the next command queued and by the next health check, so
+// the main loop closes the light and tries to open it again.
+type serialWriter struct {
+	port     serial.Port
+	logger   *log.Logger
+	commands chan string
+	acks     chan struct{} // acknowledgements from the hardware (nil if we don't wait for them)
+	quit     chan struct{} // closed to stop
+	finished chan struct{} // closed once we've stopped
+
+	lock sync.Mutex // protects err
+	err  error      // why writing failed, if it has
+}
+
+// start starts writing to a port, waiting for each command to be
+// acknowledged if waitForAcks is set.
+func (w *serialWriter) start(port serial.Port, logger *log.Logger, waitForAcks bool) {
+	w.port, w.logger = port, logger
+	w.commands = make(chan string, serialQueueLength)
+	w.acks = nil
+	if waitForAcks {
+		w.acks = make(chan struct{}, serialQueueLength)
+	}
+	w.quit = make(chan struct{})
+	w.finished = make(chan struct{})
+	w.err = nil
+	go w.run()
+}
+
+// write queues a command to be written. If too many are waiting already,
+// the device isn't keeping up, and we give up on it.
+func (w *serialWriter) write(command string) error {
+	if err := w.failure(); err != nil {
+		return err
+	}
+	select {
+	case <-w.quit:
+		return fmt.Errorf("the light is closed")
+	default:
+	}
+	select {
+	case w.commands <- command:
+		return nil
+	default:
+		w.fail(fmt.Errorf("the light isn't keeping up (%d commands waiting)", serialQueueLength))
+		return w.failure()
+	}
+}
+
+// acknowledged passes along an acknowledgement from the hardware.
+func (w *serialWriter) acknowledged() {
+	if w.acks == nil {
+		return
+	}
+	select {
+	case w.acks <- struct{}{}:
+	default:
+	}
+}
+
+// failure returns the reason writing failed, if it has.
+func (w *serialWriter) failure() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.err
+}
+
+func (w *serialWriter) fail(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// stop writes whatever is still waiting (giving up if the device is wedged)
+// and stops.
+func (w *serialWriter) stop() {
+	close(w.quit)
+	select {
+	case <-w.finished:
+	case <-time.After(serialWriteTimeout):
+	}
+}
+
+func (w *serialWriter) run() {
+	defer close(w.finished)
+	for {
+		var command string
+		select {
+		case command = <-w.commands:
+		case <-w.quit:
+			select {
+			case command = <-w.commands:
+			default:
+				return
+			}
+		}
+		if w.failure() != nil {
+			continue
+		}
+		if err := w.send(command); err != nil {
+			w.fail(err)
+		}
+	}
+}
+
+// send writes a command, waiting for the hardware to acknowledge it if we
+// do that (and sending it again if it doesn't).
+func (w *serialWriter) send(command string) error {
+	for attempt := 0; ; attempt++ {
+		// (forget any acknowledgements which came too late before)
+		for len(w.acks) > 0 {
+			<-w.acks
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, err := w.port.Write([]byte(command))
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-time.After(serialWriteTimeout):
+			return fmt.Errorf("writing to the light took longer than %v", serialWriteTimeout)
+		}
+		if w.acks == nil {
+			return nil
+		}
+		select {
+		case <-w.acks:
+			return nil
+		case <-time.After(serialAckTimeout):
+		}
+		if attempt == serialRetries {
+			return fmt.Errorf("the light didn't acknowledge \"%s\" (tried %d times)", command, serialRetries+1)
+		}
+		w.logger.Printf("WARNING: The light didn't acknowledge \"%s\"; sending it again", command)
+	}
+}
+
+// openSerialPort opens the serial port our hardware is attached to: either
+// the one named by Device, or the first one in DeviceDir matching
+// DeviceRegexp. If quiet, we don't log the search.
+func openSerialPort(config *ConfigData, quiet bool) (serial.Port, <-chan []byte, error) {
+	// If the user had a specific port in mind, just use that.
+	if config.Device != "" {
+		port, incoming, err := openSerialDevice(config, config.Device)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Can't open serial device %v: %v", config.Device, err)
+		}
+		return port, incoming, nil
+	}
+
+	// On the other hand, maybe we should hunt around to find it.
+	// This is necessary on systems where the USB port is given a
+	// random device name every time. (We don't log every search while
+	// waiting for a lost light to come back, though: that's quiet.)
+	//
+	// Without a DeviceDir to search (as on Windows, where there is no
+	// directory of devices, and the ports are just COM1, COM2, ...), we ask
+	// the system for its list of serial ports instead.
+	where := config.DeviceDir
+	if where == "" {
+		where = "the system's serial ports"
+	}
+	if !quiet {
+		config.logger.Printf("Searching for available device port in %s...", where)
+	}
+	type candidate struct {
+		name string // what we match against DeviceRegexp
+		path string // what we open
+	}
+	var candidates []candidate
+	if config.DeviceDir == "" {
+		ports, err := serial.GetPortsList()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Can't list serial ports: %v", err)
+		}
+		for _, p := range ports {
+			candidates = append(candidates, candidate{name: p, path: p})
+		}
+	} else {
+		fileList, err := os.ReadDir(config.DeviceDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Can't scan directory %s: %v", config.DeviceDir, err)
+		}
+		for _, f := range fileList {
+			if !f.IsDir() {
+				candidates = append(candidates, candidate{name: f.Name(), path: fmt.Sprintf("%s%c%s", config.DeviceDir, os.PathSeparator, f.Name())})
+			}
+		}
+	}
+	for _, c := range candidates {
+		ok, err := regexp.MatchString(config.DeviceRegexp, c.name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Matching %s vs %s: %v", c.name, config.DeviceRegexp, err)
+		}
+		if ok {
+			port, incoming, err := openSerialDevice(config, c.path)
+			if err == nil {
+				config.logger.Printf("Opened %s", c.path)
+				return port, incoming, nil
+			}
+			if config.SerialIdentify && !quiet {
+				config.logger.Printf("Skipping %s: %v", c.path, err)
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("Unable to open any device matching /%s/ in %s.", config.DeviceRegexp, where)
+}
+
+// checkLightHealth makes sure the light hardware is still working, so we
+// notice it's gone wrong even if we haven't changed the light in a while.
+// If we've lost the light, we try to open it again, and report whether it's
+// back (so the main loop can show on it whatever it should be showing).
+func checkLightHealth(config *ConfigData) (reopened bool) {
+	if config.lightLost {
+		if config.finding != nil {
+			return false // (we're still looking for it)
+		}
+		if light, err := newLight(config); err == nil {
+			return openLight(config, light)
+		}
+		return false
+	}
+	if config.light == nil {
+		return false
+	}
+	if err := config.light.HealthCheck(); err != nil {
+		if !config.hardwareFault {
+			config.hardwareFault = true
+			config.logger.Printf("ERROR: Light hardware is not working: %v", err)
+			pushNotify(config, "hardware", "The light is not working: %v", err)
+		}
+		loseLight(config)
+	}
+	return false
+}
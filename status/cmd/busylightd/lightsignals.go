@@ -0,0 +1,209 @@
+//
+// Configurable light signals.
+//
+// Each state is shown on the light with a light signal ("green", "redflash",
+// and so on). How each signal is shown depends on the light: our own serial
+// hardware is sent a one-letter command for it, and the RGB lights show it
+// as a color or a pattern of colors. The LightSignals setting may change how
+// any of these are shown (for a home-built light which expects different
+// commands, say) or add new ones for the user's own states. It may also give
+// a signal an effect (see effects.go), which the daemon plays itself, on any
+// light, rather than leaving it to the hardware.
+//
+// Every signal the states need must be something the light can show; we
+// check that at startup, rather than finding out when the state comes up.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// LightSignalConfigData says how to show one light signal.
+type LightSignalConfigData struct {
+	Command string   // what to send our serial hardware to show it (e.g., "G")
+	Colors  []string // what RGB lights show: a color (e.g., "#00ff00"), or several to flash between
+	Effect  string   // how to show it over time (default "steady", or "alternate" for several Colors)
+	Hz      float64  // how many times per second the effect repeats (default depends on the effect)
+}
+
+// builtinLightSignals are signals we define just as though they were in the
+// LightSignals setting (so they may be redefined there in the same way).
+var builtinLightSignals = map[string]LightSignalConfigData{
+	"degraded": {Command: "B", Colors: []string{"#8000ff"}, Effect: "double-pulse", Hz: 0.75},
+	"flash":    {Command: "R", Colors: []string{"#ff0000"}, Effect: "blink", Hz: 2},
+	"warning":  {Command: "Y", Colors: []string{"#ffa000"}, Effect: "blink", Hz: 0.5},
+}
+
+// lightSignalSettings returns the definitions of the signals from the
+// LightSignals setting, along with our own built-in ones.
+func lightSignalSettings(config *ConfigData) map[string]LightSignalConfigData {
+	settings := make(map[string]LightSignalConfigData)
+	for signal, s := range builtinLightSignals {
+		settings[signal] = s
+	}
+	for signal, s := range config.LightSignals {
+		settings[signal] = s
+	}
+	return settings
+}
+
+// parseRGBColor understands a color written as "#rrggbb".
+func parseRGBColor(s string) (rgbColor, error) {
+	var c rgbColor
+	digits, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(digits) != 3 {
+		return c, fmt.Errorf("can't understand color \"%s\" (expected \"#rrggbb\")", s)
+	}
+	copy(c[:], digits)
+	return c, nil
+}
+
+// effect returns the effect the signal is shown with.
+func (s LightSignalConfigData) effect() string {
+	switch {
+	case s.Effect != "":
+		return s.Effect
+	case len(s.Colors) > 1:
+		return "alternate"
+	default:
+		return "steady"
+	}
+}
+
+// pattern turns the configured colors and effect into a pattern for an RGB
+// light. Without any Colors, the signal's usual color is used (if it has one).
+func (s LightSignalConfigData) pattern(signal string) ([]rgbStep, error) {
+	if err := checkEffect(s.effect(), s.Hz); err != nil {
+		return nil, err
+	}
+	var colors []rgbColor
+	for _, color := range s.Colors {
+		c, err := parseRGBColor(color)
+		if err != nil {
+			return nil, err
+		}
+		colors = append(colors, c)
+	}
+	if len(colors) == 0 {
+		if usual, known := rgbPatterns[signal]; known {
+			colors = append(colors, usual[0].Color)
+		} else {
+			return nil, nil
+		}
+	}
+	return effectPattern(s.effect(), s.Hz, colors...), nil
+}
+
+// serialPattern returns the pattern we play on our serial hardware for a
+// light signal, where its effect is done by the daemon rather than by the
+// hardware. Any step which isn't off shows the signal's command.
+func serialPattern(config *ConfigData, signal string) []rgbStep {
+	if s, configured := lightSignalSettings(config)[signal]; configured && s.Effect != "" {
+		return effectPattern(s.Effect, s.Hz, rgbColor{255, 255, 255})
+	}
+	return []rgbStep{{Color: rgbColor{255, 255, 255}}}
+}
+
+// serialCommand returns the command which shows a light signal on our serial hardware.
+func serialCommand(config *ConfigData, signal string) (string, bool) {
+	if s, configured := lightSignalSettings(config)[signal]; configured && s.Command != "" {
+		return s.Command, true
+	}
+	command, known := serialColorCodes[signal]
+	return command, known
+}
+
+// rgbSignalPatterns returns how an RGB light shows each light signal.
+// (Any configured colors which can't be understood were rejected at startup
+// by checkLightSignals.)
+func rgbSignalPatterns(config *ConfigData) map[string][]rgbStep {
+	patterns := make(map[string][]rgbStep)
+	for signal, pattern := range rgbPatterns {
+		patterns[signal] = pattern
+	}
+	for signal, s := range lightSignalSettings(config) {
+		if pattern, err := s.pattern(signal); err == nil && len(pattern) > 0 {
+			patterns[signal] = pattern
+		}
+	}
+	return patterns
+}
+
+// signalRate returns how many times per second a light signal repeats, as
+// far as we know (1, for the ones the hardware does by itself).
+func signalRate(config *ConfigData, signal string) float64 {
+	if s, configured := lightSignalSettings(config)[signal]; configured {
+		if s.Hz > 0 {
+			return s.Hz
+		}
+		if hz := effectRates[s.effect()]; hz > 0 {
+			return hz
+		}
+	}
+	return 1
+}
+
+// lightSignalDefined reports whether the configured light can show a light signal.
+func lightSignalDefined(config *ConfigData, signal string) bool {
+	switch config.Driver {
+	case "", "serial":
+		_, defined := serialCommand(config, signal)
+		return defined
+	case "mqtt":
+		return true // (whatever's listening can make of it what it likes)
+	case "remote":
+		return true // (the light server tells us if it can't show one)
+	default:
+		return signal == "lowpri" || rgbSignalPatterns(config)[signal] != nil
+	}
+}
+
+// checkLightSignals makes sure the LightSignals setting makes sense, and
+// that the light can show every signal our states need.
+func checkLightSignals(config *ConfigData) error {
+	driver := config.Driver
+	if driver == "" {
+		driver = "serial"
+	}
+	for signal, s := range config.LightSignals {
+		if s.Command == "" && len(s.Colors) == 0 && s.Effect == "" {
+			return fmt.Errorf("Light signal \"%s\" needs a Command, Colors, or an Effect", signal)
+		}
+		if _, err := s.pattern(signal); err != nil {
+			return fmt.Errorf("Light signal \"%s\": %v", signal, err)
+		}
+		if driver == "serial" && s.Effect == "breathe" {
+			return fmt.Errorf("Light signal \"%s\": the serial light can't fade, so can't breathe", signal)
+		}
+	}
+	if _, known := lightDrivers[driver]; !known {
+		return nil // (newLight will complain about this)
+	}
+
+	need := map[string]string{"blue": "startup", "lowpri": "the low-priority indicator"}
+	for state, signal := range stateColors {
+		need[signal] = "state \"" + state + "\""
+	}
+	for _, name := range customStateNames(config) {
+		need[config.States[name].Signal] = "state \"" + name + "\""
+	}
+	if config.SnoozeSignal != "" {
+		need[config.SnoozeSignal] = "snoozing"
+	}
+	if len(config.QuietHours.Hours) > 0 {
+		need[config.QuietHours.quietSignal()] = "quiet hours"
+	}
+	for signal, user := range need {
+		if !lightSignalDefined(config, signal) {
+			return fmt.Errorf("Light signal \"%s\" (used for %s) isn't defined for the %s light", signal, user, driver)
+		}
+	}
+	return nil
+}
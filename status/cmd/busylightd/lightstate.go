@@ -0,0 +1,124 @@
+//
+// Working out what the light shows.
+//
+// The main loop keeps track of what it's been told (by the user, by
+// signals, and by the calendars) as indicators, and everything else which
+// has a say in the matter (the automatic sources, the user's overrides, and
+// so on) alongside them as stateInputs. From those, resolveState chooses
+// the overall state (see priority.go), and resolveDisplay decides what goes
+// on the light: usually the state, but a light server client (see
+// remotelight.go), quiet hours, snoozing, and flash notifications each take
+// the light over for a while, in that order.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+// indicators are what the main loop has been told about us.
+type indicators struct {
+	Active      bool // is the daemon active (as opposed to sleeping)?
+	Zoom        bool // has the user told us they're in a call?
+	ZoomMuted   bool // if so, is their microphone muted?
+	Urgent      bool // is the urgent indicator on?
+	LowPriority bool // is the low-priority indicator on?
+	BusyTime    bool // do the calendars say we're busy now?
+}
+
+// stateInputs are everything which decides what the light shows.
+type stateInputs struct {
+	indicators
+	Auto     sourceStatus // what the automatic sources want
+	Force    string       // the state the user forced for a while ("force"), if any
+	Override string       // the user's "busy" or "dnd" override, if any
+	Calendar string       // the state the calendars call for, while BusyTime is set
+	Warning  bool         // should we warn of a meeting about to start?
+	Custom   []string     // the user's own states which are on
+	Quiet    bool         // is it quiet hours?
+	Snoozing bool         // is the light snoozing?
+	Flashing bool         // is a flash notification playing?
+	Remote   string       // the light signal a light server client wants shown, if any (see remotelight.go)
+}
+
+// claims returns the claims on the state, by reason (see priority.go).
+func (in stateInputs) claims() stateClaims {
+	claims := make(stateClaims)
+	if in.Urgent || in.Auto.Urgent {
+		claims["urgent"] = "urgent"
+	}
+	// (what the user tells us about a call wins over what we detect)
+	if in.Zoom {
+		claims["call"] = "zoom-open"
+		if in.ZoomMuted {
+			claims["call"] = "zoom-muted"
+		}
+	} else if in.Auto.InCall {
+		claims["call"] = "zoom-muted"
+		if in.Auto.MicOpen {
+			claims["call"] = "zoom-open"
+		}
+	}
+	if in.Force != "" {
+		claims["force"] = in.Force
+	}
+	if in.Override != "" {
+		claims["override"] = in.Override
+	}
+	if in.Auto.Focus {
+		claims["focus"] = "dnd"
+	}
+	if in.BusyTime {
+		claims["calendar"] = in.Calendar
+	} else if in.Auto.Busy {
+		claims["calendar"] = "busy"
+	}
+	if in.Auto.Away {
+		claims["away"] = "away"
+	}
+	if in.Warning {
+		claims["warning"] = "warning"
+	}
+	for _, name := range in.Custom {
+		claims[name] = name
+	}
+	return claims
+}
+
+// lowPriority reports whether to add the low-priority indicator to the
+// state, given what the automatic sources want.
+func (ind indicators) lowPriority(auto sourceStatus) bool {
+	return ind.LowPriority || auto.LowPriority || auto.OnCall
+}
+
+// resolveState chooses the overall state.
+func resolveState(config *ConfigData, in stateInputs) string {
+	if !in.Active {
+		return "off"
+	}
+	return chooseState(config, in.claims())
+}
+
+// lightDisplay says what goes on the light.
+type lightDisplay struct {
+	Signal string // a light signal to show instead of the state, perhaps with "+lowpri" (empty to show the state)
+	Hold   bool   // leave the light alone (a flash notification has it)
+}
+
+// resolveDisplay decides what goes on the light. While the daemon is
+// asleep, that's always the state ("off").
+func resolveDisplay(config *ConfigData, in stateInputs) lightDisplay {
+	switch {
+	case !in.Active:
+		return lightDisplay{}
+	case in.Remote != "":
+		return lightDisplay{Signal: in.Remote}
+	case in.Quiet:
+		return lightDisplay{Signal: config.QuietHours.quietSignal()}
+	case in.Snoozing:
+		return lightDisplay{Signal: snoozeSignal(config)}
+	case in.Flashing:
+		return lightDisplay{Hold: true}
+	}
+	return lightDisplay{}
+}
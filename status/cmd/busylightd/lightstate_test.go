@@ -0,0 +1,201 @@
+//
+// Tests for working out which state the light shows.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStateConfig has a couple of the user's own states, and the default
+// priority order.
+func testStateConfig() *ConfigData {
+	return &ConfigData{
+		States: map[string]CustomStateConfigData{
+			"lunch": {Signal: "blue"},
+			"onair": {Signal: "redflash"},
+		},
+	}
+}
+
+func TestResolveState(t *testing.T) {
+	active := indicators{Active: true}
+	tests := []struct {
+		name string
+		in   stateInputs
+		want string
+	}{
+		{"asleep", stateInputs{indicators: indicators{Urgent: true}, Force: "dnd"}, "off"},
+		{"nothing claimed", stateInputs{indicators: active}, "free"},
+
+		// the calendar
+		{"calendar", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "busy"}, "busy"},
+		{"calendar's own state", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "dnd"}, "dnd"},
+		{"calendar state without busy time", stateInputs{indicators: active, Calendar: "dnd"}, "free"},
+		{"source busy", stateInputs{indicators: active, Auto: sourceStatus{Busy: true}}, "busy"},
+		{"warning", stateInputs{indicators: active, Warning: true}, "warning"},
+		{"calendar over warning", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "busy", Warning: true}, "busy"},
+		{"away", stateInputs{indicators: active, Auto: sourceStatus{Away: true}}, "away"},
+		{"calendar over away", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "busy", Auto: sourceStatus{Away: true}}, "busy"},
+		{"focus over calendar", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "busy", Auto: sourceStatus{Focus: true}}, "dnd"},
+
+		// calls
+		{"call, muted", stateInputs{indicators: indicators{Active: true, Zoom: true, ZoomMuted: true}}, "zoom-muted"},
+		{"call, open", stateInputs{indicators: indicators{Active: true, Zoom: true}}, "zoom-open"},
+		{"detected call", stateInputs{indicators: active, Auto: sourceStatus{InCall: true}}, "zoom-muted"},
+		{"detected call, mic open", stateInputs{indicators: active, Auto: sourceStatus{InCall: true, MicOpen: true}}, "zoom-open"},
+		{"call over calendar", stateInputs{indicators: indicators{Active: true, Zoom: true, BusyTime: true}, Calendar: "dnd"}, "zoom-open"},
+		{"detected call over calendar", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "busy", Auto: sourceStatus{InCall: true}}, "zoom-muted"},
+
+		// manual states
+		{"override", stateInputs{indicators: active, Override: "dnd"}, "dnd"},
+		{"override over calendar", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "busy", Override: "dnd"}, "dnd"},
+		{"call over override", stateInputs{indicators: indicators{Active: true, Zoom: true}, Override: "dnd"}, "zoom-open"},
+		{"force over call", stateInputs{indicators: indicators{Active: true, Zoom: true}, Force: "free"}, "free"},
+		{"force over calendar", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "busy", Force: "lunch"}, "lunch"},
+		{"urgent over force", stateInputs{indicators: indicators{Active: true, Urgent: true}, Force: "free"}, "urgent"},
+		{"source urgent over call", stateInputs{indicators: indicators{Active: true, Zoom: true}, Auto: sourceStatus{Urgent: true}}, "urgent"},
+		{"own state", stateInputs{indicators: active, Custom: []string{"lunch"}}, "lunch"},
+		{"own state over override", stateInputs{indicators: active, Override: "busy", Custom: []string{"lunch"}}, "lunch"},
+		{"call over own state", stateInputs{indicators: indicators{Active: true, Zoom: true}, Custom: []string{"lunch"}}, "zoom-open"},
+
+		// the low-priority indicator doesn't change the state
+		{"low priority alone", stateInputs{indicators: indicators{Active: true, LowPriority: true}}, "free"},
+		{"low priority with calendar", stateInputs{indicators: indicators{Active: true, LowPriority: true, BusyTime: true}, Calendar: "busy"}, "busy"},
+		{"on call with call", stateInputs{indicators: indicators{Active: true, Zoom: true}, Auto: sourceStatus{OnCall: true, LowPriority: true}}, "zoom-open"},
+
+		// two claims for the same reason
+		{"our word over detected call", stateInputs{indicators: indicators{Active: true, Zoom: true, ZoomMuted: true}, Auto: sourceStatus{InCall: true, MicOpen: true}}, "zoom-muted"},
+		{"calendar over source busy", stateInputs{indicators: indicators{Active: true, BusyTime: true}, Calendar: "dnd", Auto: sourceStatus{Busy: true}}, "dnd"},
+		{"own states in name order", stateInputs{indicators: active, Custom: []string{"onair", "lunch"}}, "lunch"},
+	}
+
+	config := testStateConfig()
+	for _, test := range tests {
+		if got := resolveState(config, test.in); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestChooseStatePriority(t *testing.T) {
+	claims := stateClaims{
+		"call":     "zoom-open",
+		"calendar": "busy",
+		"override": "dnd",
+		"lunch":    "lunch",
+		"onair":    "onair",
+	}
+	tests := []struct {
+		priority []string
+		want     string
+	}{
+		{nil, "zoom-open"},
+		{[]string{"calendar"}, "busy"},
+		{[]string{"CALENDAR"}, "busy"},
+		{[]string{"override", "call"}, "lunch"},
+		{[]string{"override", "call", "lunch", "onair"}, "dnd"},
+		{[]string{"onair"}, "onair"},
+		{[]string{"call", "onair"}, "zoom-open"},
+		{[]string{"urgent", "force", "away"}, "zoom-open"},
+	}
+
+	for _, test := range tests {
+		config := testStateConfig()
+		config.StatePriority = test.priority
+		if got := chooseState(config, claims); got != test.want {
+			t.Errorf("StatePriority %v: got %q, want %q", test.priority, got, test.want)
+		}
+	}
+}
+
+func TestLowPriority(t *testing.T) {
+	tests := []struct {
+		ind  indicators
+		auto sourceStatus
+		want bool
+	}{
+		{indicators{}, sourceStatus{}, false},
+		{indicators{LowPriority: true}, sourceStatus{}, true},
+		{indicators{}, sourceStatus{LowPriority: true}, true},
+		{indicators{}, sourceStatus{OnCall: true}, true},
+		{indicators{Urgent: true}, sourceStatus{Busy: true}, false},
+	}
+
+	for _, test := range tests {
+		if got := test.ind.lowPriority(test.auto); got != test.want {
+			t.Errorf("%+v with %+v: got %v, want %v", test.ind, test.auto, got, test.want)
+		}
+	}
+}
+
+func TestCustomStateExpiry(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		states      activeStates
+		in          stateInputs
+		wantExpired []string
+		want        string
+	}{
+		{
+			name:   "not yet",
+			states: activeStates{"lunch": now.Add(time.Minute)},
+			want:   "lunch",
+		},
+		{
+			name:        "just ended",
+			states:      activeStates{"lunch": now},
+			wantExpired: []string{"lunch"},
+			want:        "free",
+		},
+		{
+			name:   "no end",
+			states: activeStates{"onair": {}},
+			want:   "onair",
+		},
+		{
+			name:        "ended, leaving the calendar",
+			states:      activeStates{"lunch": now.Add(-time.Minute)},
+			in:          stateInputs{indicators: indicators{BusyTime: true}, Calendar: "busy"},
+			wantExpired: []string{"lunch"},
+			want:        "busy",
+		},
+		{
+			name:        "one of two ended",
+			states:      activeStates{"lunch": now.Add(-time.Second), "onair": now.Add(time.Hour)},
+			wantExpired: []string{"lunch"},
+			want:        "onair",
+		},
+		{
+			name:        "both ended",
+			states:      activeStates{"lunch": now.Add(-time.Second), "onair": now.Add(-time.Hour)},
+			in:          stateInputs{Override: "dnd"},
+			wantExpired: []string{"lunch", "onair"},
+			want:        "dnd",
+		},
+	}
+
+	config := testStateConfig()
+	for _, test := range tests {
+		expired := test.states.expire(now)
+		if !reflect.DeepEqual(expired, test.wantExpired) {
+			t.Errorf("%s: expired %v, want %v", test.name, expired, test.wantExpired)
+		}
+
+		in := test.in
+		in.Active = true
+		for name := range test.states {
+			in.Custom = append(in.Custom, name)
+		}
+		if got := resolveState(config, in); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
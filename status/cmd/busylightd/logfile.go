@@ -0,0 +1,106 @@
+//
+// Log file rotation.
+//
+// A daemon which runs for months would otherwise append to its log file
+// forever. If configured, we start a new log file when the current one gets
+// too big or too old, keeping a few of the old ones as LogFile.1 (the most
+// recent), LogFile.2, and so on.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogRotationConfigData says when to start a new log file.
+type LogRotationConfigData struct {
+	MaxSizeMB  int // start a new log file when it reaches this size (0 for no limit)
+	MaxAgeDays int // start a new log file when it's this old (0 for no limit)
+	Keep       int // how many old log files to keep (default 5)
+}
+
+// rotatingLog is a log file which rotates itself as configured.
+type rotatingLog struct {
+	path     string
+	settings LogRotationConfigData
+
+	lock    sync.Mutex // protects everything below
+	file    *os.File
+	size    int64
+	started time.Time // when the current file was started
+}
+
+// openRotatingLog opens the log file for appending.
+func openRotatingLog(path string, settings LogRotationConfigData) (*rotatingLog, error) {
+	l := &rotatingLog{path: path, settings: settings}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *rotatingLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size, l.started = f, info.Size(), info.ModTime()
+	if l.size == 0 {
+		l.started = time.Now()
+	}
+	return nil
+}
+
+// due reports whether it's time to start a new file before writing n more bytes.
+func (l *rotatingLog) due(n int) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.settings.MaxSizeMB > 0 && l.size+int64(n) > int64(l.settings.MaxSizeMB)<<20 {
+		return true
+	}
+	return l.settings.MaxAgeDays > 0 && time.Since(l.started) > time.Duration(l.settings.MaxAgeDays)*24*time.Hour
+}
+
+// rotate moves the current file (and the older ones) aside and starts a new one.
+func (l *rotatingLog) rotate() error {
+	keep := l.settings.Keep
+	if keep <= 0 {
+		keep = 5
+	}
+	l.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", l.path, keep))
+	for i := keep - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		l.open() // (carry on with the one we have)
+		return err
+	}
+	return l.open()
+}
+
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.due(len(p)) {
+		if err := l.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "busylightd: unable to rotate log file %s: %v\n", l.path, err)
+		}
+	}
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
@@ -0,0 +1,29 @@
+//
+// Luxafor flag driver.
+//
+// The Luxafor Flag (and the other Luxafor USB lights, which speak the same
+// protocol) is a USB HID device with six RGB LEDs. See rgblight.go for how
+// we show our signals on it.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+const (
+	luxaforVendorID  = 0x04d8
+	luxaforProductID = 0xf372
+)
+
+// newLuxaforLight makes a driver for the first Luxafor light attached to the system.
+func newLuxaforLight(config *ConfigData) lightDriver {
+	return newRGBLight(config, &hidDevice{
+		name: "Luxafor",
+		ids:  [][2]uint16{{luxaforVendorID, luxaforProductID}},
+		command: func(c rgbColor) []byte {
+			// (no report ID), "static color" command, all LEDs, color
+			return []byte{0, 1, 0xff, c[0], c[1], c[2], 0, 0, 0}
+		},
+	}, rgbLightTiming{})
+}
@@ -0,0 +1,180 @@
+//
+// VIP email urgent trigger.
+//
+// We can keep an IMAP connection open (using IDLE, so the server tells us
+// as soon as anything changes) and make the light urgent when mail arrives
+// from certain people, or with certain subjects. The light stays urgent
+// until those messages have been read, or until they've been waiting for a
+// while (at which point we assume they've been noticed some other way).
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// MailConfigData describes the mailbox to watch and the messages which are urgent.
+type MailConfigData struct {
+	Server   string // IMAP server (with TLS), e.g. "imap.example.com:993"
+	Username string
+	Password string
+	Mailbox  string // mailbox to watch (default "INBOX")
+
+	// Mail from any of these addresses (or, for entries like "@example.com",
+	// any address in that domain) is urgent.
+	Senders []string
+
+	// Mail whose subject contains any of these strings (ignoring case) is urgent.
+	Subjects []string
+
+	// How long an unread urgent message keeps the light urgent (default 30).
+	UrgentMinutes int
+}
+
+// isUrgent reports whether a message is one we should be alerted about.
+func (m MailConfigData) isUrgent(envelope *imap.Envelope) bool {
+	if envelope == nil {
+		return false
+	}
+	for _, from := range envelope.From {
+		address := strings.ToLower(from.Address())
+		for _, sender := range m.Senders {
+			sender = strings.ToLower(sender)
+			if address == sender || (strings.HasPrefix(sender, "@") && strings.HasSuffix(address, sender)) {
+				return true
+			}
+		}
+	}
+	subject := strings.ToLower(envelope.Subject)
+	for _, s := range m.Subjects {
+		if strings.Contains(subject, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// latestUrgentMail finds when the most recent unread urgent message arrived
+// (in the last `within` period). If there isn't one, the zero time is returned.
+func (m MailConfigData) latestUrgentMail(c *client.Client, within time.Duration) (time.Time, error) {
+	var latest time.Time
+	uids, err := c.UidSearch(&imap.SearchCriteria{
+		WithoutFlags: []string{imap.SeenFlag},
+		Since:        time.Now().Add(-within),
+	})
+	if err != nil || len(uids) == 0 {
+		return latest, err
+	}
+
+	set := new(imap.SeqSet)
+	set.AddNum(uids...)
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(set, []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate}, messages)
+	}()
+	for msg := range messages {
+		if m.isUrgent(msg.Envelope) && msg.InternalDate.After(latest) {
+			latest = msg.InternalDate
+		}
+	}
+	return latest, <-done
+}
+
+// watchMailbox logs in to the IMAP server and watches for urgent mail until the connection fails.
+// Each time we find out when the latest urgent message arrived, we send that to `found`.
+func (m MailConfigData) watchMailbox(config *ConfigData, within time.Duration, found chan<- time.Time) error {
+	c, err := client.DialTLS(m.Server, nil)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+	if err = c.Login(m.Username, m.Password); err != nil {
+		return err
+	}
+	mailbox := m.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if _, err = c.Select(mailbox, true); err != nil {
+		return err
+	}
+	config.logger.Printf("Watching %s on %s for urgent mail", mailbox, m.Server)
+
+	updates := make(chan client.Update, 100)
+	c.Updates = updates
+	for {
+		latest, err := m.latestUrgentMail(c, within)
+		if err != nil {
+			return err
+		}
+		found <- latest
+
+		// Wait for the server to tell us something's changed.
+		stop := make(chan struct{})
+		idle := make(chan error, 1)
+		go func() {
+			idle <- c.Idle(stop, nil)
+		}()
+		select {
+		case <-updates:
+			close(stop)
+			if err = <-idle; err != nil {
+				return err
+			}
+		case err = <-idle:
+			return fmt.Errorf("IDLE ended: %v", err)
+		}
+		for len(updates) > 0 {
+			<-updates
+		}
+	}
+}
+
+// startMailWatcher starts watching for urgent mail, if configured to do so.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startMailWatcher(config *ConfigData) {
+	mail := config.Mail
+	if mail.Server == "" {
+		return
+	}
+	urgentFor := 30 * time.Minute
+	if mail.UrgentMinutes > 0 {
+		urgentFor = time.Duration(mail.UrgentMinutes) * time.Minute
+	}
+
+	found := make(chan time.Time)
+	go func() {
+		for {
+			if err := mail.watchMailbox(config, urgentFor, found); err != nil {
+				config.logger.Printf("ERROR: Unable to watch %s for urgent mail: %v (will try again)", mail.Server, err)
+			}
+			time.Sleep(time.Minute)
+		}
+	}()
+
+	go func() {
+		var latest time.Time
+		urgent := false
+		expire := time.NewTicker(time.Minute)
+		for {
+			select {
+			case latest = <-found:
+			case <-expire.C:
+			}
+			if isUrgent := time.Since(latest) < urgentFor; isUrgent != urgent {
+				reportSource(config, "mail", sourceStatus{Urgent: isUrgent})
+				urgent = isUrgent
+			}
+		}
+	}()
+}
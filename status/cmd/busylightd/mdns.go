@@ -0,0 +1,258 @@
+//
+// Peer-to-peer status sharing over multicast DNS.
+//
+// Each daemon on the local network advertises itself as an instance of the
+// _busylight._tcp service, with its current status carried in the instance's
+// TXT record. We announce ourselves whenever our state changes (and
+// periodically in between), answer queries from daemons that have just
+// started up, and listen for everyone else's announcements so we always know
+// the state of the rest of the household without any server or configuration.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// MDNSConfigData controls sharing our status with other daemons on the local network.
+type MDNSConfigData struct {
+	Enabled   bool   // share status with other daemons via mDNS?
+	Interface string // network interface to use (default: let the system choose)
+}
+
+const (
+	mdnsService  = "_busylight._tcp.local."
+	mdnsTTL      = 120 // seconds peers should believe our announcements
+	mdnsCacheBit = 0x8000
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsInstanceName returns the name under which we advertise ourselves.
+func mdnsInstanceName(config *ConfigData) string {
+	name := config.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return strings.ReplaceAll(name, ".", "-")
+}
+
+// mdnsAnnouncement builds an unsolicited mDNS response advertising our status.
+// A ttl of zero tells the other daemons we're going away.
+func mdnsAnnouncement(instance string, status DaemonStatus, ttl uint32) ([]byte, error) {
+	svcName, err := dnsmessage.NewName(mdnsService)
+	if err != nil {
+		return nil, err
+	}
+	instName, err := dnsmessage.NewName(instance + "." + mdnsService)
+	if err != nil {
+		return nil, err
+	}
+
+	txt := []string{
+		"v=1",
+		"state=" + status.State,
+		"since=" + strconv.FormatInt(status.Since.Unix(), 10),
+	}
+	if status.LowPriority {
+		txt = append(txt, "lowpri=1")
+	}
+	if !status.NextTransition.IsZero() {
+		txt = append(txt, "next="+strconv.FormatInt(status.NextTransition.Unix(), 10))
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err = b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if err = b.PTRResource(dnsmessage.ResourceHeader{Name: svcName, Class: dnsmessage.ClassINET, TTL: ttl},
+		dnsmessage.PTRResource{PTR: instName}); err != nil {
+		return nil, err
+	}
+	if err = b.TXTResource(dnsmessage.ResourceHeader{Name: instName, Class: dnsmessage.ClassINET | mdnsCacheBit, TTL: ttl},
+		dnsmessage.TXTResource{TXT: txt}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// mdnsQuery builds a query asking every daemon on the network to announce itself.
+func mdnsQuery() ([]byte, error) {
+	svcName, err := dnsmessage.NewName(mdnsService)
+	if err != nil {
+		return nil, err
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err = b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err = b.Question(dnsmessage.Question{Name: svcName, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// mdnsPeerFromTXT interprets a TXT record announced by another daemon.
+func mdnsPeerFromTXT(name string, ttl uint32, txt []string) PeerStatus {
+	peer := PeerStatus{
+		Name:    strings.TrimSuffix(name, "."+mdnsService),
+		Source:  "mdns",
+		Expires: time.Now().Add(time.Duration(ttl) * time.Second),
+	}
+	for _, field := range txt {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "state":
+			peer.State = kv[1]
+		case "lowpri":
+			peer.LowPriority = kv[1] == "1"
+		case "since", "next":
+			secs, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			if kv[0] == "since" {
+				peer.Since = time.Unix(secs, 0)
+			} else {
+				peer.NextTransition = time.Unix(secs, 0)
+			}
+		}
+	}
+	return peer
+}
+
+// startMDNS joins the mDNS multicast group and begins sharing status with other daemons.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startMDNS(config *ConfigData) error {
+	if !config.MDNS.Enabled {
+		return nil
+	}
+
+	var iface *net.Interface
+	if config.MDNS.Interface != "" {
+		var err error
+		if iface, err = net.InterfaceByName(config.MDNS.Interface); err != nil {
+			return fmt.Errorf("Unable to use network interface %s for mDNS: %v", config.MDNS.Interface, err)
+		}
+	}
+	conn, err := net.ListenMulticastUDP("udp4", iface, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("Unable to listen for mDNS traffic: %v", err)
+	}
+
+	instance := mdnsInstanceName(config)
+	announce := func(status DaemonStatus, ttl uint32) {
+		msg, err := mdnsAnnouncement(instance, status, ttl)
+		if err != nil {
+			config.logger.Printf("ERROR: Unable to build mDNS announcement: %v", err)
+			return
+		}
+		if _, err = conn.WriteToUDP(msg, mdnsGroup); err != nil {
+			config.logger.Printf("ERROR: Unable to send mDNS announcement: %v", err)
+		}
+	}
+
+	//
+	// Listen for other daemons' announcements and queries.
+	//
+	go func() {
+		buf := make([]byte, 9000)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				config.logger.Printf("ERROR: mDNS listener stopped: %v", err)
+				return
+			}
+			var p dnsmessage.Parser
+			header, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			if !header.Response {
+				questions, err := p.AllQuestions()
+				if err != nil {
+					continue
+				}
+				for _, q := range questions {
+					if q.Type == dnsmessage.TypePTR && strings.EqualFold(q.Name.String(), mdnsService) {
+						announce(config.events.Current(), mdnsTTL)
+						break
+					}
+				}
+				continue
+			}
+			if err = p.SkipAllQuestions(); err != nil {
+				continue
+			}
+			answers, err := p.AllAnswers()
+			if err != nil {
+				continue
+			}
+			for _, rr := range answers {
+				txt, ok := rr.Body.(*dnsmessage.TXTResource)
+				name := rr.Header.Name.String()
+				if !ok || !strings.HasSuffix(strings.ToLower(name), mdnsService) {
+					continue
+				}
+				peer := mdnsPeerFromTXT(name, rr.Header.TTL, txt.TXT)
+				if strings.EqualFold(peer.Name, instance) {
+					continue // that's just us
+				}
+				if rr.Header.TTL == 0 {
+					config.logger.Printf("Peer %s (%v) has left the network", peer.Name, from.IP)
+					config.peers.Remove(peer.Name)
+					continue
+				}
+				if config.peers.Update(peer) {
+					config.logger.Printf("Discovered peer %s (%v), currently %s", peer.Name, from.IP, peer.State)
+				}
+			}
+		}
+	}()
+
+	//
+	// Tell everyone about ourselves whenever our state changes, and
+	// often enough in between that they don't forget about us.
+	//
+	events := config.events.Subscribe()
+	go func() {
+		ticker := time.NewTicker(mdnsTTL / 2 * time.Second)
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				announce(event.Status, mdnsTTL)
+			case <-ticker.C:
+				announce(config.events.Current(), mdnsTTL)
+			}
+		}
+	}()
+
+	config.mdnsGoodbye = func() {
+		announce(config.events.Current(), 0)
+		conn.Close()
+	}
+
+	if query, err := mdnsQuery(); err == nil {
+		conn.WriteToUDP(query, mdnsGroup)
+	}
+	config.logger.Printf("Sharing status on the local network as %q", instance)
+	return nil
+}
@@ -0,0 +1,107 @@
+//
+// Tests for sharing our status over mDNS.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestMDNSPeerFromTXT(t *testing.T) {
+	tests := []struct {
+		name     string
+		instance string
+		txt      []string
+		want     PeerStatus
+	}{
+		{
+			name:     "everything",
+			instance: "alice." + mdnsService,
+			txt:      []string{"v=1", "state=busy", "since=1709542800", "lowpri=1", "next=1709546400"},
+			want:     PeerStatus{Name: "alice", State: "busy", Since: time.Unix(1709542800, 0), LowPriority: true, NextTransition: time.Unix(1709546400, 0)},
+		},
+		{
+			name:     "just the state",
+			instance: "bob." + mdnsService,
+			txt:      []string{"state=free"},
+			want:     PeerStatus{Name: "bob", State: "free"},
+		},
+		{
+			name:     "not low priority",
+			instance: "bob." + mdnsService,
+			txt:      []string{"state=dnd", "lowpri=0"},
+			want:     PeerStatus{Name: "bob", State: "dnd"},
+		},
+		{
+			name:     "value with an equals sign",
+			instance: "bob." + mdnsService,
+			txt:      []string{"state=a=b"},
+			want:     PeerStatus{Name: "bob", State: "a=b"},
+		},
+		{
+			name:     "junk ignored",
+			instance: "carol." + mdnsService,
+			txt:      []string{"state", "since=yesterday", "next=", "colour=red", "state=away"},
+			want:     PeerStatus{Name: "carol", State: "away"},
+		},
+	}
+
+	for _, test := range tests {
+		before := time.Now()
+		got := mdnsPeerFromTXT(test.instance, 120, test.txt)
+		if got.Expires.Before(before.Add(120*time.Second)) || got.Expires.After(time.Now().Add(120*time.Second)) {
+			t.Errorf("%s: expires %v, want 120s from now", test.name, got.Expires)
+		}
+		got.Expires = time.Time{}
+		test.want.Source = "mdns"
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMDNSAnnouncementRoundTrip(t *testing.T) {
+	statuses := []DaemonStatus{
+		{State: "busy", Since: time.Unix(1709542800, 0), NextTransition: time.Unix(1709546400, 0)},
+		{State: "free", Since: time.Unix(1709542800, 0), LowPriority: true},
+	}
+
+	for _, status := range statuses {
+		msg, err := mdnsAnnouncement("alice", status, 120)
+		if err != nil {
+			t.Fatalf("%s: %v", status.State, err)
+		}
+		var p dnsmessage.Parser
+		if _, err = p.Start(msg); err != nil {
+			t.Fatalf("%s: %v", status.State, err)
+		}
+		p.SkipAllQuestions()
+		answers, err := p.AllAnswers()
+		if err != nil {
+			t.Fatalf("%s: %v", status.State, err)
+		}
+		found := false
+		for _, rr := range answers {
+			if txt, ok := rr.Body.(*dnsmessage.TXTResource); ok {
+				found = true
+				got := mdnsPeerFromTXT(rr.Header.Name.String(), rr.Header.TTL, txt.TXT)
+				want := PeerStatus{Name: "alice", State: status.State, Since: status.Since, LowPriority: status.LowPriority, NextTransition: status.NextTransition, Source: "mdns"}
+				got.Expires = time.Time{}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %+v, want %+v", status.State, got, want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: no TXT record announced", status.State)
+		}
+	}
+}
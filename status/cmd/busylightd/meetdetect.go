@@ -0,0 +1,149 @@
+//
+// Noticing Google Meet calls.
+//
+// Google Meet runs in a web browser, so there's no app to ask whether we're
+// in a meeting; but while we are, the browser tab's title says so (e.g.,
+// "Meet - abc-defg-hij"). So we poll the titles of the browsers' tabs (on
+// macOS) or windows (elsewhere, which only shows the tab on top in each
+// window), and take a Meet title to mean we're in a call, just as the
+// camera/microphone detection or the Zoom script would tell us. The title
+// doesn't tell us whether we're muted, so we assume we are unless told
+// otherwise (with the open signal or command).
+//
+// On macOS we ask each running browser for its tabs with osascript (which
+// needs permission to control the browser); on Linux we list the windows
+// with wmctrl (under X11); on Windows we ask PowerShell for the programs'
+// main window titles.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"time"
+)
+
+// MeetDetectionConfigData controls noticing Google Meet calls.
+type MeetDetectionConfigData struct {
+	Enabled      bool
+	TitlePattern string // regular expression matching a Meet call's title (default defaultMeetTitlePattern)
+	PollSeconds  int    // how often to check (default 5)
+}
+
+// defaultMeetTitlePattern matches the title Google Meet gives its tab during a call.
+const defaultMeetTitlePattern = `\bMeet [-\x{2013}] \S`
+
+// titlePattern is the regular expression matching a Meet call's title.
+func (m MeetDetectionConfigData) titlePattern() string {
+	if m.TitlePattern == "" {
+		return defaultMeetTitlePattern
+	}
+	return m.TitlePattern
+}
+
+// pollInterval is how often to check.
+func (m MeetDetectionConfigData) pollInterval() time.Duration {
+	if m.PollSeconds == 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(m.PollSeconds) * time.Second
+}
+
+// macBrowsers are the browsers we ask for their tabs on macOS, with the
+// name each gives a tab's title in AppleScript.
+var macBrowsers = map[string]string{
+	"Google Chrome":  "title",
+	"Microsoft Edge": "title",
+	"Brave Browser":  "title",
+	"Chromium":       "title",
+	"Safari":         "name",
+}
+
+// browserTitles gets the titles of the browsers' tabs (or windows, where we
+// can't see the tabs), all run together.
+func browserTitles(config *ConfigData) ([]byte, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		var titles []byte
+		for browser, title := range macBrowsers {
+			// (asking a browser which isn't running would start it)
+			if _, err := config.children.output("pgrep", "-x", browser); err != nil {
+				continue
+			}
+			output, err := config.children.output("osascript", "-e",
+				fmt.Sprintf(`tell application "%s" to get %s of every tab of every window`, browser, title))
+			if err != nil {
+				return nil, fmt.Errorf("Unable to ask %s for its tabs: %v", browser, err)
+			}
+			titles = append(titles, output...)
+		}
+		return titles, nil
+
+	case "windows":
+		return config.children.output("powershell", "-NoProfile", "-Command",
+			"Get-Process | Where-Object {$_.MainWindowTitle} | ForEach-Object {$_.MainWindowTitle}")
+
+	default:
+		return config.children.output("wmctrl", "-l")
+	}
+}
+
+// watchMeetCalls polls the browsers' titles, reporting whether we're in a
+// Meet call each time that changes.
+func watchMeetCalls(config *ConfigData) {
+	settings := currentSettings(config).MeetDetection
+	pattern := regexp.MustCompile(settings.titlePattern())
+	inCall, working := false, true
+	for {
+		titles, err := browserTitles(config)
+		if err != nil {
+			if working {
+				config.logger.Printf("ERROR: Unable to check for Google Meet calls: %v", err)
+			}
+			working = false
+			time.Sleep(settings.pollInterval())
+			continue
+		}
+		if !working {
+			config.logger.Printf("Checking for Google Meet calls again")
+			working = true
+		}
+
+		if nowInCall := pattern.Match(titles); nowInCall != inCall {
+			if nowInCall {
+				config.logger.Printf("In a Google Meet call")
+			} else {
+				config.logger.Printf("Left the Google Meet call")
+			}
+			reportSource(config, "google meet", sourceStatus{InCall: nowInCall})
+			inCall = nowInCall
+		}
+		time.Sleep(settings.pollInterval())
+	}
+}
+
+// checkMeetDetection makes sure the MeetDetection setting makes sense.
+func checkMeetDetection(config *ConfigData) error {
+	m := config.MeetDetection
+	if _, err := regexp.Compile(m.titlePattern()); err != nil {
+		return fmt.Errorf("MeetDetection.TitlePattern isn't a valid regular expression: %v", err)
+	}
+	if m.PollSeconds < 0 {
+		return fmt.Errorf("MeetDetection.PollSeconds can't be negative")
+	}
+	return nil
+}
+
+// startMeetDetection begins watching for Google Meet calls, if enabled.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startMeetDetection(config *ConfigData) {
+	if !config.MeetDetection.Enabled {
+		return
+	}
+	go watchMeetCalls(config)
+}
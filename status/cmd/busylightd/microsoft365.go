@@ -0,0 +1,133 @@
+//
+// Microsoft 365 (Outlook) calendars.
+//
+// Calendars whose Provider is "microsoft" are read from Microsoft Graph
+// rather than Google. The calendar ID is the mailbox's email address, and
+// we ask Graph for its free/busy schedule, which is the same kind of
+// information Google's free/busy query gives us.
+//
+// This needs an Azure AD application registration with the Calendars.Read
+// application permission; we authenticate as that application using its
+// client secret, just as for Teams presence (see teams.go).
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Microsoft365ConfigData describes how we read Microsoft 365 calendars.
+type Microsoft365ConfigData struct {
+	TenantID     string // Azure AD tenant (directory) ID
+	ClientID     string // application (client) ID of our app registration
+	ClientSecret string // client secret of our app registration
+	UserID       string // the user (object ID or user principal name) on whose behalf we query schedules
+}
+
+// microsoftBusyStatuses are the free/busy statuses we count as being busy.
+var microsoftBusyStatuses = map[string]bool{
+	"busy":      true,
+	"tentative": true,
+	"oof":       true,
+}
+
+// microsoftBusyPeriods asks Microsoft Graph when each of the given calendars is busy
+// between start and end, adding what it finds to busy (keyed by calendar ID).
+func microsoftBusyPeriods(ctx context.Context, config *ConfigData, ids []string, start, end time.Time, busy map[string][]BusyPeriod) error {
+	ms := config.Microsoft365
+	if ms.TenantID == "" || ms.ClientID == "" || ms.ClientSecret == "" || ms.UserID == "" {
+		return fmt.Errorf("Unable to query Microsoft 365 calendars: TenantID, ClientID, ClientSecret, and UserID must all be given")
+	}
+	credentials := clientcredentials.Config{
+		ClientID:     ms.ClientID,
+		ClientSecret: ms.ClientSecret,
+		TokenURL:     "https://login.microsoftonline.com/" + url.PathEscape(ms.TenantID) + "/oauth2/v2.0/token",
+		Scopes:       []string{"https://graph.microsoft.com/.default"},
+	}
+	client := credentials.Client(ctx)
+	client.Timeout = 30 * time.Second
+
+	body, err := json.Marshal(map[string]interface{}{
+		"schedules": ids,
+		"startTime": map[string]string{"dateTime": start.UTC().Format("2006-01-02T15:04:05"), "timeZone": "UTC"},
+		"endTime":   map[string]string{"dateTime": end.UTC().Format("2006-01-02T15:04:05"), "timeZone": "UTC"},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://graph.microsoft.com/v1.0/users/"+url.PathEscape(ms.UserID)+"/calendar/getSchedule", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Prefer", `outlook.timezone="UTC"`)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Unable to query Microsoft 365 calendars: %v", err)
+	}
+	defer resp.Body.Close()
+	if err = graphError(resp); err != nil {
+		return fmt.Errorf("Unable to query Microsoft 365 calendars: %v", err)
+	}
+
+	type graphTime struct {
+		DateTime string `json:"dateTime"`
+	}
+	var schedules struct {
+		Value []struct {
+			ScheduleID    string `json:"scheduleId"`
+			ScheduleItems []struct {
+				Status  string    `json:"status"`
+				Subject string    `json:"subject"` // (if the application may see it)
+				Start   graphTime `json:"start"`
+				End     graphTime `json:"end"`
+			} `json:"scheduleItems"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"value"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&schedules); err != nil {
+		return fmt.Errorf("Unable to understand Microsoft 365 schedule: %v", err)
+	}
+
+	// (times are in UTC, as we asked, but without a zone, and with up to 7 fractional digits)
+	const graphTimeLayout = "2006-01-02T15:04:05.9999999"
+	for _, schedule := range schedules.Value {
+		title := config.Calendars[schedule.ScheduleID].Title
+		if schedule.Error != nil {
+			config.logger.Printf("ERROR: Calendar \"%s\": %s", title, schedule.Error.Message)
+			continue
+		}
+		busy[schedule.ScheduleID] = nil
+		for _, item := range schedule.ScheduleItems {
+			if !microsoftBusyStatuses[item.Status] {
+				continue
+			}
+			startTime, err := time.ParseInLocation(graphTimeLayout, item.Start.DateTime, time.UTC)
+			if err != nil {
+				config.logger.Printf("ERROR: %s: Unable to parse start time \"%v\": %v", title, item.Start.DateTime, err)
+				continue
+			}
+			endTime, err := time.ParseInLocation(graphTimeLayout, item.End.DateTime, time.UTC)
+			if err != nil {
+				config.logger.Printf("ERROR: %s: Unable to parse end time \"%v\": %v", title, item.End.DateTime, err)
+				continue
+			}
+			busy[schedule.ScheduleID] = append(busy[schedule.ScheduleID], BusyPeriod{Start: startTime, End: endTime, Title: item.Subject})
+		}
+	}
+	return nil
+}
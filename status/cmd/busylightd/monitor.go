@@ -0,0 +1,123 @@
+//
+// Status-page and health-check monitoring.
+//
+// The light can double as a lightweight uptime beacon: we poll some health
+// URLs (or hosted status pages) and turn on the low-priority indicator, or
+// show urgent, while any of the services they watch is degraded.
+//
+// A plain health URL is degraded if it doesn't answer with a 2xx status.
+// A status page (Atlassian Statuspage's /api/v2/status.json, which many
+// hosted status pages provide) is degraded if it reports any incident.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MonitorCheck is one service to keep an eye on.
+type MonitorCheck struct {
+	Name      string // what to call it in the log (default: the URL)
+	URL       string // health URL or status page to poll
+	Type      string // "http" (the default) or "statuspage"
+	Indicator string // "lowpri" (the default) or "urgent", shown while degraded
+	Failures  int    // how many failures in a row mean it's degraded (default 2)
+}
+
+// MonitorConfigData controls status-page monitoring.
+type MonitorConfigData struct {
+	Checks      []MonitorCheck
+	PollSeconds int // how often to check (default 60)
+}
+
+// healthy polls a service to see if it's working properly.
+func (m MonitorCheck) healthy(client *http.Client) error {
+	resp, err := client.Get(m.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("returned %s", resp.Status)
+	}
+	if m.Type == "statuspage" {
+		var page struct {
+			Status struct {
+				Indicator   string `json:"indicator"`
+				Description string `json:"description"`
+			} `json:"status"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			return fmt.Errorf("unable to read status page: %v", err)
+		}
+		if page.Status.Indicator != "none" {
+			return fmt.Errorf("%s", page.Status.Description)
+		}
+	}
+	return nil
+}
+
+// startMonitor starts polling the configured services, reporting to the main event loop
+// whenever the indicators they call for change.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startMonitor(config *ConfigData) {
+	checks := config.Monitor.Checks
+	if len(checks) == 0 {
+		return
+	}
+	interval := 60 * time.Second
+	if config.Monitor.PollSeconds > 0 {
+		interval = time.Duration(config.Monitor.PollSeconds) * time.Second
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	go func() {
+		var last sourceStatus
+		failures := make([]int, len(checks))
+		for {
+			var status sourceStatus
+			for i, check := range checks {
+				name := check.Name
+				if name == "" {
+					name = check.URL
+				}
+				threshold := check.Failures
+				if threshold <= 0 {
+					threshold = 2
+				}
+
+				if err := check.healthy(client); err != nil {
+					failures[i]++
+					if failures[i] == threshold {
+						config.logger.Printf("Monitored service %s is degraded: %v", name, err)
+					}
+				} else {
+					if failures[i] >= threshold {
+						config.logger.Printf("Monitored service %s has recovered", name)
+					}
+					failures[i] = 0
+				}
+
+				if failures[i] >= threshold {
+					if check.Indicator == "urgent" {
+						status.Urgent = true
+					} else {
+						status.LowPriority = true
+					}
+				}
+			}
+			if status != last {
+				reportSource(config, "monitor", status)
+				last = status
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,253 @@
+//
+// MQTT state publishing.
+//
+// If configured, we publish our state to an MQTT broker, and announce it
+// using Home Assistant's MQTT discovery conventions, so the busylight shows
+// up there as a set of entities which can drive any smart lights or
+// automations you like. With Driver set to "mqtt", the light signals
+// themselves are published too, in place of any light hardware.
+//
+// Everything is published under the configured Topic:
+//    <Topic>/availability  "online" or "offline"
+//    <Topic>/state         the overall state name (e.g., "busy")
+//    <Topic>/attributes    the full daemon status, as JSON
+//    <Topic>/light         the light signal (e.g., "red"), if Driver is "mqtt"
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTTConfigData describes the MQTT broker we publish to.
+type MQTTConfigData struct {
+	Broker          string // broker URL, e.g. "tcp://mqtt.local:1883" or "ssl://mqtt.local:8883"
+	Username        string // credentials for the broker, if it needs them
+	Password        string
+	ClientID        string // our MQTT client ID (default "busylight-<hostname>")
+	Topic           string // base topic we publish under (default "busylight/<hostname>")
+	DiscoveryPrefix string // Home Assistant discovery prefix (default "homeassistant"; "-" to not announce ourselves)
+	Name            string // name of the device in Home Assistant (default "Busylight")
+}
+
+// mqttEntity is one Home Assistant entity we announce.
+type mqttEntity struct {
+	Component string // "sensor" or "binary_sensor"
+	ID        string
+	Name      string
+	Topic     string // which of our topics has its value
+	Template  string // how to get its value from the message, if not the whole message
+	Icon      string
+}
+
+var mqttEntities = []mqttEntity{
+	{Component: "sensor", ID: "state", Name: "State", Topic: "state", Icon: "mdi:traffic-light"},
+	{Component: "binary_sensor", ID: "busy", Name: "Busy", Topic: "attributes", Template: "{{ 'ON' if value_json.BusyNow else 'OFF' }}", Icon: "mdi:calendar-clock"},
+	{Component: "binary_sensor", ID: "in_call", Name: "In a call", Topic: "attributes", Template: "{{ 'ON' if value_json.Zoom else 'OFF' }}", Icon: "mdi:video"},
+	{Component: "binary_sensor", ID: "muted", Name: "Muted", Topic: "attributes", Template: "{{ 'ON' if value_json.Muted else 'OFF' }}", Icon: "mdi:microphone-off"},
+	{Component: "binary_sensor", ID: "urgent", Name: "Urgent", Topic: "attributes", Template: "{{ 'ON' if value_json.Urgent else 'OFF' }}", Icon: "mdi:alert"},
+	{Component: "binary_sensor", ID: "waiting", Name: "Someone waiting", Topic: "attributes", Template: "{{ 'ON' if value_json.Waiting else 'OFF' }}", Icon: "mdi:account-clock"},
+}
+
+// mqttTopic returns the full name of one of our topics.
+func mqttTopic(config *ConfigData, topic string) string {
+	base := config.MQTT.Topic
+	if base == "" {
+		hostname, _ := os.Hostname()
+		base = "busylight/" + mqttSafeName(hostname)
+	}
+	return base + "/" + topic
+}
+
+// mqttClientID is our MQTT client ID, which also identifies us in Home Assistant.
+func mqttClientID(config *ConfigData) string {
+	if config.MQTT.ClientID == "" {
+		hostname, _ := os.Hostname()
+		return "busylight-" + mqttSafeName(hostname)
+	}
+	return config.MQTT.ClientID
+}
+
+// mqttSafeName makes a name usable as a single level of a topic or as a Home Assistant ID.
+func mqttSafeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// mqttPublish sends a retained message to one of our topics. Failures are logged,
+// not returned, since there's nothing else to be done about them.
+func mqttPublish(config *ConfigData, topic string, payload interface{}) {
+	topic = mqttTopic(currentSettings(config), topic)
+	token := config.mqtt.Publish(topic, 1, true, payload)
+	go func() {
+		if token.WaitTimeout(30*time.Second) && token.Error() != nil {
+			config.logger.Printf("ERROR: Unable to publish to MQTT topic %s: %v", topic, token.Error())
+		}
+	}()
+}
+
+// mqttAnnounce publishes the Home Assistant discovery messages for our entities.
+func mqttAnnounce(config *ConfigData) {
+	settings := currentSettings(config)
+	prefix := settings.MQTT.DiscoveryPrefix
+	if prefix == "-" {
+		return
+	}
+	if prefix == "" {
+		prefix = "homeassistant"
+	}
+	name := settings.MQTT.Name
+	if name == "" {
+		name = "Busylight"
+	}
+	node := mqttSafeName(mqttClientID(settings))
+	device := map[string]interface{}{
+		"identifiers":  []string{node},
+		"name":         name,
+		"manufacturer": "Mad Science Zone",
+		"model":        "busylight",
+	}
+
+	entities := mqttEntities
+	if settings.Driver == "mqtt" {
+		entities = append(entities, mqttEntity{Component: "sensor", ID: "light", Name: "Light", Topic: "light", Icon: "mdi:lightbulb"})
+	}
+	for _, entity := range entities {
+		announcement := map[string]interface{}{
+			"name":                  name + " " + entity.Name,
+			"unique_id":             node + "_" + entity.ID,
+			"state_topic":           mqttTopic(settings, entity.Topic),
+			"availability_topic":    mqttTopic(settings, "availability"),
+			"json_attributes_topic": mqttTopic(settings, "attributes"),
+			"icon":                  entity.Icon,
+			"device":                device,
+		}
+		if entity.Template != "" {
+			announcement["value_template"] = entity.Template
+		}
+		payload, err := json.Marshal(announcement)
+		if err != nil {
+			config.logger.Printf("ERROR: Unable to describe MQTT entity %s: %v", entity.ID, err)
+			continue
+		}
+		topic := prefix + "/" + entity.Component + "/" + node + "/" + entity.ID + "/config"
+		config.mqtt.Publish(topic, 1, true, payload)
+	}
+}
+
+// connectMQTT starts our connection to the MQTT broker, if we haven't already.
+// If the broker can't be reached, we keep trying in the background, holding
+// on to anything we publish in the meantime.
+func connectMQTT(config *ConfigData) error {
+	if config.mqtt != nil {
+		return nil
+	}
+	if config.MQTT.Broker == "" {
+		return fmt.Errorf("No MQTT broker configured")
+	}
+	broker := config.MQTT.Broker
+	options := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(mqttClientID(config)).
+		SetUsername(config.MQTT.Username).
+		SetPassword(config.MQTT.Password).
+		SetWill(mqttTopic(config, "availability"), "offline", 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			config.logger.Printf("Connected to MQTT broker %s", broker)
+			mqttAnnounce(config)
+			client.Publish(mqttTopic(currentSettings(config), "availability"), 1, true, "online")
+		}).
+		SetConnectionLostHandler(func(client mqtt.Client, err error) {
+			config.logger.Printf("WARNING: Lost connection to MQTT broker %s: %v", broker, err)
+		})
+	config.mqtt = mqtt.NewClient(options)
+	config.mqtt.Connect()
+	return nil
+}
+
+// startMQTT arranges for our state to be published to the MQTT broker on each change.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startMQTT(config *ConfigData) error {
+	if config.MQTT.Broker == "" {
+		return nil
+	}
+	if err := connectMQTT(config); err != nil {
+		return fmt.Errorf("Unable to connect to MQTT broker: %v", err)
+	}
+
+	events := config.events.Subscribe()
+	go func() {
+		for event := range events {
+			status, err := json.Marshal(event.Status)
+			if err != nil {
+				config.logger.Printf("ERROR: Unable to encode status for MQTT: %v", err)
+				continue
+			}
+			mqttPublish(config, "attributes", status)
+			mqttPublish(config, "state", event.Status.State)
+		}
+	}()
+	return nil
+}
+
+// stopMQTT tells the broker we're going away and disconnects from it.
+func stopMQTT(config *ConfigData) {
+	if config.mqtt != nil {
+		config.mqtt.Publish(mqttTopic(config, "availability"), 1, true, "offline").WaitTimeout(2 * time.Second)
+		config.mqtt.Disconnect(250)
+		config.mqtt = nil
+	}
+}
+
+// mqttLight publishes the light signals instead of showing them on hardware.
+type mqttLight struct {
+	config *ConfigData
+}
+
+func newMQTTLight(config *ConfigData) lightDriver {
+	return &mqttLight{config: config}
+}
+
+// Open sets up publishing the light signals to the MQTT broker.
+func (l *mqttLight) Open() error {
+	if err := connectMQTT(l.config); err != nil {
+		return fmt.Errorf("Can't use MQTT light: %v", err)
+	}
+	l.config.logger.Printf("Publishing light signals to MQTT topic %s", mqttTopic(l.config, "light"))
+	return nil
+}
+
+func (l *mqttLight) Set(color string) error {
+	if l.config.mqtt == nil {
+		return fmt.Errorf("not connected")
+	}
+	mqttPublish(l.config, "light", color)
+	return nil
+}
+
+func (l *mqttLight) Close() error {
+	return nil
+}
+
+func (l *mqttLight) HealthCheck() error {
+	if l.config.mqtt == nil || !l.config.mqtt.IsConnectionOpen() {
+		return fmt.Errorf("not connected to MQTT broker %s", l.config.MQTT.Broker)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+//
+// OBS Studio scene switching.
+//
+// If configured, we switch OBS to a given scene whenever we enter a state
+// (e.g., a "be right back" scene while muted in a call, and the live scene
+// when the microphone is open), using the obs-websocket (version 5) protocol
+// built into OBS 28 and later.
+//
+// We connect afresh for each scene change rather than keeping a connection
+// open, since OBS is often not running at all.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// OBSConfigData describes the OBS Studio instance we control.
+type OBSConfigData struct {
+	URL      string            // obs-websocket server (default "ws://localhost:4455")
+	Password string            // obs-websocket server password, if authentication is enabled
+	Scenes   map[string]string // the scene to switch to on entering each state; other states leave the scene alone
+}
+
+// obsMessage is a message in the obs-websocket protocol.
+type obsMessage struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+}
+
+// obsAuthentication computes the response to the server's authentication challenge.
+func obsAuthentication(password, salt, challenge string) string {
+	secret := sha256.Sum256([]byte(password + salt))
+	response := sha256.Sum256([]byte(base64.StdEncoding.EncodeToString(secret[:]) + challenge))
+	return base64.StdEncoding.EncodeToString(response[:])
+}
+
+// obsSetScene connects to OBS and switches to the named scene.
+func obsSetScene(settings OBSConfigData, scene string, requestID int) error {
+	url := settings.URL
+	if url == "" {
+		url = "ws://localhost:4455"
+	}
+	conn, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var msg obsMessage
+	if err = websocket.JSON.Receive(conn, &msg); err != nil {
+		return err
+	}
+	var hello struct {
+		Authentication *struct {
+			Challenge string `json:"challenge"`
+			Salt      string `json:"salt"`
+		} `json:"authentication"`
+	}
+	if err = json.Unmarshal(msg.D, &hello); err != nil || msg.Op != 0 {
+		return fmt.Errorf("unexpected greeting from OBS (op %d)", msg.Op)
+	}
+	identify := map[string]interface{}{"rpcVersion": 1, "eventSubscriptions": 0}
+	if hello.Authentication != nil {
+		identify["authentication"] = obsAuthentication(settings.Password, hello.Authentication.Salt, hello.Authentication.Challenge)
+	}
+	if err = websocket.JSON.Send(conn, map[string]interface{}{"op": 1, "d": identify}); err != nil {
+		return err
+	}
+	if err = websocket.JSON.Receive(conn, &msg); err != nil {
+		return err
+	}
+	if msg.Op != 2 {
+		return fmt.Errorf("OBS refused our connection (op %d); is the password right?", msg.Op)
+	}
+
+	id := strconv.Itoa(requestID)
+	if err = websocket.JSON.Send(conn, map[string]interface{}{"op": 6, "d": map[string]interface{}{
+		"requestType": "SetCurrentProgramScene",
+		"requestId":   id,
+		"requestData": map[string]string{"sceneName": scene},
+	}}); err != nil {
+		return err
+	}
+	for {
+		if err = websocket.JSON.Receive(conn, &msg); err != nil {
+			return err
+		}
+		var response struct {
+			RequestID     string `json:"requestId"`
+			RequestStatus struct {
+				Result  bool   `json:"result"`
+				Code    int    `json:"code"`
+				Comment string `json:"comment"`
+			} `json:"requestStatus"`
+		}
+		if msg.Op != 7 || json.Unmarshal(msg.D, &response) != nil || response.RequestID != id {
+			continue
+		}
+		if !response.RequestStatus.Result {
+			return fmt.Errorf("OBS error %d: %s", response.RequestStatus.Code, response.RequestStatus.Comment)
+		}
+		return nil
+	}
+}
+
+// startOBS arranges for OBS scenes to follow our state, if configured.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startOBS(config *ConfigData) {
+	settings := config.OBS
+	if len(settings.Scenes) == 0 {
+		return
+	}
+	events := config.events.Subscribe()
+	go func() {
+		requests := 0
+		unreachable := false // (so we don't fill the log while OBS isn't running)
+		for event := range events {
+			if event.Status.State == event.Previous {
+				continue
+			}
+			scene, isSet := settings.Scenes[event.Status.State]
+			if !isSet {
+				continue
+			}
+			requests++
+			if err := obsSetScene(settings, scene, requests); err != nil {
+				if !unreachable {
+					config.logger.Printf("WARNING: Unable to switch OBS to scene \"%s\": %v", scene, err)
+				}
+				unreachable = true
+				continue
+			}
+			unreachable = false
+			config.logger.Printf("Switched OBS to scene \"%s\"", scene)
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+//
+// Manual state overrides.
+//
+// The user can ask to be shown as busy, or as not to be disturbed, for a
+// while ("busy until 15:30", "dnd 1h"), regardless of what the calendar
+// says. Optionally, we also put a real event on the calendar for that time,
+// so colleagues who check the calendar rather than the light see the block
+// too. If the override is cancelled early, the event is removed again. The
+// calendar is changed in the background (in the order the changes were
+// asked for), so a slow calendar service doesn't hold up the main loop.
+//
+// Beyond that, "force <state> <time>" (e.g., "force free 2h", "force dnd
+// until 15:00") shows any state at all for a while, winning over everything
+// but the urgent indicator (by default; see priority.go): the calendar, calls,
+// and the rest. "force off" stops it early.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+)
+
+// CalendarWriteBackConfigData controls writing manual overrides back to the calendar.
+// This requires a token with permission to change the calendar (see upcoming(1)).
+type CalendarWriteBackConfigData struct {
+	Enabled    bool   // create calendar events for manual overrides?
+	CalendarID string // the calendar to put them on (default "primary")
+}
+
+// manualOverride is a state the user has asked for, until a given time.
+type manualOverride struct {
+	State      string    // "busy" or "dnd"; empty if there's no override in effect
+	Until      time.Time // when it ends
+	OnCalendar bool      // have we asked for it to be put on the calendar?
+}
+
+// calendarWrite is a change to make to the calendar for an override: adding
+// an event for it, or (with no State) removing the one added last.
+type calendarWrite struct {
+	State string
+	Until time.Time
+}
+
+// parseOverrideEnd works out when an override should end, given the rest of
+// the command asking for it: a length of time ("30m") or a time of day ("until 15:30").
+func parseOverrideEnd(config *ConfigData, args []string) (time.Time, error) {
+	if len(args) == 0 {
+		return time.Time{}, fmt.Errorf("how long?")
+	}
+	if args[0] != "until" {
+		d, err := parseCommandDuration(args[0])
+		return time.Now().Add(d), err
+	}
+	if len(args) < 2 {
+		return time.Time{}, fmt.Errorf("until when?")
+	}
+	loc := localZone(config)
+	clock, err := time.ParseInLocation("15:04", args[1], loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't understand %q as a time of day (use HH:MM)", args[1])
+	}
+	now := time.Now().In(loc)
+	until := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	if !until.After(now) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, nil
+}
+
+// forceCommand carries out "force <state> <time>|until <HH:MM>|off", updating
+// the forced state and returning our reply.
+func forceCommand(config *ConfigData, forced *manualOverride, args []string) string {
+	const usage = "force <state> <time>|until <HH:MM>|off"
+	if len(args) == 1 && args[0] == "off" {
+		*forced = manualOverride{}
+		return "Forced state is off"
+	}
+	if len(args) == 0 {
+		return "usage: " + usage
+	}
+	state := args[0]
+	if !knownState(config, state) {
+		return fmt.Sprintf("There's no state called \"%s\" (usage: %s)", state, usage)
+	}
+	until, err := parseOverrideEnd(config, args[1:])
+	if err != nil {
+		return fmt.Sprintf("%v (usage: %s)", err, usage)
+	}
+	*forced = manualOverride{State: state, Until: until}
+	return fmt.Sprintf("%s until %s", describeState(config, state), until.In(localZone(config)).Format("15:04"))
+}
+
+// newCalendarService connects to the Google Calendar API.
+// The context limits how long the calls made through it (including
+// refreshing our access token) may take.
+func newCalendarService(ctx context.Context, config *ConfigData) (*calendar.Service, error) {
+	googleConfig, err := google.ConfigFromJSON(config.googleConfig, calendar.CalendarReadonlyScope)
+	if err != nil {
+		return nil, err
+	}
+	client, err := getClient(ctx, googleConfig, config.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to query calendar: %v", err)
+	}
+	return calendar.New(client)
+}
+
+// writeBackCalendarID is the calendar we put override events on.
+func (c CalendarWriteBackConfigData) writeBackCalendarID() string {
+	if c.CalendarID == "" {
+		return "primary"
+	}
+	return c.CalendarID
+}
+
+// writeBackOverride asks for a change to the calendar for an override,
+// reporting whether it'll be made.
+func writeBackOverride(config *ConfigData, write calendarWrite) bool {
+	select {
+	case config.writeBacks <- write:
+		return true
+	default:
+		config.logger.Printf("ERROR: Unable to change the calendar for the override (too many changes waiting already)")
+		return false
+	}
+}
+
+// startCalendarWriteBack starts making the changes asked for with
+// writeBackOverride, one at a time. Once an event has been removed, the
+// main loop is asked to refresh the calendar, so it's gone from there too.
+func startCalendarWriteBack(config *ConfigData) {
+	config.writeBacks = make(chan calendarWrite, 10)
+	go func() {
+		var eventID string // the event we created last, if any
+		for write := range config.writeBacks {
+			settings := currentSettings(config)
+			if write.State != "" {
+				eventID = addToCalendar(settings, write)
+			} else if eventID != "" {
+				if removeFromCalendar(settings, eventID) {
+					sendCommand(config, "calendar write-back", "reload", 0)
+				}
+				eventID = ""
+			}
+		}
+	}()
+}
+
+// addToCalendar creates a calendar event covering an override, returning
+// its ID (empty if we couldn't).
+func addToCalendar(config *ConfigData, o calendarWrite) string {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Polling.timeout())
+	defer cancel()
+	srv, err := newCalendarService(ctx, config)
+	if err == nil {
+		var event *calendar.Event
+		event, err = srv.Events.Insert(config.CalendarWriteBack.writeBackCalendarID(), &calendar.Event{
+			Summary:      stateDescriptions[o.State],
+			Description:  "Set from busylight",
+			Start:        &calendar.EventDateTime{DateTime: time.Now().Format(time.RFC3339)},
+			End:          &calendar.EventDateTime{DateTime: o.Until.Format(time.RFC3339)},
+			Transparency: "opaque",
+		}).Context(ctx).Do()
+		if err == nil {
+			config.logger.Printf("Created calendar event %s for %s override", event.Id, o.State)
+			return event.Id
+		}
+	}
+	config.logger.Printf("ERROR: Unable to create calendar event for %s override: %v", o.State, err)
+	return ""
+}
+
+// removeFromCalendar deletes a calendar event we created for an override,
+// reporting whether it's gone.
+func removeFromCalendar(config *ConfigData, eventID string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Polling.timeout())
+	defer cancel()
+	srv, err := newCalendarService(ctx, config)
+	if err == nil {
+		err = srv.Events.Delete(config.CalendarWriteBack.writeBackCalendarID(), eventID).Context(ctx).Do()
+	}
+	if err != nil {
+		config.logger.Printf("ERROR: Unable to remove calendar event %s: %v", eventID, err)
+		return false
+	}
+	config.logger.Printf("Removed calendar event %s", eventID)
+	return true
+}
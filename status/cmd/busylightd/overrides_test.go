@@ -0,0 +1,77 @@
+//
+// Tests for manual overrides.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOverrideEnd(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("no time zone data: %v", err)
+	}
+	config := &ConfigData{}
+	config.zone.Store(tokyo)
+
+	lengths := []struct {
+		args []string
+		want time.Duration
+	}{
+		{[]string{"30m"}, 30 * time.Minute},
+		{[]string{"1h30m"}, 90 * time.Minute},
+		{[]string{"45"}, 45 * time.Minute},
+		{[]string{"2h", "ignored"}, 2 * time.Hour},
+	}
+	for _, test := range lengths {
+		before := time.Now()
+		got, err := parseOverrideEnd(config, test.args)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.args, err)
+		} else if got.Before(before.Add(test.want)) || got.After(time.Now().Add(test.want)) {
+			t.Errorf("%v: got %v, want %v from now", test.args, got, test.want)
+		}
+	}
+
+	// (times of day are in our own time zone, and always in the next 24 hours)
+	now := time.Now().In(tokyo)
+	for _, clock := range []time.Time{now.Add(-time.Hour), now.Add(2 * time.Minute), now.Add(3 * time.Hour)} {
+		args := []string{"until", clock.Format("15:04")}
+		got, err := parseOverrideEnd(config, args)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", args, err)
+			continue
+		}
+		if got.In(tokyo).Format("15:04:05") != clock.Format("15:04")+":00" {
+			t.Errorf("%v: got %v, want %s in Tokyo", args, got.In(tokyo), clock.Format("15:04"))
+		}
+		if !got.After(now) || got.After(now.Add(24*time.Hour)) {
+			t.Errorf("%v: got %v, want within the next day of %v", args, got, now)
+		}
+	}
+
+	invalid := []struct {
+		args    []string
+		wantErr string
+	}{
+		{nil, "how long?"},
+		{[]string{"until"}, "until when?"},
+		{[]string{"until", "3pm"}, "as a time of day"},
+		{[]string{"until", "25:00"}, "as a time of day"},
+		{[]string{"soon"}, "as a length of time"},
+		{[]string{"0"}, "must be positive"},
+		{[]string{"-5m"}, "must be positive"},
+	}
+	for _, test := range invalid {
+		if _, err := parseOverrideEnd(config, test.args); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%v: got error %v, want one containing %q", test.args, err, test.wantErr)
+		}
+	}
+}
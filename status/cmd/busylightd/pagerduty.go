@@ -0,0 +1,108 @@
+//
+// PagerDuty on-call and incident integration.
+//
+// We poll PagerDuty's REST API to find out whether we're on call right now
+// and whether any triggered incidents are assigned to us. Being on call
+// turns on the on-call indicator; a triggered incident makes the light show
+// urgent until it's acknowledged or resolved. (We poll rather than wait
+// for PagerDuty's webhooks so this works from behind a home router.)
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PagerDutyConfigData describes how we talk to PagerDuty.
+type PagerDutyConfigData struct {
+	Token       string // PagerDuty REST API key (a read-only user token is sufficient)
+	UserID      string // our PagerDuty user ID (e.g., "PABC123")
+	PollSeconds int    // how often to check (default 60)
+}
+
+// pagerDutyGet fetches a collection from the PagerDuty REST API and reports how many items it holds.
+func pagerDutyGet(client *http.Client, token, path string, query url.Values, collection string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://api.pagerduty.com/"+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Token token="+token)
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: PagerDuty returned %s", path, resp.Status)
+	}
+
+	var reply map[string]json.RawMessage
+	if err = json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	var items []json.RawMessage
+	if err = json.Unmarshal(reply[collection], &items); err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	return len(items), nil
+}
+
+// checkPagerDuty asks PagerDuty whether we're on call and whether we have any triggered incidents
+// (which make us urgent).
+func checkPagerDuty(client *http.Client, pd PagerDutyConfigData) (status sourceStatus, err error) {
+	n, err := pagerDutyGet(client, pd.Token, "oncalls", url.Values{"user_ids[]": {pd.UserID}}, "oncalls")
+	if err != nil {
+		return status, err
+	}
+	status.OnCall = n > 0
+
+	n, err = pagerDutyGet(client, pd.Token, "incidents", url.Values{"user_ids[]": {pd.UserID}, "statuses[]": {"triggered"}}, "incidents")
+	if err != nil {
+		return status, err
+	}
+	status.Urgent = n > 0
+	return status, nil
+}
+
+// startPagerDuty starts polling PagerDuty, reporting whatever we learn to the main event loop
+// whenever it changes.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startPagerDuty(config *ConfigData) error {
+	pd := config.PagerDuty
+	if pd.Token == "" {
+		return nil
+	}
+	if pd.UserID == "" {
+		return fmt.Errorf("Unable to watch PagerDuty: UserID must be given")
+	}
+	interval := 60 * time.Second
+	if pd.PollSeconds > 0 {
+		interval = time.Duration(pd.PollSeconds) * time.Second
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	go func() {
+		var last sourceStatus
+		for {
+			status, err := checkPagerDuty(client, pd)
+			if err != nil {
+				config.logger.Printf("ERROR: Unable to check PagerDuty: %v", err)
+			} else if status != last {
+				reportSource(config, "pagerduty", status)
+				last = status
+			}
+			time.Sleep(interval)
+		}
+	}()
+	return nil
+}
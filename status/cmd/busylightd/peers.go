@@ -0,0 +1,127 @@
+//
+// Tracking the status of other people's busylights.
+//
+// Other daemons may tell us about their own states (for example, via mDNS
+// announcements on the local network). We keep track of what each of them
+// last told us here, so the information can be reported or combined with
+// our own state.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeerStatus is what we know about another person's busylight.
+type PeerStatus struct {
+	Name           string    // the name the other person goes by
+	State          string    // their overall state (see stateDescriptions)
+	Since          time.Time // when they entered that state
+	LowPriority    bool      // is their low-priority indicator on?
+	NextTransition time.Time // when their calendar says they'll next change busy/free status
+	Source         string    // how we heard about this peer
+	Expires        time.Time // when we should stop believing this information
+}
+
+// Summary gives the peer's status in the same form as our own DaemonStatus.
+func (p PeerStatus) Summary() DaemonStatus {
+	return DaemonStatus{
+		State:          p.State,
+		Description:    stateDescriptions[p.State],
+		Since:          p.Since,
+		Active:         p.State != "off",
+		BusyNow:        p.State != "free" && p.State != "off" && p.State != "warning",
+		LowPriority:    p.LowPriority,
+		NextTransition: p.NextTransition,
+	}
+}
+
+// peerTable holds the most recent status reported by each peer.
+type peerTable struct {
+	lock    sync.Mutex
+	peers   map[string]PeerStatus // keyed by lower-case name
+	changed chan struct{}         // signalled whenever a peer's state changes
+}
+
+// Changed returns a channel which receives a value whenever any peer changes state.
+func (t *peerTable) Changed() <-chan struct{} {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.changed == nil {
+		t.changed = make(chan struct{}, 1)
+	}
+	return t.changed
+}
+
+// notify signals that a peer has changed state. The caller must hold the lock.
+func (t *peerTable) notify() {
+	if t.changed == nil {
+		t.changed = make(chan struct{}, 1)
+	}
+	select {
+	case t.changed <- struct{}{}:
+	default:
+		// there's already a notification pending
+	}
+}
+
+// Update records new status information about a peer. It returns true if this
+// is a peer we didn't know about before (or whose information had expired).
+func (t *peerTable) Update(p PeerStatus) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.peers == nil {
+		t.peers = make(map[string]PeerStatus)
+	}
+	key := strings.ToLower(p.Name)
+	old, known := t.peers[key]
+	t.peers[key] = p
+	isNew := !known || time.Now().After(old.Expires)
+	if isNew || old.State != p.State || old.LowPriority != p.LowPriority {
+		t.notify()
+	}
+	return isNew
+}
+
+// Remove forgets about a peer.
+func (t *peerTable) Remove(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.peers, strings.ToLower(name))
+	t.notify()
+}
+
+// Get returns the current status of the named peer, if we know it.
+func (t *peerTable) Get(name string) (PeerStatus, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	p, known := t.peers[strings.ToLower(name)]
+	if !known || time.Now().After(p.Expires) {
+		return PeerStatus{}, false
+	}
+	return p, true
+}
+
+// List returns all peers whose information hasn't yet expired, sorted by name.
+func (t *peerTable) List() []PeerStatus {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var list []PeerStatus
+	now := time.Now()
+	for key, p := range t.peers {
+		if now.After(p.Expires) {
+			delete(t.peers, key)
+			continue
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return list
+}
@@ -0,0 +1,97 @@
+//
+// How often, and how far ahead, we poll the calendars.
+//
+// By default we poll every hour, looking 8 hours ahead each time. Someone
+// on call may want to poll every few minutes and look a day ahead; someone
+// on a metered connection may want to poll less often. (Polling more often
+// than every few minutes is just asking to run into the calendar services'
+// quotas.)
+//
+// Each calendar service gets Polling.TimeoutSeconds (by default, 30) to
+// answer before we give up on it, so a connection which hangs doesn't leave
+// us waiting forever.
+//
+// If a poll fails (the network is down, or the calendar service is having a
+// bad day), we don't wait for the next one to try again, but retry after a
+// minute, then two, then four, and so on up to the usual time between polls,
+// with a little randomness thrown in so a whole office full of lights
+// doesn't retry all at once when the service comes back. Each failure
+// briefly flashes the "degraded" light signal (a purple double pulse), so
+// the user knows the light may not be up to date.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// PollingConfigData controls how we poll the calendars.
+type PollingConfigData struct {
+	Minutes        int // how often to poll (default 60)
+	LookaheadHours int // how far ahead to look each time (default 8)
+	TimeoutSeconds int // how long to wait for a calendar service to answer (default 30)
+}
+
+// interval returns how often to poll the calendars.
+func (p PollingConfigData) interval() time.Duration {
+	if p.Minutes <= 0 {
+		return time.Hour
+	}
+	return time.Duration(p.Minutes) * time.Minute
+}
+
+// lookahead returns how far ahead to look when polling the calendars.
+func (p PollingConfigData) lookahead() time.Duration {
+	if p.LookaheadHours <= 0 {
+		return 8 * time.Hour
+	}
+	return time.Duration(p.LookaheadHours) * time.Hour
+}
+
+// timeout returns how long to wait for a calendar service to answer.
+func (p PollingConfigData) timeout() time.Duration {
+	if p.TimeoutSeconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(p.TimeoutSeconds) * time.Second
+}
+
+// retryJitter randomizes the time between retries (only the main loop uses it).
+var retryJitter = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// retryDelay returns how long to wait before polling again after the given
+// number of failures in a row.
+func (p PollingConfigData) retryDelay(failures int) time.Duration {
+	delay := p.interval()
+	if failures < 8 {
+		if backoff := time.Minute << uint(failures-1); backoff < delay {
+			delay = backoff
+		}
+	}
+	// (give or take up to a quarter of that)
+	return delay + time.Duration((retryJitter.Float64()-0.5)*float64(delay)/2)
+}
+
+// checkPolling makes sure the Polling setting makes sense.
+func checkPolling(config *ConfigData) error {
+	p := config.Polling
+	if p.Minutes < 0 || (p.Minutes > 0 && p.Minutes < 2) || p.Minutes > 24*60 {
+		return fmt.Errorf("Polling.Minutes must be between 2 and 1440")
+	}
+	if p.LookaheadHours < 0 || p.LookaheadHours > 7*24 {
+		return fmt.Errorf("Polling.LookaheadHours must be between 1 and 168")
+	}
+	if p.TimeoutSeconds < 0 || p.TimeoutSeconds > 300 {
+		return fmt.Errorf("Polling.TimeoutSeconds must be between 1 and 300")
+	}
+	if p.lookahead() < p.interval() {
+		return fmt.Errorf("Polling.LookaheadHours must look at least as far ahead as the time between polls")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+//
+// Choosing which state to show.
+//
+// At any moment, several things may each want the light to show something:
+// the calendar says we're busy, we're in a call, the user asked not to be
+// disturbed, and so on. Each of these reasons claims the state it wants,
+// and the first claim in priority order wins. The order may be changed
+// with the StatePriority setting; by default it is:
+//
+//    urgent   - the urgent indicator is on (set by hand or by a source)
+//    force    - the user asked for a particular state for a while
+//    call     - we're in a call (as told by the user, or as detected)
+//    override - the user asked for "busy" or "dnd" for a while
+//    focus    - a source says we're focusing (e.g., a focus mode)
+//    calendar - the calendar (or a source, such as Slack) says we're busy
+//    away     - we've stepped away from the computer (see awaydetect.go)
+//    warning  - the calendar says we'll be busy soon (see warning.go)
+//
+// The user's own states (see states.go) also claim themselves, under their
+// own names. If nothing claims a state, we're free.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultStatePriority is the order in which claims win, unless configured otherwise.
+var defaultStatePriority = []string{"urgent", "force", "call", "override", "focus", "calendar", "away", "warning"}
+
+// stateClaims are the states wanted right now, by reason.
+type stateClaims map[string]string
+
+// statePriority is the configured order of reasons, with any left out of the
+// configuration following the others in their default order, and any of the
+// user's own states left out just ahead of "override".
+func statePriority(config *ConfigData) []string {
+	var priority []string
+	for _, reason := range config.StatePriority {
+		priority = append(priority, strings.ToLower(reason))
+	}
+	for _, reason := range defaultStatePriority {
+		if !containsFold(priority, reason) {
+			priority = append(priority, reason)
+		}
+	}
+
+	var unplaced []string
+	for _, name := range customStateNames(config) {
+		if !containsFold(priority, name) {
+			unplaced = append(unplaced, name)
+		}
+	}
+	for i, reason := range priority {
+		if reason == "override" {
+			return append(priority[:i], append(unplaced, priority[i:]...)...)
+		}
+	}
+	return priority
+}
+
+// chooseState picks the state to show from the claims on it.
+func chooseState(config *ConfigData, claims stateClaims) string {
+	for _, reason := range statePriority(config) {
+		if state, claimed := claims[strings.ToLower(reason)]; claimed {
+			return state
+		}
+	}
+	return "free"
+}
+
+// checkStatePriority makes sure the StatePriority setting makes sense.
+func checkStatePriority(config *ConfigData) error {
+	for i, reason := range config.StatePriority {
+		if _, isCustom := config.States[strings.ToLower(reason)]; !isCustom && !containsFold(defaultStatePriority, reason) {
+			return fmt.Errorf("Unknown reason \"%s\" in StatePriority (expected one of %v, or one of the States)", reason, defaultStatePriority)
+		}
+		if containsFold(config.StatePriority[:i], reason) {
+			return fmt.Errorf("\"%s\" appears more than once in StatePriority", reason)
+		}
+	}
+	return nil
+}
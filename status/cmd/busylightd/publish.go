@@ -0,0 +1,151 @@
+//
+// Publish our status to a static web location.
+//
+// This lets an intranet page or personal web site show our availability
+// without anyone needing to connect to this machine. On every state change
+// we simply PUT a JSON document (and optionally a small HTML snippet) to
+// a URL of the user's choosing, such as a WebDAV share or an S3-compatible
+// bucket which accepts uploads with the configured headers.
+//
+// We can also keep a small JSON file on this machine up to date, for menu
+// bar widgets, tmux status lines, stream overlays, and the like, which can
+// simply read it whenever they like. It's replaced in one go, so they never
+// see it half-written, and says "off" once the daemon has shut down.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+// PublishConfigData describes where (if anywhere) we upload our status on every state change.
+type PublishConfigData struct {
+	// URL which receives the JSON status document via HTTP PUT.
+	JSONURL string
+
+	// URL which receives an HTML snippet suitable for embedding in a web page.
+	HTMLURL string
+
+	// Credentials for HTTP basic authentication, if required by the server.
+	Username string
+	Password string
+
+	// Any additional HTTP headers to send with each upload (e.g., "x-amz-acl").
+	Headers map[string]string
+
+	// Local file where we keep a small JSON description of the state.
+	File string
+}
+
+// stateFile is what we write to the Publish.File.
+type stateFile struct {
+	State          string
+	Description    string
+	Since          time.Time
+	NextTransition time.Time
+	Until          time.Time
+}
+
+// statusHTML renders a status snapshot as a small self-contained HTML fragment.
+func statusHTML(config *ConfigData, status DaemonStatus) string {
+	var until string
+	if status.BusyNow && !status.NextTransition.IsZero() {
+		until = fmt.Sprintf(" until %s", status.NextTransition.In(localZone(config)).Format("15:04"))
+	}
+	return fmt.Sprintf("<span class=\"busylight busylight-%s\" title=\"as of %s\">%s%s</span>\n",
+		html.EscapeString(status.State),
+		html.EscapeString(status.Since.In(localZone(config)).Format(time.RFC1123)),
+		html.EscapeString(status.Description),
+		html.EscapeString(until))
+}
+
+// putDocument uploads a document to the given URL.
+func (p PublishConfigData) putDocument(client *http.Client, url, contentType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	if p.Username != "" {
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil
+}
+
+// writeStateFile replaces the contents of the state file with the given status.
+func writeStateFile(config *ConfigData, path string, status DaemonStatus) {
+	data, err := json.Marshal(stateFile{
+		State:          status.State,
+		Description:    status.Description,
+		Since:          status.Since,
+		NextTransition: status.NextTransition,
+		Until:          status.Until,
+	})
+	if err != nil {
+		config.logger.Printf("ERROR: Unable to encode status for %s: %v", path, err)
+		return
+	}
+	temp := path + ".new"
+	if err = ioutil.WriteFile(temp, append(data, '\n'), 0644); err == nil {
+		err = os.Rename(temp, path)
+	}
+	if err != nil {
+		config.logger.Printf("ERROR: Unable to write status to %s: %v", path, err)
+		os.Remove(temp)
+	}
+}
+
+// startStatusPublisher subscribes to state changes and uploads each one to the configured
+// locations. The publishing settings are captured at startup; changing them requires
+// a restart of the daemon.
+func startStatusPublisher(config *ConfigData) {
+	p := config.Publish
+	if p.JSONURL == "" && p.HTMLURL == "" && p.File == "" {
+		return
+	}
+
+	events := config.events.Subscribe()
+	client := &http.Client{Timeout: 30 * time.Second}
+	go func() {
+		for event := range events {
+			if p.File != "" {
+				writeStateFile(config, p.File, event.Status)
+			}
+			if p.JSONURL != "" {
+				doc, err := json.MarshalIndent(event.Status, "", "  ")
+				if err != nil {
+					config.logger.Printf("ERROR: Unable to encode status for publishing: %v", err)
+				} else if err = p.putDocument(client, p.JSONURL, "application/json", doc); err != nil {
+					config.logger.Printf("ERROR: Unable to publish status to %s: %v", p.JSONURL, err)
+				}
+			}
+			if p.HTMLURL != "" {
+				if err := p.putDocument(client, p.HTMLURL, "text/html; charset=utf-8", []byte(statusHTML(config, event.Status))); err != nil {
+					config.logger.Printf("ERROR: Unable to publish status to %s: %v", p.HTMLURL, err)
+				}
+			}
+		}
+	}()
+}
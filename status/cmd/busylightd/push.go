@@ -0,0 +1,205 @@
+//
+// Push notifications to a phone.
+//
+// Some things are worth knowing about even when we aren't looking at the
+// light: the urgent state coming on, a meeting about to start while the
+// daemon is idle (so the light isn't going to tell anyone), or the light
+// itself failing. We can send these to ntfy, Pushover, or Gotify, which
+// pass them on to the phone.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PushConfigData describes the push notification service we use.
+type PushConfigData struct {
+	Service string // "ntfy", "pushover", or "gotify"
+	URL     string // ntfy topic URL (e.g., "https://ntfy.sh/mytopic") or Gotify server URL
+	Token   string // ntfy access token (if needed), Pushover application token, or Gotify application token
+	User    string // Pushover user key
+
+	// The events to notify about ("urgent", "meeting", and "hardware"), with
+	// how to notify about each. If empty, all of them are sent with the default settings.
+	Events map[string]PushEventConfigData
+
+	// How many minutes' warning to give of a meeting while we're idle (default 5).
+	MeetingMinutes int
+}
+
+// PushEventConfigData describes how to send one kind of notification.
+type PushEventConfigData struct {
+	Title    string // notification title, if not the default
+	Priority int    // priority, in the service's own terms; 0 uses the service's default
+}
+
+// defaultPushTitles are the titles of our notifications unless the configuration says otherwise.
+var defaultPushTitles = map[string]string{
+	"urgent":   "Busylight: urgent",
+	"meeting":  "Busylight: meeting starting",
+	"hardware": "Busylight: hardware problem",
+}
+
+// pushMessage is a notification waiting to be sent.
+type pushMessage struct {
+	Event   string // "urgent", "meeting", or "hardware"
+	Message string
+}
+
+// pushNotify queues a notification to be sent, if we're configured to send that kind.
+// It never blocks, so it's safe to call from the main event loop.
+func pushNotify(config *ConfigData, event, format string, a ...interface{}) {
+	if config.pushes == nil {
+		return
+	}
+	select {
+	case config.pushes <- pushMessage{Event: event, Message: fmt.Sprintf(format, a...)}:
+	default:
+		config.logger.Printf("WARNING: Dropped %s push notification (too many queued)", event)
+	}
+}
+
+// sendPush delivers a notification to the configured service.
+func sendPush(client *http.Client, settings PushConfigData, title, message string, priority int) error {
+	var req *http.Request
+	var err error
+	switch strings.ToLower(settings.Service) {
+	case "ntfy":
+		if req, err = http.NewRequest(http.MethodPost, settings.URL, strings.NewReader(message)); err != nil {
+			return err
+		}
+		req.Header.Set("Title", title)
+		if priority != 0 {
+			req.Header.Set("Priority", strconv.Itoa(priority))
+		}
+		if settings.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+settings.Token)
+		}
+
+	case "pushover":
+		form := url.Values{
+			"token":   {settings.Token},
+			"user":    {settings.User},
+			"title":   {title},
+			"message": {message},
+		}
+		if priority != 0 {
+			form.Set("priority", strconv.Itoa(priority))
+		}
+		if req, err = http.NewRequest(http.MethodPost, "https://api.pushover.net/1/messages.json", strings.NewReader(form.Encode())); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	case "gotify":
+		body, err := json.Marshal(map[string]interface{}{"title": title, "message": message, "priority": priority})
+		if err != nil {
+			return err
+		}
+		if req, err = http.NewRequest(http.MethodPost, strings.TrimSuffix(settings.URL, "/")+"/message", bytes.NewReader(body)); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gotify-Key", settings.Token)
+
+	default:
+		return fmt.Errorf("unknown service %q", settings.Service)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// startPushNotifications starts sending push notifications, if configured.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startPushNotifications(config *ConfigData) error {
+	settings := config.Push
+	if settings.Service == "" {
+		return nil
+	}
+	switch strings.ToLower(settings.Service) {
+	case "ntfy", "pushover", "gotify":
+	default:
+		return fmt.Errorf("Unable to send push notifications: unknown service %q", settings.Service)
+	}
+	wanted := func(event string) (PushEventConfigData, bool) {
+		if len(settings.Events) == 0 {
+			return PushEventConfigData{}, true
+		}
+		e, isSet := settings.Events[event]
+		return e, isSet
+	}
+	warning := time.Duration(settings.MeetingMinutes) * time.Minute
+	if warning <= 0 {
+		warning = 5 * time.Minute
+	}
+
+	config.pushes = make(chan pushMessage, 10)
+	client := &http.Client{Timeout: 30 * time.Second}
+	go func() {
+		for push := range config.pushes {
+			e, isSet := wanted(push.Event)
+			if !isSet {
+				continue
+			}
+			title := e.Title
+			if title == "" {
+				title = defaultPushTitles[push.Event]
+			}
+			if err := sendPush(client, settings, title, push.Message, e.Priority); err != nil {
+				config.logger.Printf("ERROR: Unable to send %s push notification: %v", push.Event, err)
+			}
+		}
+	}()
+
+	events := config.events.Subscribe()
+	go func() {
+		var warned time.Time // the meeting start we last warned about
+		check := time.NewTicker(time.Minute)
+		defer check.Stop()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Status.State == "urgent" && event.Previous != "urgent" {
+					pushNotify(config, "urgent", "Urgent state turned on (%s).", event.Cause)
+				}
+
+			case <-check.C:
+				// If we're idle, the light won't show that a meeting is starting,
+				// so make sure we know about it.
+				status := config.events.Current()
+				next := status.NextTransition
+				if status.Active || status.BusyNow || next.IsZero() || next.Equal(warned) {
+					continue
+				}
+				if until := time.Until(next); until > 0 && until <= warning {
+					warned = next
+					pushNotify(config, "meeting", "A meeting starts at %s, but busylight is idle.", next.In(localZone(config)).Format("15:04"))
+				}
+			}
+		}
+	}()
+	return nil
+}
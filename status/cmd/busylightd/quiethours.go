@@ -0,0 +1,46 @@
+//
+// Quiet hours.
+//
+// For those whose light is in a bedroom office (say), the QuietHours setting
+// gives times when the light shows nothing (or whatever light signal is
+// chosen for it, such as a dim color defined in LightSignals) no matter what
+// the state is. Everything else carries on as usual, and when the quiet
+// hours are over, the light shows whatever the state is by then.
+//
+// The hours are given just as for WorkingHours (see workinghours.go).
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import "time"
+
+// QuietHoursConfigData says when the light should be kept quiet.
+type QuietHoursConfigData struct {
+	Hours  map[string]string // the quiet hours, by day of the week (as for WorkingHours)
+	Signal string            // the light signal to show during them (default "off")
+}
+
+// quietSignal is the light signal to show during quiet hours.
+func (q QuietHoursConfigData) quietSignal() string {
+	if q.Signal == "" {
+		return "off"
+	}
+	return q.Signal
+}
+
+// quietHours reports whether the given time is within quiet hours, and when
+// that next changes (zero if it never does).
+func quietHours(config *ConfigData, t time.Time) (bool, time.Time) {
+	if len(config.QuietHours.Hours) == 0 {
+		return false, time.Time{}
+	}
+	return inSchedule(config.QuietHours.Hours, t.In(localZone(config)))
+}
+
+// checkQuietHours makes sure the QuietHours setting makes sense.
+func checkQuietHours(config *ConfigData) error {
+	return checkSchedule("QuietHours", config.QuietHours.Hours)
+}
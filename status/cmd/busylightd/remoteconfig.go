@@ -0,0 +1,159 @@
+//
+// Centralized configuration distribution.
+//
+// An organization managing a fleet of lights can publish shared settings
+// (palettes, states, schedules and so on) as a JSON document on an HTTPS
+// server. Each daemon fetches that document whenever it (re-)reads its own
+// configuration and lays it over the local settings. Only settings which
+// affect what the light shows and when can be set remotely; anything which
+// could run commands, write files, or open the daemon up to the network
+// (or tell it who to trust) may only be set locally, since whoever controls
+// the document would otherwise control the computer.
+//
+// The document is fetched in the background, so a slow server doesn't hold
+// up the light; the main event loop then lays it over the local settings
+// and checks the result, carrying on with the settings it had if they
+// don't make sense.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RemoteConfigData describes where to get centrally-managed configuration settings.
+type RemoteConfigData struct {
+	// HTTPS URL of the JSON document holding the managed settings.
+	URL string
+
+	// If given, sent as a bearer token to authenticate us to the server.
+	Token string
+
+	// If non-empty, only these top-level settings are taken from the remote document.
+	Keys []string
+
+	// If given, a copy of the last document successfully fetched is kept here,
+	// to be used if the server can't be reached.
+	CacheFile string
+}
+
+// remoteConfigKeys are the only settings which may be set from a remote
+// configuration document.
+var remoteConfigKeys = []string{"LightSignals", "SnoozeSignal", "States", "StatePriority", "WorkingHours", "QuietHours", "MeetingWarning"}
+
+// containsFold reports whether the list contains the string s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchRemoteConfig retrieves the managed configuration document.
+func fetchRemoteConfig(r RemoteConfigData) ([]byte, error) {
+	if !strings.HasPrefix(strings.ToLower(r.URL), "https://") {
+		return nil, fmt.Errorf("remote configuration URL %s must use https", r.URL)
+	}
+	req, err := http.NewRequest(http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// remoteConfigDocument fetches the managed configuration document, falling
+// back on (or updating) the cached copy, if there is one.
+func remoteConfigDocument(config *ConfigData, r RemoteConfigData) ([]byte, error) {
+	doc, err := fetchRemoteConfig(r)
+	if err != nil {
+		if r.CacheFile == "" {
+			return nil, fmt.Errorf("Unable to fetch remote configuration: %v", err)
+		}
+		config.logger.Printf("WARNING: Unable to fetch remote configuration (using cached copy): %v", err)
+		if doc, err = ioutil.ReadFile(r.CacheFile); err != nil {
+			return nil, fmt.Errorf("Unable to read cached remote configuration: %v", err)
+		}
+	} else if r.CacheFile != "" {
+		if err = ioutil.WriteFile(r.CacheFile, doc, 0600); err != nil {
+			config.logger.Printf("WARNING: Unable to cache remote configuration in %s: %v", r.CacheFile, err)
+		}
+	}
+	return doc, nil
+}
+
+// fetchRemoteConfigLater fetches the managed configuration (if any) in the
+// background, and passes it to the main event loop on config.remoteConfigs.
+func fetchRemoteConfigLater(config *ConfigData) {
+	r := config.RemoteConfig
+	if r.URL == "" {
+		return
+	}
+	go func() {
+		doc, err := remoteConfigDocument(config, r)
+		if err != nil {
+			config.logger.Printf("ERROR: %v", err)
+			return
+		}
+		config.remoteConfigs <- doc
+	}()
+}
+
+// layRemoteConfig lays the managed configuration document over the settings
+// already read from the local configuration file.
+func layRemoteConfig(config *ConfigData, doc []byte) error {
+	// (anything which isn't one of our settings at all is a mistake, as in
+	// the local file)
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&ConfigData{}); err != nil {
+		return fmt.Errorf("Unable to understand remote configuration: %v", err)
+	}
+
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &settings); err != nil {
+		return fmt.Errorf("Unable to understand remote configuration: %v", err)
+	}
+	// (JSON field names are matched without regard to case, so we must do the same here)
+	r := config.RemoteConfig
+	for key := range settings {
+		if !containsFold(remoteConfigKeys, key) {
+			config.logger.Printf("WARNING: Ignoring %s in remote configuration; it may only be set locally", key)
+			delete(settings, key)
+		} else if len(r.Keys) > 0 && !containsFold(r.Keys, key) {
+			delete(settings, key)
+		}
+	}
+
+	filtered, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(filtered, config); err != nil {
+		return fmt.Errorf("Unable to apply remote configuration: %v", err)
+	}
+	return nil
+}
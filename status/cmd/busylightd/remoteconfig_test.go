@@ -0,0 +1,110 @@
+//
+// Tests for laying a remote configuration over the local one.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLayRemoteConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []string // RemoteConfig.Keys
+		doc      string
+		want     func(*ConfigData)
+		warnings []string // settings we should say we're ignoring
+		wantErr  string
+	}{
+		{
+			name: "display setting",
+			doc:  `{"SnoozeSignal": "blue"}`,
+			want: func(c *ConfigData) { c.SnoozeSignal = "blue" },
+		},
+		{
+			name: "names without regard to case",
+			doc:  `{"snoozesignal": "blue", "STATEPRIORITY": ["calendar"]}`,
+			want: func(c *ConfigData) { c.SnoozeSignal, c.StatePriority = "blue", []string{"calendar"} },
+		},
+		{
+			name: "object",
+			doc:  `{"States": {"lunch": {"Signal": "blue"}}}`,
+			want: func(c *ConfigData) { c.States = map[string]CustomStateConfigData{"lunch": {Signal: "blue"}} },
+		},
+		{
+			name:     "local-only settings ignored",
+			doc:      `{"SocketFile": "/tmp/elsewhere", "Hooks": [], "SnoozeSignal": "blue"}`,
+			want:     func(c *ConfigData) { c.SnoozeSignal = "blue" },
+			warnings: []string{"SocketFile", "Hooks"},
+		},
+		{
+			name:     "can't redirect itself",
+			doc:      `{"RemoteConfig": {"URL": "https://elsewhere.example/config.json"}}`,
+			want:     func(c *ConfigData) {},
+			warnings: []string{"RemoteConfig"},
+		},
+		{
+			name: "only the chosen keys",
+			keys: []string{"States"},
+			doc:  `{"SnoozeSignal": "blue", "States": {"lunch": {"Signal": "blue"}}}`,
+			want: func(c *ConfigData) { c.States = map[string]CustomStateConfigData{"lunch": {Signal: "blue"}} },
+		},
+		{
+			name: "chosen keys without regard to case",
+			keys: []string{"snoozesignal"},
+			doc:  `{"SnoozeSignal": "blue"}`,
+			want: func(c *ConfigData) { c.SnoozeSignal = "blue" },
+		},
+		{
+			name: "empty",
+			doc:  `{}`,
+			want: func(c *ConfigData) {},
+		},
+
+		{name: "not JSON", doc: `SnoozeSignal: blue`, wantErr: "Unable to understand remote configuration"},
+		{name: "not an object", doc: `["SnoozeSignal"]`, wantErr: "Unable to understand remote configuration"},
+		{name: "unknown setting", doc: `{"SnoozeColour": "blue"}`, wantErr: "Unable to understand remote configuration"},
+		{name: "wrong type", doc: `{"SnoozeSignal": 3}`, wantErr: "Unable to understand remote configuration"},
+	}
+
+	for _, test := range tests {
+		var logged bytes.Buffer
+		config := &ConfigData{SocketFile: "/tmp/sock", logger: log.New(&logged, "", 0)}
+		config.RemoteConfig = RemoteConfigData{URL: "https://example.com/config.json", Keys: test.keys}
+		want := &ConfigData{SocketFile: "/tmp/sock"}
+		want.RemoteConfig = config.RemoteConfig
+
+		err := layRemoteConfig(config, []byte(test.doc))
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		test.want(want)
+		config.logger = nil
+		if !reflect.DeepEqual(config, want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, config, want)
+		}
+		for _, setting := range test.warnings {
+			if !strings.Contains(logged.String(), "Ignoring "+setting+" ") {
+				t.Errorf("%s: didn't warn about ignoring %s (logged %q)", test.name, setting, logged.String())
+			}
+		}
+		if len(test.warnings) == 0 && logged.Len() > 0 {
+			t.Errorf("%s: unexpected warnings %q", test.name, logged.String())
+		}
+	}
+}
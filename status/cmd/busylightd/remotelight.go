@@ -0,0 +1,427 @@
+//
+// Remote light driver and light server.
+//
+// The light doesn't have to be plugged into the computer which knows our
+// schedule: it can live on (say) a Raspberry Pi by the door, plugged into
+// a busylightd there which offers it to other daemons as a light server
+// (see LightServer), while the calendars and call detection run on the
+// work laptop, whose Driver is "remote" (see RemoteLight).
+//
+// The two talk over TCP (with TLS if the server has a certificate) a line
+// at a time. The client introduces itself, then sends the light signals
+// it wants shown, and pings now and then to make sure the light is still
+// working, each along with the state the client is in (if it has one yet);
+// the server answers each line with "ok" or "error <why>":
+//
+//    hello <token> <name>
+//    set <signal> [<state>]
+//    ping [<state>]
+//
+// A client named in LightServer.Clients says hello with its own token (and
+// goes by the name it's registered under); one whose scope is only "read"
+// (see scopes.go) may ping, but not set the light.
+//
+// While a client is connected, the signal it asked for takes the server's
+// light over from the server's own state; when it hangs up (or hasn't been
+// heard from for a while, as when a laptop goes to sleep), the light goes
+// back to showing the server's state.
+//
+// With LightServer.Arbitrate set, the light is shared instead (say, between
+// a work laptop and a personal desktop): whichever is busiest of the
+// server's own state and the clients' states wins.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RemoteLightConfigData describes the light server we use, if Driver is "remote".
+type RemoteLightConfigData struct {
+	Address string // the light server's address (e.g., "doorpi.local:8644")
+	Token   string // the server's LightServer.Token, or ours from its LightServer.Clients
+	TLS     bool   // connect using TLS (if the server has a certificate)
+	CAFile  string // CA certificate(s) to verify the server's certificate (default: the system's trusted CAs)
+}
+
+// LightServerConfigData controls offering our light to other daemons.
+type LightServerConfigData struct {
+	// The address to listen on, as for HTTP.Listen (so ":8644" means
+	// localhost only). If empty, we don't offer our light. We use TLS if
+	// HTTP.CertFile and HTTP.KeyFile are given.
+	Listen string
+
+	// Clients must present this token, or one of their own from Clients.
+	Token string
+
+	// Named clients, each with a token of its own (so what each may do can
+	// be limited; see scopes.go).
+	Clients map[string]string
+
+	// If true, show the busiest of our own state and the clients' states,
+	// rather than whatever the latest client asked for.
+	Arbitrate bool
+
+	// How long a client's claim on the light lasts without hearing from it
+	// (default 60 seconds; clients check in every 15 seconds).
+	ClaimSeconds int
+}
+
+// claimTimeout is how long a client's claim on the light lasts without
+// hearing from it.
+func (s LightServerConfigData) claimTimeout() time.Duration {
+	if s.ClaimSeconds <= 0 {
+		return time.Minute
+	}
+	return time.Duration(s.ClaimSeconds) * time.Second
+}
+
+// remoteLightTimeout is how long we wait for the light server to answer.
+const remoteLightTimeout = 10 * time.Second
+
+// remoteLight is a light on another daemon's light server.
+type remoteLight struct {
+	config *ConfigData
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRemoteLight(config *ConfigData) lightDriver {
+	return &remoteLight{config: config}
+}
+
+// Open connects to the light server and introduces us.
+func (l *remoteLight) Open() error {
+	settings := l.config.RemoteLight
+	dialer := &net.Dialer{Timeout: remoteLightTimeout}
+	var err error
+	if settings.TLS || settings.CAFile != "" {
+		tlsConfig := &tls.Config{}
+		if settings.CAFile != "" {
+			if tlsConfig.RootCAs, err = loadCertPool(settings.CAFile); err != nil {
+				return fmt.Errorf("Unable to load RemoteLight.CAFile: %v", err)
+			}
+		}
+		l.conn, err = tls.DialWithDialer(dialer, "tcp", settings.Address, tlsConfig)
+	} else {
+		l.conn, err = dialer.Dial("tcp", settings.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("Can't reach light server %s: %v", settings.Address, err)
+	}
+	l.reader = bufio.NewReader(l.conn)
+
+	name := l.config.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	if err = l.request("hello " + settings.Token + " " + name); err != nil {
+		l.conn.Close()
+		return fmt.Errorf("Light server %s turned us away: %v", settings.Address, err)
+	}
+	l.config.logger.Printf("Using the light on light server %s", settings.Address)
+	return nil
+}
+
+// request sends a line to the light server and waits for its answer.
+func (l *remoteLight) request(line string) error {
+	if l.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	l.conn.SetDeadline(time.Now().Add(remoteLightTimeout))
+	if _, err := fmt.Fprintf(l.conn, "%s\n", line); err != nil {
+		return err
+	}
+	reply, err := l.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	reply = strings.TrimSpace(reply)
+	if reply != "ok" {
+		return fmt.Errorf("%s", strings.TrimPrefix(reply, "error "))
+	}
+	return nil
+}
+
+// withState adds our current state to a request, so a server arbitrating
+// between its clients knows how busy we are.
+func (l *remoteLight) withState(request string) string {
+	if state := l.config.events.Current().State; state != "" {
+		return request + " " + state
+	}
+	return request
+}
+
+func (l *remoteLight) Set(color string) error {
+	return l.request(l.withState("set " + color))
+}
+
+func (l *remoteLight) Close() error {
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close()
+}
+
+func (l *remoteLight) HealthCheck() error {
+	return l.request(l.withState("ping"))
+}
+
+// lightClaim is a message to the main event loop from the light
+// server: what a client wants our light to show (nothing, once it's gone).
+type lightClaim struct {
+	Client string
+	Signal string // as lastSignal would have it, e.g. "yellow+lowpri"
+	State  string // the state the client is showing (if it told us)
+}
+
+// busiestStates are our own states, least busy first, for arbitrating
+// between the light server's clients.
+var busiestStates = []string{"off", "free", "away", "warning", "busy", "dnd", "zoom-muted", "zoom-open", "urgent"}
+
+// stateBusyness ranks a state by how busy it is. A state we don't know
+// (one of the client's own) counts as busy.
+func stateBusyness(state string) int {
+	for i, s := range busiestStates {
+		if s == state {
+			return i
+		}
+	}
+	if state == "" {
+		return 0
+	}
+	return stateBusyness("busy")
+}
+
+// lightClaims are what the light server's clients want our light to show.
+type lightClaims struct {
+	claims map[string]lightClaim // by client
+	latest string                // the client which asked most recently
+}
+
+// update takes a claim from a client (or its withdrawal).
+func (c *lightClaims) update(claim lightClaim) {
+	if c.claims == nil {
+		c.claims = make(map[string]lightClaim)
+	}
+	if claim.Signal == "" {
+		delete(c.claims, claim.Client)
+		if c.latest == claim.Client {
+			c.latest = ""
+		}
+		return
+	}
+	c.claims[claim.Client] = claim
+	c.latest = claim.Client
+}
+
+// showing returns the light signal the clients want shown instead of our
+// own state (empty if none). Unless we're arbitrating, the client which
+// asked most recently wins; if we are, the client whose state is busiest
+// wins, if it's busier than ours.
+func (c *lightClaims) showing(config *ConfigData, own string) string {
+	var clients []string
+	for client := range c.claims {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+
+	if !config.LightServer.Arbitrate {
+		if c.latest != "" {
+			return c.claims[c.latest].Signal
+		}
+		// (the latest has gone; fall back on any of the others, in a predictable order)
+		if len(clients) == 0 {
+			return ""
+		}
+		return c.claims[clients[0]].Signal
+	}
+
+	showing, busiest := "", stateBusyness(own)
+	for _, client := range clients {
+		if busyness := stateBusyness(c.claims[client].State); busyness > busiest {
+			showing, busiest = c.claims[client].Signal, busyness
+		}
+	}
+	return showing
+}
+
+// showLightSignal shows a light signal, possibly with the low-priority
+// indicator added (e.g., "yellow+lowpri"), unless it's already showing.
+func showLightSignal(config *ConfigData, showing string) {
+	if config.light == nil || (!config.hardwareFault && config.lastSignal == showing) {
+		return
+	}
+	signal := strings.TrimSuffix(showing, "+lowpri")
+	lightSignal(config, signal, 0)
+	if signal != showing {
+		lightSignal(config, "lowpri", 0)
+	}
+}
+
+// serveLightClient answers one light server client until it hangs up.
+func serveLightClient(config *ConfigData, conn net.Conn) {
+	defer conn.Close()
+	lines := bufio.NewScanner(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\n", args...)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(currentSettings(config).LightServer.claimTimeout()))
+	if !lines.Scan() {
+		return
+	}
+	settings := currentSettings(config)
+	words := strings.SplitN(strings.TrimSpace(lines.Text()), " ", 3)
+	if len(words) < 2 || words[0] != "hello" {
+		reply("error not authorized")
+		config.logger.Printf("Light server client %s wasn't authorized", conn.RemoteAddr())
+		return
+	}
+	name, named := clientWithToken(settings.LightServer.Clients, words[1])
+	scope := scopeAdmin
+	switch {
+	case named:
+		scope = scopeOf(settings, name)
+	case settings.LightServer.Token != "" && subtle.ConstantTimeCompare([]byte(words[1]), []byte(settings.LightServer.Token)) == 1:
+		name = conn.RemoteAddr().String()
+		if len(words) > 2 {
+			name = words[2]
+		}
+	default:
+		reply("error not authorized")
+		config.logger.Printf("Light server client %s wasn't authorized", conn.RemoteAddr())
+		return
+	}
+	reply("ok")
+	config.logger.Printf("Light server client %s (%s, %s) connected", name, scope, conn.RemoteAddr())
+
+	showing, state := "", ""
+	defer func() {
+		config.logger.Printf("Light server client %s (%s) disconnected", name, conn.RemoteAddr())
+		if showing != "" {
+			config.remoteLights <- lightClaim{Client: name}
+		}
+	}()
+	for {
+		conn.SetReadDeadline(time.Now().Add(currentSettings(config).LightServer.claimTimeout()))
+		if !lines.Scan() {
+			return
+		}
+		words := strings.Fields(lines.Text())
+		switch {
+		case (len(words) == 2 || len(words) == 3) && words[0] == "set":
+			signal := words[1]
+			if scope < scopeControl {
+				config.logger.Printf("WARNING: Refused to let light server client %s (%s, %s) show %s", name, scope, conn.RemoteAddr(), signal)
+				reply("error not allowed")
+				continue
+			}
+			if !lightSignalDefined(settings, signal) {
+				reply("error light signal \"%s\" isn't defined here", signal)
+				continue
+			}
+			if signal == "lowpri" {
+				showing += "+lowpri"
+			} else {
+				showing = signal
+			}
+			if len(words) == 3 {
+				state = words[2]
+			}
+			config.remoteLights <- lightClaim{Client: name, Signal: showing, State: state}
+			reply("ok")
+
+		case (len(words) == 1 || len(words) == 2) && words[0] == "ping":
+			if len(words) == 2 && words[1] != state {
+				state = words[1]
+				if showing != "" {
+					config.remoteLights <- lightClaim{Client: name, Signal: showing, State: state}
+				}
+			}
+			if light := config.events.Current().Light; light != "ok" {
+				reply("error the light is %s", light)
+			} else {
+				reply("ok")
+			}
+
+		default:
+			reply("error unknown request")
+		}
+	}
+}
+
+// checkRemoteLight makes sure the RemoteLight and LightServer settings make sense.
+func checkRemoteLight(config *ConfigData) error {
+	if config.Driver == "remote" && config.RemoteLight.Address == "" {
+		return fmt.Errorf("RemoteLight.Address is needed for the remote light")
+	}
+	if config.LightServer.Listen != "" {
+		if _, err := listenAddress("LightServer.Listen", config.LightServer.Listen); err != nil {
+			return err
+		}
+		if config.LightServer.Token == "" && len(config.LightServer.Clients) == 0 {
+			return fmt.Errorf("LightServer.Listen needs LightServer.Token or LightServer.Clients, so clients can be told apart from anyone else")
+		}
+		if err := checkClientTokens("LightServer", config.LightServer.Clients); err != nil {
+			return err
+		}
+		if config.Driver == "remote" {
+			return fmt.Errorf("LightServer.Listen can't offer a remote light to others")
+		}
+		if config.LightServer.ClaimSeconds < 0 {
+			return fmt.Errorf("LightServer.ClaimSeconds can't be negative")
+		}
+	}
+	return nil
+}
+
+// startLightServer starts offering our light to other daemons, if configured to do so.
+// The settings are captured at startup; changing them requires a restart of the daemon.
+func startLightServer(config *ConfigData) error {
+	if config.LightServer.Listen == "" {
+		return nil
+	}
+	address, err := listenAddress("LightServer.Listen", config.LightServer.Listen)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("Unable to start light server: %v", err)
+	}
+	if config.HTTP.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.HTTP.CertFile, config.HTTP.KeyFile)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("Unable to load certificate for the light server: %v", err)
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	} else if !isLoopback(listener.Addr()) {
+		config.logger.Printf("WARNING: The light server's token can be read by anyone on the network between here and its clients (set HTTP.CertFile and HTTP.KeyFile to use TLS)")
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				config.logger.Printf("ERROR: Light server stopped: %v", err)
+				return
+			}
+			go serveLightClient(config, conn)
+		}
+	}()
+	config.logger.Printf("Offering our light to other daemons on %s", listener.Addr())
+	return nil
+}
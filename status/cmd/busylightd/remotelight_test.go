@@ -0,0 +1,42 @@
+//
+// Tests for sharing the light with the light server's clients.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import "testing"
+
+func TestLightClaims(t *testing.T) {
+	tests := []struct {
+		name      string
+		arbitrate bool
+		claims    []lightClaim
+		own       string
+		want      string
+	}{
+		{"none", false, nil, "free", ""},
+		{"latest wins", false, []lightClaim{{"a", "red", "busy"}, {"b", "green", "free"}}, "busy", "green"},
+		{"latest withdrawn", false, []lightClaim{{"b", "green", "free"}, {"a", "red", "busy"}, {"a", "", ""}}, "busy", "green"},
+		{"all withdrawn", false, []lightClaim{{"a", "red", "busy"}, {"a", "", ""}}, "busy", ""},
+		{"arbitrate, busier client", true, []lightClaim{{"a", "red", "dnd"}}, "busy", "red"},
+		{"arbitrate, we're busier", true, []lightClaim{{"a", "yellow", "busy"}}, "zoom-open", ""},
+		{"arbitrate, tie with us", true, []lightClaim{{"a", "yellow", "busy"}}, "busy", ""},
+		{"arbitrate, tie between clients", true, []lightClaim{{"b", "red2", "dnd"}, {"a", "red1", "dnd"}}, "free", "red1"},
+		{"arbitrate, unknown state counts as busy", true, []lightClaim{{"a", "blue", "lunch"}}, "free", "blue"},
+	}
+
+	for _, test := range tests {
+		config := &ConfigData{}
+		config.LightServer.Arbitrate = test.arbitrate
+		var claims lightClaims
+		for _, claim := range test.claims {
+			claims.update(claim)
+		}
+		if got := claims.showing(config, test.own); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+//
+// Support for RGB lights.
+//
+// Off-the-shelf presence lights (blink(1), Luxafor, and so on) and smart
+// bulbs have RGB LEDs instead of our own device's separate colored lights.
+// For those, we show the steady signals as colors, and do the flashing ones
+// (which our own hardware does by itself) with effects (see effects.go).
+// Each driver just has to provide an rgbDevice, which knows how to set the
+// color; the USB HID ones just have to say what to send the device.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/karalabe/hid"
+)
+
+// rgbColor is a color as red, green, and blue levels.
+type rgbColor [3]byte
+
+var (
+	rgbOff    = rgbColor{0, 0, 0}
+	rgbRed    = rgbColor{255, 0, 0}
+	rgbGreen  = rgbColor{0, 255, 0}
+	rgbBlue   = rgbColor{0, 0, 255}
+	rgbYellow = rgbColor{255, 160, 0}
+)
+
+// rgbStep is one step of a (possibly repeating) light pattern.
+type rgbStep struct {
+	Color rgbColor
+	Hold  time.Duration // how long to show it (0 for as long as the pattern lasts)
+}
+
+// rgbPatterns shows each light signal as a pattern of colors (unless
+// configured otherwise; see lightsignals.go).
+var rgbPatterns = map[string][]rgbStep{
+	"off":      {{Color: rgbOff}},
+	"green":    {{Color: rgbGreen}},
+	"yellow":   {{Color: rgbYellow}},
+	"red":      {{Color: rgbRed}},
+	"red2":     {{Color: rgbRed}},
+	"blue":     {{Color: rgbBlue}},
+	"redflash": effectPattern("blink", 1, rgbRed),
+	"urgent":   effectPattern("alternate", 1, rgbRed, rgbBlue),
+}
+
+// rgbLightTiming describes any timing constraints an RGB light has.
+type rgbLightTiming struct {
+	KeepAlive time.Duration // if nonzero, the device needs to hear from us this often
+	MinHold   time.Duration // if nonzero, don't change the color more often than this when flashing
+}
+
+// rgbDevice is a light which can be set to any color.
+type rgbDevice interface {
+	Open() error
+	SetColor(c rgbColor) error
+	Close() error
+	HealthCheck() error
+}
+
+// rgbLight drives an RGB device as a lightDriver.
+type rgbLight struct {
+	device   rgbDevice
+	timing   rgbLightTiming
+	patterns map[string][]rgbStep // how we show each light signal
+	effects  animator             // keeps the patterns going
+}
+
+func newRGBLight(config *ConfigData, device rgbDevice, timing rgbLightTiming) *rgbLight {
+	return &rgbLight{device: device, timing: timing, patterns: rgbSignalPatterns(config)}
+}
+
+// Open opens the device and starts driving it.
+func (l *rgbLight) Open() error {
+	if err := l.device.Open(); err != nil {
+		return err
+	}
+	l.effects.start(l.timing)
+	return l.effects.play(l.patterns["off"], l.device.SetColor)
+}
+
+// Set shows a light signal. The "lowpri" signal adds a green strobe to
+// whatever we're showing already, as it does on our own hardware.
+func (l *rgbLight) Set(color string) error {
+	var pattern []rgbStep
+	if color == "lowpri" {
+		for _, step := range l.effects.current() {
+			if step.Hold == 0 {
+				step.Hold = 900 * time.Millisecond
+			}
+			pattern = append(pattern, step, rgbStep{Color: rgbGreen, Hold: 100 * time.Millisecond})
+		}
+	} else {
+		var valid bool
+		if pattern, valid = l.patterns[color]; !valid {
+			return fmt.Errorf("not defined")
+		}
+	}
+	return l.effects.play(pattern, l.device.SetColor)
+}
+
+func (l *rgbLight) Close() error {
+	l.effects.stop()
+	l.device.SetColor(rgbOff)
+	return l.device.Close()
+}
+
+func (l *rgbLight) HealthCheck() error {
+	return l.device.HealthCheck()
+}
+
+// hidDevice is an RGB light on USB HID.
+type hidDevice struct {
+	name    string                // what the device is called, for messages
+	ids     [][2]uint16           // vendor and product IDs it might have
+	command func(rgbColor) []byte // the report which sets it to a color
+
+	device *hid.Device
+	path   string // where we found it
+}
+
+// Open finds and opens the first device with one of our IDs.
+func (d *hidDevice) Open() error {
+	if !hid.Supported() {
+		return fmt.Errorf("Can't open %s: USB HID isn't supported on this system", d.name)
+	}
+	for _, ids := range d.ids {
+		devices := hid.Enumerate(ids[0], ids[1])
+		if len(devices) == 0 {
+			continue
+		}
+		device, err := devices[0].Open()
+		if err != nil {
+			return fmt.Errorf("Can't open %s device: %v", d.name, err)
+		}
+		d.device, d.path = device, devices[0].Path
+		return nil
+	}
+	return fmt.Errorf("Can't find a %s device", d.name)
+}
+
+func (d *hidDevice) SetColor(c rgbColor) error {
+	_, err := d.device.Write(d.command(c))
+	return err
+}
+
+func (d *hidDevice) Close() error {
+	return d.device.Close()
+}
+
+// HealthCheck makes sure the device we opened is still plugged in.
+func (d *hidDevice) HealthCheck() error {
+	for _, ids := range d.ids {
+		for _, info := range hid.Enumerate(ids[0], ids[1]) {
+			if info.Path == d.path {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s device is no longer attached", d.name)
+}
@@ -0,0 +1,139 @@
+//
+// What each client may do.
+//
+// Several of our interfaces may be used by more than one client, each
+// known to us by name: the HTTP API and gRPC service (with a token from
+// HTTP.APITokens, or a certificate named in HTTP.APIClients), the light
+// server (with a token from LightServer.Clients), and the hub (with a
+// token from Hub.Clients). The Scopes setting may limit any of them, by
+// name, to one of:
+//
+//    read    - only see how we're doing: our status and events, whether
+//              the light server's light is working, the hub's members
+//    control - also change our state (e.g., "urgent on" or "dnd 1h"),
+//              show a signal on the light server's light, or report to
+//              the hub
+//    admin   - anything, including turning the daemon off and on and
+//              re-reading its configuration
+//
+// So a family member's button can be given a token which can turn on the
+// urgent indicator, but not reconfigure the daemon. Clients not listed in
+// Scopes (and anyone using HTTP.APIToken or LightServer.Token, which don't
+// say who they are) may do anything. Every command a named client sends
+// is logged under its name and scope, as is anything it was refused, so
+// there's a record of who did what.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// clientScope is what a client may do; each scope allows everything the
+// ones before it do.
+type clientScope int
+
+const (
+	scopeRead clientScope = iota
+	scopeControl
+	scopeAdmin
+)
+
+// scopeNames are the names of the scopes, as given in the Scopes setting.
+var scopeNames = map[string]clientScope{
+	"read":    scopeRead,
+	"control": scopeControl,
+	"admin":   scopeAdmin,
+}
+
+func (s clientScope) String() string {
+	for name, scope := range scopeNames {
+		if scope == s {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// scopeOf returns what a named client may do.
+func scopeOf(config *ConfigData, client string) clientScope {
+	if scope, limited := config.Scopes[client]; limited {
+		return scopeNames[strings.ToLower(scope)]
+	}
+	return scopeAdmin
+}
+
+// commandScope returns the scope needed to run a control command (as
+// returned by commandWords).
+func commandScope(words []string) clientScope {
+	if len(words) == 0 {
+		return scopeRead
+	}
+	switch words[0] {
+	case "status", "help":
+		return scopeRead
+	case "on", "off", "reconfigure":
+		return scopeAdmin
+	}
+	return scopeControl
+}
+
+// scopeClients lists the names of the clients which may be given scopes.
+func scopeClients(config *ConfigData) []string {
+	names := append([]string{}, config.HTTP.APIClients...)
+	for _, clients := range []map[string]string{config.HTTP.APITokens, config.LightServer.Clients, config.Hub.Clients} {
+		for name := range clients {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// clientWithToken returns the name of the client (of those in a setting
+// like Hub.Clients, giving each one's token) presenting a token, if any.
+func clientWithToken(clients map[string]string, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	var names []string
+	for name := range clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(clients[name])) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// checkScopes makes sure the Scopes setting makes sense.
+func checkScopes(config *ConfigData) error {
+	var names []string
+	for name := range config.Scopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	clients := scopeClients(config)
+	for _, name := range names {
+		if _, known := scopeNames[strings.ToLower(config.Scopes[name])]; !known {
+			return fmt.Errorf("Unknown scope \"%s\" for %s in Scopes (expected read, control, or admin)", config.Scopes[name], name)
+		}
+		found := false
+		for _, client := range clients {
+			found = found || client == name
+		}
+		if !found {
+			return fmt.Errorf("Scopes names \"%s\", which isn't in HTTP.APITokens, HTTP.APIClients, LightServer.Clients, or Hub.Clients", name)
+		}
+	}
+	return nil
+}
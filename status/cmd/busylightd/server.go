@@ -0,0 +1,207 @@
+//
+// Embedded HTTP server for busylightd.
+//
+// This is off unless an address to listen on is given in the configuration.
+// Each subsystem which needs to answer HTTP requests has its handlers
+// registered in newHTTPMux.
+//
+// Since anyone who can reach the control API can change the light, the
+// server only listens on this machine unless told otherwise: an address
+// with no host (":8642") means localhost, and it takes "*:8642" (or an
+// explicit address) to listen on the network. Anything beyond the widget
+// needs an API token or a client certificate (see api.go), and on the
+// network it ought to be served over HTTPS, or the token can be read in
+// passing; we warn if it isn't.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+)
+
+// HTTPConfigData controls the daemon's embedded HTTP server.
+type HTTPConfigData struct {
+	// The address to listen on, e.g. "127.0.0.1:8642". With no host
+	// (":8642"), we listen on localhost only; "*:8642" listens on every
+	// interface. If empty, the server is not started.
+	Listen string
+
+	// If given, we serve HTTPS using this certificate and private key (PEM files).
+	CertFile string
+	KeyFile  string
+
+	// If given, clients may present certificates signed by these CAs (PEM file) to
+	// identify themselves. This is required for other daemons to federate with us.
+	ClientCAFile string
+
+	// Clients must present this token to use the control API (see api.go).
+	APIToken string
+
+	// Named clients, each with a token of its own which it may present
+	// instead (so what each may do can be limited; see scopes.go).
+	APITokens map[string]string
+
+	// Clients presenting certificates (signed by a CA in ClientCAFile) with
+	// these common names may use the control API without the token.
+	// If this, APIToken, and APITokens are all empty, the control API is disabled.
+	APIClients []string
+}
+
+// apiTokenSet reports whether any API tokens are set.
+func (h HTTPConfigData) apiTokenSet() bool {
+	return h.APIToken != "" || len(h.APITokens) > 0
+}
+
+// checkClientTokens makes sure each of a setting's named clients has a
+// token of its own.
+func checkClientTokens(setting string, clients map[string]string) error {
+	var names []string
+	for name := range clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	seen := make(map[string]string)
+	for _, name := range names {
+		token := clients[name]
+		if token == "" {
+			return fmt.Errorf("%s client \"%s\" needs a token", setting, name)
+		}
+		if other, taken := seen[token]; taken {
+			return fmt.Errorf("%s clients \"%s\" and \"%s\" can't have the same token", setting, other, name)
+		}
+		seen[token] = name
+	}
+	return nil
+}
+
+// listenAddress returns the address we actually listen on for a Listen setting.
+func listenAddress(setting, listen string) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("Unable to understand %s address \"%s\": %v", setting, listen, err)
+	}
+	switch host {
+	case "":
+		host = "localhost"
+	case "*":
+		host = ""
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// isLoopback reports whether a listener only accepts connections from this machine.
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// checkHTTP makes sure the HTTP settings make sense.
+func checkHTTP(config *ConfigData) error {
+	h := config.HTTP
+	if h.Listen != "" {
+		if _, err := listenAddress("HTTP.Listen", h.Listen); err != nil {
+			return err
+		}
+	}
+	if (h.CertFile == "") != (h.KeyFile == "") {
+		return fmt.Errorf("HTTP.CertFile and HTTP.KeyFile must be given together")
+	}
+	if h.ClientCAFile != "" && h.CertFile == "" {
+		return fmt.Errorf("HTTP.ClientCAFile needs HTTP.CertFile and HTTP.KeyFile (client certificates only work over HTTPS)")
+	}
+	if len(h.APIClients) > 0 && h.ClientCAFile == "" {
+		return fmt.Errorf("HTTP.APIClients needs HTTP.ClientCAFile to check their certificates")
+	}
+	if err := checkClientTokens("HTTP.APITokens", h.APITokens); err != nil {
+		return err
+	}
+	if config.GRPC.Listen != "" {
+		if _, err := listenAddress("GRPC.Listen", config.GRPC.Listen); err != nil {
+			return err
+		}
+		if !h.apiTokenSet() && len(h.APIClients) == 0 {
+			return fmt.Errorf("GRPC.Listen needs HTTP.APIToken, HTTP.APITokens, or HTTP.APIClients, so clients can be told apart from anyone else")
+		}
+	}
+	return nil
+}
+
+// newHTTPMux sets up the handlers for every URL the daemon answers.
+func newHTTPMux(config *ConfigData) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/widget", widgetPageHandler(config))
+	mux.HandleFunc("/widget.json", widgetJSONHandler(config))
+	mux.HandleFunc("/widget/events", widgetEventsHandler(config))
+	mux.HandleFunc("/dashboard", dashboardPageHandler(config))
+	mux.HandleFunc("/federation/state", federationHandler(config))
+	mux.HandleFunc("/hub/state", hubHandler(config))
+	mux.HandleFunc("/api/", apiHandler(config))
+	mux.HandleFunc("/slack/command", slackCommandHandler(config))
+	mux.HandleFunc("/zoom/webhook", zoomWebhookHandler(config))
+	alerts := &openAlerts{}
+	mux.HandleFunc("/alerts/alertmanager", alertsHandler(config, alerts, parseAlertmanager))
+	mux.HandleFunc("/alerts/grafana", alertsHandler(config, alerts, parseGrafana))
+	mux.HandleFunc("/alerts/opsgenie", alertsHandler(config, alerts, parseOpsgenie))
+	return mux
+}
+
+// startHTTPServer starts listening for HTTP requests, if configured to do so.
+// The server settings are captured at startup; changing them requires a restart of the daemon.
+func startHTTPServer(config *ConfigData) error {
+	if config.HTTP.Listen == "" {
+		return nil
+	}
+
+	address, err := listenAddress("HTTP.Listen", config.HTTP.Listen)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("Unable to start HTTP server: %v", err)
+	}
+	server := &http.Server{
+		Handler:  newHTTPMux(config),
+		ErrorLog: config.logger,
+	}
+
+	if config.HTTP.CertFile == "" {
+		if config.HTTP.apiTokenSet() && !isLoopback(listener.Addr()) {
+			config.logger.Printf("WARNING: API tokens can be read by anyone on the network between here and API clients (set HTTP.CertFile and HTTP.KeyFile to use HTTPS)")
+		}
+		if len(config.Hub.Clients) > 0 && !isLoopback(listener.Addr()) {
+			config.logger.Printf("WARNING: Hub clients' tokens can be read by anyone on the network between here and them (set HTTP.CertFile and HTTP.KeyFile to use HTTPS)")
+		}
+		go func() {
+			err := server.Serve(listener)
+			config.logger.Printf("ERROR: HTTP server stopped: %v", err)
+		}()
+		config.logger.Printf("Listening for HTTP requests on %s", listener.Addr())
+		return nil
+	}
+
+	server.TLSConfig = &tls.Config{}
+	if config.HTTP.ClientCAFile != "" {
+		pool, err := loadCertPool(config.HTTP.ClientCAFile)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("Unable to load client CA file: %v", err)
+		}
+		server.TLSConfig.ClientCAs = pool
+		server.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	go func() {
+		err := server.ServeTLS(listener, config.HTTP.CertFile, config.HTTP.KeyFile)
+		config.logger.Printf("ERROR: HTTPS server stopped: %v", err)
+	}()
+	config.logger.Printf("Listening for HTTPS requests on %s", listener.Addr())
+	return nil
+}
@@ -0,0 +1,235 @@
+//
+// Slack status write-back.
+//
+// Whenever our state changes, we set our Slack status (emoji and text) to
+// match, according to a template for each state, and optionally turn on
+// Slack's Do Not Disturb. When we enter a state with no template (such as
+// being free), the status is cleared again. That way the light on the door
+// and our presence in Slack never disagree.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SlackStatusTemplate describes the Slack status to set for a particular state.
+type SlackStatusTemplate struct {
+	Emoji string // status emoji, e.g. ":calendar:"
+	Text  string // status text; a Go text/template (see slackTemplateData)
+	DND   bool   // also turn on Do Not Disturb?
+}
+
+// SlackConfigData describes how we talk to Slack.
+type SlackConfigData struct {
+	// A Slack user token (xoxp-...) with the users.profile:write and dnd:write scopes.
+	Token string
+
+	// The signing secret of the Slack app whose slash command sends requests
+	// to our HTTP server. If empty, we don't accept slash commands.
+	SigningSecret string
+
+	// If non-empty, only these Slack user IDs may control the light via slash commands.
+	AllowedUsers []string
+
+	// The status to set for each of our states. If a state isn't listed, our Slack
+	// status is cleared when we enter it. If this is omitted entirely,
+	// defaultSlackStatuses is used.
+	Statuses map[string]SlackStatusTemplate
+
+	// If true, we leave our Slack status alone while it's one we didn't set
+	// (e.g., "On vacation" set by hand), rather than replacing or clearing it.
+	KeepManualStatus bool
+
+	// If true, we also watch our presence in Slack (see slackpresence.go):
+	// a huddle means we're in a call, and Do Not Disturb that we're busy.
+	// This needs the users.profile:read and dnd:read scopes.
+	WatchPresence bool
+}
+
+var defaultSlackStatuses = map[string]SlackStatusTemplate{
+	"busy":       {Emoji: ":spiral_calendar_pad:", Text: "Busy{{if .FreeAt}} until {{.FreeAt}}{{end}}"},
+	"zoom-muted": {Emoji: ":video_camera:", Text: "In a meeting", DND: true},
+	"zoom-open":  {Emoji: ":video_camera:", Text: "In a meeting", DND: true},
+	"urgent":     {Emoji: ":rotating_light:", Text: "Dealing with something urgent", DND: true},
+	"dnd":        {Emoji: ":no_entry:", Text: "Do not disturb{{if .Until}} until {{.Until}}{{end}}", DND: true},
+	"away":       {Emoji: ":palm_tree:", Text: "Away"},
+}
+
+// slackTemplateData is what status text templates have to work with.
+type slackTemplateData struct {
+	Name        string // our name
+	State       string // our state
+	Description string // description of the state
+	FreeAt      string // "HH:MM" when we'll be free, if busy and we know
+	Until       string // "HH:MM" when a temporary state (such as dnd) ends
+}
+
+// slackCall invokes a Slack Web API method. If params is a url.Values, it is sent
+// as a form; otherwise it's sent as JSON.
+func slackCall(client *http.Client, token, method string, params interface{}, result interface{}) error {
+	var req *http.Request
+	var err error
+	endpoint := "https://slack.com/api/" + method
+	if form, isForm := params.(url.Values); isForm {
+		req, err = http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		var body []byte
+		if body, err = json.Marshal(params); err != nil {
+			return err
+		}
+		req, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: Slack returned %s", method, resp.Status)
+	}
+
+	var reply struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	var raw json.RawMessage
+	if err = json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if err = json.Unmarshal(raw, &reply); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s: %s", method, reply.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(raw, result)
+	}
+	return nil
+}
+
+// startSlackStatus arranges for our Slack status to follow our state.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startSlackStatus(config *ConfigData) error {
+	if config.Slack.Token == "" {
+		return nil
+	}
+	token, keepManual, name := config.Slack.Token, config.Slack.KeepManualStatus, config.Name
+	statuses := slackStatuses(config)
+	templates := make(map[string]*template.Template)
+	for state, s := range statuses {
+		t, err := template.New("slack-" + state).Parse(s.Text)
+		if err != nil {
+			return fmt.Errorf("Unable to understand Slack status text for %s: %v", state, err)
+		}
+		templates[state] = t
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	events := config.events.Subscribe()
+	go func() {
+		dndOn := false
+		var ourText, ourEmoji string // the status we set last
+		for event := range events {
+			if event.Status.State == event.Previous {
+				continue
+			}
+			status, isSet := statuses[event.Status.State]
+			data := slackTemplateData{
+				Name:        name,
+				State:       event.Status.State,
+				Description: event.Status.Description,
+			}
+			var expiration int64
+			if !event.Status.Until.IsZero() {
+				data.Until = event.Status.Until.In(localZone(config)).Format("15:04")
+				expiration = event.Status.Until.Unix()
+			}
+			if event.Status.BusyNow && !event.Status.NextTransition.IsZero() {
+				data.FreeAt = event.Status.NextTransition.In(localZone(config)).Format("15:04")
+				if event.Status.State == "busy" {
+					expiration = event.Status.NextTransition.Unix()
+				}
+			}
+
+			var text bytes.Buffer
+			if isSet {
+				if err := templates[event.Status.State].Execute(&text, data); err != nil {
+					config.logger.Printf("ERROR: Unable to build Slack status text: %v", err)
+					continue
+				}
+			}
+			manual := false
+			if keepManual {
+				var current struct {
+					Profile struct {
+						StatusText  string `json:"status_text"`
+						StatusEmoji string `json:"status_emoji"`
+					} `json:"profile"`
+				}
+				if err := slackCall(client, token, "users.profile.get", url.Values{}, &current); err != nil {
+					config.logger.Printf("ERROR: Unable to get Slack status: %v", err)
+				} else if current.Profile.StatusText != "" || current.Profile.StatusEmoji != "" {
+					manual = current.Profile.StatusText != ourText || current.Profile.StatusEmoji != ourEmoji
+				}
+			}
+			if manual {
+				config.logger.Printf("Leaving Slack status alone, since it was set by hand")
+			} else {
+				profile := map[string]interface{}{
+					"profile": map[string]interface{}{
+						"status_text":       text.String(),
+						"status_emoji":      status.Emoji,
+						"status_expiration": expiration,
+					},
+				}
+				if err := slackCall(client, token, "users.profile.set", profile, nil); err != nil {
+					config.logger.Printf("ERROR: Unable to set Slack status: %v", err)
+				} else {
+					ourText, ourEmoji = text.String(), status.Emoji
+				}
+			}
+
+			if status.DND {
+				minutes := 60
+				if expiration > 0 {
+					minutes = int(time.Until(time.Unix(expiration, 0))/time.Minute) + 1
+				}
+				if err := slackCall(client, token, "dnd.setSnooze", url.Values{"num_minutes": {fmt.Sprint(minutes)}}, nil); err != nil {
+					config.logger.Printf("ERROR: Unable to turn on Slack Do Not Disturb: %v", err)
+				} else {
+					dndOn = true
+				}
+			} else if dndOn {
+				if err := slackCall(client, token, "dnd.endSnooze", url.Values{}, nil); err != nil {
+					config.logger.Printf("ERROR: Unable to turn off Slack Do Not Disturb: %v", err)
+				}
+				dndOn = false
+			}
+		}
+	}()
+	return nil
+}
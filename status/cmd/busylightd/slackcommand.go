@@ -0,0 +1,83 @@
+//
+// Slack slash command control.
+//
+// A Slack app's slash command (e.g., "/busylight dnd 1h") can be pointed at
+// our HTTP server, so the light can be controlled from any device running
+// Slack. Every request is checked against the app's signing secret, and
+// optionally against a list of Slack users allowed to control the light.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// slackRequestSignature computes the signature Slack puts on its requests.
+func slackRequestSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// slackCommandHandler answers slash commands sent to us by Slack.
+func slackCommandHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := currentSettings(config)
+		secret := settings.Slack.SigningSecret
+		if secret == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64*1024))
+		if err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+		secs, err := strconv.ParseInt(timestamp, 10, 64)
+		if age := time.Since(time.Unix(secs, 0)); err != nil || age > 5*time.Minute || age < -5*time.Minute {
+			http.Error(w, "stale request", http.StatusUnauthorized)
+			return
+		}
+		if !hmac.Equal([]byte(r.Header.Get("X-Slack-Signature")), []byte(slackRequestSignature(secret, timestamp, body))) {
+			config.logger.Printf("WARNING: Rejected Slack command with bad signature from %s", r.RemoteAddr)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		userID, userName := form.Get("user_id"), form.Get("user_name")
+		var reply string
+		if len(settings.Slack.AllowedUsers) > 0 && !containsFold(settings.Slack.AllowedUsers, userID) {
+			config.logger.Printf("WARNING: Rejected Slack command from unauthorized user %s (%s)", userName, userID)
+			reply = "Sorry, you aren't allowed to control this light."
+		} else {
+			reply = sendCommand(config, "Slack user "+userName, form.Get("text"), 2500*time.Millisecond)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": reply})
+	}
+}
@@ -0,0 +1,120 @@
+//
+// Slack presence as an input.
+//
+// For teams who live in Slack huddles rather than Zoom, we can watch our
+// own presence in Slack: while we're in a huddle, we're in a call (Slack
+// doesn't tell us whether we're muted, so we assume so), and while Slack's
+// Do Not Disturb is on, we're busy.
+//
+// Of course, Slack status write-back (see slack.go) may well have turned
+// on Do Not Disturb itself, for a state we're already showing; while we're
+// in such a state, we don't take Slack's word for how busy we are, so the
+// two don't keep each other going after the state ends.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// slackPresenceInterval is how often we ask Slack about our presence.
+const slackPresenceInterval = 30 * time.Second
+
+// slackStatuses returns the Slack status to set for each of our states.
+func slackStatuses(config *ConfigData) map[string]SlackStatusTemplate {
+	if config.Slack.Statuses == nil {
+		return defaultSlackStatuses
+	}
+	return config.Slack.Statuses
+}
+
+// slackPresence asks Slack whether we're in a huddle, and whether Do Not
+// Disturb is on.
+func slackPresence(client *http.Client, token string) (huddle, dnd bool, err error) {
+	var profile struct {
+		Profile struct {
+			HuddleState string `json:"huddle_state"`
+		} `json:"profile"`
+	}
+	if err = slackCall(client, token, "users.profile.get", url.Values{}, &profile); err != nil {
+		return false, false, err
+	}
+
+	var info struct {
+		DNDEnabled     bool  `json:"dnd_enabled"`
+		NextDNDStartTS int64 `json:"next_dnd_start_ts"`
+		NextDNDEndTS   int64 `json:"next_dnd_end_ts"`
+		SnoozeEnabled  bool  `json:"snooze_enabled"`
+	}
+	if err = slackCall(client, token, "dnd.info", url.Values{}, &info); err != nil {
+		return false, false, err
+	}
+	// (dnd_enabled only means there's a Do Not Disturb schedule; we're in it
+	// if it's already started)
+	now := time.Now().Unix()
+	scheduled := info.DNDEnabled && info.NextDNDStartTS <= now && now < info.NextDNDEndTS
+	return profile.Profile.HuddleState == "in_a_huddle", info.SnoozeEnabled || scheduled, nil
+}
+
+// watchSlackPresence polls our Slack presence, reporting it whenever it changes.
+func watchSlackPresence(config *ConfigData) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	settings := currentSettings(config)
+	statuses := slackStatuses(settings)
+	var reported sourceStatus
+	working := true
+	for {
+		huddle, dnd, err := slackPresence(client, settings.Slack.Token)
+		if err != nil {
+			if working {
+				config.logger.Printf("ERROR: Unable to check our Slack presence: %v", err)
+			}
+			working = false
+			time.Sleep(slackPresenceInterval)
+			continue
+		}
+		if !working {
+			config.logger.Printf("Checking our Slack presence again")
+			working = true
+		}
+
+		if dnd && statuses[config.events.Current().State].DND {
+			// (we probably turned it on ourselves)
+			dnd = reported.Busy
+		}
+		if status := (sourceStatus{InCall: huddle, Busy: dnd}); status != reported {
+			if status.InCall != reported.InCall {
+				if huddle {
+					config.logger.Printf("In a Slack huddle")
+				} else {
+					config.logger.Printf("Left the Slack huddle")
+				}
+			}
+			if status.Busy != reported.Busy {
+				if dnd {
+					config.logger.Printf("Slack Do Not Disturb is on")
+				} else {
+					config.logger.Printf("Slack Do Not Disturb is off")
+				}
+			}
+			reportSource(config, "slack", status)
+			reported = status
+		}
+		time.Sleep(slackPresenceInterval)
+	}
+}
+
+// startSlackPresence begins watching our Slack presence, if configured to.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startSlackPresence(config *ConfigData) {
+	if config.Slack.Token == "" || !config.Slack.WatchPresence {
+		return
+	}
+	go watchSlackPresence(config)
+}
@@ -0,0 +1,160 @@
+//
+// Noticing the computer waking up from sleep, or the clock changing.
+//
+// Our timers count the time the computer is awake, so if a laptop's lid is
+// closed over lunch, everything we'd planned to do while it was shut
+// happens that much late: the light carries on showing the morning's
+// meeting until a timer catches up. So we watch for the computer having
+// been asleep, and tell the main loop, which polls the calendars at once
+// and sets its timers afresh from the times they're really meant to go off.
+//
+// We can tell we've been asleep because the monotonic clock (which Go's
+// timers use) doesn't advance while the computer sleeps, but the wall clock
+// does. The same thing happens if the clock is set forward (and the other
+// way round if it's set back), which calls for the same cure.
+//
+// We also watch for the time zone changing, whether for daylight saving
+// time or because we've travelled (and the system's zone was changed), so
+// the working and quiet hours follow the local clock, and the times we
+// show are given in the new zone. Go only reads the system's zone once (as
+// time.Local), and changing that under the rest of the program would be a
+// data race, so we load the new zone ourselves and the main event loop
+// keeps it in config.zone (see localZone); the times we work out and show
+// are put in that zone explicitly.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+)
+
+// clockCheckInterval is how often we look at the clocks.
+const clockCheckInterval = 15 * time.Second
+
+// clockJumpThreshold is how far the wall clock has to get ahead of (or
+// behind) the monotonic clock before we decide we've been asleep (or the
+// clock was set).
+const clockJumpThreshold = time.Minute
+
+// localZoneFile is where the system keeps its time zone.
+const localZoneFile = "/etc/localtime"
+
+// clockChange is news that our timers can no longer be trusted.
+type clockChange struct {
+	Jump     time.Duration  // how far the wall clock got ahead of the time which passed (after sleeping, or the clock being set forward), or behind it (if set back)
+	Zone     string         // the new time zone's name, if that changed
+	Location *time.Location // the system's time zone, if it's been changed
+}
+
+// followSystemZone reports whether we should follow changes to the system's
+// time zone (which we can't on Windows, and shouldn't if TZ tells us the
+// zone to use).
+func followSystemZone() bool {
+	return runtime.GOOS != "windows" && os.Getenv("TZ") == ""
+}
+
+// zoneFileSignature identifies the system's time zone setting, so we can
+// tell when it's changed.
+func zoneFileSignature() string {
+	target, _ := os.Readlink(localZoneFile)
+	info, err := os.Stat(localZoneFile)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %d %v", target, info.Size(), info.ModTime())
+}
+
+// loadLocalZone loads the system's time zone afresh.
+func loadLocalZone() (*time.Location, error) {
+	data, err := ioutil.ReadFile(localZoneFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the system's time zone: %v", err)
+	}
+	loc, err := time.LoadLocationFromTZData("Local", data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to understand the system's time zone: %v", err)
+	}
+	return loc, nil
+}
+
+// localZone returns the local time zone: time.Local, unless we've seen the
+// system's zone change since we started. Only the main event loop changes it.
+func localZone(config *ConfigData) *time.Location {
+	if loc, changed := config.zone.Load().(*time.Location); changed {
+		return loc
+	}
+	return time.Local
+}
+
+// watchClock starts watching for the computer waking up, the clock being
+// set, or the time zone changing, telling the main event loop on
+// config.clockChanges.
+func watchClock(config *ConfigData) {
+	config.clockChanges = make(chan clockChange)
+	loc := localZone(config)
+	go func() {
+		last := time.Now()
+		zone, offset := last.In(loc).Zone()
+		signature := zoneFileSignature()
+		for range time.NewTicker(clockCheckInterval).C {
+			var change clockChange
+			if followSystemZone() {
+				if s := zoneFileSignature(); s != signature {
+					signature = s
+					if reloaded, err := loadLocalZone(); err != nil {
+						config.logger.Printf("ERROR: %v", err)
+					} else {
+						loc = reloaded
+						change.Location = loc
+					}
+				}
+			}
+
+			now := time.Now()
+			// (Round(0) strips the monotonic reading, leaving the wall clock)
+			if jump := now.Round(0).Sub(last.Round(0)) - now.Sub(last); jump >= clockJumpThreshold || jump <= -clockJumpThreshold {
+				change.Jump = jump
+			}
+			last = now
+			if name, off := now.In(loc).Zone(); name != zone || off != offset {
+				zone, offset = name, off
+				change.Zone = name
+			}
+			if change != (clockChange{}) {
+				config.clockChanges <- change
+			}
+		}
+	}()
+}
+
+// inZone gives the busy periods in a time zone (after the local zone has
+// changed).
+func (cal *CalendarAvailability) inZone(loc *time.Location) {
+	for i := range cal.UpcomingPeriods {
+		cal.UpcomingPeriods[i].Start = cal.UpcomingPeriods[i].Start.In(loc)
+		cal.UpcomingPeriods[i].End = cal.UpcomingPeriods[i].End.In(loc)
+	}
+}
+
+// rearmTimer sets a timer to go off at a given time by the wall clock (at
+// once, if that's already passed), forgetting any time it went off which
+// hasn't been handled yet. For a zero time, it just stops the timer.
+func rearmTimer(timer *time.Timer, at time.Time) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	if !at.IsZero() {
+		timer.Reset(time.Until(at.Round(0)))
+	}
+}
@@ -0,0 +1,48 @@
+//
+// Snoozing the light.
+//
+// "snooze 30m" (or "snooze until 15:30") puts the light on the SnoozeSignal
+// ("off", unless configured otherwise) for a while, whatever the state, and
+// then goes back to showing the state by itself, so there's nothing to
+// remember to turn back on. "snooze" by itself says how long is left, and
+// "snooze off" ends it early.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// snoozeSignal is the light signal shown while snoozing.
+func snoozeSignal(config *ConfigData) string {
+	if config.SnoozeSignal == "" {
+		return "off"
+	}
+	return config.SnoozeSignal
+}
+
+// snoozeCommand carries out "snooze [<time>|until <HH:MM>|off]", updating
+// until (zero when not snoozing) and returning our reply.
+func snoozeCommand(config *ConfigData, until *time.Time, args []string) string {
+	switch {
+	case len(args) == 0:
+		if until.IsZero() {
+			return "Not snoozing"
+		}
+		return fmt.Sprintf("Snoozing until %s (%s left)", until.In(localZone(config)).Format("15:04"), time.Until(*until).Round(time.Second))
+	case len(args) == 1 && args[0] == "off":
+		*until = time.Time{}
+		return "Snooze is off"
+	}
+	end, err := parseOverrideEnd(config, args)
+	if err != nil {
+		return fmt.Sprintf("%v (usage: snooze [<time>|until <HH:MM>|off])", err)
+	}
+	*until = end
+	return fmt.Sprintf("Snoozing until %s", end.In(localZone(config)).Format("15:04"))
+}
@@ -0,0 +1,91 @@
+//
+// Unix domain socket control channel.
+//
+// Local programs may connect to this socket and send control commands (see
+// control.go), one per line. Each command is answered with a single line of
+// JSON, giving the command, the daemon's reply, and our status after
+// carrying it out:
+//
+//    {"Command":"urgent on","Reply":"Urgent indicator is now true","Status":{...}}
+//
+// The socket is only accessible to the user running the daemon.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// socketReply is our answer to a command received on the control socket.
+type socketReply struct {
+	Command string
+	Reply   string
+	Status  DaemonStatus
+}
+
+// serveControlConnection answers commands from one client until it hangs up.
+func serveControlConnection(config *ConfigData, conn net.Conn) {
+	defer conn.Close()
+	lines := bufio.NewScanner(conn)
+	out := json.NewEncoder(conn)
+	for lines.Scan() {
+		command := strings.TrimSpace(lines.Text())
+		if command == "" {
+			continue
+		}
+		reply := sendCommand(config, "control socket", command, 10*time.Second)
+		if err := out.Encode(socketReply{Command: command, Reply: reply, Status: config.events.Current()}); err != nil {
+			return
+		}
+	}
+}
+
+// startControlSocket starts listening for commands on our Unix socket, if configured to do so.
+// The socket's location is captured at startup; changing it requires a restart of the daemon.
+func startControlSocket(config *ConfigData) error {
+	if config.SocketFile == "" {
+		return nil
+	}
+
+	// If the daemon wasn't shut down cleanly, the old socket may still be there.
+	if conn, err := net.Dial("unix", config.SocketFile); err == nil {
+		conn.Close()
+		return fmt.Errorf("Unable to listen on %s: another daemon is already using it", config.SocketFile)
+	}
+	os.Remove(config.SocketFile)
+
+	listener, err := net.Listen("unix", config.SocketFile)
+	if err != nil {
+		return fmt.Errorf("Unable to listen on %s: %v", config.SocketFile, err)
+	}
+	if err = os.Chmod(config.SocketFile, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("Unable to secure %s: %v", config.SocketFile, err)
+	}
+	config.controlSocket = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					time.Sleep(time.Second)
+					continue
+				}
+				return // (we're shutting down)
+			}
+			go serveControlConnection(config, conn)
+		}
+	}()
+	config.logger.Printf("Listening for commands on %s", config.SocketFile)
+	return nil
+}
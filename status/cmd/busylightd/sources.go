@@ -0,0 +1,56 @@
+//
+// Automatic status sources.
+//
+// Several integrations (PagerDuty, alerting systems, and so on) turn
+// indicators on and off by themselves, independently of anything the user
+// sets by hand. Each one reports its current opinion to the main event loop
+// under its own name, and an indicator is on if any source (or the user)
+// says it should be. That way one source clearing its alarm doesn't turn off
+// another's, or the user's.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+// sourceStatus is what one automatic source thinks our indicators should be.
+type sourceStatus struct {
+	Urgent      bool // show the urgent state
+	LowPriority bool // add the low-priority indicator
+	OnCall      bool // turn on the on-call indicator
+	Focus       bool // show the dnd state (unless something more important is going on)
+	InCall      bool // we're in a call (unless told otherwise by the user)
+	MicOpen     bool // if in a call, the microphone is open
+	Away        bool // we've stepped away from the computer
+	Busy        bool // show the busy state (as if the calendar said so)
+}
+
+// sourceUpdate is a message to the main event loop from an automatic source.
+type sourceUpdate struct {
+	Source string
+	Status sourceStatus
+}
+
+// reportSource tells the main event loop what the named source now thinks.
+func reportSource(config *ConfigData, source string, status sourceStatus) {
+	config.sourceUpdates <- sourceUpdate{Source: source, Status: status}
+}
+
+// sourceStatuses holds the latest opinion of each automatic source.
+type sourceStatuses map[string]sourceStatus
+
+// combined reports which indicators any of the sources want turned on.
+func (s sourceStatuses) combined() (c sourceStatus) {
+	for _, status := range s {
+		c.Urgent = c.Urgent || status.Urgent
+		c.LowPriority = c.LowPriority || status.LowPriority
+		c.OnCall = c.OnCall || status.OnCall
+		c.Focus = c.Focus || status.Focus
+		c.InCall = c.InCall || status.InCall
+		c.MicOpen = c.MicOpen || status.MicOpen
+		c.Away = c.Away || status.Away
+		c.Busy = c.Busy || status.Busy
+	}
+	return c
+}
@@ -0,0 +1,151 @@
+//
+// User-defined states.
+//
+// Besides our own states (free, busy, and so on), the user may define any
+// others they like in the States setting, e.g. "lunch" or "on-air", each
+// shown with one of the light signals. These are turned on and off with the
+// "state" control command ("state lunch 1h", "state on-air", "state
+// on-air off"), or just by name if that isn't one of the other commands
+// ("lunch 1h"). Each may be given a length of time after which it ends by
+// itself, unless another is asked for.
+//
+// Several may be on at once; like everything else which calls for a state,
+// each makes its claim under its own name (see priority.go), and unless
+// placed elsewhere in StatePriority, they rank just above "override".
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CustomStateConfigData describes one of the user's own states.
+type CustomStateConfigData struct {
+	Signal      string // the light signal to show it with (e.g., "blue")
+	Description string // how it's described to people (default: its name)
+	Minutes     int    // if nonzero, it ends by itself after this long, unless told otherwise
+}
+
+// activeStates are the user-defined states which are on, with when each
+// ends (zero if it doesn't end by itself).
+type activeStates map[string]time.Time
+
+// customStateNames lists the user-defined states, in a predictable order.
+func customStateNames(config *ConfigData) []string {
+	var names []string
+	for name := range config.States {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describeState returns the human-friendly description of a state.
+func describeState(config *ConfigData, state string) string {
+	if custom, isCustom := config.States[state]; isCustom {
+		if custom.Description != "" {
+			return custom.Description
+		}
+		return state
+	}
+	return stateDescriptions[state]
+}
+
+// knownState reports whether a state is one which may be asked for: one of
+// our own (other than "off"), or one of the user's.
+func knownState(config *ConfigData, state string) bool {
+	if _, isCustom := config.States[state]; isCustom {
+		return true
+	}
+	return stateColors[state] != "" && state != "off"
+}
+
+// stateSignal returns the light signal which shows a state.
+func stateSignal(config *ConfigData, state string) string {
+	if custom, isCustom := config.States[state]; isCustom {
+		return custom.Signal
+	}
+	return stateColors[state]
+}
+
+// command carries out "state <name> [<time>|until <HH:MM>|off]", returning our reply.
+func (a activeStates) command(config *ConfigData, args []string) string {
+	if len(args) == 0 {
+		return fmt.Sprintf("usage: state <name> [<time>|until <HH:MM>|off] (states: %s)", strings.Join(customStateNames(config), ", "))
+	}
+	name := args[0]
+	custom, isCustom := config.States[name]
+	if !isCustom {
+		return fmt.Sprintf("There's no state called \"%s\" (states: %s)", name, strings.Join(customStateNames(config), ", "))
+	}
+	args = args[1:]
+	if len(args) == 1 && args[0] == "off" {
+		delete(a, name)
+		return fmt.Sprintf("%s is off", describeState(config, name))
+	}
+
+	var until time.Time
+	if len(args) > 0 {
+		var err error
+		if until, err = parseOverrideEnd(config, args); err != nil {
+			return fmt.Sprintf("%v (usage: state %s [<time>|until <HH:MM>|off])", err, name)
+		}
+	} else if custom.Minutes > 0 {
+		until = time.Now().Add(time.Duration(custom.Minutes) * time.Minute)
+	}
+	a[name] = until
+	if until.IsZero() {
+		return fmt.Sprintf("%s is on", describeState(config, name))
+	}
+	return fmt.Sprintf("%s until %s", describeState(config, name), until.In(localZone(config)).Format("15:04"))
+}
+
+// expire turns off the states whose time is up, returning their names.
+func (a activeStates) expire(now time.Time) []string {
+	var expired []string
+	for name, until := range a {
+		if !until.IsZero() && !until.After(now) {
+			expired = append(expired, name)
+			delete(a, name)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// nextExpiry returns when the next of the states is due to end, if any are.
+func (a activeStates) nextExpiry() (next time.Time, found bool) {
+	for _, until := range a {
+		if !until.IsZero() && (!found || until.Before(next)) {
+			next, found = until, true
+		}
+	}
+	return next, found
+}
+
+// checkCustomStates makes sure the States setting makes sense.
+func checkCustomStates(config *ConfigData) error {
+	for _, name := range customStateNames(config) {
+		custom := config.States[name]
+		switch {
+		case name == "" || name != strings.ToLower(name) || strings.ContainsAny(name, " \t"):
+			return fmt.Errorf("State name \"%s\" must be a single lower-case word", name)
+		case stateDescriptions[name] != "":
+			return fmt.Errorf("State \"%s\" is already one of our own states", name)
+		case containsFold(defaultStatePriority, name):
+			return fmt.Errorf("State \"%s\" can't have the same name as one of the reasons in StatePriority", name)
+		case custom.Signal == "":
+			return fmt.Errorf("State \"%s\" needs a Signal to show it with", name)
+		case custom.Minutes < 0:
+			return fmt.Errorf("State \"%s\" can't last a negative number of minutes", name)
+		}
+	}
+	return nil
+}
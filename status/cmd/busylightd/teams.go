@@ -0,0 +1,173 @@
+//
+// Microsoft Teams presence write-back.
+//
+// In organizations where colleagues check Teams before walking over, we set
+// our Teams presence to match the light whenever our state changes, using
+// the Microsoft Graph setPresence call. This needs an Azure AD application
+// registration with the Presence.ReadWrite.All application permission;
+// we authenticate as that application using its client secret.
+//
+// A presence set this way only lasts for a limited time, so we keep
+// re-asserting it while we remain in the same state. When we enter a
+// state with no presence defined (such as being free), our session's
+// presence is cleared so Teams goes back to working it out for itself.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// TeamsPresence is the Teams presence to set for a particular state.
+// Graph only accepts certain combinations: Available/Available, Busy/InACall,
+// Busy/InAConferenceCall, Away/Away, and DoNotDisturb/Presenting.
+type TeamsPresence struct {
+	Availability string
+	Activity     string
+}
+
+// TeamsConfigData describes how we talk to Microsoft Teams.
+type TeamsConfigData struct {
+	TenantID     string // Azure AD tenant (directory) ID
+	ClientID     string // application (client) ID of our app registration
+	ClientSecret string // client secret of our app registration
+	UserID       string // object ID (or user principal name) of the user whose presence we set
+
+	// The presence to set for each of our states. If a state isn't listed, our
+	// presence is cleared when we enter it. If this is omitted entirely,
+	// defaultTeamsPresences is used.
+	Presences map[string]TeamsPresence
+}
+
+var defaultTeamsPresences = map[string]TeamsPresence{
+	"busy":       {Availability: "Busy", Activity: "InACall"},
+	"zoom-muted": {Availability: "Busy", Activity: "InAConferenceCall"},
+	"zoom-open":  {Availability: "Busy", Activity: "InAConferenceCall"},
+	"urgent":     {Availability: "DoNotDisturb", Activity: "Presenting"},
+	"dnd":        {Availability: "DoNotDisturb", Activity: "Presenting"},
+	"away":       {Availability: "Away", Activity: "Away"},
+}
+
+// how long each presence we set lasts, and how often we renew it
+const (
+	teamsPresenceDuration = "PT1H"
+	teamsPresenceRenewal  = 45 * time.Minute
+)
+
+// graphPost sends a JSON request to a Microsoft Graph API endpoint.
+func graphPost(client *http.Client, endpoint string, params interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return graphError(resp)
+}
+
+// graphError describes what went wrong with a Microsoft Graph request, if anything did.
+func graphError(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var reply struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&reply) == nil && reply.Error.Message != "" {
+			return fmt.Errorf("Graph returned %s: %s: %s", resp.Status, reply.Error.Code, reply.Error.Message)
+		}
+		return fmt.Errorf("Graph returned %s", resp.Status)
+	}
+	return nil
+}
+
+// startTeamsPresence arranges for our Teams presence to follow our state.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startTeamsPresence(config *ConfigData) error {
+	teams := config.Teams
+	if teams.ClientID == "" {
+		return nil
+	}
+	if teams.TenantID == "" || teams.ClientSecret == "" || teams.UserID == "" {
+		return fmt.Errorf("Unable to set Teams presence: TenantID, ClientSecret, and UserID must all be given")
+	}
+	presences := teams.Presences
+	if presences == nil {
+		presences = defaultTeamsPresences
+	}
+
+	credentials := clientcredentials.Config{
+		ClientID:     teams.ClientID,
+		ClientSecret: teams.ClientSecret,
+		TokenURL:     "https://login.microsoftonline.com/" + url.PathEscape(teams.TenantID) + "/oauth2/v2.0/token",
+		Scopes:       []string{"https://graph.microsoft.com/.default"},
+	}
+	client := credentials.Client(context.Background())
+	client.Timeout = 30 * time.Second
+	endpoint := "https://graph.microsoft.com/v1.0/users/" + url.PathEscape(teams.UserID) + "/presence/"
+
+	events := config.events.Subscribe()
+	go func() {
+		renewal := time.NewTicker(teamsPresenceRenewal)
+		defer renewal.Stop()
+		var current TeamsPresence
+		isSet := false
+
+		setPresence := func() {
+			if !isSet {
+				return
+			}
+			if err := graphPost(client, endpoint+"setPresence", map[string]string{
+				"sessionId":          teams.ClientID,
+				"availability":       current.Availability,
+				"activity":           current.Activity,
+				"expirationDuration": teamsPresenceDuration,
+			}); err != nil {
+				config.logger.Printf("ERROR: Unable to set Teams presence: %v", err)
+			}
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Status.State == event.Previous {
+					continue
+				}
+				wasSet := isSet
+				current, isSet = presences[event.Status.State]
+				if isSet {
+					setPresence()
+				} else if wasSet {
+					if err := graphPost(client, endpoint+"clearPresence", map[string]string{
+						"sessionId": teams.ClientID,
+					}); err != nil {
+						config.logger.Printf("ERROR: Unable to clear Teams presence: %v", err)
+					}
+				}
+
+			case <-renewal.C:
+				setPresence()
+			}
+		}
+	}()
+	return nil
+}
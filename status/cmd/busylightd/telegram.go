@@ -0,0 +1,179 @@
+//
+// Telegram bot remote control.
+//
+// A Telegram bot lets us check or change the light from a phone. Any of the
+// control commands (see control.go) may be sent to the bot as a message,
+// with or without a leading slash (e.g., "status" or "/dnd 30m"), and every
+// reply comes with buttons for the most common ones.
+//
+// Since anyone can find and message a Telegram bot, we only listen to the
+// chats on our allowlist. Messages from anywhere else are logged (so you
+// can find your own chat's ID to put on the list) and otherwise ignored.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TelegramConfigData describes our Telegram bot.
+type TelegramConfigData struct {
+	Token        string  // the bot's token from @BotFather
+	AllowedChats []int64 // IDs of the chats the bot will take commands from
+}
+
+// telegramButtons are offered with every reply, as rows of (label, command).
+var telegramButtons = [][][2]string{
+	{{"Status", "status"}, {"Calendar", "cal"}, {"Off", "off"}},
+	{{"DND 30m", "dnd 30m"}, {"DND 1h", "dnd 1h"}, {"DND off", "dnd off"}},
+	{{"Urgent", "urgent"}, {"Low priority", "lowpri"}},
+}
+
+type telegramBot struct {
+	settings TelegramConfigData
+	client   *http.Client
+}
+
+// call invokes a Telegram Bot API method.
+func (bot *telegramBot) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	resp, err := bot.client.Post("https://api.telegram.org/bot"+bot.settings.Token+"/"+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// (the error includes the URL, which includes our token)
+		return fmt.Errorf("%s: request failed", method)
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s: %s", method, reply.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(reply.Result, result)
+	}
+	return nil
+}
+
+// isAllowed reports whether we take commands from the given chat.
+func (bot *telegramBot) isAllowed(chatID int64) bool {
+	for _, id := range bot.settings.AllowedChats {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// reply sends a message to a chat, along with our command buttons.
+func (bot *telegramBot) reply(chatID int64, text string) error {
+	var keyboard [][]map[string]string
+	for _, row := range telegramButtons {
+		var buttons []map[string]string
+		for _, b := range row {
+			buttons = append(buttons, map[string]string{"text": b[0], "callback_data": b[1]})
+		}
+		keyboard = append(keyboard, buttons)
+	}
+	return bot.call("sendMessage", map[string]interface{}{
+		"chat_id":      chatID,
+		"text":         text,
+		"reply_markup": map[string]interface{}{"inline_keyboard": keyboard},
+	}, nil)
+}
+
+// listen long-polls Telegram for messages and button presses, and carries out the commands they contain.
+func (bot *telegramBot) listen(config *ConfigData) {
+	offset := int64(0)
+	for {
+		var updates []struct {
+			UpdateID int64 `json:"update_id"`
+			Message  *struct {
+				Chat struct {
+					ID int64 `json:"id"`
+				} `json:"chat"`
+				Text string `json:"text"`
+			} `json:"message"`
+			CallbackQuery *struct {
+				ID      string `json:"id"`
+				Data    string `json:"data"`
+				Message struct {
+					Chat struct {
+						ID int64 `json:"id"`
+					} `json:"chat"`
+				} `json:"message"`
+			} `json:"callback_query"`
+		}
+		params := map[string]interface{}{"offset": offset, "timeout": 30, "allowed_updates": []string{"message", "callback_query"}}
+		if err := bot.call("getUpdates", params, &updates); err != nil {
+			config.logger.Printf("ERROR: Telegram getUpdates failed: %v (retrying in 1 minute)", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			var chatID int64
+			var text string
+			switch {
+			case u.Message != nil:
+				chatID, text = u.Message.Chat.ID, u.Message.Text
+			case u.CallbackQuery != nil:
+				chatID, text = u.CallbackQuery.Message.Chat.ID, u.CallbackQuery.Data
+				bot.call("answerCallbackQuery", map[string]string{"callback_query_id": u.CallbackQuery.ID}, nil)
+			default:
+				continue
+			}
+			if !bot.isAllowed(chatID) {
+				config.logger.Printf("WARNING: Ignoring Telegram message from chat %d, which isn't in AllowedChats", chatID)
+				continue
+			}
+
+			// Accept "/dnd 30m" (or "/dnd@ourbot 30m") as well as "dnd 30m".
+			words := strings.Fields(strings.TrimPrefix(text, "/"))
+			if len(words) > 0 {
+				if i := strings.IndexByte(words[0], '@'); i > 0 {
+					words[0] = words[0][:i]
+				}
+				if words[0] == "start" {
+					words[0] = "help"
+				}
+			}
+			text = strings.Join(words, " ")
+			reply := sendCommand(config, fmt.Sprintf("telegram chat %d", chatID), text, 5*time.Second)
+			if err := bot.reply(chatID, reply); err != nil {
+				config.logger.Printf("ERROR: Unable to answer Telegram chat %d: %v", chatID, err)
+			}
+		}
+	}
+}
+
+// startTelegramBot starts the Telegram bot, if configured.
+// Its settings are captured at startup; changing them requires a restart of the daemon.
+func startTelegramBot(config *ConfigData) {
+	if config.Telegram.Token == "" {
+		return
+	}
+	if len(config.Telegram.AllowedChats) == 0 {
+		config.logger.Printf("WARNING: Telegram bot has no AllowedChats, so it will ignore every message")
+	}
+	bot := &telegramBot{settings: config.Telegram, client: &http.Client{Timeout: 60 * time.Second}}
+	go bot.listen(config)
+}
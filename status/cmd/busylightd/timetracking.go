@@ -0,0 +1,312 @@
+//
+// Time-tracking integration (Toggl Track or Clockify).
+//
+// When we enter a busy, call, or do-not-disturb state, we start a time
+// entry describing it, and stop it again when we're free. We never
+// interrupt a timer somebody else started, though: if one is already
+// running, we leave it alone.
+//
+// Optionally, an externally-started timer works the other way around: while
+// one is running, we show that we're focused (the dnd state), since that
+// person is presumably getting on with something.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TimeTrackingConfigData describes the time-tracking service we use.
+type TimeTrackingConfigData struct {
+	Service     string // "toggl" or "clockify"
+	Token       string // API token (Toggl) or API key (Clockify)
+	WorkspaceID string // workspace to record time entries in
+	ProjectID   string // project to record time entries against, if any
+
+	// We track time while in these states. If empty, defaultTrackedStates is used.
+	States []string
+
+	// The description to give each state's time entries, if not as in defaultTimeEntryDescriptions.
+	Descriptions map[string]string
+
+	// Show a timer someone else started as the dnd state?
+	ReflectExternal bool
+}
+
+var defaultTrackedStates = []string{"busy", "zoom-muted", "zoom-open", "dnd"}
+
+var defaultTimeEntryDescriptions = map[string]string{
+	"busy":       "Busy",
+	"zoom-muted": "Meeting",
+	"zoom-open":  "Meeting",
+	"dnd":        "Focus time",
+}
+
+// timeTracker is a time-tracking service we know how to talk to.
+type timeTracker interface {
+	start(description string) (id string, err error)
+	stop(id string) error
+	current() (id string, err error) // the running timer's ID, or "" if none is running
+}
+
+// newTimeTrackingRequest prepares a request to a time-tracking service, with an optional JSON body.
+func newTimeTrackingRequest(method, url string, body interface{}) (*http.Request, error) {
+	if body == nil {
+		return http.NewRequest(method, url, nil)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, err
+}
+
+// timeTrackingRequest sends a request to a time-tracking service and decodes the JSON reply into result.
+func timeTrackingRequest(client *http.Client, req *http.Request, result interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+//
+// Toggl Track (API v9)
+//
+
+type togglTracker struct {
+	settings TimeTrackingConfigData
+	client   *http.Client
+}
+
+func (t *togglTracker) request(method, path string, body interface{}, result interface{}) error {
+	req, err := newTimeTrackingRequest(method, "https://api.track.toggl.com/api/v9"+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.settings.Token, "api_token")
+	return timeTrackingRequest(t.client, req, result)
+}
+
+func (t *togglTracker) start(description string) (string, error) {
+	var workspace int64
+	fmt.Sscan(t.settings.WorkspaceID, &workspace)
+	entry := map[string]interface{}{
+		"description":  description,
+		"workspace_id": workspace,
+		"start":        time.Now().UTC().Format(time.RFC3339),
+		"duration":     -1,
+		"created_with": "busylight",
+	}
+	if t.settings.ProjectID != "" {
+		var project int64
+		fmt.Sscan(t.settings.ProjectID, &project)
+		entry["project_id"] = project
+	}
+	var result struct {
+		ID int64 `json:"id"`
+	}
+	err := t.request(http.MethodPost, "/workspaces/"+t.settings.WorkspaceID+"/time_entries", entry, &result)
+	return fmt.Sprint(result.ID), err
+}
+
+func (t *togglTracker) stop(id string) error {
+	return t.request(http.MethodPatch, "/workspaces/"+t.settings.WorkspaceID+"/time_entries/"+id+"/stop", nil, nil)
+}
+
+func (t *togglTracker) current() (string, error) {
+	var result *struct {
+		ID int64 `json:"id"`
+	}
+	if err := t.request(http.MethodGet, "/me/time_entries/current", nil, &result); err != nil || result == nil {
+		return "", err
+	}
+	return fmt.Sprint(result.ID), nil
+}
+
+//
+// Clockify (API v1)
+//
+
+type clockifyTracker struct {
+	settings TimeTrackingConfigData
+	client   *http.Client
+	userID   string
+}
+
+func (t *clockifyTracker) request(method, path string, body interface{}, result interface{}) error {
+	req, err := newTimeTrackingRequest(method, "https://api.clockify.me/api/v1"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", t.settings.Token)
+	return timeTrackingRequest(t.client, req, result)
+}
+
+// user finds out (once) which Clockify user our API key belongs to.
+func (t *clockifyTracker) user() (string, error) {
+	if t.userID == "" {
+		var result struct {
+			ID string `json:"id"`
+		}
+		if err := t.request(http.MethodGet, "/user", nil, &result); err != nil {
+			return "", err
+		}
+		t.userID = result.ID
+	}
+	return t.userID, nil
+}
+
+func (t *clockifyTracker) start(description string) (string, error) {
+	entry := map[string]interface{}{
+		"description": description,
+		"start":       time.Now().UTC().Format(time.RFC3339),
+	}
+	if t.settings.ProjectID != "" {
+		entry["projectId"] = t.settings.ProjectID
+	}
+	var result struct {
+		ID string `json:"id"`
+	}
+	err := t.request(http.MethodPost, "/workspaces/"+t.settings.WorkspaceID+"/time-entries", entry, &result)
+	return result.ID, err
+}
+
+func (t *clockifyTracker) stop(id string) error {
+	user, err := t.user()
+	if err != nil {
+		return err
+	}
+	return t.request(http.MethodPatch, "/workspaces/"+t.settings.WorkspaceID+"/user/"+user+"/time-entries",
+		map[string]string{"end": time.Now().UTC().Format(time.RFC3339)}, nil)
+}
+
+func (t *clockifyTracker) current() (string, error) {
+	user, err := t.user()
+	if err != nil {
+		return "", err
+	}
+	var result []struct {
+		ID string `json:"id"`
+	}
+	if err = t.request(http.MethodGet, "/workspaces/"+t.settings.WorkspaceID+"/user/"+user+"/time-entries?in-progress=true", nil, &result); err != nil || len(result) == 0 {
+		return "", err
+	}
+	return result[0].ID, nil
+}
+
+// startTimeTracking arranges for time entries to follow our state, if configured.
+// These settings are captured at startup; changing them requires a restart of the daemon.
+func startTimeTracking(config *ConfigData) error {
+	settings := config.TimeTracking
+	if settings.Service == "" {
+		return nil
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	var tracker timeTracker
+	switch strings.ToLower(settings.Service) {
+	case "toggl":
+		tracker = &togglTracker{settings: settings, client: client}
+	case "clockify":
+		tracker = &clockifyTracker{settings: settings, client: client}
+	default:
+		return fmt.Errorf("Unable to track time: unknown service %q", settings.Service)
+	}
+	states := settings.States
+	if len(states) == 0 {
+		states = defaultTrackedStates
+	}
+	describe := func(state string) string {
+		if d, isSet := settings.Descriptions[state]; isSet {
+			return d
+		}
+		if d, isSet := defaultTimeEntryDescriptions[state]; isSet {
+			return d
+		}
+		return describeState(currentSettings(config), state)
+	}
+
+	var poll <-chan time.Time
+	if settings.ReflectExternal {
+		poll = time.NewTicker(time.Minute).C
+	}
+	events := config.events.Subscribe()
+	go func() {
+		ours := ""        // ID of the timer we started, if it's running
+		description := "" // ...and what it's for
+		external := false // is someone else's timer running?
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Status.State == event.Previous {
+					continue
+				}
+				wanted := ""
+				if containsFold(states, event.Status.State) {
+					wanted = describe(event.Status.State)
+				}
+				if wanted == description {
+					continue
+				}
+				if ours != "" {
+					if err := tracker.stop(ours); err != nil {
+						config.logger.Printf("ERROR: Unable to stop time entry: %v", err)
+					}
+					ours, description = "", ""
+				}
+				if wanted == "" {
+					continue
+				}
+				if running, err := tracker.current(); err != nil {
+					config.logger.Printf("ERROR: Unable to check for a running time entry: %v", err)
+					continue
+				} else if running != "" {
+					// (not ours; leave it alone)
+					continue
+				}
+				id, err := tracker.start(wanted)
+				if err != nil {
+					config.logger.Printf("ERROR: Unable to start time entry: %v", err)
+					continue
+				}
+				ours, description = id, wanted
+
+			case <-poll:
+				running, err := tracker.current()
+				if err != nil {
+					config.logger.Printf("ERROR: Unable to check for a running time entry: %v", err)
+					continue
+				}
+				if isExternal := running != "" && running != ours; isExternal != external {
+					external = isExternal
+					reportSource(config, "time tracking", sourceStatus{Focus: external})
+				}
+			}
+		}
+	}()
+	return nil
+}
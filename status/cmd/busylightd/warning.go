@@ -0,0 +1,48 @@
+//
+// Warning of meetings about to start.
+//
+// If MeetingWarning.Minutes is set, then for that long before the calendar
+// says we'll be busy, we show the "warning" state (a slow yellow blink,
+// unless the "warning" light signal is redefined in LightSignals), so the
+// user can wrap up what they're doing. Like the other reasons for a state,
+// this claims its state as "warning" (see priority.go), which by default
+// ranks below all the others.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import "time"
+
+// MeetingWarningConfigData controls warning that a busy period is about to start.
+type MeetingWarningConfigData struct {
+	Minutes int // how long beforehand to start warning (0, the default, for no warning)
+}
+
+// NextBusyStart returns when the next busy period starts, if there's one
+// coming up and we're not in one already.
+func (cal *CalendarAvailability) NextBusyStart(config *ConfigData) (time.Time, bool) {
+	if cal.ScheduledBusyNow(config) || len(cal.UpcomingPeriods) == 0 {
+		return time.Time{}, false
+	}
+	return cal.UpcomingPeriods[0].Start, true
+}
+
+// meetingWarning reports whether we should be warning of a meeting now, or
+// if not, when we should start (zero if there's nothing to warn of).
+func meetingWarning(config *ConfigData, cal *CalendarAvailability) (bool, time.Time) {
+	if config.MeetingWarning.Minutes <= 0 {
+		return false, time.Time{}
+	}
+	start, upcoming := cal.NextBusyStart(config)
+	if !upcoming {
+		return false, time.Time{}
+	}
+	warnAt := start.Add(-time.Duration(config.MeetingWarning.Minutes) * time.Minute)
+	if !time.Now().Before(warnAt) {
+		return true, time.Time{}
+	}
+	return false, warnAt
+}
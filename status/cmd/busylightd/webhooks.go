@@ -0,0 +1,190 @@
+//
+// Outbound webhooks on state change.
+//
+// For each configured webhook, we send a JSON payload to its URL whenever
+// we enter one of the states it's interested in. The payload may be given
+// as a template (so it can be shaped to whatever IFTTT, Zapier, or a home
+// automation system expects), failed deliveries are retried a few times,
+// and each request may be signed with an HMAC so the receiver can verify
+// it really came from us.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// WebhookConfigData describes a URL to notify on state changes.
+type WebhookConfigData struct {
+	// The URL to send to.
+	URL string
+
+	// The HTTP method to use (e.g., "PUT"). Defaults to "POST".
+	Method string
+
+	// Any extra headers to send (e.g., an Authorization header the receiver wants).
+	Headers map[string]string
+
+	// The webhook is only called when entering one of these states.
+	// If empty, it is called on every state change.
+	States []string
+
+	// A Go text/template for the request body. The template is executed with the
+	// StateEvent as its data (so {{.Status.State}} is the new state, {{.Previous}} the
+	// old one, etc.). If empty, the StateEvent itself is sent as JSON.
+	Template string
+
+	// The Content-Type of the request body. Defaults to "application/json".
+	ContentType string
+
+	// If given, each request carries an X-Busylight-Signature header holding
+	// "sha256=" followed by the hex HMAC-SHA256 of the timestamp (from the
+	// X-Busylight-Timestamp header), a period, and the request body, using this secret.
+	Secret string
+
+	// How many times to retry a failed delivery. Defaults to 3.
+	Retries int
+}
+
+// webhook is a configured webhook ready to be called.
+type webhook struct {
+	WebhookConfigData
+	template *template.Template
+}
+
+// runsOn reports whether the webhook should be called when entering the given state.
+func (h webhook) runsOn(state string) bool {
+	return stateSelected(h.States, state)
+}
+
+// payload renders the request body for an event.
+func (h webhook) payload(event StateEvent) ([]byte, error) {
+	if h.template == nil {
+		return json.Marshal(event)
+	}
+	var body bytes.Buffer
+	if err := h.template.Execute(&body, event); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// webhookSignature computes the HMAC signature for a request body sent at the given time.
+func webhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver sends the payload to the webhook's URL, retrying with increasing delays if it fails.
+func (h webhook) deliver(config *ConfigData, client *http.Client, body []byte) {
+	contentType := h.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	retries := h.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+
+	delay := 5 * time.Second
+	for attempt := 0; ; attempt++ {
+		err := func() error {
+			req, err := http.NewRequest(method, h.URL, bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("User-Agent", "busylightd")
+			for name, value := range h.Headers {
+				req.Header.Set(name, value)
+			}
+			if h.Secret != "" {
+				timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+				req.Header.Set("X-Busylight-Timestamp", timestamp)
+				req.Header.Set("X-Busylight-Signature", webhookSignature(h.Secret, timestamp, body))
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return fmt.Errorf("server returned %s", resp.Status)
+			}
+			return nil
+		}()
+		if err == nil {
+			return
+		}
+		if attempt >= retries {
+			config.logger.Printf("ERROR: Webhook %s failed (giving up): %v", h.URL, err)
+			return
+		}
+		config.logger.Printf("WARNING: Webhook %s failed (retrying in %v): %v", h.URL, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// startWebhooks arranges for the configured webhooks to be called on each state change.
+// The webhooks are captured at startup; changing them requires a restart of the daemon.
+func startWebhooks(config *ConfigData) error {
+	if len(config.Webhooks) == 0 {
+		return nil
+	}
+
+	var hooks []webhook
+	for i, w := range config.Webhooks {
+		h := webhook{WebhookConfigData: w}
+		if w.Template != "" {
+			t, err := template.New(fmt.Sprintf("webhook%d", i)).Parse(w.Template)
+			if err != nil {
+				return fmt.Errorf("Unable to understand template for webhook %s: %v", w.URL, err)
+			}
+			h.template = t
+		}
+		hooks = append(hooks, h)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	events := config.events.Subscribe()
+	go func() {
+		for event := range events {
+			if event.Status.State == event.Previous {
+				continue
+			}
+			for _, h := range hooks {
+				if !h.runsOn(event.Status.State) {
+					continue
+				}
+				body, err := h.payload(event)
+				if err != nil {
+					config.logger.Printf("ERROR: Unable to build payload for webhook %s: %v", h.URL, err)
+					continue
+				}
+				go h.deliver(config, client, body)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,74 @@
+//
+// Tests for signing outbound webhooks.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	// (expected values from Python's hmac.new(secret, timestamp + b"." + body, hashlib.sha256))
+	tests := []struct {
+		secret, timestamp, body string
+		want                    string
+	}{
+		{"s3cret", "1700000000", `{"State":"busy"}`, "sha256=e5419d9757ff73e45b280e4ee4fd3ad0dea8a5e62f6f296887a51cbcee1f0493"},
+		{"s3cret", "1700000000", "", "sha256=21948100f1d7a89f3338f6b1106fc4f7a702fbe1493b833a3382f80193bde3fe"},
+		{"other", "1700000000", `{"State":"busy"}`, "sha256=a0571e699c2965a9bc630ff76a3ce81ff8470e303a9bdcc30a14e711e7f1161d"},
+		{"s3cret", "1700000001", `{"State":"busy"}`, "sha256=83465d83733765e41bdd072f6402696ad5f4f74572ced6df7a5a5835e16900cf"},
+	}
+
+	for _, test := range tests {
+		if got := webhookSignature(test.secret, test.timestamp, []byte(test.body)); got != test.want {
+			t.Errorf("secret %q, timestamp %s, body %q: got %s, want %s", test.secret, test.timestamp, test.body, got, test.want)
+		}
+	}
+}
+
+func TestWebhookSignedDelivery(t *testing.T) {
+	body := []byte(`{"State":"dnd"}`)
+	tests := []struct {
+		secret string
+		signed bool
+	}{
+		{"s3cret", true},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		var timestamp, signature string
+		var received []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timestamp, signature = r.Header.Get("X-Busylight-Timestamp"), r.Header.Get("X-Busylight-Signature")
+			received, _ = ioutil.ReadAll(r.Body)
+		}))
+		h := webhook{WebhookConfigData: WebhookConfigData{URL: server.URL, Secret: test.secret}}
+		h.deliver(&ConfigData{logger: log.New(ioutil.Discard, "", 0)}, server.Client(), body)
+		server.Close()
+
+		if string(received) != string(body) {
+			t.Errorf("secret %q: received %q, want %q", test.secret, received, body)
+		}
+		if !test.signed {
+			if timestamp != "" || signature != "" {
+				t.Errorf("secret %q: unexpectedly signed (%s, %s)", test.secret, timestamp, signature)
+			}
+			continue
+		}
+		if timestamp == "" {
+			t.Errorf("secret %q: no timestamp", test.secret)
+		}
+		if want := webhookSignature(test.secret, timestamp, body); signature != want {
+			t.Errorf("secret %q: got signature %s, want %s", test.secret, signature, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+//
+// Embeddable status widget.
+//
+// A tiny HTML page (suitable for an <iframe> on a personal home page or a
+// Notion page) plus a JSON document showing our current state and when we
+// expect to be free. The page keeps itself up to date using server-sent
+// events, falling back to reloading itself periodically if scripting is
+// unavailable.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// widgetStatus is the subset of our status we're willing to show to the world.
+type widgetStatus struct {
+	Name        string
+	State       string
+	Description string
+	Since       string // RFC 3339
+	FreeAt      string // "HH:MM" if we're busy and know when that will end
+}
+
+func newWidgetStatus(config *ConfigData, status DaemonStatus) widgetStatus {
+	w := widgetStatus{
+		Name:        currentSettings(config).Name,
+		State:       status.State,
+		Description: status.Description,
+		Since:       status.Since.Format(time.RFC3339),
+	}
+	if status.BusyNow && !status.NextTransition.IsZero() {
+		w.FreeAt = status.NextTransition.In(localZone(config)).Format("15:04")
+	}
+	return w
+}
+
+var widgetPage = template.Must(template.New("widget").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<noscript><meta http-equiv="refresh" content="60"></noscript>
+<title>{{if .Name}}{{.Name}}: {{end}}{{.Description}}</title>
+<style>
+body { margin: 0; font-family: sans-serif; font-size: 14px; }
+#widget { display: flex; align-items: center; padding: 6px 10px; }
+#lamp { width: 14px; height: 14px; border-radius: 50%; margin-right: 8px; background: #9e9e9e; }
+.free #lamp { background: #2e7d32; }
+.busy #lamp { background: #f9a825; }
+.zoom-muted #lamp, .zoom-open #lamp { background: #c62828; }
+.urgent #lamp { background: #6a1b9a; }
+#free { color: #757575; margin-left: 6px; }
+</style>
+</head>
+<body>
+<div id="widget" class="{{.State}}">
+<span id="lamp"></span>
+<span id="desc">{{if .Name}}{{.Name}}: {{end}}{{.Description}}</span>
+<span id="free">{{if .FreeAt}}free at {{.FreeAt}}{{end}}</span>
+</div>
+<script>
+(function () {
+	var src = new EventSource("widget/events");
+	src.onmessage = function (e) {
+		var s = JSON.parse(e.data);
+		document.getElementById("widget").className = s.State;
+		document.getElementById("desc").textContent = (s.Name ? s.Name + ": " : "") + s.Description;
+		document.getElementById("free").textContent = s.FreeAt ? "free at " + s.FreeAt : "";
+		document.title = document.getElementById("desc").textContent;
+	};
+})();
+</script>
+</body>
+</html>
+`))
+
+// widgetPageHandler serves the embeddable HTML page.
+func widgetPageHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := widgetPage.Execute(w, newWidgetStatus(config, config.events.Current())); err != nil {
+			config.logger.Printf("ERROR: Unable to render status widget: %v", err)
+		}
+	}
+}
+
+// widgetJSONHandler serves our status as a JSON document which any web page may fetch.
+func widgetJSONHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(newWidgetStatus(config, config.events.Current()))
+	}
+}
+
+// widgetEventsHandler streams our status to the widget page as server-sent events.
+func widgetEventsHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		events := config.events.Subscribe()
+		defer config.events.Unsubscribe(events)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		send := func(status DaemonStatus) bool {
+			data, err := json.Marshal(newWidgetStatus(config, status))
+			if err != nil {
+				return false
+			}
+			if _, err = fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return true
+		}
+
+		if !send(config.events.Current()) {
+			return
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-events:
+				if !send(event.Status) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+//
+// Working hours.
+//
+// If the WorkingHours setting is given, the daemon goes to sleep by itself
+// (turning off the light and calendar polling, as for the WINCH signal) when
+// the working day is over, and wakes up again when the next one starts. It
+// maps each day of the week to the hours worked that day, e.g.
+//
+//    {"mon": "09:00-17:30", "fri": "09:00-12:00, 13:00-16:00"}
+//
+// Days which aren't listed are days off. Hours may run past midnight (e.g.,
+// "22:00-02:00"), into the next day. The user may still wake the daemon
+// or put it to sleep by hand; we only step in when the working hours start
+// or end.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// workingHoursPeriod is one stretch of working time within a day.
+type workingHoursPeriod struct {
+	Start, End time.Duration // since midnight (End may be into the next day)
+}
+
+// parseWeekday understands the name of a day of the week ("mon" or "monday").
+func parseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("can't understand \"%s\" as a day of the week", name)
+}
+
+// parseClock understands a time of day written as "HH:MM", as the time since midnight.
+func parseClock(s string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("can't understand \"%s\" as a time of day (use HH:MM)", s)
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// parseWorkingHours understands a day's working hours, e.g. "09:00-12:00, 13:00-17:00".
+func parseWorkingHours(s string) ([]workingHoursPeriod, error) {
+	var periods []workingHoursPeriod
+	for _, span := range strings.Split(s, ",") {
+		times := strings.Split(span, "-")
+		if len(times) != 2 {
+			return nil, fmt.Errorf("can't understand \"%s\" as working hours (use HH:MM-HH:MM)", strings.TrimSpace(span))
+		}
+		start, err := parseClock(times[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(times[1])
+		if err != nil {
+			return nil, err
+		}
+		if end == start {
+			return nil, fmt.Errorf("working hours \"%s\" end when they start", strings.TrimSpace(span))
+		}
+		if end < start {
+			end += 24 * time.Hour // (they run past midnight)
+		}
+		periods = append(periods, workingHoursPeriod{Start: start, End: end})
+	}
+	return periods, nil
+}
+
+// workingHours reports whether the given time is within working hours, and
+// when that next changes (zero if it never does, as when no working hours
+// are configured).
+func workingHours(config *ConfigData, t time.Time) (bool, time.Time) {
+	if len(config.WorkingHours) == 0 {
+		return true, time.Time{}
+	}
+	return inSchedule(config.WorkingHours, t.In(localZone(config)))
+}
+
+// inSchedule reports whether the given time is within the hours of a weekly
+// schedule (like WorkingHours), and when that next changes (zero if it never does).
+func inSchedule(schedule map[string]string, t time.Time) (bool, time.Time) {
+	days := make(map[time.Weekday][]workingHoursPeriod)
+	for name, hours := range schedule {
+		// (anything which can't be understood was rejected by checkSchedule)
+		day, _ := parseWeekday(name)
+		days[day], _ = parseWorkingHours(hours)
+	}
+
+	working := false
+	var next time.Time
+	for d := -1; d <= 7; d++ {
+		// (a day is not always 24 hours long, so we find the times by the clock)
+		at := func(clock time.Duration) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day()+d, 0, int(clock/time.Minute), 0, 0, t.Location())
+		}
+		for _, period := range days[at(0).Weekday()] {
+			start, end := at(period.Start), at(period.End)
+			if !t.Before(start) && t.Before(end) {
+				working = true
+			}
+			for _, change := range []time.Time{start, end} {
+				if change.After(t) && (next.IsZero() || change.Before(next)) {
+					next = change
+				}
+			}
+		}
+	}
+	return working, next
+}
+
+// checkSchedule makes sure a weekly schedule (like WorkingHours) makes sense.
+func checkSchedule(setting string, schedule map[string]string) error {
+	for name, hours := range schedule {
+		if _, err := parseWeekday(name); err != nil {
+			return fmt.Errorf("%s: %v", setting, err)
+		}
+		if _, err := parseWorkingHours(hours); err != nil {
+			return fmt.Errorf("%s for %s: %v", setting, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+//
+// Zoom calls, as told by a Zoom app's webhooks.
+//
+// Instead of running a script on the computer which asks the Zoom client
+// whether it's in a meeting, a Zoom Marketplace app (a webhook-only app is
+// enough) can send its event notifications to our HTTP server at
+// /zoom/webhook, which must be reachable from Zoom over HTTPS. We check
+// each request's signature with the app's secret token, and answer Zoom's
+// endpoint validation requests, then turn the events into the same mute,
+// open and cal commands as the signals, so the two can be used side by
+// side:
+//
+//    meeting.started            - mute (a meeting we host has started)
+//    meeting.ended              - cal
+//    meeting.participant_joined - mute, if the participant is us
+//    meeting.participant_left   - cal, if the participant is us
+//
+// We can't tell whether we're muted on joining, so we assume we are. Any
+// other events the app is sent (such as ones for muting and unmuting) can
+// be mapped to commands with ZoomWebhook.Events.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ZoomWebhookConfigData describes the Zoom app whose webhooks tell us about calls.
+type ZoomWebhookConfigData struct {
+	// The app's secret token, used to check the requests are from Zoom.
+	// If empty, we don't accept Zoom webhooks.
+	SecretToken string
+
+	// Our Zoom account's email address. Events about participants only count
+	// if they're about us, so they're ignored unless this is set.
+	Email string
+
+	// The command ("mute", "open" or "cal") to run for each event, beyond
+	// (or instead of) those in defaultZoomEvents.
+	Events map[string]string
+}
+
+var defaultZoomEvents = map[string]string{
+	"meeting.started":            "mute",
+	"meeting.ended":              "cal",
+	"meeting.participant_joined": "mute",
+	"meeting.participant_left":   "cal",
+}
+
+// zoomCommand returns the command to run for an event, if any.
+func zoomCommand(settings *ConfigData, event string) string {
+	if command, isSet := settings.ZoomWebhook.Events[event]; isSet {
+		return command
+	}
+	return defaultZoomEvents[event]
+}
+
+// zoomSignature computes the signature Zoom puts on its requests (or, with
+// no timestamp, on the token of an endpoint validation request).
+func zoomSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	if timestamp == "" {
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// zoomEvent is the part of a Zoom webhook request we care about.
+type zoomEvent struct {
+	Event   string `json:"event"`
+	Payload struct {
+		PlainToken string `json:"plainToken"` // (for endpoint validation)
+		Object     struct {
+			Topic       string `json:"topic"`
+			Participant *struct {
+				UserName string `json:"user_name"`
+				Email    string `json:"email"`
+			} `json:"participant"`
+		} `json:"object"`
+	} `json:"payload"`
+}
+
+// zoomWebhookHandler takes event notifications from a Zoom app.
+func zoomWebhookHandler(config *ConfigData) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := currentSettings(config)
+		secret := settings.ZoomWebhook.SecretToken
+		if secret == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64*1024))
+		if err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		timestamp := r.Header.Get("X-Zm-Request-Timestamp")
+		secs, err := strconv.ParseInt(timestamp, 10, 64)
+		if age := time.Since(time.Unix(secs, 0)); err != nil || age > 5*time.Minute || age < -5*time.Minute {
+			http.Error(w, "stale request", http.StatusUnauthorized)
+			return
+		}
+		if !hmac.Equal([]byte(r.Header.Get("X-Zm-Signature")), []byte(zoomSignature(secret, timestamp, body))) {
+			config.logger.Printf("WARNING: Rejected Zoom webhook with bad signature from %s", r.RemoteAddr)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event zoomEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if event.Event == "endpoint.url_validation" {
+			writeJSON(w, map[string]string{
+				"plainToken":     event.Payload.PlainToken,
+				"encryptedToken": zoomSignature(secret, "", []byte(event.Payload.PlainToken)),
+			})
+			return
+		}
+
+		command := zoomCommand(settings, event.Event)
+		if participant := event.Payload.Object.Participant; participant != nil {
+			if settings.ZoomWebhook.Email == "" || !strings.EqualFold(participant.Email, settings.ZoomWebhook.Email) {
+				command = ""
+			}
+		}
+		if command != "" {
+			config.logger.Printf("Zoom says %s (%s)", event.Event, event.Payload.Object.Topic)
+			sendCommand(config, "Zoom webhook", command, 2500*time.Millisecond)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// checkZoomWebhook makes sure the ZoomWebhook setting makes sense.
+func checkZoomWebhook(config *ConfigData) error {
+	z := config.ZoomWebhook
+	if z.SecretToken == "" {
+		return nil
+	}
+	if config.HTTP.Listen == "" {
+		return fmt.Errorf("ZoomWebhook.SecretToken needs HTTP.Listen, so Zoom can reach us")
+	}
+	for event, command := range z.Events {
+		if command != "" && command != "mute" && command != "open" && command != "cal" {
+			return fmt.Errorf("ZoomWebhook.Events can't run \"%s\" for %s (only mute, open or cal)", command, event)
+		}
+	}
+	return nil
+}
@@ -18,15 +18,15 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"os/user"
-	"path/filepath"
 	"time"
 
+	"github.com/fizban-of-ragnarok/busylight/internal/configdir"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -39,9 +39,12 @@ type calendarConfigData struct {
 }
 
 type configData struct {
-	Calendars      map[string]calendarConfigData
-	TokenFile      string
-	CredentialFile string
+	Calendars         map[string]calendarConfigData
+	TokenFile         string
+	CredentialFile    string
+	CalendarWriteBack struct {
+		Enabled bool
+	}
 }
 
 func getConfigFromFile(filename string, data *configData) error {
@@ -105,14 +108,13 @@ func saveToken(path string, token *oauth2.Token) {
 
 func main() {
 	var config configData
-	var thisUser *user.User
-
-	thisUser, err := user.Current()
+	var Fconfig = flag.String("config", "", "read the configuration from this file")
+	flag.Parse()
+	configFile, err := configdir.ConfigFile(*Fconfig)
 	if err != nil {
-		log.Fatalf("Unable to determine current user: %v", err)
+		log.Fatalf("%v", err)
 	}
-
-	err = getConfigFromFile(filepath.Join(thisUser.HomeDir, ".busylight/config.json"), &config)
+	err = getConfigFromFile(configFile, &config)
 	if err != nil {
 		log.Fatalf("Unable to initialize: %v", err)
 	}
@@ -122,7 +124,13 @@ func main() {
 		log.Fatalf("Unable to read client secret file %v: %v", config.CredentialFile, err)
 	}
 
-	googleConfig, err := google.ConfigFromJSON(b, calendar.CalendarReadonlyScope)
+	// If busylightd is going to put events on the calendar, the token we get
+	// needs to allow that.
+	scope := calendar.CalendarReadonlyScope
+	if config.CalendarWriteBack.Enabled {
+		scope = calendar.CalendarEventsScope
+	}
+	googleConfig, err := google.ConfigFromJSON(b, scope)
 	if err != nil {
 		log.Fatalf("Unable to parse client secret file to config: %v", err)
 	}
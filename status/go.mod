@@ -3,8 +3,15 @@ module github.com/fizban-of-ragnarok/busylight
 go 1.16
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/emersion/go-imap v1.2.1
+	github.com/golang/protobuf v1.4.3
+	github.com/karalabe/hid v1.0.0
+	github.com/teambition/rrule-go v1.8.2
 	go.bug.st/serial v1.1.3
 	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 	golang.org/x/oauth2 v0.0.0-20210220000619-9bb904979d93
 	google.golang.org/api v0.41.0
+	google.golang.org/grpc v1.36.0
+	google.golang.org/protobuf v1.25.0
 )
@@ -0,0 +1,71 @@
+//
+// Where our configuration files live.
+//
+// On Unix-like systems, that's ~/.busylight, as it always has been, unless
+// the user has put them in $XDG_CONFIG_HOME/busylight (~/.config/busylight
+// if XDG_CONFIG_HOME isn't set) instead. Windows has no tradition of
+// dot-directories in the user's home directory, so there we use
+// %APPDATA%\busylight.
+//
+// Any of the commands may be pointed at a different configuration file
+// altogether with its -config option or the BUSYLIGHT_CONFIG environment
+// variable (e.g., to run two daemons for two lights); see ConfigFile.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package configdir
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+)
+
+// Dir returns the directory holding our configuration files.
+func Dir() (string, error) {
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("Unable to find application data directory: %v", err)
+		}
+		return filepath.Join(dir, "busylight"), nil
+	}
+	thisUser, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("Unable to determine current user: %v", err)
+	}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(thisUser.HomeDir, ".config")
+	}
+	if info, err := os.Stat(filepath.Join(xdg, "busylight")); err == nil && info.IsDir() {
+		return filepath.Join(xdg, "busylight"), nil
+	}
+	return filepath.Join(thisUser.HomeDir, ".busylight"), nil
+}
+
+// Path returns the full path of one of our configuration files.
+func Path(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// ConfigFile returns the configuration file to use: the one given on the
+// command line (if it isn't empty), or in the BUSYLIGHT_CONFIG environment
+// variable, or else config.json in our usual directory.
+func ConfigFile(given string) (string, error) {
+	if given != "" {
+		return given, nil
+	}
+	if file := os.Getenv("BUSYLIGHT_CONFIG"); file != "" {
+		return file, nil
+	}
+	return Path("config.json")
+}
@@ -0,0 +1,299 @@
+//
+// Connecting to the D-Bus session bus.
+//
+// We find the session bus where DBUS_SESSION_BUS_ADDRESS says (or at
+// $XDG_RUNTIME_DIR/bus, where systemd puts it), identify ourselves as the
+// user we're running as, and then exchange messages with the bus: method
+// calls from other programs come in to the handler given to Serve, and we
+// may emit signals at any time.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package dbus
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Conn is a connection to a message bus.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	lock   sync.Mutex // (held while sending a message)
+	serial uint32
+	name   string // our unique name on the bus (e.g., ":1.42")
+}
+
+// sessionBusAddresses returns the places the session bus may be, in the
+// order to try them, as network and address for net.Dial.
+func sessionBusAddresses() ([][2]string, error) {
+	address := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if address == "" {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("Unable to find the session bus (DBUS_SESSION_BUS_ADDRESS isn't set)")
+		}
+		address = "unix:path=" + dir + "/bus"
+	}
+
+	var found [][2]string
+	for _, alternative := range strings.Split(address, ";") {
+		colon := strings.Index(alternative, ":")
+		if colon < 0 || alternative[:colon] != "unix" {
+			continue // (we only speak to the bus over Unix sockets)
+		}
+		for _, kv := range strings.Split(alternative[colon+1:], ",") {
+			eq := strings.Index(kv, "=")
+			if eq < 0 {
+				continue
+			}
+			value, err := unescapeAddress(kv[eq+1:])
+			if err != nil {
+				return nil, err
+			}
+			switch kv[:eq] {
+			case "path":
+				found = append(found, [2]string{"unix", value})
+			case "abstract":
+				found = append(found, [2]string{"unix", "@" + value})
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("Unable to find a Unix socket for the session bus in \"%s\"", address)
+	}
+	return found, nil
+}
+
+// unescapeAddress undoes the %xx escapes in a bus address value.
+func unescapeAddress(s string) (string, error) {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("bad escape in bus address \"%s\"", s)
+		}
+		b, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("bad escape in bus address \"%s\"", s)
+		}
+		out = append(out, b[0])
+		i += 2
+	}
+	return string(out), nil
+}
+
+// SessionBus connects to the user's session bus.
+func SessionBus() (*Conn, error) {
+	addresses, err := sessionBusAddresses()
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	for _, address := range addresses {
+		if conn, err = net.Dial(address[0], address[1]); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to the session bus: %v", err)
+	}
+
+	c := &Conn{conn: conn, reader: bufio.NewReader(conn)}
+	if err = c.authenticate(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Unable to authenticate to the session bus: %v", err)
+	}
+	reply, err := c.call(&Message{
+		Type:        MethodCall,
+		Path:        "/org/freedesktop/DBus",
+		Interface:   "org.freedesktop.DBus",
+		Member:      "Hello",
+		Destination: "org.freedesktop.DBus",
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Unable to join the session bus: %v", err)
+	}
+	if len(reply.Body) > 0 {
+		c.name, _ = reply.Body[0].(string)
+	}
+	return c, nil
+}
+
+// authenticate tells the bus who we are (by user ID, which it can check for
+// itself on a Unix socket).
+func (c *Conn) authenticate() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := fmt.Fprintf(c.conn, "\x00AUTH EXTERNAL %s\r\n", uid); err != nil {
+		return err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("bus said %s", strings.TrimSpace(line))
+	}
+	_, err = fmt.Fprintf(c.conn, "BEGIN\r\n")
+	return err
+}
+
+// Name returns our unique name on the bus.
+func (c *Conn) Name() string {
+	return c.name
+}
+
+// Close disconnects from the bus.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Send sends a message, giving it the next serial number.
+func (c *Conn) Send(m *Message) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.serial++
+	m.Serial = c.serial
+	data, err := m.marshal()
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// receive reads the next message.
+func (c *Conn) receive() (*Message, error) {
+	start := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, start); err != nil {
+		return nil, err
+	}
+	length, order, err := messageLength(start)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	copy(buf, start)
+	if _, err = io.ReadFull(c.reader, buf[16:]); err != nil {
+		return nil, err
+	}
+	return unmarshal(buf, order)
+}
+
+// call makes a method call and waits for its reply, setting aside anything
+// else which comes in meanwhile. This is only for use before Serve starts.
+func (c *Conn) call(m *Message) (*Message, error) {
+	if err := c.Send(m); err != nil {
+		return nil, err
+	}
+	for {
+		reply, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		if reply.ReplySerial != m.Serial {
+			continue
+		}
+		if reply.Type == Error {
+			detail := ""
+			if len(reply.Body) > 0 {
+				detail, _ = reply.Body[0].(string)
+			}
+			return nil, fmt.Errorf("%s: %s", reply.ErrorName, detail)
+		}
+		return reply, nil
+	}
+}
+
+// RequestName asks for a well-known name on the bus, failing if someone
+// else has it already.
+func (c *Conn) RequestName(name string) error {
+	const doNotQueue = 0x4
+	reply, err := c.call(&Message{
+		Type:        MethodCall,
+		Path:        "/org/freedesktop/DBus",
+		Interface:   "org.freedesktop.DBus",
+		Member:      "RequestName",
+		Destination: "org.freedesktop.DBus",
+		Signature:   "su",
+		Body:        []interface{}{name, uint32(doNotQueue)},
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to take the name %s on the bus: %v", name, err)
+	}
+	const primaryOwner, alreadyOwner = 1, 4
+	if len(reply.Body) == 0 || (reply.Body[0] != uint32(primaryOwner) && reply.Body[0] != uint32(alreadyOwner)) {
+		return fmt.Errorf("Unable to take the name %s on the bus: someone else has it", name)
+	}
+	return nil
+}
+
+// Emit sends a signal.
+func (c *Conn) Emit(path ObjectPath, iface, member, signature string, args ...interface{}) error {
+	return c.Send(&Message{
+		Type:      Signal,
+		Path:      path,
+		Interface: iface,
+		Member:    member,
+		Signature: signature,
+		Body:      args,
+	})
+}
+
+// Reply is the answer to a method call: either the values to return, laid
+// out as Signature says, or an error (with a D-Bus error name).
+type Reply struct {
+	Signature string
+	Body      []interface{}
+	ErrorName string
+	Error     string
+}
+
+// Serve passes each method call which comes in to the handler, and sends
+// back its reply (unless the caller didn't want one), until the connection
+// is closed.
+func (c *Conn) Serve(handler func(call *Message) Reply) error {
+	for {
+		m, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if m.Type != MethodCall {
+			continue
+		}
+		reply := handler(m)
+		if m.Flags&NoReplyExpected != 0 {
+			continue
+		}
+		answer := &Message{
+			Type:        MethodReturn,
+			ReplySerial: m.Serial,
+			Destination: m.Sender,
+			Signature:   reply.Signature,
+			Body:        reply.Body,
+		}
+		if reply.ErrorName != "" {
+			answer.Type = Error
+			answer.ErrorName = reply.ErrorName
+			answer.Signature = "s"
+			answer.Body = []interface{}{reply.Error}
+		}
+		if err = c.Send(answer); err != nil {
+			return err
+		}
+	}
+}
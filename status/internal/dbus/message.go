@@ -0,0 +1,613 @@
+//
+// D-Bus messages and their wire format.
+//
+// This is just enough of the D-Bus protocol for busylightd to offer a
+// service on the session bus: it can encode and decode every basic type,
+// variants, arrays, dictionaries, and structures, but not file descriptors.
+// Values are given and returned as plain Go values (see encode for which),
+// laid out according to a D-Bus type signature.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package dbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Message types.
+const (
+	MethodCall   = 1
+	MethodReturn = 2
+	Error        = 3
+	Signal       = 4
+)
+
+// NoReplyExpected is the flag on a method call which doesn't want an answer.
+const NoReplyExpected = 0x1
+
+// Header field codes.
+const (
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSender      = 7
+	fieldSignature   = 8
+)
+
+// maxMessageLength is the longest message the protocol allows.
+const maxMessageLength = 128 * 1024 * 1024
+
+// ObjectPath is a value of D-Bus type "o".
+type ObjectPath string
+
+// Signature is a value of D-Bus type "g".
+type Signature string
+
+// Variant is a value of D-Bus type "v": any value, along with its type.
+type Variant struct {
+	Signature string
+	Value     interface{}
+}
+
+// Message is one D-Bus message.
+type Message struct {
+	Type        byte
+	Flags       byte
+	Serial      uint32
+	Path        ObjectPath
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   string
+	Body        []interface{}
+}
+
+// nextType splits the first complete type off a signature.
+func nextType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("missing type in signature")
+	}
+	switch sig[0] {
+	case 'a':
+		elem, rest, err := nextType(sig[1:])
+		return "a" + elem, rest, err
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		inside := sig[1:]
+		for inside != "" && inside[0] != closing {
+			var err error
+			if _, inside, err = nextType(inside); err != nil {
+				return "", "", err
+			}
+		}
+		if inside == "" {
+			return "", "", fmt.Errorf("unterminated %c in signature", sig[0])
+		}
+		n := len(sig) - len(inside) + 1
+		return sig[:n], sig[n:], nil
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 's', 'o', 'g', 'v':
+		return sig[:1], sig[1:], nil
+	}
+	return "", "", fmt.Errorf("unknown type %q in signature", sig[0])
+}
+
+// alignment returns the boundary a type is aligned on.
+func alignment(sig string) int {
+	switch sig[0] {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 4
+}
+
+// encoder builds the wire form of values.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) pad(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.pad(4)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(e.buf[len(e.buf)-4:], v)
+}
+
+// encode adds a value of the given type. The Go value for each type is:
+// byte (y), bool (b), int16 (n), uint16 (q), int32 (i), uint32 (u), int64
+// (x), uint64 (t), float64 (d), string (s, o, g; or ObjectPath for o and
+// Signature for g), Variant (v), a slice (a), a map with string keys (a{s...}
+// and the like), or []interface{} for a structure.
+func (e *encoder) encode(sig string, v interface{}) error {
+	e.pad(alignment(sig))
+	switch sig[0] {
+	case 'y':
+		b, ok := v.(byte)
+		if !ok {
+			return fmt.Errorf("expected byte for y, not %T", v)
+		}
+		e.buf = append(e.buf, b)
+	case 'b':
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool for b, not %T", v)
+		}
+		var u uint32
+		if b {
+			u = 1
+		}
+		e.uint32(u)
+	case 'n', 'q':
+		var u uint16
+		switch n := v.(type) {
+		case int16:
+			u = uint16(n)
+		case uint16:
+			u = n
+		default:
+			return fmt.Errorf("expected 16-bit integer for %s, not %T", sig, v)
+		}
+		e.buf = append(e.buf, 0, 0)
+		binary.LittleEndian.PutUint16(e.buf[len(e.buf)-2:], u)
+	case 'i', 'u':
+		var u uint32
+		switch n := v.(type) {
+		case int32:
+			u = uint32(n)
+		case uint32:
+			u = n
+		default:
+			return fmt.Errorf("expected 32-bit integer for %s, not %T", sig, v)
+		}
+		e.uint32(u)
+	case 'x', 't', 'd':
+		var u uint64
+		switch n := v.(type) {
+		case int64:
+			u = uint64(n)
+		case uint64:
+			u = n
+		case float64:
+			u = math.Float64bits(n)
+		default:
+			return fmt.Errorf("expected 64-bit number for %s, not %T", sig, v)
+		}
+		e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], u)
+	case 's', 'o', 'g':
+		var s string
+		switch str := v.(type) {
+		case string:
+			s = str
+		case ObjectPath:
+			s = string(str)
+		case Signature:
+			s = string(str)
+		default:
+			return fmt.Errorf("expected string for %s, not %T", sig, v)
+		}
+		if sig[0] == 'g' {
+			e.buf = append(e.buf, byte(len(s)))
+		} else {
+			e.uint32(uint32(len(s)))
+		}
+		e.buf = append(append(e.buf, s...), 0)
+	case 'v':
+		variant, ok := v.(Variant)
+		if !ok {
+			return fmt.Errorf("expected Variant for v, not %T", v)
+		}
+		if err := e.encode("g", variant.Signature); err != nil {
+			return err
+		}
+		return e.encode(variant.Signature, variant.Value)
+	case 'a':
+		return e.array(sig[1:], v)
+	case '(':
+		fields, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected []interface{} for %s, not %T", sig, v)
+		}
+		inside := sig[1 : len(sig)-1]
+		for _, field := range fields {
+			var t string
+			var err error
+			if t, inside, err = nextType(inside); err != nil {
+				return err
+			}
+			if err = e.encode(t, field); err != nil {
+				return err
+			}
+		}
+		if inside != "" {
+			return fmt.Errorf("too few fields for %s", sig)
+		}
+	default:
+		return fmt.Errorf("can't encode %s", sig)
+	}
+	return nil
+}
+
+// array adds an array of elements of the given type.
+func (e *encoder) array(elem string, v interface{}) error {
+	e.uint32(0) // (filled in below)
+	lengthAt := len(e.buf) - 4
+	e.pad(alignment(elem))
+	start := len(e.buf)
+
+	value := reflect.ValueOf(v)
+	switch {
+	case elem[0] == '{' && value.Kind() == reflect.Map:
+		key, rest, err := nextType(elem[1:])
+		if err != nil {
+			return err
+		}
+		if key != "s" {
+			return fmt.Errorf("only string keys are supported, not %s", key)
+		}
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			e.pad(8)
+			if err = e.encode(key, k.String()); err != nil {
+				return err
+			}
+			if err = e.encode(rest[:len(rest)-1], value.MapIndex(k).Interface()); err != nil {
+				return err
+			}
+		}
+	case value.Kind() == reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := e.encode(elem, value.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("expected slice or map for a%s, not %T", elem, v)
+	}
+	binary.LittleEndian.PutUint32(e.buf[lengthAt:], uint32(len(e.buf)-start))
+	return nil
+}
+
+// decoder reads the wire form of values.
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+	if d.pos > len(d.buf) {
+		return fmt.Errorf("message too short")
+	}
+	return nil
+}
+
+func (d *decoder) take(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) {
+		return nil, fmt.Errorf("message too short")
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// decode reads a value of the given type, giving the same Go types encode
+// takes (except that a{...} comes back as map[string]interface{} or
+// map[interface{}]interface{}, and other arrays as []interface{}).
+func (d *decoder) decode(sig string) (interface{}, error) {
+	if err := d.align(alignment(sig)); err != nil {
+		return nil, err
+	}
+	switch sig[0] {
+	case 'y':
+		b, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b', 'i', 'u':
+		b, err := d.take(4)
+		if err != nil {
+			return nil, err
+		}
+		u := d.order.Uint32(b)
+		switch sig[0] {
+		case 'b':
+			return u != 0, nil
+		case 'i':
+			return int32(u), nil
+		}
+		return u, nil
+	case 'n', 'q':
+		b, err := d.take(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'x', 't', 'd':
+		b, err := d.take(8)
+		if err != nil {
+			return nil, err
+		}
+		u := d.order.Uint64(b)
+		switch sig[0] {
+		case 'x':
+			return int64(u), nil
+		case 'd':
+			return math.Float64frombits(u), nil
+		}
+		return u, nil
+	case 's', 'o', 'g':
+		var n int
+		if sig[0] == 'g' {
+			b, err := d.take(1)
+			if err != nil {
+				return nil, err
+			}
+			n = int(b[0])
+		} else {
+			b, err := d.take(4)
+			if err != nil {
+				return nil, err
+			}
+			n = int(d.order.Uint32(b))
+		}
+		b, err := d.take(n + 1)
+		if err != nil {
+			return nil, err
+		}
+		s := string(b[:n])
+		switch sig[0] {
+		case 'o':
+			return ObjectPath(s), nil
+		case 'g':
+			return Signature(s), nil
+		}
+		return s, nil
+	case 'v':
+		t, err := d.decode("g")
+		if err != nil {
+			return nil, err
+		}
+		vsig := string(t.(Signature))
+		if elem, rest, err := nextType(vsig); err != nil || rest != "" || elem == "" {
+			return nil, fmt.Errorf("bad variant signature %q", vsig)
+		}
+		value, err := d.decode(vsig)
+		return Variant{Signature: vsig, Value: value}, err
+	case 'a':
+		return d.array(sig[1:])
+	case '(':
+		var fields []interface{}
+		inside := sig[1 : len(sig)-1]
+		for inside != "" {
+			var t string
+			var err error
+			if t, inside, err = nextType(inside); err != nil {
+				return nil, err
+			}
+			field, err := d.decode(t)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("can't decode %s", sig)
+}
+
+// array reads an array of elements of the given type.
+func (d *decoder) array(elem string) (interface{}, error) {
+	b, err := d.take(4)
+	if err != nil {
+		return nil, err
+	}
+	n := int(d.order.Uint32(b))
+	if err = d.align(alignment(elem)); err != nil {
+		return nil, err
+	}
+	end := d.pos + n
+	if end > len(d.buf) {
+		return nil, fmt.Errorf("message too short")
+	}
+
+	if elem[0] == '{' {
+		key, rest, err := nextType(elem[1:])
+		if err != nil {
+			return nil, err
+		}
+		value := rest[:len(rest)-1]
+		strings := make(map[string]interface{})
+		others := make(map[interface{}]interface{})
+		for d.pos < end {
+			if err = d.align(8); err != nil {
+				return nil, err
+			}
+			k, err := d.decode(key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(value)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := k.(string); ok {
+				strings[s] = v
+			} else {
+				others[k] = v
+			}
+		}
+		if key == "s" {
+			return strings, nil
+		}
+		return others, nil
+	}
+
+	var elements []interface{}
+	for d.pos < end {
+		v, err := d.decode(elem)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, v)
+	}
+	return elements, nil
+}
+
+// marshal returns the wire form of a message.
+func (m *Message) marshal() ([]byte, error) {
+	body := &encoder{}
+	sig := m.Signature
+	for _, arg := range m.Body {
+		var t string
+		var err error
+		if t, sig, err = nextType(sig); err != nil {
+			return nil, fmt.Errorf("more arguments than signature %q allows", m.Signature)
+		}
+		if err = body.encode(t, arg); err != nil {
+			return nil, err
+		}
+	}
+	if sig != "" {
+		return nil, fmt.Errorf("fewer arguments than signature %q calls for", m.Signature)
+	}
+
+	var fields []interface{}
+	field := func(code byte, sig string, value interface{}) {
+		fields = append(fields, []interface{}{code, Variant{Signature: sig, Value: value}})
+	}
+	if m.Path != "" {
+		field(fieldPath, "o", m.Path)
+	}
+	if m.Interface != "" {
+		field(fieldInterface, "s", m.Interface)
+	}
+	if m.Member != "" {
+		field(fieldMember, "s", m.Member)
+	}
+	if m.ErrorName != "" {
+		field(fieldErrorName, "s", m.ErrorName)
+	}
+	if m.ReplySerial != 0 {
+		field(fieldReplySerial, "u", m.ReplySerial)
+	}
+	if m.Destination != "" {
+		field(fieldDestination, "s", m.Destination)
+	}
+	if m.Signature != "" {
+		field(fieldSignature, "g", Signature(m.Signature))
+	}
+
+	header := &encoder{buf: []byte{'l', m.Type, m.Flags, 1}}
+	header.uint32(uint32(len(body.buf)))
+	header.uint32(m.Serial)
+	if err := header.encode("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	header.pad(8)
+	return append(header.buf, body.buf...), nil
+}
+
+// messageLength works out how long a message is from its first 16 bytes.
+func messageLength(start []byte) (int, binary.ByteOrder, error) {
+	var order binary.ByteOrder
+	switch start[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return 0, nil, fmt.Errorf("bad byte order %q in message", start[0])
+	}
+	body := int(order.Uint32(start[4:]))
+	fields := int(order.Uint32(start[12:]))
+	header := (16 + fields + 7) &^ 7
+	if body > maxMessageLength || fields > maxMessageLength || header+body > maxMessageLength {
+		return 0, nil, fmt.Errorf("message too long")
+	}
+	return header + body, order, nil
+}
+
+// unmarshal understands the wire form of a message.
+func unmarshal(buf []byte, order binary.ByteOrder) (*Message, error) {
+	m := &Message{Type: buf[1], Flags: buf[2], Serial: order.Uint32(buf[8:])}
+	d := &decoder{buf: buf, pos: 12, order: order}
+	v, err := d.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range v.([]interface{}) {
+		field := f.([]interface{})
+		value := field[1].(Variant).Value
+		switch field[0].(byte) {
+		case fieldPath:
+			m.Path, _ = value.(ObjectPath)
+		case fieldInterface:
+			m.Interface, _ = value.(string)
+		case fieldMember:
+			m.Member, _ = value.(string)
+		case fieldErrorName:
+			m.ErrorName, _ = value.(string)
+		case fieldReplySerial:
+			m.ReplySerial, _ = value.(uint32)
+		case fieldDestination:
+			m.Destination, _ = value.(string)
+		case fieldSender:
+			m.Sender, _ = value.(string)
+		case fieldSignature:
+			s, _ := value.(Signature)
+			m.Signature = string(s)
+		}
+	}
+	if err = d.align(8); err != nil {
+		return nil, err
+	}
+
+	// (the body is aligned as though it started the message)
+	body := &decoder{buf: buf[d.pos:], order: order}
+	sig := m.Signature
+	for sig != "" {
+		var t string
+		if t, sig, err = nextType(sig); err != nil {
+			return nil, err
+		}
+		arg, err := body.decode(t)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = append(m.Body, arg)
+	}
+	return m, nil
+}
@@ -0,0 +1,111 @@
+//
+// Which Unix signals ask busylightd to do what.
+//
+// The daemon can be controlled by sending it signals (see busylight.1).
+// Not every system has the same signals (Linux has no SIGINFO, for
+// example), so each system has its own defaults, and the user may assign
+// any action to a different signal in the Signals section of config.json.
+// The daemon and the programs which signal it all use this package, so
+// they agree on which signal is which.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package signals
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// The actions a signal may ask the daemon to take. (These are the same as
+// the busylight command-line options which request them.)
+const (
+	Mute   = "mute"   // in a call, muted
+	Open   = "open"   // in a call, microphone open
+	Cal    = "cal"    // out of the call; back to the calendar
+	Reload = "reload" // refresh calendar data now
+	Urgent = "urgent" // toggle the urgent indicator
+	LowPri = "lowpri" // toggle the low-priority indicator
+	Zzz    = "zzz"    // toggle active/inactive
+	Kill   = "kill"   // shut down
+
+	Reconfigure = "reconfigure" // re-read the configuration
+)
+
+var actions = []string{Mute, Open, Cal, Reload, Urgent, LowPri, Zzz, Kill, Reconfigure}
+
+// Parse understands a signal name, with or without the "SIG" prefix (e.g.,
+// "USR1" or "SIGUSR1"), or a signal number. Where the system has realtime
+// signals, "RTMIN+n" and "RTMAX-n" are understood as well.
+//
+// SIGCHLD isn't allowed: the system sends it whenever one of the daemon's
+// child processes exits. (It used to toggle the low-priority indicator,
+// which went wrong whenever the daemon ran a hook.)
+func Parse(name string) (syscall.Signal, error) {
+	name = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+	if sig, known := signalNames[name]; known {
+		return sig, nil
+	}
+	n, err := strconv.Atoi(name)
+	if name == "CHLD" || (err == nil && syscall.Signal(n) == sigCHLD) {
+		return 0, fmt.Errorf("SIGCHLD can't be used, since every child process sends it")
+	}
+	if err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := parseRealtime(name); ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal \"%s\"", name)
+}
+
+// Name returns the short name of a signal (e.g., "USR1"), as used in the documentation.
+func Name(sig syscall.Signal) string {
+	for name, s := range signalNames {
+		if s == sig {
+			return name
+		}
+	}
+	if name, ok := realtimeName(sig); ok {
+		return name
+	}
+	return sig.String()
+}
+
+// Table gives the signal for each action: this system's default, unless
+// overridden by the configuration (which maps action names to signal names).
+// Actions with no signal on this system are left out.
+func Table(overrides map[string]string) (map[string]syscall.Signal, error) {
+	table := make(map[string]syscall.Signal)
+	for action, sig := range defaults {
+		table[action] = sig
+	}
+	for action, name := range overrides {
+		known := false
+		for _, a := range actions {
+			known = known || a == action
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown action \"%s\" in Signals", action)
+		}
+		sig, err := Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("for action \"%s\": %v", action, err)
+		}
+		table[action] = sig
+	}
+
+	// Two actions can't share one signal.
+	used := make(map[syscall.Signal]string)
+	for action, sig := range table {
+		if other, taken := used[sig]; taken {
+			return nil, fmt.Errorf("actions \"%s\" and \"%s\" both use SIG%s", other, action, Name(sig))
+		}
+		used[sig] = action
+	}
+	return table, nil
+}
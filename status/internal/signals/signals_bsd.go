@@ -0,0 +1,53 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+//
+// Signals on macOS and the BSDs.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package signals
+
+import "syscall"
+
+// defaults are the signals the daemon has always used. (There's no obvious
+// signal left over for Reconfigure, so it has none unless the user picks one.)
+var defaults = map[string]syscall.Signal{
+	Mute:   syscall.SIGUSR1,
+	Open:   syscall.SIGUSR2,
+	Cal:    syscall.SIGHUP,
+	Reload: syscall.SIGINFO,
+	Urgent: syscall.SIGVTALRM,
+	LowPri: syscall.SIGALRM,
+	Zzz:    syscall.SIGWINCH,
+	Kill:   syscall.SIGINT,
+}
+
+// (the system sends this one on its own; see Parse)
+const sigCHLD = syscall.SIGCHLD
+
+// signalNames are the signals which may be assigned to actions.
+var signalNames = map[string]syscall.Signal{
+	"ALRM":   syscall.SIGALRM,
+	"HUP":    syscall.SIGHUP,
+	"INFO":   syscall.SIGINFO,
+	"INT":    syscall.SIGINT,
+	"PROF":   syscall.SIGPROF,
+	"QUIT":   syscall.SIGQUIT,
+	"TERM":   syscall.SIGTERM,
+	"USR1":   syscall.SIGUSR1,
+	"USR2":   syscall.SIGUSR2,
+	"VTALRM": syscall.SIGVTALRM,
+	"WINCH":  syscall.SIGWINCH,
+}
+
+// (There are no realtime signals here.)
+func parseRealtime(name string) (syscall.Signal, bool) {
+	return 0, false
+}
+
+func realtimeName(sig syscall.Signal) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,99 @@
+//
+// Signals on Linux.
+//
+// Linux has no SIGINFO, so we refresh the calendar on the first realtime
+// signal instead (which the shell calls RTMIN, e.g. "kill -RTMIN <pid>").
+// Having realtime signals to spare, we also use the next one to ask the
+// daemon to re-read its configuration.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package signals
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// The realtime signals available to programs. (The C library keeps the
+// first couple for itself, so its SIGRTMIN is 34, not 32.)
+const (
+	sigRTMIN = syscall.Signal(34)
+	sigRTMAX = syscall.Signal(64)
+)
+
+var defaults = map[string]syscall.Signal{
+	Mute:   syscall.SIGUSR1,
+	Open:   syscall.SIGUSR2,
+	Cal:    syscall.SIGHUP,
+	Reload: sigRTMIN,
+	Urgent: syscall.SIGVTALRM,
+	LowPri: syscall.SIGALRM,
+	Zzz:    syscall.SIGWINCH,
+	Kill:   syscall.SIGINT,
+
+	Reconfigure: sigRTMIN + 1,
+}
+
+// (the system sends this one on its own; see Parse)
+const sigCHLD = syscall.SIGCHLD
+
+// signalNames are the signals which may be assigned to actions, besides the realtime ones.
+var signalNames = map[string]syscall.Signal{
+	"ALRM":   syscall.SIGALRM,
+	"HUP":    syscall.SIGHUP,
+	"INT":    syscall.SIGINT,
+	"PROF":   syscall.SIGPROF,
+	"PWR":    syscall.SIGPWR,
+	"QUIT":   syscall.SIGQUIT,
+	"TERM":   syscall.SIGTERM,
+	"USR1":   syscall.SIGUSR1,
+	"USR2":   syscall.SIGUSR2,
+	"VTALRM": syscall.SIGVTALRM,
+	"WINCH":  syscall.SIGWINCH,
+}
+
+// parseRealtime understands "RTMIN", "RTMIN+n", "RTMAX", and "RTMAX-n".
+func parseRealtime(name string) (syscall.Signal, bool) {
+	var base syscall.Signal
+	var rest string
+	sign := 1
+	switch {
+	case strings.HasPrefix(name, "RTMIN"):
+		base, rest = sigRTMIN, strings.TrimPrefix(name, "RTMIN")
+	case strings.HasPrefix(name, "RTMAX"):
+		base, rest, sign = sigRTMAX, strings.TrimPrefix(name, "RTMAX"), -1
+	default:
+		return 0, false
+	}
+	offset := 0
+	if rest != "" {
+		if (sign > 0 && rest[0] != '+') || (sign < 0 && rest[0] != '-') {
+			return 0, false
+		}
+		n, err := strconv.Atoi(rest[1:])
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		offset = n * sign
+	}
+	sig := base + syscall.Signal(offset)
+	if sig < sigRTMIN || sig > sigRTMAX {
+		return 0, false
+	}
+	return sig, true
+}
+
+func realtimeName(sig syscall.Signal) (string, bool) {
+	switch {
+	case sig == sigRTMIN:
+		return "RTMIN", true
+	case sig > sigRTMIN && sig <= sigRTMAX:
+		return fmt.Sprintf("RTMIN+%d", sig-sigRTMIN), true
+	}
+	return "", false
+}
@@ -0,0 +1,35 @@
+//
+// Signals on Windows.
+//
+// Windows has no signals one process can send another, so the daemon can
+// only be controlled through its control socket (see busylightctl) or its
+// HTTP API there. The one exception is shutting it down with Ctrl-C when
+// it's running in a console window.
+//
+// Steve Willoughby <steve@madscience.zone>
+// License: BSD 3-Clause open-source license
+//
+
+package signals
+
+import "syscall"
+
+var defaults = map[string]syscall.Signal{
+	Kill: syscall.SIGINT,
+}
+
+// (there's no such thing here)
+const sigCHLD = syscall.Signal(-1)
+
+// signalNames are the signals which may be assigned to actions.
+var signalNames = map[string]syscall.Signal{
+	"INT": syscall.SIGINT,
+}
+
+func parseRealtime(name string) (syscall.Signal, bool) {
+	return 0, false
+}
+
+func realtimeName(sig syscall.Signal) (string, bool) {
+	return "", false
+}